@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"agent/internal/forge"
+	"agent/internal/github"
+	"agent/pkg/agent"
+)
+
+// runAction is the GitHub Actions entrypoint: it answers a triggering issue or pull
+// request comment, pushing any changes and replying with the result
+func runAction(flags *flag.FlagSet) func() {
+	trigger := flags.String("trigger", "@agent", "Phrase a comment (or new issue body) must contain to run the agent.")
+	allowed := flags.String("allowed-associations", "OWNER,MEMBER,COLLABORATOR", "Comma-separated author associations allowed to trigger the agent.")
+	maxTurns := flags.Int("max-turns", 30, "Maximum model calls for the run.")
+	tokenBudget := flags.Int64("token-budget", 1_000_000, "Maximum tokens the run may consume.")
+	return func() {
+		ctx := context.Background()
+		event, err := github.LoadEvent(os.Getenv("GITHUB_EVENT_PATH"))
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		repo := os.Getenv("GITHUB_REPOSITORY")
+		if repo == "" {
+			repo = event.Repository.FullName
+		}
+
+		request, association, ok := actionRequest(os.Getenv("GITHUB_EVENT_NAME"), event, *trigger)
+		if !ok {
+			log.Printf("No '%s' trigger in this event, nothing to do\n", *trigger)
+			return
+		}
+		if !slices.Contains(strings.Split(*allowed, ","), association) {
+			log.Printf("Author association '%s' may not trigger the agent, ignoring\n", association)
+			return
+		}
+
+		gh := forge.NewGitHub(os.Getenv("GITHUB_API_URL"), repo, os.Getenv("GITHUB_TOKEN"))
+		number := event.Issue.Number
+		reply := func(body string) {
+			comment := gh.CommentOnIssue
+			if event.IsPullRequest() {
+				comment = gh.CommentOnChangeRequest
+			}
+			if err := comment(ctx, number, body); err != nil {
+				log.Printf("Error commenting on #%d: %s\n", number, err.Error())
+			}
+		}
+
+		branch, canPush, err := checkoutActionBranch(ctx, gh, event)
+		if err != nil {
+			reply(fmt.Sprintf("The agent could not check out the branch: %s", err.Error()))
+			log.Fatalf("Error: %s", err.Error())
+		}
+
+		limits := []agent.Option{agent.WithMaxTurns(*maxTurns), agent.WithTokenBudget(*tokenBudget), toolExamples()}
+		if event.IsPullRequest() && isReviewRequest(request) {
+			if err := runReview(ctx, gh, number, request, limits...); err != nil {
+				reply(fmt.Sprintf("The agent could not complete the review: %s", err.Error()))
+				log.Fatalf("Error: %s", err.Error())
+			}
+			return
+		}
+
+		prompt := fmt.Sprintf("You are running unattended in CI on GitHub %s #%d, \"%s\".\n\n%s\n\nRequest:\n%s\n\n"+
+			"Make any code changes directly in the working tree; they will be committed and pushed for you. "+
+			"Finish with a short summary of what you did for the reply comment.",
+			issueKind(event), number, event.Issue.Title, event.Issue.Body, request)
+
+		agentInstance := agent.NewAgent(newClient(), nil, projectTools(), limits...)
+		answer, runErr := agentInstance.RunTask(ctx, prompt)
+		usage := agentInstance.Usage()
+		footer := fmt.Sprintf("\n\n<sub>%d model calls, %d tokens</sub>", usage.Requests, usage.Total())
+		if runErr != nil {
+			reply(fmt.Sprintf("The agent stopped before finishing: %s\n\n%s%s", runErr.Error(), answer, footer))
+			log.Fatalf("Error: %s", runErr.Error())
+		}
+
+		changed, err := commitChanges(fmt.Sprintf("Agent changes for #%d", number))
+		if err != nil {
+			reply(fmt.Sprintf("%s\n\nThe agent made changes but they could not be committed: %s%s", answer, err.Error(), footer))
+			log.Fatalf("Error: %s", err.Error())
+		}
+
+		switch {
+		case !changed:
+			reply(answer + footer)
+		case !canPush:
+			diff, _ := git("diff", "HEAD~1")
+			reply(fmt.Sprintf("%s\n\nThis branch cannot be pushed to from CI, so here is the proposed change:\n\n```diff\n%s\n```%s", answer, diff, footer))
+		default:
+			if _, err := git("push", "origin", "HEAD:refs/heads/"+branch); err != nil {
+				reply(fmt.Sprintf("%s\n\nPushing branch `%s` failed: %s%s", answer, branch, err.Error(), footer))
+				log.Fatalf("Error: %s", err.Error())
+			}
+			if event.IsPullRequest() {
+				reply(fmt.Sprintf("%s\n\nPushed the changes to `%s`.%s", answer, branch, footer))
+				return
+			}
+			pr, err := gh.OpenChangeRequest(ctx, forge.NewChangeRequest{
+				Title: fmt.Sprintf("Agent: %s", event.Issue.Title),
+				Body:  fmt.Sprintf("Closes #%d\n\n%s", number, answer),
+				Head:  branch,
+				Base:  event.Repository.DefaultBranch,
+			})
+			if err != nil {
+				reply(fmt.Sprintf("%s\n\nPushed `%s` but could not open a pull request: %s%s", answer, branch, err.Error(), footer))
+				return
+			}
+			reply(fmt.Sprintf("%s\n\nOpened %s.%s", answer, pr.URL, footer))
+		}
+	}
+}
+
+// actionRequest extracts the user's request from the event, along with the author's
+// association, reporting false when the trigger phrase is absent
+func actionRequest(eventName string, event *github.Event, trigger string) (string, string, bool) {
+	switch eventName {
+	case "issue_comment":
+		if event.Action != "created" || event.Comment == nil || !strings.Contains(event.Comment.Body, trigger) {
+			return "", "", false
+		}
+		request := strings.TrimSpace(strings.Replace(event.Comment.Body, trigger, "", 1))
+		return request, event.Comment.AuthorAssociation, true
+	case "issues":
+		if event.Action != "opened" || !strings.Contains(event.Issue.Body, trigger) {
+			return "", "", false
+		}
+		return "Resolve the issue described above.", event.Issue.AuthorAssociation, true
+	default:
+		return "", "", false
+	}
+}
+
+// checkoutActionBranch checks out the pull request's head branch, or a new branch for
+// an issue. It reports whether the branch can be pushed (fork branches cannot).
+func checkoutActionBranch(ctx context.Context, f forge.Forge, event *github.Event) (string, bool, error) {
+	if _, err := git("config", "user.name", "github-actions[bot]"); err != nil {
+		return "", false, err
+	}
+	if _, err := git("config", "user.email", "41898282+github-actions[bot]@users.noreply.github.com"); err != nil {
+		return "", false, err
+	}
+
+	if !event.IsPullRequest() {
+		branch := fmt.Sprintf("agent/issue-%d", event.Issue.Number)
+		_, err := git("checkout", "-B", branch)
+		return branch, true, err
+	}
+
+	pr, err := f.GetChangeRequest(ctx, event.Issue.Number)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := git("fetch", "origin", fmt.Sprintf("pull/%d/head", pr.Number)); err != nil {
+		return "", false, err
+	}
+	if _, err := git("checkout", "-B", pr.HeadRef, "FETCH_HEAD"); err != nil {
+		return "", false, err
+	}
+	return pr.HeadRef, !pr.FromFork, nil
+}
+
+// commitChanges commits everything the agent changed, reporting whether there was anything to commit
+func commitChanges(message string) (bool, error) {
+	status, err := git("status", "--porcelain", "--", ".", ":!.agent")
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(status) == "" {
+		return false, nil
+	}
+	if _, err := git("add", "-A", "--", ".", ":!.agent"); err != nil {
+		return false, err
+	}
+	if _, err := git("commit", "-m", message); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isReviewRequest reports whether a pull request comment asks for a review rather than changes
+func isReviewRequest(request string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(request)), "review")
+}
+
+func issueKind(event *github.Event) string {
+	if event.IsPullRequest() {
+		return "pull request"
+	}
+	return "issue"
+}
+
+// git runs a git command in the working directory and returns its output
+func git(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(out)))
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
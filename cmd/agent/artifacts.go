@@ -0,0 +1,22 @@
+package main
+
+import (
+	"log"
+
+	"agent/pkg/agent"
+)
+
+// defaultArtifactDir is where generated non-code files are saved, relative to the project
+const defaultArtifactDir = ".agent/artifacts"
+
+// listArtifacts reports the files the model saved with save_artifact
+func listArtifacts(a *agent.Agent) {
+	saved := a.Artifacts()
+	if len(saved) == 0 {
+		return
+	}
+	log.Printf("Artifacts saved in %s:\n", a.ArtifactDir())
+	for _, path := range saved {
+		log.Printf("  %s\n", path)
+	}
+}
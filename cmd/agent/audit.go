@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"agent/internal/audit"
+	"agent/pkg/agent"
+)
+
+// defaultAuditLog is where tool calls and notices are recorded, relative to the project
+const defaultAuditLog = ".agent/audit.log"
+
+// auditKeyEnv names the file holding the key audit entries are signed with. It is read
+// from the environment, so candidate and worker processes sign with it too.
+const auditKeyEnv = "AGENT_AUDIT_KEY"
+
+// openAuditLog opens the audit log at path, signing entries with the key named by
+// AGENT_AUDIT_KEY if it is set
+func openAuditLog(path string) (*audit.Log, error) {
+	var key ed25519.PrivateKey
+	if keyFile := os.Getenv(auditKeyEnv); keyFile != "" {
+		var err error
+		if key, err = readSigningKey(keyFile); err != nil {
+			return nil, err
+		}
+	}
+	return audit.Open(path, key)
+}
+
+// readSigningKey reads a base64 ed25519 private key, or its seed, from path
+func readSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	switch {
+	case err == nil && len(decoded) == ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(decoded), nil
+	case err == nil && len(decoded) == ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(decoded), nil
+	}
+	return nil, fmt.Errorf("'%s' is not a base64 ed25519 private key; create one with keygen", path)
+}
+
+// writeSigningKey creates a new ed25519 key, saving its seed to path, which must not
+// exist yet, and returns the base64 public key
+func writeSigningKey(path string) (string, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("'%s' already exists", path)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintln(file, base64.StdEncoding.EncodeToString(private.Seed())); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(public), nil
+}
+
+// parsePublicKey decodes a base64 ed25519 public key
+func parsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("not a base64 ed25519 public key")
+	}
+	return key, nil
+}
+
+// runAudit verifies the audit log's hash chain and signatures, or creates a signing key
+func runAudit(flags *flag.FlagSet) func() {
+	publicKey := flags.String("public-key", "", "Base64 ed25519 public key every entry must be signed with, for verify.")
+	unhashed := flags.Int("unhashed", 0, "Entries at the start of the log written before hashing was added, which verify accepts without a hash.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: agent audit [-public-key KEY] [-unhashed N] [verify [file] | keygen <private-key-file>]")
+		flags.PrintDefaults()
+	}
+	return func() {
+		switch flags.Arg(0) {
+		case "", "verify":
+			path := flags.Arg(1)
+			if path == "" {
+				path = defaultAuditLog
+			}
+			var key ed25519.PublicKey
+			if *publicKey != "" {
+				var err error
+				if key, err = parsePublicKey(*publicKey); err != nil {
+					log.Fatal("Error: -public-key is not a base64 ed25519 public key")
+				}
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			defer file.Close()
+			report, err := audit.Verify(file, key, *unhashed)
+			if err != nil {
+				log.Fatalf("Error: %s is not intact: %s", path, err.Error())
+			}
+			fmt.Printf("%s is intact: %d entries, %d signed", path, report.Entries, report.Signed)
+			if report.Unchained > 0 {
+				fmt.Printf(", the first %d written before hashing and not covered", report.Unchained)
+			}
+			fmt.Printf(".\nLast hash: %s\n", report.Last)
+		case "keygen":
+			path := flags.Arg(1)
+			if path == "" {
+				flags.Usage()
+				os.Exit(2)
+			}
+			public, err := writeSigningKey(path)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			fmt.Printf("Wrote the signing key to %s. Sign with it by setting %s=%s.\n", path, auditKeyEnv, path)
+			fmt.Printf("Public key, to verify with agent audit -public-key KEY verify:\n%s\n", public)
+		default:
+			flags.Usage()
+			os.Exit(2)
+		}
+	}
+}
+
+// auditEvents passes events on to next and also records tool calls, failed tool results
+// and the model's notices in the audit log. Successful tool output is left out, since
+// the session already holds it and it can be large.
+func auditEvents(next agent.EventHandler, auditLog *audit.Log, sessionID string) agent.EventHandler {
+	return func(e agent.Event) {
+		next(e)
+		if e.Type == agent.EventText || (e.Type == agent.EventToolResult && !e.IsError) {
+			return
+		}
+		entry := audit.Entry{
+			Session:  sessionID,
+			Ref:      e.Ref,
+			Type:     string(e.Type),
+			Tool:     e.ToolName,
+			Input:    e.Input,
+			Severity: e.Severity,
+			IsError:  e.IsError,
+		}
+		if e.Type != agent.EventToolUse {
+			entry.Text = e.Text
+		}
+		if err := auditLog.Record(entry); err != nil {
+			log.Printf("Error: %s\n", err.Error())
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"agent/pkg/agent"
+)
+
+// maxCulpritDiff bounds how much of the culprit commit is inlined into the prompt
+const maxCulpritDiff = 50_000
+
+// maxTestOutput keeps the end of the failing test output, where the errors usually are
+const maxTestOutput = 10_000
+
+// runBisect drives git bisect between a good and a bad revision using a test command,
+// then has the agent explain the first bad commit and propose a fix
+func runBisect(flags *flag.FlagSet) func() {
+	bad := flags.String("bad", "HEAD", "Revision where the test fails.")
+	good := flags.String("good", "", "Revision where the test passes.")
+	test := flags.String("test", "", "Shell command that exits 0 on good revisions, 125 to skip, and any other code on bad ones.")
+	maxTurns := flags.Int("max-turns", 30, "Maximum model calls for the analysis.")
+	return func() {
+		if *good == "" || *test == "" {
+			log.Fatalf("Error: -good and -test are required")
+		}
+		if out, err := git("status", "--porcelain", "--untracked-files=no"); err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		} else if out != "" {
+			log.Fatalf("Error: the working tree has uncommitted changes; commit or stash them before bisecting")
+		}
+
+		if _, err := git("bisect", "start", *bad, *good); err != nil {
+			log.Fatalf("Error starting bisect: %s", err.Error())
+		}
+		log.Printf("Bisecting %s..%s with: %s\n", *good, *bad, *test)
+		cmd := exec.Command("git", "bisect", "run", "sh", "-c", *test)
+		cmd.Stderr = os.Stderr
+		runOut, runErr := cmd.Output()
+
+		bisectLog, _ := git("bisect", "log")
+		culprit, culpritErr := git("rev-parse", "--verify", "refs/bisect/bad")
+		if _, err := git("bisect", "reset"); err != nil {
+			log.Printf("Error resetting bisect: %s\n", err.Error())
+		}
+
+		fmt.Printf("\u001b[1mBisect log\u001b[0m\n%s\n", bisectLog)
+		if runErr != nil || culpritErr != nil || !strings.Contains(string(runOut), "is the first bad commit") {
+			fmt.Print(string(runOut))
+			log.Fatalf("Error: bisect did not find a culprit commit")
+		}
+		culprit = strings.TrimSpace(culprit)
+
+		show, err := git("show", "--stat", "--patch", culprit)
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		if len(show) > maxCulpritDiff {
+			show = show[:maxCulpritDiff] + "\n... (commit truncated; read the files for the rest)"
+		}
+		testOut, _ := exec.Command("sh", "-c", *test).CombinedOutput()
+		if len(testOut) > maxTestOutput {
+			testOut = testOut[len(testOut)-maxTestOutput:]
+		}
+
+		prompt := fmt.Sprintf("git bisect found %s as the first commit where `%s` fails (last known good: %s).\n\n"+
+			"The commit:\n```diff\n%s\n```\n\nTest output on the current checkout:\n```\n%s\n```\n\n"+
+			"Explain how this commit causes the failure, referencing the commit by its short hash, and propose a fix "+
+			"as a diff against the current tree. Do not modify any files.",
+			culprit, *test, *good, show, strings.TrimSpace(string(testOut)))
+
+		analyst := agent.NewAgent(newClient(), nil, readOnlyTools(), agent.WithMaxTurns(*maxTurns), toolExamples())
+		answer, err := analyst.RunTask(context.Background(), prompt)
+		if err != nil {
+			log.Fatalf("Error analyzing %s: %s", culprit, err.Error())
+		}
+		fmt.Printf("\u001b[1mFirst bad commit\u001b[0m %s\n\n%s\n", culprit, answer)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// candidate is one isolated attempt at a task
+type candidate struct {
+	index    int
+	dir      string
+	base     string // commit the attempt started from, including the user's uncommitted changes
+	output   string
+	runErr   error
+	passed   bool
+	diff     string
+	added    int
+	removed  int
+	duration time.Duration
+}
+
+// better reports whether c should be preferred over other: passing the check first,
+// then having made changes at all, then the smaller diff
+func (c *candidate) better(other *candidate) bool {
+	if c.passed != other.passed {
+		return c.passed
+	}
+	if (c.diff != "") != (other.diff != "") {
+		return c.diff != ""
+	}
+	return c.added+c.removed < other.added+other.removed
+}
+
+// runCandidates runs the prompt n times in parallel, each in its own git worktree,
+// checks every result with the build/test command and presents the best diff
+func runCandidates(prompt string, n, maxTurns int, check string) error {
+	if check == "" {
+		check = detectBuildCommand()
+	}
+	if check == "" {
+		return fmt.Errorf("no build or test command detected; pass -check to evaluate candidates")
+	}
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	root = strings.TrimSpace(root)
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the agent executable: %w", err)
+	}
+	// Candidates carry over the user's uncommitted changes to tracked files
+	pending, err := git("diff", "HEAD", "--binary")
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	candidates := make([]*candidate, n)
+	var wg sync.WaitGroup
+	for i := range candidates {
+		c := &candidate{index: i + 1}
+		candidates[i] = c
+		if err := c.prepare(root, pending); err != nil {
+			c.cleanup(root)
+			return err
+		}
+		defer c.cleanup(root)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.run(ctx, exe, prompt, maxTurns, check, root)
+		}()
+	}
+	log.Printf("Running %d candidates, checking each with: %s\n", n, check)
+	wg.Wait()
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].better(candidates[j]) })
+	best := candidates[0]
+
+	fmt.Println("\u001b[1mCandidates\u001b[0m")
+	for _, c := range candidates {
+		status := "\u001b[91mcheck failed\u001b[0m"
+		if c.passed {
+			status = "\u001b[92mcheck passed\u001b[0m"
+		}
+		if c.runErr != nil {
+			status += fmt.Sprintf(" (agent error: %s)", c.runErr.Error())
+		}
+		fmt.Printf("  #%d  %s  +%d -%d  %s\n", c.index, status, c.added, c.removed, c.duration.Round(time.Second))
+	}
+
+	if best.diff == "" && !best.passed {
+		return fmt.Errorf("no candidate completed the task")
+	}
+	if best.diff == "" {
+		fmt.Printf("\nNo candidate changed any files. Answer from #%d:\n\n%s\n", best.index, best.output)
+		return nil
+	}
+	patch := filepath.Join(root, ".agent", "candidates", time.Now().UTC().Format("20060102-150405")+".patch")
+	if err := os.MkdirAll(filepath.Dir(patch), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(patch, []byte(best.diff), 0644); err != nil {
+		return fmt.Errorf("failed to save the winning diff: %w", err)
+	}
+	fmt.Printf("\n\u001b[1mWinner: #%d\u001b[0m\n\n%s\n\n```diff\n%s```\n\nSaved to %s; apply it with: git apply %s\n",
+		best.index, best.output, best.diff, patch, patch)
+	if !best.passed {
+		return fmt.Errorf("no candidate passed the check")
+	}
+	return nil
+}
+
+// prepare creates the candidate's worktree at HEAD and commits the pending changes
+// on top, so the candidate's own diff can be taken against that commit
+func (c *candidate) prepare(root, pending string) error {
+	dir, err := os.MkdirTemp("", "agent-candidate-*")
+	if err != nil {
+		return fmt.Errorf("failed to create candidate directory: %w", err)
+	}
+	c.dir = dir
+	if _, err := git("-C", root, "worktree", "add", "--detach", dir, "HEAD"); err != nil {
+		return err
+	}
+	if pending != "" {
+		apply := exec.Command("git", "-C", dir, "apply", "--binary", "-")
+		apply.Stdin = strings.NewReader(pending)
+		if out, err := apply.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to carry uncommitted changes into candidate %d: %s", c.index, out)
+		}
+		if _, err := git("-C", dir, "-c", "user.name=agent", "-c", "user.email=agent@localhost",
+			"commit", "-qam", "Uncommitted changes"); err != nil {
+			return err
+		}
+	}
+	base, err := git("-C", dir, "rev-parse", "HEAD")
+	c.base = strings.TrimSpace(base)
+	return err
+}
+
+// run executes the agent in the worktree, then the check, and records the diff
+func (c *candidate) run(ctx context.Context, exe, prompt string, maxTurns int, check, root string) {
+	start := time.Now()
+	args := []string{"-p", prompt, "-session-store", "", "-file-history", "", "-max-turns", strconv.Itoa(maxTurns),
+		"-audit-log", filepath.Join(root, defaultAuditLog), "-artifacts", filepath.Join(root, defaultArtifactDir)}
+	if onboarding := filepath.Join(root, defaultOnboardingPath); fileExists(onboarding) {
+		args = append(args, "-context", onboarding)
+	}
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Dir = c.dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		c.runErr = err
+		log.Printf("Candidate %d failed: %s\n", c.index, lastLine(stderr.String()))
+	}
+	c.output = strings.TrimSpace(stdout.String())
+
+	checkCmd := exec.CommandContext(ctx, "sh", "-c", check)
+	checkCmd.Dir = c.dir
+	c.passed = c.runErr == nil && checkCmd.Run() == nil
+
+	// The agent's own files are not part of the patch, nor of its size
+	git("-C", c.dir, "add", "-A", "--", ".", ":!.agent")
+	c.diff, _ = git("-C", c.dir, "diff", "--cached", c.base, "--", ".", ":!.agent")
+	for _, line := range strings.Split(c.diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			c.added++
+		case strings.HasPrefix(line, "-"):
+			c.removed++
+		}
+	}
+	c.duration = time.Since(start)
+	log.Printf("Candidate %d finished in %s\n", c.index, c.duration.Round(time.Second))
+}
+
+func (c *candidate) cleanup(root string) {
+	if c.dir == "" {
+		return
+	}
+	if _, err := git("-C", root, "worktree", "remove", "--force", c.dir); err != nil {
+		os.RemoveAll(c.dir)
+		git("-C", root, "worktree", "prune")
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	return s[strings.LastIndex(s, "\n")+1:]
+}
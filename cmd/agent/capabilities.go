@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"agent/pkg/agent"
+)
+
+// runCapabilities prints the agent's capabilities as JSON for editor and UI integrations
+func runCapabilities(flags *flag.FlagSet) func() {
+	probe := flags.Bool("probe", false, "Report the model's features as detected with the API, instead of assuming it has them all.")
+	return func() {
+		features := agent.AllFeatures
+		if *probe {
+			features = probeFeatures(newClient())
+		}
+		trying, err := experiments(projectConfig(), "")
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		caps := agent.NewAgent(nil, nil, projectTools(), agent.WithFeatures(features), agent.WithExperiments(trying)).Capabilities()
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(caps); err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+	}
+}
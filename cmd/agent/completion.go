@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// commandWords are the arguments completed after a command's flags
+var commandWords = map[string][]string{
+	"sessions":   {"list", "show", "delete"},
+	"completion": {"bash", "zsh", "fish"},
+	"telemetry":  {"status", "enable", "disable", "preview"},
+}
+
+// runCompletion prints a completion script for bash, zsh or fish, built from the
+// commands and their flags so it never falls behind them
+func runCompletion(flags *flag.FlagSet) func() {
+	program := flags.String("program", "agent", "Name the agent binary is installed under.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: agent completion [flags] bash|zsh|fish")
+		flags.PrintDefaults()
+	}
+	return func() {
+		switch flags.Arg(0) {
+		case "bash":
+			fmt.Print(bashCompletion(*program))
+		case "zsh":
+			// zsh runs the bash completion through its compatibility layer
+			fmt.Print("autoload -U +X bashcompinit && bashcompinit\n" + bashCompletion(*program))
+		case "fish":
+			fmt.Print(fishCompletion(*program))
+		case "":
+			flags.Usage()
+			os.Exit(2)
+		default:
+			log.Fatalf("Error: no completion for shell '%s'; use bash, zsh or fish", flags.Arg(0))
+		}
+	}
+}
+
+// flagNames returns cmd's flags, each with its leading dash
+func flagNames(cmd command) []string {
+	flags, _ := commandFlags(cmd)
+	var names []string
+	flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	return names
+}
+
+// completionWords returns the arguments completed after cmd's flags
+func completionWords(cmd command) []string {
+	if cmd.name == "help" {
+		var names []string
+		for _, c := range commands() {
+			names = append(names, c.name)
+		}
+		return names
+	}
+	return commandWords[cmd.name]
+}
+
+// bashCompletion completes command names as the first word, then the flags of the
+// command given, or of run when there is none
+func bashCompletion(program string) string {
+	function := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(program)
+	var names []string
+	var cases strings.Builder
+	for _, cmd := range commands() {
+		names = append(names, cmd.name)
+		names = append(names, cmd.aliases...)
+		pattern := strings.Join(append([]string{cmd.name}, cmd.aliases...), "|")
+		fmt.Fprintf(&cases, "    %s) flags=%q; words=%q ;;\n", pattern, strings.Join(flagNames(cmd), " "), strings.Join(completionWords(cmd), " "))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s completion for bash\n", program)
+	fmt.Fprintf(&b, "%s() {\n", function)
+	b.WriteString("  local cur=${COMP_WORDS[COMP_CWORD]} cmd=run flags words\n")
+	fmt.Fprintf(&b, "  local commands=%q\n", strings.Join(names, " "))
+	b.WriteString("  if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n")
+	b.WriteString("    COMPREPLY=($(compgen -W \"$commands\" -- \"$cur\"))\n")
+	b.WriteString("    return\n")
+	b.WriteString("  fi\n")
+	b.WriteString("  if [[ \" $commands \" == *\" ${COMP_WORDS[1]} \"* ]]; then\n")
+	b.WriteString("    cmd=${COMP_WORDS[1]}\n")
+	b.WriteString("  fi\n")
+	b.WriteString("  case $cmd in\n")
+	b.WriteString(cases.String())
+	b.WriteString("  esac\n")
+	b.WriteString("  if [[ $cur == -* ]]; then\n")
+	b.WriteString("    COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	b.WriteString("  elif [[ -n $words ]]; then\n")
+	b.WriteString("    COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	b.WriteString("  else\n")
+	b.WriteString("    COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	b.WriteString("  fi\n")
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "complete -F %s %s\n", function, program)
+	return b.String()
+}
+
+// fishCompletion completes commands and, after each, its flags with their descriptions
+func fishCompletion(program string) string {
+	var names []string
+	for _, cmd := range commands() {
+		names = append(names, cmd.name)
+		names = append(names, cmd.aliases...)
+	}
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s completion for fish\n", program)
+	for _, cmd := range commands() {
+		for _, name := range append([]string{cmd.name}, cmd.aliases...) {
+			fmt.Fprintf(&b, "complete -c %s -n '__fish_use_subcommand' -f -a %s -d '%s'\n", program, name, quote.Replace(cmd.summary))
+		}
+		condition := fmt.Sprintf("__fish_seen_subcommand_from %s", strings.Join(append([]string{cmd.name}, cmd.aliases...), " "))
+		if cmd.name == "run" {
+			// Without a command, the flags are run's
+			condition = fmt.Sprintf("not __fish_seen_subcommand_from %s", strings.Join(names, " "))
+		}
+		flags, _ := commandFlags(cmd)
+		flags.VisitAll(func(f *flag.Flag) {
+			description, _, _ := strings.Cut(f.Usage, ". ")
+			fmt.Fprintf(&b, "complete -c %s -n '%s' -o %s -d '%s'\n", program, condition, f.Name, quote.Replace(strings.TrimSuffix(description, ".")))
+		})
+		if words := completionWords(cmd); len(words) > 0 {
+			fmt.Fprintf(&b, "complete -c %s -n '%s' -f -a '%s'\n", program, condition, strings.Join(words, " "))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"agent/internal/conflict"
+	"agent/pkg/agent"
+)
+
+// runResolveConflicts walks the conflicted files of a merge or rebase, asks the model
+// to resolve each hunk, applies approved resolutions and verifies the build
+func runResolveConflicts(flags *flag.FlagSet) func() {
+	build := flags.String("build", "", "Command run to verify the result. Detected from the project when empty.")
+	contextLines := flags.Int("context", 15, "Lines of surrounding code shown to the model for each hunk.")
+	yes := flags.Bool("yes", false, "Apply every proposed resolution without asking.")
+	return func() {
+		out, err := git("diff", "--name-only", "--diff-filter=U")
+		if err != nil {
+			log.Fatalf("Error listing conflicted files: %s", err.Error())
+		}
+		files := strings.Fields(out)
+		if len(files) == 0 {
+			log.Println("No conflicted files")
+			return
+		}
+
+		ctx := context.Background()
+		resolver := agent.NewAgent(newClient(), nil, nil)
+		input := bufio.NewReader(os.Stdin)
+		unresolved := 0
+
+		for _, path := range files {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				log.Fatalf("Error reading '%s': %s", path, err.Error())
+			}
+			parsed, err := conflict.Parse(string(content))
+			if err != nil {
+				log.Printf("Skipping '%s': %s\n", path, err.Error())
+				unresolved++
+				continue
+			}
+
+			resolutions := make([]*string, len(parsed.Hunks))
+			for i, hunk := range parsed.Hunks {
+				fmt.Printf("\n\u001b[1m%s: conflict %d of %d (line %d)\u001b[0m\n", path, i+1, len(parsed.Hunks), hunk.StartLine)
+				resolution, err := resolveHunk(ctx, resolver, path, parsed, i, *contextLines)
+				if err != nil {
+					log.Printf("Error resolving hunk: %s\n", err.Error())
+					continue
+				}
+				fmt.Printf("\u001b[91mours (%s):\u001b[0m\n%s\u001b[92mtheirs (%s):\u001b[0m\n%s\u001b[93mproposed:\u001b[0m\n%s",
+					hunk.OursLabel, hunk.Ours, hunk.TheirsLabel, hunk.Theirs, resolution)
+
+				if *yes {
+					resolutions[i] = &resolution
+					continue
+				}
+				switch ask(input, "Apply this resolution? [y]es/[n]o/[q]uit: ") {
+				case "y", "yes":
+					resolutions[i] = &resolution
+				case "q", "quit":
+					writeResolutions(path, parsed, resolutions)
+					log.Println("Stopped; remaining conflicts left in place")
+					return
+				}
+			}
+
+			if !writeResolutions(path, parsed, resolutions) {
+				unresolved++
+			}
+		}
+
+		if unresolved > 0 {
+			log.Printf("%d file(s) still have conflicts, skipping the build\n", unresolved)
+			return
+		}
+		verifyBuild(*build)
+	}
+}
+
+// resolveHunk asks the model for the merged text of hunk i
+func resolveHunk(ctx context.Context, resolver *agent.Agent, path string, file *conflict.File, i, contextLines int) (string, error) {
+	hunk := file.Hunks[i]
+	before, after := file.Context(i, contextLines)
+	base := hunk.Base
+	switch {
+	case !hunk.HasBase:
+		base = "(not recorded; set merge.conflictStyle=diff3 to include it)\n"
+	case base == "":
+		base = "(empty; both sides added this code)\n"
+	}
+
+	prompt := fmt.Sprintf("Resolve this git conflict in %s. \"Ours\" is %q and \"theirs\" is %q; during a rebase "+
+		"ours is the branch being rebased onto. Combine the intent of both sides.\n\n"+
+		"Code before the conflict:\n```\n%s```\n\nOurs:\n```\n%s```\n\nBase:\n```\n%s```\n\nTheirs:\n```\n%s```\n\n"+
+		"Code after the conflict:\n```\n%s```\n\n"+
+		"Reply with a one-sentence rationale, then the exact replacement text for the conflicted region "+
+		"(markers excluded) between <resolution> and </resolution> tags.",
+		path, hunk.OursLabel, hunk.TheirsLabel, before, hunk.Ours, base, hunk.Theirs, after)
+
+	answer, err := resolver.RunTask(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	_, rest, ok := strings.Cut(answer, "<resolution>")
+	resolution, _, closed := strings.Cut(rest, "</resolution>")
+	if !ok || !closed {
+		return "", fmt.Errorf("model reply had no <resolution> block")
+	}
+	resolution = strings.TrimPrefix(resolution, "\n")
+	if resolution != "" && !strings.HasSuffix(resolution, "\n") {
+		resolution += "\n"
+	}
+	return resolution, nil
+}
+
+// writeResolutions saves the file and stages it once no conflicts remain, reporting whether it is fully resolved
+func writeResolutions(path string, file *conflict.File, resolutions []*string) bool {
+	if err := os.WriteFile(path, []byte(file.Render(resolutions)), 0644); err != nil {
+		log.Printf("Error writing '%s': %s\n", path, err.Error())
+		return false
+	}
+	for _, resolution := range resolutions {
+		if resolution == nil {
+			return false
+		}
+	}
+	if _, err := git("add", "--", path); err != nil {
+		log.Printf("Error staging '%s': %s\n", path, err.Error())
+		return false
+	}
+	log.Printf("Resolved and staged %s\n", path)
+	return true
+}
+
+// verifyBuild runs the build command and reports the outcome
+func verifyBuild(command string) {
+	if command == "" {
+		command = detectBuildCommand()
+	}
+	if command == "" {
+		log.Println("No build command detected; pass -build to verify the result")
+		return
+	}
+	log.Printf("Verifying with: %s\n", command)
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("\u001b[91mBuild failed\u001b[0m: %s\n", err.Error())
+		os.Exit(1)
+	}
+	log.Println("\u001b[92mBuild passed\u001b[0m")
+}
+
+// detectBuildCommand guesses the project's build command from its manifest files
+func detectBuildCommand() string {
+	candidates := []struct{ file, command string }{
+		{"go.mod", "go build ./..."},
+		{"Cargo.toml", "cargo build"},
+		{"package.json", "npm run build --if-present"},
+		{"Makefile", "make"},
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c.file); err == nil {
+			return c.command
+		}
+	}
+	return ""
+}
+
+// ask prints prompt and returns the user's lower-cased answer, with yes in any
+// language normalized to "y"
+func ask(input *bufio.Reader, prompt string) string {
+	fmt.Print(prompt)
+	answer, _ := input.ReadString('\n')
+	if isAffirmative(answer) {
+		return "y"
+	}
+	return strings.ToLower(strings.TrimSpace(answer))
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/pkg/agent"
+	"agent/pkg/session"
+)
+
+const (
+	// defaultCrashDir is where crash reports are written, relative to the project
+	defaultCrashDir = ".agent/crashes"
+	// crashEvents is how many of the most recent events a crash report includes
+	crashEvents = 50
+	// issueURL opens a new issue on the agent's repository
+	issueURL = "https://github.com/joshuaisaact/Go-AI-Agent/issues/new"
+	// maxIssueBody keeps the prefilled issue within the URL length browsers accept
+	maxIssueBody = 6000
+)
+
+// crashReporter keeps the last events of the session, already scrubbed, so that a
+// panic can be written up as a report that is safe to share. File contents, tool
+// output and the model's text are reduced to their sizes; tool inputs keep short
+// values such as paths and commands, with anything that looks like a secret removed.
+type crashReporter struct {
+	dir      string
+	flags    *flag.FlagSet
+	input    *terminalInput // asks whether to open an issue; nil when not interactive
+	cleanup  func()         // restores the terminal before the report is printed
+	mu       sync.Mutex
+	recent   []agent.Event
+	received int
+}
+
+func newCrashReporter(dir string, flags *flag.FlagSet, input *terminalInput) *crashReporter {
+	return &crashReporter{dir: dir, flags: flags, input: input, cleanup: func() {}}
+}
+
+// events passes events on to next after keeping a scrubbed copy of each
+func (c *crashReporter) events(next agent.EventHandler) agent.EventHandler {
+	return func(e agent.Event) {
+		c.mu.Lock()
+		c.recent = append(c.recent, scrubEvent(e))
+		if len(c.recent) > crashEvents {
+			c.recent = slices.Delete(c.recent, 0, len(c.recent)-crashEvents)
+		}
+		c.received++
+		c.mu.Unlock()
+		next(e)
+	}
+}
+
+// recover is deferred at the top of the goroutine running the agent. On a panic it
+// writes the report, offers to open an issue with it, and panics again so the process
+// still exits with the stack trace.
+func (c *crashReporter) recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := debug.Stack()
+	c.cleanup()
+	report := c.report(r, stack)
+	path, err := c.write(report)
+	if err != nil {
+		log.Printf("Error writing crash report: %s\n", err.Error())
+		panic(r)
+	}
+	log.Printf("\u001b[91mThe agent crashed.\u001b[0m A report with file contents and secrets removed was written to %s\n", path)
+	if c.input != nil && c.input.Confirm("Open a GitHub issue prefilled with the report?") {
+		if err := openBrowser(issueLink(r, report, path)); err != nil {
+			log.Printf("Error opening browser: %s\n", err.Error())
+		}
+	}
+	panic(r)
+}
+
+// report renders the crash as Markdown: the panic and stack, the build and settings,
+// and the recent events
+func (c *crashReporter) report(r any, stack []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Panic\n\n```\n%s\n\n%s```\n\n", scrubText(fmt.Sprint(r)), stack)
+	fmt.Fprintf(&b, "## Build\n\n%s\n\n", versionString())
+	b.WriteString("## Settings\n\n")
+	for _, line := range c.settings() {
+		fmt.Fprintf(&b, "- %s\n", line)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(&b, "\n## Last %d of %d events\n\n", len(c.recent), c.received)
+	b.WriteString("```\n")
+	for _, e := range c.recent {
+		line := fmt.Sprintf("%s %-5s %s", e.Time.Format(time.TimeOnly), e.Ref, e.Type)
+		if e.ToolName != "" {
+			line += " " + e.ToolName
+		}
+		if len(e.Input) > 0 {
+			line += " " + string(e.Input)
+		}
+		if e.IsError {
+			line += " (error)"
+		}
+		if e.Text != "" {
+			line += ": " + e.Text
+		}
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("```\n")
+	return b.String()
+}
+
+// settings summarises the flags that were set and the config, naming which options are
+// in use rather than their values, which may be internal URLs or credentials
+func (c *crashReporter) settings() []string {
+	var lines []string
+	if c.flags != nil {
+		var set []string
+		c.flags.Visit(func(f *flag.Flag) {
+			value := f.Value.String()
+			if strings.Contains(value, "://") || len(value) > 40 {
+				value = "(set)"
+			}
+			set = append(set, fmt.Sprintf("-%s=%s", f.Name, scrubText(value)))
+		})
+		if len(set) == 0 {
+			set = []string{"defaults"}
+		}
+		lines = append(lines, "flags: "+strings.Join(set, " "))
+	}
+	cfg := projectConfig()
+	lines = append(lines,
+		fmt.Sprintf("network: base_url %t, proxy %t, %d CA certs, low_bandwidth %t",
+			cfg.Network.BaseURL != "" || os.Getenv("ANTHROPIC_BASE_URL") != "", cfg.Network.Proxy != "", len(cfg.Network.CACerts), cfg.Network.LowBandwidth),
+		fmt.Sprintf("language: %q, %d key bindings, %d tools tuned", cfg.Language, len(cfg.Keys), len(cfg.Tools)),
+	)
+	return lines
+}
+
+// write saves the report under the crash directory, named by the time of the crash
+func (c *crashReporter) write(report string) (string, error) {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create '%s': %w", c.dir, err)
+	}
+	path := filepath.Join(c.dir, "crash-"+time.Now().Format("20060102-150405")+".md")
+	if err := os.WriteFile(path, []byte(report), 0600); err != nil {
+		return "", fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	return path, nil
+}
+
+// issueLink returns a new-issue URL with the report as its body, cut to fit in a URL
+func issueLink(r any, report, path string) string {
+	body := report
+	if len(body) > maxIssueBody {
+		body = body[:maxIssueBody] + fmt.Sprintf("\n```\n\n(Cut short; the full report is %s.)\n", path)
+	}
+	title := fmt.Sprintf("Crash: %s", scrubText(fmt.Sprint(r)))
+	if len(title) > 100 {
+		title = title[:100]
+	}
+	return issueURL + "?" + url.Values{"title": {title}, "body": {body}}.Encode()
+}
+
+// scrubEvent returns e with the model's text and tool output replaced by their sizes,
+// and secrets removed from notices and errors
+func scrubEvent(e agent.Event) agent.Event {
+	switch {
+	case e.Type == agent.EventToolResult && e.IsError:
+		// Errors are what maintainers need most, and rarely carry file contents
+		first, _, _ := strings.Cut(e.Text, "\n")
+		e.Text = scrubText(first)
+	case e.Type == agent.EventText || e.Type == agent.EventToolResult:
+		e.Text = fmt.Sprintf("[%d bytes]", len(e.Text))
+	default:
+		e.Text = scrubText(e.Text)
+	}
+	if len(e.Input) > 0 {
+		e.Input = scrubInput(e.Input)
+	}
+	return e
+}
+
+// scrubInput keeps a tool input's short, single-line string values, such as paths and
+// commands, and replaces the others, which hold file contents and edits, by their sizes
+func scrubInput(input json.RawMessage) json.RawMessage {
+	var fields map[string]any
+	if err := json.Unmarshal(input, &fields); err != nil {
+		return json.RawMessage(fmt.Sprintf(`"[%d bytes]"`, len(input)))
+	}
+	for key, value := range fields {
+		switch v := value.(type) {
+		case string:
+			if len(v) > 120 || strings.Contains(v, "\n") {
+				fields[key] = fmt.Sprintf("[%d bytes]", len(v))
+			} else {
+				fields[key] = scrubText(v)
+			}
+		case map[string]any, []any:
+			data, _ := json.Marshal(v)
+			fields[key] = fmt.Sprintf("[%d bytes]", len(data))
+		}
+	}
+	data, _ := json.Marshal(fields)
+	return data
+}
+
+// scrubText removes anything that looks like a key or token, and the API key itself
+func scrubText(text string) string {
+	if key := os.Getenv("ANTHROPIC_API_KEY"); len(key) > 8 {
+		text = strings.ReplaceAll(text, key, "[secret]")
+	}
+	return session.SecretPattern.ReplaceAllString(text, "[secret]")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"agent/internal/config"
+	"agent/pkg/agent"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// runDoctor checks that the agent itself is ready to run here: credentials, config,
+// the commands its tools call, the session store and, unless -offline, the API
+func runDoctor(flags *flag.FlagSet) func() {
+	location, encryption := sessionStoreFlags(flags)
+	offline := flags.Bool("offline", false, "Skip the request that checks the API can be reached with the credentials.")
+	return func() {
+		checks := []prerequisite{
+			commandPrerequisite("git", "used for diffs, candidates and bisecting", "", "--version"),
+			commandPrerequisite("rg", "used by the ripgrep_search tool", "", "--version"),
+			commandPrerequisite("go", "used by the pprof tools", "", "version"),
+		}
+
+		credentials := prerequisite{name: "credentials", reason: "an API key or OAuth login; run agent login", ok: hasCredentials()}
+		if credentials.ok {
+			credentials.found = "found"
+		}
+		checks = append(checks, credentials)
+
+		settings := prerequisite{name: "config", reason: config.ProjectPath + " and the user config parse"}
+		cfg, err := config.Load()
+		if err == nil {
+			_, err = parseKeyBindings(cfg.Keys)
+		}
+		if err == nil {
+			_, err = cfg.Network.Transport()
+		}
+		if err == nil {
+			_, err = experiments(cfg, "")
+		}
+		settings.ok, settings.found = err == nil, "valid"
+		if err != nil {
+			settings.found = err.Error()
+		}
+		checks = append(checks, settings)
+
+		ctx := context.Background()
+		store := prerequisite{name: "session store", reason: *location + " can be opened and listed"}
+		if *location != "" {
+			if s, err := openSessionStore(ctx, *location, *encryption, true); err != nil {
+				store.found = err.Error()
+			} else if _, err := s.List(ctx); err != nil {
+				store.found = err.Error()
+			} else {
+				store.ok, store.found = true, "reachable"
+			}
+			checks = append(checks, store)
+		}
+
+		if !*offline && credentials.ok && settings.ok {
+			api := prerequisite{name: "API", reason: "a one-token request to " + string(agent.DefaultModel) + " succeeds"}
+			ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+			_, err := newClient().Messages.New(ctx, anthropic.MessageNewParams{
+				Model:     agent.DefaultModel,
+				MaxTokens: 1,
+				Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("ping"))},
+			})
+			api.ok, api.found = err == nil, "reachable"
+			if err != nil {
+				api.found = err.Error()
+			}
+			checks = append(checks, api)
+		}
+
+		printPrerequisites(checks)
+		for _, check := range checks {
+			// rg and go only matter to the tools that call them
+			if !check.ok && check.name != "rg" && check.name != "go" {
+				os.Exit(1)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// defaultDraftPath is where an unfinished multi-line message is kept, relative to the project
+const defaultDraftPath = ".agent/draft.txt"
+
+// drafts reads chat messages that may span several lines, each but the last ending in
+// a backslash, and saves the lines written so far after every one, so a message that
+// is cut short by ctrl-c or a crash can be picked up on the next launch. With line
+// editing the text being typed is saved after every key as well; without it the
+// terminal holds the current line until Enter, so that line is what a crash loses.
+type drafts struct {
+	input *terminalInput
+	path  string
+
+	mu    sync.Mutex
+	lines []string // the message so far
+}
+
+// newDrafts offers to restore the draft left at path by an earlier run, kept if accepted
+// and deleted otherwise
+func newDrafts(input *terminalInput, path string) *drafts {
+	d := &drafts{input: input, path: path}
+	content, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(content)) == "" {
+		return d
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	log.Printf("An unsent message was saved as a draft (%d lines):\n", len(lines))
+	for _, line := range lines {
+		fmt.Printf("\u001b[90m| %s\u001b[0m\n", line)
+	}
+	if input.Confirm("Resume the draft?") {
+		d.lines = lines
+	} else {
+		d.discard()
+	}
+	return d
+}
+
+// ReadMessage is the agent's MessageHandler. A line ending in a backslash continues on
+// the next, and a resumed draft is continued the same way, so an empty line sends it.
+func (d *drafts) ReadMessage(ctx context.Context) (string, error) {
+	d.input.watchEdits(d.saveEditing)
+	defer d.input.watchEdits(nil)
+
+	d.mu.Lock()
+	if len(d.lines) > 0 {
+		for _, line := range d.lines {
+			fmt.Printf("\n\u001b[90m| %s\u001b[0m", line)
+		}
+		fmt.Print("\n... ")
+	}
+	d.mu.Unlock()
+	for {
+		line, err := d.input.ReadMessage(ctx)
+		if err != nil {
+			// The draft stays on disk for the next run
+			return "", err
+		}
+		d.mu.Lock()
+		continued := strings.HasSuffix(line, "\\")
+		if continued || len(d.lines) == 0 || line != "" {
+			d.lines = append(d.lines, strings.TrimSuffix(line, "\\"))
+		}
+		if !continued {
+			message := strings.Join(d.lines, "\n")
+			d.lines = nil
+			d.discard()
+			d.mu.Unlock()
+			return message, nil
+		}
+		d.save(d.lines)
+		d.mu.Unlock()
+		fmt.Print("... ")
+	}
+}
+
+// saveEditing saves the message so far followed by the text in the line editor
+func (d *drafts) saveEditing(text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.lines) == 0 && strings.TrimSpace(text) == "" {
+		d.discard()
+		return
+	}
+	d.save(append(slices.Clone(d.lines), text))
+}
+
+// save writes lines to the draft file
+func (d *drafts) save(lines []string) {
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		log.Printf("Error saving draft: %s\n", err.Error())
+		return
+	}
+	if err := os.WriteFile(d.path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		log.Printf("Error saving draft: %s\n", err.Error())
+	}
+}
+
+// discard deletes the draft file once its message has been sent or declined
+func (d *drafts) discard() {
+	if err := os.Remove(d.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error removing draft '%s': %s\n", d.path, err.Error())
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"agent/pkg/eval"
+)
+
+// runEval runs an evaluation suite and reports the pass rate and cost of each task
+func runEval(flags *flag.FlagSet) func() {
+	suitePath := flags.String("suite", "evals/suite.yaml", "Suite file listing the tasks.")
+	repeat := flags.Int("repeat", 1, "Runs per task; more runs give a steadier pass rate.")
+	concurrency := flags.Int("concurrency", 1, "Task runs executed in parallel.")
+	timeout := flags.Duration("timeout", 10*time.Minute, "Time limit for tasks that do not set one.")
+	jsonOut := flags.String("json", "", "Also write every result as JSON to this file.")
+	chaos := flags.Float64("chaos", 0, "Inject API 529s, tool timeouts and malformed tool results into this fraction of requests and tool calls, to check the agent degrades gracefully.")
+	return func() {
+		suite, err := eval.LoadSuite(*suitePath)
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			log.Fatalf("Error locating the agent executable: %s", err.Error())
+		}
+
+		runner := &eval.Runner{
+			Executable:  exe,
+			Repeat:      *repeat,
+			Concurrency: *concurrency,
+			Timeout:     *timeout,
+			Chaos:       *chaos,
+			Progress: func(r eval.Result) {
+				status := "\u001b[92mpass\u001b[0m"
+				if !r.Passed {
+					status = "\u001b[91mfail\u001b[0m"
+				}
+				log.Printf("%s #%d: %s ($%.4f, %.0fs) %s\n", r.Task, r.Run, status, r.Cost, r.Duration, r.Error)
+			},
+		}
+		results := runner.Run(context.Background(), suite)
+
+		if *jsonOut != "" {
+			data, _ := json.MarshalIndent(results, "", "  ")
+			if err := os.WriteFile(*jsonOut, data, 0644); err != nil {
+				log.Fatalf("Error writing '%s': %s", *jsonOut, err.Error())
+			}
+		}
+
+		var passed, runs int
+		var cost float64
+		fmt.Printf("\n%-30s %9s %10s %10s %8s\n", "TASK", "PASS", "COST/RUN", "TOKENS", "TIME")
+		for _, s := range eval.Summarize(results) {
+			fmt.Printf("%-30s %4d/%-4d $%9.4f %10d %7.0fs\n", s.Task, s.Passed, s.Runs, s.Cost, s.Tokens, s.Duration)
+			passed += s.Passed
+			runs += s.Runs
+			cost += s.Cost * float64(s.Runs)
+		}
+		if runs > 0 {
+			fmt.Printf("\nPassed %d of %d runs (%.0f%%), total cost $%.4f\n", passed, runs, 100*float64(passed)/float64(runs), cost)
+		}
+	}
+}
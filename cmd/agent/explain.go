@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"agent/pkg/agent"
+)
+
+// maxExplainChanges bounds how much recent git history is inlined into the prompt
+const maxExplainChanges = 30_000
+
+// runExplain diagnoses an error message or stack trace given as arguments or on stdin.
+// It attaches the source the error points at and the recent changes to those files up
+// front, so the answer usually needs no exploring, and skips all interactive setup.
+func runExplain(flags *flag.FlagSet) func() {
+	commits := flags.Int("commits", 5, "How many recent commits touching the referenced files to include.")
+	maxTurns := flags.Int("max-turns", 15, "Maximum model calls for the diagnosis.")
+	return func() {
+		text := strings.Join(flags.Args(), " ")
+		if text == "" || text == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				log.Fatalf("Error reading the error from stdin: %s", err.Error())
+			}
+			text = string(data)
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			log.Fatal("Error: pass the error message or stack trace as arguments or on stdin")
+		}
+		if len(text) > maxTestOutput {
+			// The end of an error dump is usually where the cause is
+			text = "...\n" + text[len(text)-maxTestOutput:]
+		}
+
+		sources, files := agent.TraceSources(text)
+		var b strings.Builder
+		fmt.Fprintf(&b, "Diagnose this error:\n```\n%s\n```\n", text)
+		if sources != "" {
+			b.WriteString("\n" + sources)
+		}
+		if changes := recentChanges(files, *commits); changes != "" {
+			fmt.Fprintf(&b, "\nRecent changes%s:\n```diff\n%s\n```\n", scopeNote(files), changes)
+		}
+		b.WriteString("\nExplain what the error means, its most likely root cause in this code, citing files and lines, " +
+			"and whether one of the recent changes introduced it. Then propose a fix as a diff against the current tree. " +
+			"Read more of the code only if the context above is not enough. Do not modify any files.")
+
+		explainer := agent.NewAgent(newClient(), nil, readOnlyTools(), agent.WithMaxTurns(*maxTurns), agent.WithMaxTokens(4096), toolExamples())
+		answer, err := explainer.RunTask(context.Background(), b.String())
+		if err != nil {
+			log.Fatalf("Error explaining the error: %s", err.Error())
+		}
+		fmt.Println(answer)
+	}
+}
+
+// recentChanges returns the uncommitted changes and the last commits to files, or to
+// the whole repository when the error names no files. It is empty outside a git
+// repository.
+func recentChanges(files []string, commits int) string {
+	pathArgs := append([]string{"--"}, files...)
+	diff, err := git(append([]string{"diff", "HEAD"}, pathArgs...)...)
+	if err != nil {
+		return ""
+	}
+	logArgs := []string{"log", "-n", strconv.Itoa(commits), "--date=short", "--format=commit %h %ad %an%n    %s"}
+	if len(files) > 0 {
+		logArgs = append(logArgs, "--patch")
+	} else {
+		logArgs = append(logArgs, "--stat")
+	}
+	history, _ := git(append(logArgs, pathArgs...)...)
+
+	var changes []string
+	if diff = strings.TrimSpace(diff); diff != "" {
+		changes = append(changes, "# Uncommitted\n"+diff)
+	}
+	if history = strings.TrimSpace(history); history != "" {
+		changes = append(changes, history)
+	}
+	all := strings.Join(changes, "\n\n")
+	if len(all) > maxExplainChanges {
+		all = all[:maxExplainChanges] + "\n... (history truncated)"
+	}
+	return all
+}
+
+// scopeNote says which files the recent changes cover
+func scopeNote(files []string) string {
+	if len(files) == 0 {
+		return " in the repository"
+	}
+	return " to " + strings.Join(files, ", ")
+}
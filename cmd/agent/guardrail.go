@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"agent/internal/config"
+	"agent/pkg/tools"
+)
+
+// Sensitive directory actions
+const (
+	sensitiveReadOnly = "read-only"
+	sensitiveRefuse   = "refuse"
+)
+
+// builtinSensitiveDirs are directories no project lives in. A trailing /** covers the
+// directories below too; the others match only themselves, since projects are often
+// kept under /usr/local, /var/www or the home directory.
+func builtinSensitiveDirs() []string {
+	if runtime.GOOS == "windows" {
+		drive := os.Getenv("SystemDrive") + `\`
+		return []string{"~", drive, drive + `Windows\**`, drive + "Program Files", drive + "Program Files (x86)", drive + "Users"}
+	}
+	return []string{"~", "/", "/etc/**", "/bin/**", "/sbin/**", "/boot/**", "/dev/**", "/proc/**", "/sys/**",
+		"/usr", "/usr/bin/**", "/usr/sbin/**", "/usr/lib/**", "/lib/**", "/var", "/opt", "/tmp", "/home", "/root",
+		"/System/**", "/Library", "/Applications", "/Users", "/private/etc/**", "/private/var"}
+}
+
+// sensitiveDir returns the entry of the denylist that dir falls under, if any
+func sensitiveDir(dir string, cfg config.SensitiveDirs) (string, bool) {
+	dir = canonicalDir(dir)
+	for _, entry := range append(builtinSensitiveDirs(), cfg.Paths...) {
+		pattern, below := strings.CutSuffix(filepath.FromSlash(entry), string(filepath.Separator)+"**")
+		pattern = canonicalDir(expandHome(pattern))
+		if dir == pattern {
+			return entry, true
+		}
+		if below && strings.HasPrefix(dir, strings.TrimSuffix(pattern, string(filepath.Separator))+string(filepath.Separator)) {
+			return entry, true
+		}
+	}
+	return "", false
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return home + path[1:]
+}
+
+// canonicalDir makes dir absolute and resolves symlinks, so /etc and /private/etc on
+// macOS or a linked home directory are recognised either way
+func canonicalDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	return filepath.Clean(dir)
+}
+
+// guardSensitiveDir checks the working directory against the denylist. It returns the
+// tools to run with, without the mutating ones when the directory is sensitive, and a
+// warning to show the user; with action refuse it returns an error instead.
+func guardSensitiveDir(chatTools []tools.ToolDefinition, cfg config.SensitiveDirs) ([]tools.ToolDefinition, string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return chatTools, "", nil
+	}
+	entry, ok := sensitiveDir(dir, cfg)
+	if !ok {
+		return chatTools, "", nil
+	}
+	switch cfg.Action {
+	case "", sensitiveReadOnly:
+	case sensitiveRefuse:
+		return nil, "", fmt.Errorf("refusing to run in %s, which matches %s in the sensitive directory list; cd into a project, or pass -allow-sensitive-dir", dir, entry)
+	default:
+		return nil, "", fmt.Errorf("unknown sensitive_dirs.action '%s'; use %s or %s", cfg.Action, sensitiveReadOnly, sensitiveRefuse)
+	}
+	var readOnly []tools.ToolDefinition
+	for _, tool := range chatTools {
+		if !tool.Mutating {
+			readOnly = append(readOnly, tool)
+		}
+	}
+	warning := fmt.Sprintf("%s is not a project directory (it matches %s), so the agent is read-only: the tools that change files are disabled. "+
+		"cd into a project, or pass -allow-sensitive-dir if this is intended.", dir, entry)
+	return readOnly, warning, nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"agent/pkg/agent"
+)
+
+// terminalInput reads lines from the terminal in the background so that waiting for
+// input can be abandoned when the context is cancelled. The chat and tool
+// confirmations share it, so neither reads ahead of the other. Once line editing is
+// started, keys go to the editor, which sends each line when it is submitted.
+type terminalInput struct {
+	lines  chan string
+	err    error // set before lines is closed
+	editor atomic.Pointer[lineEditor]
+
+	mu       sync.Mutex
+	onEdit   func(text string) // told of the text being edited, while set
+	steering []string          // lines typed before a prompt, kept for Pending
+}
+
+func newTerminalInput(r io.Reader) *terminalInput {
+	in := &terminalInput{lines: make(chan string)}
+	go func() {
+		reader := bufio.NewReader(r)
+		var line strings.Builder
+		for {
+			if editor := in.editor.Load(); editor != nil {
+				name, char, err := readKey(reader)
+				if err != nil {
+					in.err = err
+					break
+				}
+				if message, ok := editor.key(name, char); ok {
+					in.lines <- message
+				}
+				continue
+			}
+			char, _, err := reader.ReadRune()
+			if err != nil {
+				in.err = err
+				if line.Len() > 0 {
+					in.lines <- line.String()
+				}
+				break
+			}
+			if in.editor.Load() != nil && line.Len() == 0 {
+				// Editing started while this read was waiting
+				reader.UnreadRune()
+				continue
+			}
+			if char != '\n' {
+				line.WriteRune(char)
+				continue
+			}
+			in.lines <- strings.TrimSuffix(line.String(), "\r")
+			line.Reset()
+		}
+		close(in.lines)
+	}()
+	return in
+}
+
+// startEditing puts the terminal into line-editing mode with the given bindings,
+// returning a function that ends it. expand is called for the expand key.
+func (in *terminalInput) startEditing(bindings keyBindings, expand func()) (func(), error) {
+	restore, err := rawMode()
+	if err != nil {
+		return nil, err
+	}
+	in.editor.Store(&lineEditor{bindings: bindings, expand: expand, onEdit: in.edited})
+	return func() {
+		in.editor.Store(nil)
+		restore()
+	}, nil
+}
+
+// watchEdits calls fn with the text being edited after each change, until it is
+// called again with nil
+func (in *terminalInput) watchEdits(fn func(text string)) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.onEdit = fn
+}
+
+func (in *terminalInput) edited(text string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.onEdit != nil {
+		in.onEdit(text)
+	}
+}
+
+// ReadMessage is the agent's MessageHandler; it returns io.EOF once input ends. Lines
+// set aside by a prompt after the turn's last model call are read first.
+func (in *terminalInput) ReadMessage(ctx context.Context) (string, error) {
+	in.mu.Lock()
+	steering := in.steering
+	in.steering = nil
+	in.mu.Unlock()
+	if len(steering) > 0 {
+		return strings.Join(steering, "\n"), nil
+	}
+	select {
+	case line, ok := <-in.lines:
+		if !ok {
+			return "", in.err
+		}
+		return line, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Pending returns the lines typed since the last read without waiting, for steering
+// a turn in progress
+func (in *terminalInput) Pending() []string {
+	in.setAside()
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	lines := in.steering
+	in.steering = nil
+	return lines
+}
+
+// setAside moves the lines already typed into the steering buffer, so that guidance
+// typed while a turn runs is not taken as the answer to the next prompt
+func (in *terminalInput) setAside() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for {
+		select {
+		case line, ok := <-in.lines:
+			if !ok {
+				return
+			}
+			if line = strings.TrimSpace(line); line != "" {
+				in.steering = append(in.steering, line)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// answer shows prompt and reads the reply, which is only ever a line typed after it
+func (in *terminalInput) answer(prompt string) (string, error) {
+	in.setAside()
+	fmt.Print(prompt)
+	line, ok := <-in.lines
+	if !ok {
+		return "", in.err
+	}
+	return line, nil
+}
+
+// Ask puts the model's question to the user, who answers with an option's number or
+// their own text
+func (in *terminalInput) Ask(question string, options []string) (string, error) {
+	fmt.Printf("\u001b[93mQuestion\u001b[0m: %s\n", question)
+	for i, option := range options {
+		fmt.Printf("  %d) %s\n", i+1, option)
+	}
+	prompt := "Answer: "
+	if len(options) > 0 {
+		prompt = "Answer (number or text): "
+	}
+	line, err := in.answer(prompt)
+	if err != nil {
+		return "", err
+	}
+	answer := strings.TrimSpace(line)
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+		return options[n-1], nil
+	}
+	return answer, nil
+}
+
+// Confirm asks tool confirmation questions on the terminal, declining if input has ended
+func (in *terminalInput) Confirm(question string) bool {
+	line, err := in.answer(fmt.Sprintf("\u001b[93m%s\u001b[0m [y/N]: ", question))
+	if err != nil {
+		return false
+	}
+	return isAffirmative(line)
+}
+
+// ReviewHunks shows each pending change as a coloured diff and asks whether to write
+// it. All accepts the change and every one after it; quit rejects them.
+func (in *terminalInput) ReviewHunks(hunks []agent.Hunk) []bool {
+	verdicts := make([]bool, len(hunks))
+	for i, hunk := range hunks {
+		fmt.Printf("\n\u001b[1m%s\u001b[0m (change %d of %d)\n", hunk.Path, i+1, len(hunks))
+		for _, line := range strings.SplitAfter(hunk.Diff, "\n") {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				fmt.Print("\u001b[92m" + line + "\u001b[0m")
+			case strings.HasPrefix(line, "-"):
+				fmt.Print("\u001b[91m" + line + "\u001b[0m")
+			case strings.HasPrefix(line, "@@"):
+				fmt.Print("\u001b[96m" + line + "\u001b[0m")
+			default:
+				fmt.Print(line)
+			}
+		}
+		line, err := in.answer("\u001b[93mWrite this change?\u001b[0m [y]es/[n]o/[a]ll/[q]uit: ")
+		answer := strings.ToLower(strings.TrimSpace(line))
+		switch {
+		case err != nil || answer == "q" || answer == "quit":
+			return verdicts
+		case answer == "a" || answer == "all":
+			for j := i; j < len(verdicts); j++ {
+				verdicts[j] = true
+			}
+			return verdicts
+		default:
+			verdicts[i] = isAffirmative(answer)
+		}
+	}
+	return verdicts
+}
+
+// affirmatives are the answers accepted as yes, so approvals work in whatever language
+// the user types. Only y is accepted as a single letter; others, such as s, could
+// just as well mean skip or stop.
+var affirmatives = map[string]bool{
+	"y": true, "yes": true, "ok": true, "okay": true,
+	"si": true, "sí": true, "sim": true, "oui": true, // Spanish, Italian, Portuguese, French
+	"ja": true, "da": true, "да": true, "tak": true, "так": true, // German, Dutch, Scandinavian, Slavic
+	"evet": true, "はい": true, "是": true, "是的": true, "好": true, "예": true, "네": true,
+}
+
+// isAffirmative reports whether answer means yes
+func isAffirmative(answer string) bool {
+	return affirmatives[strings.ToLower(strings.TrimSpace(answer))]
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"agent/pkg/agent"
+)
+
+// defaultKeys binds the line editor's actions, each to comma-separated keys. The keys
+// section of the config replaces an action's keys.
+var defaultKeys = map[string]string{
+	"submit":         "enter",
+	"newline":        "ctrl+j, alt+enter",
+	"cancel":         "ctrl+u",
+	"expand":         "ctrl+o",
+	"history-search": "ctrl+r",
+}
+
+// namedKeys are the keys other than ctrl+letter and alt+character that can be bound
+var namedKeys = []string{"enter", "tab", "esc", "backspace", "delete", "up", "down", "left", "right", "home", "end", "alt+enter"}
+
+// escapeKeys maps the escape sequences terminals send for special keys to their names
+var escapeKeys = map[string]string{
+	"A": "up", "B": "down", "C": "right", "D": "left",
+	"H": "home", "F": "end", "1~": "home", "4~": "end", "7~": "home", "8~": "end", "3~": "delete",
+}
+
+// keyBindings maps key names to the action bound to them
+type keyBindings map[string]string
+
+// parseKeyBindings combines the default bindings with those from the config, failing
+// on unknown actions or keys and on keys bound to two actions
+func parseKeyBindings(config map[string]string) (keyBindings, error) {
+	actions := map[string]string{}
+	for action, keys := range defaultKeys {
+		actions[action] = keys
+	}
+	for action, keys := range config {
+		if _, ok := defaultKeys[action]; !ok {
+			return nil, fmt.Errorf("unknown key binding action '%s'; the actions are submit, newline, cancel, expand and history-search", action)
+		}
+		actions[action] = keys
+	}
+	bindings := keyBindings{}
+	for action, keys := range actions {
+		for _, key := range strings.Split(keys, ",") {
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key == "" {
+				continue
+			}
+			if !validKey(key) {
+				return nil, fmt.Errorf("unknown key '%s' bound to %s", key, action)
+			}
+			if other, ok := bindings[key]; ok {
+				return nil, fmt.Errorf("key '%s' is bound to both %s and %s", key, other, action)
+			}
+			bindings[key] = action
+		}
+	}
+	if bindings.keysFor("submit") == "" {
+		return nil, fmt.Errorf("no key is bound to submit")
+	}
+	return bindings, nil
+}
+
+// validKey reports whether key names a key the editor can recognise
+func validKey(key string) bool {
+	if slices.Contains(namedKeys, key) {
+		return true
+	}
+	if letter, ok := strings.CutPrefix(key, "ctrl+"); ok {
+		// ctrl+c and ctrl+z stay with the terminal, for stopping and suspending
+		return len(letter) == 1 && letter[0] >= 'a' && letter[0] <= 'z' && letter != "c" && letter != "z" &&
+			letter != "i" && letter != "m" && letter != "h"
+	}
+	if char, ok := strings.CutPrefix(key, "alt+"); ok {
+		return utf8.RuneCountInString(char) == 1
+	}
+	return false
+}
+
+// keysFor lists the keys bound to action, for hints
+func (b keyBindings) keysFor(action string) string {
+	var keys []string
+	for key, bound := range b {
+		if bound == action {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return strings.Join(keys, " or ")
+}
+
+// readKey reads one keypress, returning either the name of a special key or a
+// character to insert
+func readKey(reader *bufio.Reader) (string, rune, error) {
+	r, _, err := reader.ReadRune()
+	if err != nil {
+		return "", 0, err
+	}
+	switch {
+	case r == '\r':
+		return "enter", 0, nil
+	case r == '\t':
+		return "tab", 0, nil
+	case r == 127 || r == '\b':
+		return "backspace", 0, nil
+	case r == 27:
+		// A lone escape is the esc key; sequences arrive in a single write
+		if reader.Buffered() == 0 {
+			return "esc", 0, nil
+		}
+		next, _, _ := reader.ReadRune()
+		switch next {
+		case '[', 'O':
+			var seq strings.Builder
+			for reader.Buffered() > 0 {
+				c, _ := reader.ReadByte()
+				seq.WriteByte(c)
+				if c >= 0x40 && c <= 0x7e {
+					break
+				}
+			}
+			return escapeKeys[seq.String()], 0, nil
+		case '\r':
+			return "alt+enter", 0, nil
+		}
+		return "alt+" + string(next), 0, nil
+	case r < 32:
+		return "ctrl+" + string(rune('a'+r-1)), 0, nil
+	}
+	return "", r, nil
+}
+
+// lineEditor edits chat input in the terminal, with history and the actions in its
+// bindings. It draws the line relative to the cursor, so whatever prompt was printed
+// before the read is left alone.
+type lineEditor struct {
+	bindings keyBindings
+	expand   func()
+	lines    []string // earlier lines of a multi-line message
+	buffer   []rune
+	cursor   int
+	col      int // cursor position on screen, in characters from the start of the buffer
+	history  []string
+	recall   int     // position in history while browsing with up and down
+	search   *string // the query while searching history
+	found    int     // index in history of the search match
+	onEdit   func(text string)
+}
+
+// text returns the message typed so far
+func (e *lineEditor) text() string {
+	return strings.Join(append(slices.Clone(e.lines), string(e.buffer)), "\n")
+}
+
+// key handles one keypress, returning the message once it is submitted
+func (e *lineEditor) key(name string, r rune) (string, bool) {
+	if e.search != nil && e.searchKey(name, r) {
+		return "", false
+	}
+	switch action := e.bindings[name]; {
+	case action == "submit":
+		message := e.text()
+		fmt.Print("\n")
+		if strings.TrimSpace(message) != "" {
+			e.history = append(e.history, message)
+		}
+		e.lines, e.buffer, e.cursor, e.col, e.recall = nil, nil, 0, 0, len(e.history)
+		return message, true
+	case action == "newline":
+		e.lines = append(e.lines, string(e.buffer))
+		e.buffer, e.cursor, e.col = nil, 0, 0
+		fmt.Print("\n... ")
+	case action == "cancel":
+		if len(e.lines) > 0 {
+			fmt.Print("\n\u001b[90m(message cleared)\u001b[0m\n")
+			e.col = 0
+		}
+		e.lines, e.buffer, e.cursor = nil, nil, 0
+		e.redraw(e.buffer, 0)
+	case action == "expand":
+		fmt.Print("\n")
+		e.col = 0
+		e.expand()
+		e.redraw(e.buffer, e.cursor)
+		return "", false
+	case action == "history-search":
+		query := ""
+		e.search, e.found = &query, len(e.history)
+		e.drawSearch()
+		return "", false
+	case name == "backspace" && e.cursor > 0:
+		e.buffer = slices.Delete(e.buffer, e.cursor-1, e.cursor)
+		e.cursor--
+		if e.cursor == len(e.buffer) && e.col > 0 {
+			fmt.Print("\b \b")
+			e.col--
+		} else {
+			e.redraw(e.buffer, e.cursor)
+		}
+	case name == "delete" && e.cursor < len(e.buffer):
+		e.buffer = slices.Delete(e.buffer, e.cursor, e.cursor+1)
+		e.redraw(e.buffer, e.cursor)
+	case name == "left" && e.cursor > 0:
+		e.cursor--
+		e.redraw(e.buffer, e.cursor)
+	case name == "right" && e.cursor < len(e.buffer):
+		e.cursor++
+		e.redraw(e.buffer, e.cursor)
+	case name == "home":
+		e.cursor = 0
+		e.redraw(e.buffer, e.cursor)
+	case name == "end":
+		e.cursor = len(e.buffer)
+		e.redraw(e.buffer, e.cursor)
+	case name == "up" && e.recall > 0:
+		e.recall--
+		e.buffer = []rune(e.history[e.recall])
+		e.cursor = len(e.buffer)
+		e.redraw(e.buffer, e.cursor)
+	case name == "down" && e.recall < len(e.history):
+		e.recall++
+		e.buffer = nil
+		if e.recall < len(e.history) {
+			e.buffer = []rune(e.history[e.recall])
+		}
+		e.cursor = len(e.buffer)
+		e.redraw(e.buffer, e.cursor)
+	case name == "" && r != 0:
+		e.buffer = slices.Insert(e.buffer, e.cursor, r)
+		e.cursor++
+		if e.cursor == len(e.buffer) {
+			fmt.Print(string(r))
+			e.col++
+		} else {
+			e.redraw(e.buffer, e.cursor)
+		}
+	default:
+		return "", false
+	}
+	if e.onEdit != nil {
+		e.onEdit(e.text())
+	}
+	return "", false
+}
+
+// searchKey handles a keypress while searching history. Typing extends the query, the
+// search key finds an older match, cancel gives up, and any other key takes the match
+// into the buffer and is then handled as usual, unless it is the one that submitted it.
+func (e *lineEditor) searchKey(name string, r rune) bool {
+	query := *e.search
+	switch action := e.bindings[name]; {
+	case name == "" && r != 0:
+		query += string(r)
+		e.search = &query
+		e.found = e.findHistory(query, len(e.history))
+	case name == "backspace" && query != "":
+		query = string([]rune(query)[:utf8.RuneCountInString(query)-1])
+		e.search = &query
+		e.found = e.findHistory(query, len(e.history))
+	case action == "history-search":
+		e.found = e.findHistory(query, e.found)
+	case action == "cancel":
+		e.search = nil
+		e.redraw(e.buffer, e.cursor)
+		return true
+	default:
+		e.search = nil
+		if e.found < len(e.history) {
+			e.buffer = []rune(e.history[e.found])
+			e.cursor = len(e.buffer)
+		}
+		e.redraw(e.buffer, e.cursor)
+		return false
+	}
+	e.drawSearch()
+	return true
+}
+
+// findHistory returns the index of the newest history entry before the one at before
+// that contains query, or before itself when there is none
+func (e *lineEditor) findHistory(query string, before int) int {
+	for i := before - 1; i >= 0; i-- {
+		if strings.Contains(strings.ToLower(e.history[i]), strings.ToLower(query)) {
+			return i
+		}
+	}
+	return min(before, len(e.history))
+}
+
+// drawSearch shows the search query and its match in place of the buffer
+func (e *lineEditor) drawSearch() {
+	match := ""
+	if e.found < len(e.history) {
+		match = e.history[e.found]
+	}
+	prompt := []rune(fmt.Sprintf("(history '%s'): %s", *e.search, match))
+	e.redraw(prompt, len(prompt))
+}
+
+// redraw replaces what the editor last drew with text, leaving the cursor at cursor.
+// Line breaks in recalled messages are drawn as ↵ so the text stays on one line.
+func (e *lineEditor) redraw(text []rune, cursor int) {
+	var b strings.Builder
+	if e.col > 0 {
+		fmt.Fprintf(&b, "\u001b[%dD", e.col)
+	}
+	b.WriteString(strings.ReplaceAll(string(text), "\n", "↵"))
+	b.WriteString("\u001b[K")
+	if back := len(text) - cursor; back > 0 {
+		fmt.Fprintf(&b, "\u001b[%dD", back)
+	}
+	e.col = cursor
+	fmt.Print(b.String())
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// rawMode stops the terminal from echoing and line-buffering input, so the editor sees
+// each key, and returns a function that restores it. Signals stay enabled, so ctrl+c
+// still stops the agent.
+func rawMode() (func(), error) {
+	saved := exec.Command("stty", "-g")
+	saved.Stdin = os.Stdin
+	state, err := saved.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the terminal settings: %w", err)
+	}
+	raw := exec.Command("stty", "-icanon", "-echo", "-icrnl", "min", "1", "time", "0")
+	raw.Stdin = os.Stdin
+	if err := raw.Run(); err != nil {
+		return nil, fmt.Errorf("failed to set up the terminal for line editing: %w", err)
+	}
+	return func() {
+		restore := exec.Command("stty", strings.TrimSpace(string(state)))
+		restore.Stdin = os.Stdin
+		restore.Run()
+	}, nil
+}
+
+// collapsedOutput shortens long tool results in the transcript to their first lines,
+// keeping the latest in full for the expand key
+type collapsedOutput struct {
+	mu   sync.Mutex
+	last string
+	hint string // the keys that expand it
+}
+
+// maxCollapsedLines is how many lines of a tool result are shown before it is collapsed
+const maxCollapsedLines = 12
+
+// events collapses long successful tool results and passes every event on to next
+func (c *collapsedOutput) events(next agent.EventHandler) agent.EventHandler {
+	return func(e agent.Event) {
+		lines := strings.Split(e.Text, "\n")
+		if e.Type == agent.EventToolResult && !e.IsError && len(lines) > maxCollapsedLines {
+			c.mu.Lock()
+			c.last = e.Text
+			c.mu.Unlock()
+			e.Text = fmt.Sprintf("%s\n\u001b[90m... %d more lines (%s to show them)\u001b[0m",
+				strings.Join(lines[:maxCollapsedLines], "\n"), len(lines)-maxCollapsedLines, c.hint)
+		}
+		next(e)
+	}
+}
+
+// expand prints the latest collapsed tool result in full
+func (c *collapsedOutput) expand() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last == "" {
+		fmt.Print("\u001b[90m(no collapsed tool output)\u001b[0m\n")
+		return
+	}
+	fmt.Println(c.last)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"strings"
+
+	"agent/pkg/agent"
+)
+
+// labelFlags collects the cost labels given with repeated -label flags
+type labelFlags []string
+
+func (l *labelFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *labelFlags) Set(value string) error {
+	if _, _, err := agent.ParseLabel(value); err != nil {
+		return err
+	}
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"agent/internal/keychain"
+	"agent/internal/oauth"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// apiKeyAccounts maps each provider to its keychain account and environment variable
+var apiKeyAccounts = map[string]struct{ account, env string }{
+	"anthropic": {"anthropic-api-key", "ANTHROPIC_API_KEY"},
+	"openai":    {"openai-api-key", "OPENAI_API_KEY"},
+}
+
+// oauthAccount is the keychain account holding the OAuth client config and token
+const oauthAccount = "anthropic-oauth"
+
+// oauthCredentials is what gets stored under oauthAccount; the config is kept so the
+// token can be refreshed without repeating the login flags
+type oauthCredentials struct {
+	Config oauth.Config `json:"config"`
+	Token  *oauth.Token `json:"token"`
+}
+
+// runLogin stores an API key in the OS keychain, or with -oauth signs in through the browser
+func runLogin(flags *flag.FlagSet) func() {
+	provider := flags.String("provider", "anthropic", "Provider the key belongs to: anthropic or openai.")
+	useOAuth := flags.Bool("oauth", false, "Sign in through the browser with OAuth instead of entering an API key.")
+	clientID := flags.String("client-id", os.Getenv("AGENT_OAUTH_CLIENT_ID"), "OAuth client ID.")
+	authURL := flags.String("auth-url", os.Getenv("AGENT_OAUTH_AUTH_URL"), "OAuth authorization endpoint.")
+	tokenURL := flags.String("token-url", os.Getenv("AGENT_OAUTH_TOKEN_URL"), "OAuth token endpoint.")
+	scopes := flags.String("scopes", os.Getenv("AGENT_OAUTH_SCOPES"), "Space-separated OAuth scopes to request.")
+	return func() {
+		if *useOAuth {
+			cfg := oauth.Config{ClientID: *clientID, AuthURL: *authURL, TokenURL: *tokenURL, Scopes: strings.Fields(*scopes)}
+			if cfg.ClientID == "" || cfg.AuthURL == "" || cfg.TokenURL == "" {
+				log.Fatal("Error: -oauth needs -client-id, -auth-url and -token-url (or the AGENT_OAUTH_* variables)")
+			}
+			transport, err := projectConfig().Network.Transport()
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			cfg.Transport = transport
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+			token, err := oauth.Login(ctx, cfg, openBrowser)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			if err := saveOAuth(oauthCredentials{Config: cfg, Token: token}); err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			log.Println("Logged in; the token is stored in the keychain and refreshed automatically")
+			return
+		}
+
+		entry, ok := apiKeyAccounts[*provider]
+		if !ok {
+			log.Fatalf("Error: unknown provider '%s'", *provider)
+		}
+		key, err := readSecret(fmt.Sprintf("%s API key: ", *provider))
+		if err != nil {
+			log.Fatalf("Error reading key: %s", err.Error())
+		}
+		if key == "" {
+			log.Fatal("Error: no key entered")
+		}
+		if err := keychain.Set(entry.account, key); err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		log.Printf("Stored the %s API key in the keychain; %s still takes precedence when set\n", *provider, entry.env)
+	}
+}
+
+// runLogout removes a stored API key from the OS keychain
+func runLogout(flags *flag.FlagSet) func() {
+	provider := flags.String("provider", "anthropic", "Provider whose key to remove: anthropic or openai.")
+	return func() {
+		entry, ok := apiKeyAccounts[*provider]
+		if !ok {
+			log.Fatalf("Error: unknown provider '%s'", *provider)
+		}
+		accounts := []string{entry.account}
+		if *provider == "anthropic" {
+			accounts = append(accounts, oauthAccount)
+		}
+		removed := false
+		for _, account := range accounts {
+			err := keychain.Delete(account)
+			if errors.Is(err, keychain.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			removed = true
+		}
+		if !removed {
+			log.Printf("No %s credentials stored\n", *provider)
+			return
+		}
+		log.Printf("Removed the %s credentials from the keychain\n", *provider)
+	}
+}
+
+// loadOAuth returns the stored OAuth credentials, or keychain.ErrNotFound
+func loadOAuth() (*oauthCredentials, error) {
+	stored, err := keychain.Get(oauthAccount)
+	if err != nil {
+		return nil, err
+	}
+	var creds oauthCredentials
+	if err := json.Unmarshal([]byte(stored), &creds); err != nil {
+		return nil, fmt.Errorf("stored OAuth credentials are corrupt; run `agent login -oauth` again: %w", err)
+	}
+	return &creds, nil
+}
+
+func saveOAuth(creds oauthCredentials) error {
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return fmt.Errorf("failed to encode OAuth credentials: %w", err)
+	}
+	return keychain.Set(oauthAccount, string(data))
+}
+
+// oauthMiddleware authenticates each API request with a fresh OAuth access token
+func oauthMiddleware(creds *oauthCredentials) option.Middleware {
+	source := oauth.NewSource(creds.Config, creds.Token, func(token *oauth.Token) error {
+		return saveOAuth(oauthCredentials{Config: creds.Config, Token: token})
+	})
+	return func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		token, err := source.AccessToken(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("failed to refresh OAuth token; run `agent login -oauth` again: %w", err)
+		}
+		req.Header.Del("X-Api-Key")
+		req.Header.Set("Authorization", "Bearer "+token)
+		return next(req)
+	}
+}
+
+// openBrowser prints the URL and tries to open it in the default browser
+func openBrowser(url string) error {
+	fmt.Fprintf(os.Stderr, "Open this URL to sign in:\n\n  %s\n\n", url)
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	// Failing to launch a browser is fine; the URL has been printed
+	cmd.Start()
+	return nil
+}
+
+// apiKey returns the provider's key from its environment variable, falling back to the keychain
+func apiKey(provider string) (string, error) {
+	entry := apiKeyAccounts[provider]
+	if key := os.Getenv(entry.env); key != "" {
+		return key, nil
+	}
+	key, err := keychain.Get(entry.account)
+	if errors.Is(err, keychain.ErrNotFound) {
+		return "", fmt.Errorf("%s is not set and no key is stored; run `agent login` or set the variable", entry.env)
+	}
+	return key, err
+}
+
+// readSecret prompts for a line of input, hiding it when stdin is a terminal
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// stty changes the terminal settings of stdin; it fails when stdin is not a terminal
+func stty(setting string) error {
+	cmd := exec.Command("stty", setting)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
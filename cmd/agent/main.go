@@ -1,37 +1,572 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
+	"agent/internal/metrics"
 	"agent/pkg/agent"
+	"agent/pkg/session"
 	"agent/pkg/tools"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 )
 
+// lowBandwidthToolResult is the tool result size limit in low-bandwidth mode
+const lowBandwidthToolResult = 4000
+
+// probeTimeout bounds the startup check of the model's features
+const probeTimeout = 15 * time.Second
+
+// command is a subcommand of the agent binary. define declares its flags on the set it
+// is given and returns the function that runs it once they are parsed, so the flags
+// can be listed for help and shell completion without running anything.
+type command struct {
+	name    string
+	aliases []string
+	summary string
+	define  func(flags *flag.FlagSet) func()
+}
+
+// commands returns the agent's subcommands. Without one, the agent runs the chat.
+func commands() []command {
+	return []command{
+		{name: "run", summary: "Chat with the agent, or run one prompt with -p. This is the default.", define: runChat},
+		{name: "worker", aliases: []string{"serve"}, summary: "Run tasks from a queue as non-interactive jobs.", define: runWorker},
+		{name: "patch-server", summary: "Serve inline edits to editors: POST a file, cursor and instruction, get a patch.", define: runPatchServer},
+		{name: "action", summary: "Handle a GitHub Actions event, replying on the issue or pull request.", define: runAction},
+		{name: "review", summary: "Review a GitHub, GitLab or Bitbucket pull request from CI and post the findings.", define: runReviewCommand},
+		{name: "sessions", summary: "List, show or delete stored sessions.", define: runSessions},
+		{name: "audit", summary: "Verify the audit log's hash chain and signatures, or create a signing key.", define: runAudit},
+		{name: "token", summary: "Issue capability tokens scoping worker tasks' tools, paths and budgets.", define: runToken},
+		{name: "stats", summary: "Summarise stored sessions: turns, tool calls and failures.", define: runStats},
+		{name: "eval", summary: "Run the evaluation suite against the agent.", define: runEval},
+		{name: "prompt-bench", summary: "Compare system prompts or config variants on the evaluation suite.", define: runPromptBench},
+		{name: "doctor", summary: "Check credentials, config, tools and the session store.", define: runDoctor},
+		{name: "setup", summary: "Install what the project needs on this machine.", define: runSetup},
+		{name: "onboard", summary: "Write an onboarding report for the project.", define: runOnboard},
+		{name: "resolve-conflicts", summary: "Resolve merge conflicts with the agent.", define: runResolveConflicts},
+		{name: "explain", summary: "Diagnose an error message or stack trace from the arguments or stdin.", define: runExplain},
+		{name: "bisect", summary: "Find the commit that broke a test and explain it.", define: runBisect},
+		{name: "scaffold", summary: "Generate a module from a template and wire it into the build.", define: runScaffold},
+		{name: "migrate", summary: "Write and check a database migration.", define: runMigrate},
+		{name: "capabilities", summary: "Print the agent's tools, models and features as JSON.", define: runCapabilities},
+		{name: "login", summary: "Store an API key or sign in with OAuth.", define: runLogin},
+		{name: "logout", summary: "Remove stored credentials.", define: runLogout},
+		{name: "update", summary: "Install the latest release, verifying its signature and checksum.", define: runUpdate},
+		{name: "telemetry", summary: "Show, enable or disable anonymous usage telemetry, or preview the report.", define: runTelemetry},
+		{name: "completion", summary: "Print a bash, zsh or fish completion script.", define: runCompletion},
+		{name: "help", summary: "List the commands.", define: runHelp},
+	}
+}
+
+// findCommand returns the command called name or one of its aliases
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands() {
+		if cmd.name == name || slices.Contains(cmd.aliases, name) {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// commandFlags creates cmd's flag set with its flags defined, and the function to run it
+func commandFlags(cmd command) (*flag.FlagSet, func()) {
+	flags := flag.NewFlagSet("agent "+cmd.name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: agent %s [flags]\n\n%s\n\nFlags:\n", cmd.name, cmd.summary)
+		flags.PrintDefaults()
+		if cmd.name == "run" {
+			fmt.Fprintln(flags.Output())
+			printCommands(flags.Output())
+		}
+	}
+	return flags, cmd.define(flags)
+}
+
 func main() {
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
-		log.Fatal("Error: ANTHROPIC_API_KEY environment variable not set.")
+	cmd, args := commands()[0], os.Args[1:]
+	if len(args) > 0 {
+		if found, ok := findCommand(args[0]); ok {
+			cmd, args = found, args[1:]
+		}
+	}
+	flags, run := commandFlags(cmd)
+	flags.Parse(args)
+	usageTelemetry().command(cmd.name)
+	run()
+	usageTelemetry().save()
+}
+
+// printCommands lists the commands with their summaries
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		name := cmd.name
+		if len(cmd.aliases) > 0 {
+			name += " (" + strings.Join(cmd.aliases, ", ") + ")"
+		}
+		fmt.Fprintf(w, "  %-22s %s\n", name, cmd.summary)
+	}
+}
+
+// runHelp lists the commands, or shows one command's flags
+func runHelp(flags *flag.FlagSet) func() {
+	return func() {
+		if flags.NArg() == 0 {
+			fmt.Println("Usage: agent [command] [flags]")
+			fmt.Println()
+			printCommands(os.Stdout)
+			return
+		}
+		cmd, ok := findCommand(flags.Arg(0))
+		if !ok {
+			log.Fatalf("Error: unknown command '%s'", flags.Arg(0))
+		}
+		help, _ := commandFlags(cmd)
+		help.SetOutput(os.Stdout)
+		help.Usage()
+	}
+}
+
+// runChat runs the interactive conversation loop, or a single prompt with -p
+func runChat(flags *flag.FlagSet) func() {
+	metricsAddr := flags.String("metrics-addr", "", "Address to serve Prometheus metrics on (e.g. :9090). Disabled when empty.")
+	shutdownTimeout := flags.Duration("shutdown-timeout", 30*time.Second, "How long to wait for the in-flight turn to finish after SIGINT/SIGTERM.")
+	sessionStore := flags.String("session-store", defaultSessionStore, "Where to persist sessions: a directory, redis://host:port/db or postgres://... URL. Empty disables persistence.")
+	encryptSessions := flags.String("encrypt-sessions", "", "Encrypt stored sessions with a key from the OS keychain (keychain) or from $AGENT_SESSION_PASSPHRASE (passphrase).")
+	resume := flags.String("resume", "", "ID of a stored session to resume.")
+	continueFrom := flags.String("continue-from", "", "ID of a stored session whose summary seeds a new session, instead of replaying its transcript.")
+	prompt := flags.String("p", "", "Run this prompt non-interactively, print the final answer and exit.")
+	maxTurns := flags.Int("max-turns", 0, "Maximum model calls per user message. Zero means no limit.")
+	lowBandwidth := flags.Bool("low-bandwidth", false, "Truncate tool results and compress stored sessions. Also enabled by network.low_bandwidth in the config.")
+	candidates := flags.Int("candidates", 1, "With -p, run this many isolated attempts in parallel git worktrees and present the best diff.")
+	check := flags.String("check", "", "Build or test command used to judge -candidates. Detected from the project when empty.")
+	samples := flags.Int("samples", 1, "With -p, answer a question (without editing) by sampling this many answers and having a judge pick and combine them.")
+	usageFile := flags.String("usage-file", "", "With -p, write the run's token usage as JSON to this file when it ends.")
+	viewer := flags.Bool("viewer", false, "Split the terminal and show the file being read or edited above the conversation, with edits highlighted.")
+	review := flags.Bool("review", false, "Show the edits in each model response as diff hunks and write only the ones you accept.")
+	phases := flags.Bool("phases", false, "Offer only read and search tools until the model calls begin_implementation, for each message.")
+	citations := flags.Bool("citations", false, "Ask the model to cite the tool results its answers rest on, for the footnotes of agent sessions show and export.")
+	systemPrompt := flags.String("system-prompt", "", "File sent as the system prompt, ahead of the project context, e.g. to try a prompt variant.")
+	contextFile := flags.String("context", defaultOnboardingPath, "File given to the model as standing project context, if it exists. Empty disables.")
+	fileHistory := flags.String("file-history", defaultFileHistory, "Directory each version of a file the tools read or write is stored in, for /show path@t12. Empty disables.")
+	artifacts := flags.String("artifacts", defaultArtifactDir, "Directory the model saves generated reports, diagrams and data files under, one subdirectory per session. Empty disables.")
+	dbURL := flags.String("db", "", "PostgreSQL URL of a database the model may inspect with the read-only db_schema and db_query tools.")
+	auditLog := flags.String("audit-log", defaultAuditLog, "File recording tool calls and the model's notices as JSON lines. Empty disables.")
+	language := flags.String("language", "", "Language the model replies in: auto to match each message, a name such as German, or off. Defaults to language in the config, then auto.")
+	draft := flags.String("draft", defaultDraftPath, "File an unfinished multi-line message is saved to as it is typed, and offered back on the next launch. Empty disables.")
+	lineEditor := flags.Bool("line-editor", true, "In interactive sessions on a terminal, edit input with history, search and the key bindings from the config.")
+	page := flags.Bool("pager", true, "In interactive sessions, page replies longer than the terminal, with search, instead of scrolling them past.")
+	probe := flags.Bool("probe", true, "Check at startup whether the model supports tools and images, and disable what it lacks.")
+	experimental := flags.String("experimental", "", "Comma-separated experiments to turn on, or off with a leading -, over the experimental section of the config, e.g. parallel_tools,-router_model.")
+	crashDir := flags.String("crash-reports", defaultCrashDir, "Directory a report is written to if the agent crashes, with file contents and secrets removed. Empty disables.")
+	var labels labelFlags
+	flags.Var(&labels, "label", "Cost label such as billing:team-x to attribute the session's tokens to in the stats. Repeat for several.")
+	subAgents := flags.Int("sub-agents", -1, "How many levels of sub-agents the model may start with the delegate tool, over sub_agents.max_depth in the config. Zero disables.")
+	allowSensitive := flags.Bool("allow-sensitive-dir", false, "Run with all tools even in a directory on the sensitive list, such as the home directory or /.")
+	chaosRate := flags.Float64("chaos", 0, "Testing: inject API 529s, tool timeouts and malformed tool results into this fraction of requests and tool calls, e.g. 0.1.")
+	chaosSeed := flags.Int64("chaos-seed", 1, "Seed for -chaos; the same seed injects the same faults.")
+	showVersion := flags.Bool("version", false, "Print the version and build details, and exit.")
+	return func() {
+		if *showVersion {
+			fmt.Println(versionString())
+			return
+		}
+		if *samples > 1 && *prompt == "" {
+			log.Fatal("Error: -samples requires -p.")
+		}
+		if (*review || *viewer) && *prompt != "" {
+			log.Fatal("Error: -review and -viewer need an interactive session and cannot be combined with -p.")
+		}
+		if *candidates > 1 {
+			if *prompt == "" {
+				log.Fatal("Error: -candidates requires -p.")
+			}
+			if err := runCandidates(*prompt, *candidates, *maxTurns, *check); err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			return
+		}
+
+		client := newClient()
+		*lowBandwidth = *lowBandwidth || projectConfig().Network.LowBandwidth
+		features := agent.AllFeatures
+		if *probe {
+			features = probeFeatures(client)
+		}
+
+		var metricsServer *http.Server
+		if *metricsAddr != "" {
+			metricsServer = serveMetrics(*metricsAddr)
+		}
+
+		input := newTerminalInput(os.Stdin)
+		var interactive []agent.Option
+		if *prompt == "" {
+			tools.SetPrompter(input)
+			interactive = append(interactive, agent.WithOfflineQueue(input.Confirm), agent.WithSteering(input.Pending), agent.WithStatusLine())
+			if *review {
+				interactive = append(interactive, agent.WithHunkReview(input.ReviewHunks))
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		trying, err := experiments(projectConfig(), *experimental)
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		opts := append([]agent.Option{agent.WithMaxTurns(*maxTurns), agent.WithFeatures(features), toolExamples(),
+			agent.WithNotifications(), agent.WithScratchpad(), agent.WithTraceSources(), agent.WithExperiments(trying)}, interactive...)
+		if lang := replyLanguage(*language); lang != "" {
+			opts = append(opts, agent.WithLanguage(lang))
+		}
+		if *lowBandwidth {
+			opts = append(opts, agent.WithMaxToolResult(lowBandwidthToolResult))
+		}
+		if *phases {
+			opts = append(opts, agent.WithPhases())
+		}
+		if *citations {
+			opts = append(opts, agent.WithCitations())
+		}
+		if *chaosRate > 0 {
+			opts = append(opts, agent.WithChaos(*chaosRate, *chaosSeed))
+		}
+		if c := sessionCapability(); c != nil {
+			if c.MaxTurns > 0 && (*maxTurns <= 0 || *maxTurns > c.MaxTurns) {
+				opts = append(opts, agent.WithMaxTurns(c.MaxTurns))
+			}
+			if c.Budget > 0 {
+				opts = append(opts, agent.WithTokenBudget(c.Budget))
+			}
+		}
+		projectContext, err := loadContext(*contextFile)
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		if *systemPrompt != "" {
+			text, err := os.ReadFile(*systemPrompt)
+			if err != nil {
+				log.Fatalf("Error reading system prompt: %s", err.Error())
+			}
+			projectContext = strings.TrimSpace(strings.Join([]string{strings.TrimSpace(string(text)), projectContext}, "\n\n"))
+		}
+		if projectContext != "" {
+			opts = append(opts, agent.WithSystemPrompt(projectContext))
+		}
+		// Voting runs several agents on one question, so they share none of the session state
+		voteOpts := slices.Clone(opts)
+		var sessionID string
+		if *sessionStore != "" {
+			store, err := openSessionStore(ctx, *sessionStore, *encryptSessions, *lowBandwidth)
+			if err != nil {
+				log.Fatalf("Error opening session store: %s", err.Error())
+			}
+			sess := session.New()
+			switch {
+			case *resume != "" && *continueFrom != "":
+				log.Fatal("Error: -resume and -continue-from cannot be combined.")
+			case *resume != "":
+				sess, err = store.Load(ctx, *resume)
+				if err != nil {
+					log.Fatalf("Error resuming session '%s': %s", *resume, sessionError(err))
+				}
+			case *continueFrom != "":
+				if err := seedSession(ctx, client, store, sess, *continueFrom); err != nil {
+					log.Fatalf("Error: %s", sessionError(err))
+				}
+			}
+			log.Printf("Session %s\n", sess.ID)
+			sessionID = sess.ID
+			opts = append(opts, agent.WithSession(store, sess))
+		} else if *resume != "" || *continueFrom != "" {
+			log.Fatal("Error: -resume and -continue-from require a session store.")
+		}
+		if len(labels) > 0 {
+			opts = append(opts, agent.WithLabels(labels))
+		}
+		if *artifacts != "" {
+			opts = append(opts, agent.WithArtifacts(*artifacts))
+		}
+		if *fileHistory != "" {
+			opts = append(opts, agent.WithFileHistory(*fileHistory))
+		}
+		depth := projectConfig().SubAgents.MaxDepth
+		if *subAgents >= 0 {
+			depth = *subAgents
+		}
+		if depth > 0 {
+			opts = append(opts, agent.WithSubAgents(depth, projectConfig().SubAgents.Budget))
+		}
+		handler := agent.LogEvents
+		if *page && *prompt == "" {
+			if p := newPager(input); p != nil {
+				handler = p.events(handler)
+			}
+		}
+		var bindings keyBindings
+		collapsed := &collapsedOutput{}
+		if *lineEditor && *prompt == "" && isTerminal(os.Stdin) {
+			bindings, err = parseKeyBindings(projectConfig().Keys)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			collapsed.hint = bindings.keysFor("expand")
+			if collapsed.hint != "" {
+				handler = collapsed.events(handler)
+			}
+		}
+		if *auditLog != "" {
+			auditFile, err := openAuditLog(*auditLog)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			defer auditFile.Close()
+			handler = auditEvents(handler, auditFile, sessionID)
+		}
+		if *viewer {
+			fileViewer, err := newFileViewer()
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			defer fileViewer.Close()
+			handler = fileViewer.events(handler)
+		}
+		var crashes *crashReporter
+		if *crashDir != "" {
+			var issueInput *terminalInput
+			if *prompt == "" && isTerminal(os.Stdin) {
+				issueInput = input
+			}
+			crashes = newCrashReporter(*crashDir, flags, issueInput)
+			handler = crashes.events(handler)
+		}
+		handler = usageTelemetry().events(handler)
+		opts = append(opts, agent.WithEventHandler(handler))
+
+		chatTools := projectTools()
+		if *dbURL != "" {
+			chatTools = append(chatTools, tools.DatabaseTools(*dbURL)...)
+		}
+		if !*allowSensitive {
+			var warning string
+			chatTools, warning, err = guardSensitiveDir(chatTools, projectConfig().SensitiveDirs)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			if warning != "" {
+				handler(agent.Event{Type: agent.EventNotice, Severity: agent.SeverityWarning, Text: warning})
+			}
+		}
+		readMessage := input.ReadMessage
+		if *prompt == "" && *draft != "" {
+			readMessage = newDrafts(input, *draft).ReadMessage
+		}
+		agentInstance := agent.NewAgent(client, readMessage, chatTools, opts...)
+		stopEditing := func() {}
+		if bindings != nil {
+			if stopEditing, err = input.startEditing(bindings, collapsed.expand); err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+		}
+		if crashes != nil {
+			crashes.cleanup = stopEditing
+			defer crashes.recover()
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			if crashes != nil {
+				defer crashes.recover()
+			}
+			if *prompt == "" {
+				done <- agentInstance.Run(ctx)
+				return
+			}
+			var answer string
+			var err error
+			if *samples > 1 {
+				answer, err = answerByVote(ctx, *prompt, *samples, voteOpts...)
+			} else {
+				answer, err = agentInstance.RunTask(ctx, *prompt)
+			}
+			fmt.Println(answer)
+			if *usageFile != "" {
+				writeUsage(*usageFile, agentInstance.Usage())
+			}
+			done <- err
+		}()
+
+		exitCode := 0
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("Agent exited with error: %s\n", err.Error())
+				exitCode = 1
+			}
+		case sig := <-notifyShutdown():
+			log.Printf("Received %s, finishing the current turn (up to %s, signal again to force)\n", sig, *shutdownTimeout)
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), *shutdownTimeout)
+			defer cancelShutdown()
+			if err := agentInstance.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Turn did not finish before the shutdown deadline: %s\n", err.Error())
+			}
+			cancel()
+		}
+		stopEditing()
+		listArtifacts(agentInstance)
+		if tree := agentInstance.SubAgentTree(); tree != "" {
+			log.Printf("Sub-agents:\n%s\n", tree)
+		}
+
+		if metricsServer != nil {
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), *shutdownTimeout)
+			defer cancelShutdown()
+			if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Error stopping metrics server: %s\n", err.Error())
+			}
+		}
+		if exitCode != 0 {
+			usageTelemetry().save()
+			os.Exit(exitCode)
+		}
 	}
-	client := anthropic.NewClient(option.WithAPIKey(apiKey))
+}
 
-	scanner := bufio.NewScanner(os.Stdin)
+// writeUsage saves usage as JSON for the process that started this one
+func writeUsage(path string, usage agent.Usage) {
+	data, err := json.Marshal(usage)
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		log.Printf("Error writing usage to '%s': %s\n", path, err.Error())
+	}
+}
 
-	var getUserMessage agent.MessageHandler = func() (string, bool) {
-		if !scanner.Scan() {
-			return "", false
+// seedSession bootstraps sess with the summary of the stored session previousID,
+// generating and caching the summary if needed
+func seedSession(ctx context.Context, client *anthropic.Client, store session.Store, sess *session.Session, previousID string) error {
+	previous, err := store.Load(ctx, previousID)
+	if err != nil {
+		return fmt.Errorf("failed to load session '%s': %w", previousID, err)
+	}
+	cached := previous.Summary != "" && previous.SummaryCovers == len(previous.Messages)
+	if !cached {
+		log.Printf("Summarizing session %s\n", previousID)
+	}
+	summary, err := agent.Summarize(ctx, client, previous)
+	if err != nil {
+		return err
+	}
+	if !cached {
+		if err := store.Save(ctx, previous); err != nil {
+			log.Printf("Error caching summary of session '%s': %s\n", previousID, err.Error())
 		}
-		return scanner.Text(), true
 	}
+	sess.SeededFrom = previousID
+	sess.Seed = summary
+	sess.Kept = agent.Preserved(previous)
+	fmt.Printf("\u001b[1mContinuing from %s\u001b[0m\n%s\n\n", previousID, summary)
+	return store.Save(ctx, sess)
+}
 
-	agentInstance := agent.NewAgent(&client, getUserMessage, tools.GetTools())
-	err := agentInstance.Run(context.TODO())
+// newClient builds the Anthropic client, authenticating with the API key from the
+// environment or keychain, or else with the OAuth token saved by `agent login -oauth`.
+// The transport and endpoint follow the network section of the config file.
+func newClient() *anthropic.Client {
+	cfg := projectConfig()
+	transport, err := cfg.Network.Transport()
 	if err != nil {
-		log.Printf("Agent exited with error: %s\n", err.Error())
+		log.Fatalf("Error: %s", err.Error())
+	}
+	opts := []option.RequestOption{option.WithHTTPClient(&http.Client{Transport: transport})}
+	baseURL := cfg.Network.BaseURL
+	if env := os.Getenv("ANTHROPIC_BASE_URL"); env != "" {
+		baseURL = env
+	}
+	if baseURL != "" {
+		opts = append(opts, option.WithBaseURL(baseURL))
 	}
-}
\ No newline at end of file
+
+	key, err := apiKey("anthropic")
+	if err == nil {
+		opts = append(opts, option.WithAPIKey(key))
+	} else if creds, oauthErr := loadOAuth(); oauthErr == nil {
+		creds.Config.Transport = transport
+		opts = append(opts, option.WithMiddleware(oauthMiddleware(creds)))
+	} else {
+		log.Fatalf("Error: %s", err.Error())
+	}
+	client := anthropic.NewClient(opts...)
+	return &client
+}
+
+// replyLanguage resolves the -language flag against the config, returning the empty
+// string when the model is left to choose
+func replyLanguage(flagValue string) string {
+	language := flagValue
+	if language == "" {
+		language = projectConfig().Language
+	}
+	switch strings.ToLower(language) {
+	case "", agent.LanguageAuto:
+		return agent.LanguageAuto
+	case "off":
+		return ""
+	}
+	return language
+}
+
+// probeFeatures detects which optional features DefaultModel supports through client
+func probeFeatures(client *anthropic.Client) agent.Features {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	return agent.ProbeFeatures(ctx, client, agent.DefaultModel)
+}
+
+// notifyShutdown returns a channel receiving the first SIGINT/SIGTERM. A second
+// signal exits immediately.
+func notifyShutdown() <-chan os.Signal {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	first := make(chan os.Signal, 1)
+	go func() {
+		first <- <-signals
+		<-signals
+		log.Println("Forced exit")
+		os.Exit(1)
+	}()
+	return first
+}
+
+// serveMetrics exposes the Prometheus metrics endpoint on addr in the background
+func serveMetrics(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		log.Printf("Serving metrics on %s/metrics\n", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server stopped: %s\n", err.Error())
+		}
+	}()
+	return server
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"agent/pkg/agent"
+	"agent/pkg/tools"
+)
+
+// migrationFramework describes how a project's migrations are laid out and applied
+type migrationFramework struct {
+	name string
+	dir  string
+	// apply runs pending migrations against $DATABASE_URL
+	apply string
+}
+
+// migrationDirs are the usual places for migration files
+var migrationDirs = []string{"migrations", "db/migrations", "db/migrate", "sql/migrations", "database/migrations", "internal/db/migrations", "alembic/versions", "prisma/migrations"}
+
+// detectMigrations identifies the migration framework from the project's files
+func detectMigrations() (migrationFramework, bool) {
+	switch {
+	case fileExists("prisma/schema.prisma"):
+		return migrationFramework{"Prisma", "prisma/migrations", "npx prisma migrate deploy"}, true
+	case fileExists("alembic.ini"):
+		return migrationFramework{"Alembic", "alembic/versions", "alembic upgrade head"}, true
+	case fileExists("bin/rails") && fileExists("db/migrate"):
+		return migrationFramework{"Rails", "db/migrate", "bin/rails db:migrate"}, true
+	case fileExists("manage.py"):
+		return migrationFramework{"Django", "", "python manage.py migrate"}, true
+	}
+	for _, dir := range migrationDirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.sql"))
+		if len(files) == 0 {
+			continue
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err == nil && strings.Contains(string(content), "-- +goose Up") {
+				return migrationFramework{"goose", dir, fmt.Sprintf(`goose -dir %s postgres "$DATABASE_URL" up`, dir)}, true
+			}
+		}
+		if ups, _ := filepath.Glob(filepath.Join(dir, "*.up.sql")); len(ups) > 0 {
+			return migrationFramework{"golang-migrate", dir, fmt.Sprintf(`migrate -path %s -database "$DATABASE_URL" up`, dir)}, true
+		}
+		return migrationFramework{"plain SQL", dir, ""}, true
+	}
+	return migrationFramework{}, false
+}
+
+// runMigrate writes a migration for the described change with the agent, applies it to
+// a scratch database and runs the tests against it, feeding failures back for fixes
+func runMigrate(flags *flag.FlagSet) func() {
+	dbURL := flags.String("db", os.Getenv("DATABASE_URL"), "PostgreSQL URL of the database whose schema is inspected. Never migrated.")
+	scratchURL := flags.String("scratch-db", os.Getenv("AGENT_SCRATCH_DATABASE_URL"), "PostgreSQL URL of a disposable database the migration is applied to.")
+	apply := flags.String("apply", "", "Command that applies pending migrations to $DATABASE_URL. Detected from the framework when empty.")
+	reset := flags.String("reset", "", "Command run before each attempt to restore the scratch database, e.g. dropdb/createdb and restoring a dump.")
+	test := flags.String("test", "", "Command that verifies the migrated scratch database. Detected from the project when empty.")
+	attempts := flags.Int("attempts", 3, "How many times a failed migration is sent back to the model for a fix.")
+	maxTurns := flags.Int("max-turns", 40, "Maximum model calls per attempt.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: agent migrate [flags] <description of the schema change>")
+		flags.PrintDefaults()
+	}
+	return func() {
+		change := strings.Join(flags.Args(), " ")
+		switch {
+		case change == "":
+			flags.Usage()
+			os.Exit(2)
+		case *dbURL == "" || *scratchURL == "":
+			log.Fatal("Error: -db and -scratch-db (or $DATABASE_URL and $AGENT_SCRATCH_DATABASE_URL) are required")
+		case *dbURL == *scratchURL:
+			log.Fatal("Error: the scratch database must not be the inspected database")
+		}
+
+		framework, ok := detectMigrations()
+		if !ok {
+			if *apply == "" {
+				log.Fatal("Error: no migrations found; pass -apply with the command that applies them")
+			}
+			framework = migrationFramework{name: "custom"}
+		}
+		if *apply == "" {
+			*apply = framework.apply
+		}
+		if *apply == "" {
+			log.Fatalf("Error: %s migrations have no standard runner; pass -apply", framework.name)
+		}
+		if *test == "" {
+			*test = detectTestCommand()
+		}
+		log.Printf("Migrations: %s in %s, applied with: %s\n", framework.name, displayDir(framework), *apply)
+
+		ctx := context.Background()
+		before := migrationFiles(framework.dir)
+		migrationTools := append(projectTools(), tools.DatabaseTools(*dbURL)...)
+		opts := []agent.Option{agent.WithMaxTurns(*maxTurns), agent.WithMaxTokens(8192), toolExamples()}
+
+		prompt := fmt.Sprintf("Write a database migration for this change: %s\n\n"+
+			"The project uses %s migrations in %s. Inspect the current schema with db_schema first, and read "+
+			"the existing migrations to match their naming, numbering and style exactly; include a down "+
+			"migration if the existing ones have one. Only add new migration files (and model or schema files "+
+			"the framework requires); never edit migrations that already exist, and do not run anything. "+
+			"Finish with the paths you created and a one-paragraph summary.",
+			change, framework.name, displayDir(framework))
+		if recent := recentMigrations(before, 3); recent != "" {
+			prompt += "\n\nThe most recent migrations:\n" + recent
+		}
+
+		for attempt := 1; ; attempt++ {
+			migrator := agent.NewAgent(newClient(), nil, migrationTools, opts...)
+			summary, err := migrator.RunTask(ctx, prompt)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			fmt.Printf("\u001b[1mProposed migration\u001b[0m\n%s\n", summary)
+			created := newFiles(before, migrationFiles(framework.dir))
+
+			stage, output, ok := verifyMigration(*reset, *apply, *test, *scratchURL)
+			if ok {
+				if *test != "" {
+					log.Println("\u001b[92mMigration applied to the scratch database and the tests passed\u001b[0m")
+				} else {
+					log.Println("\u001b[92mMigration applied to the scratch database\u001b[0m (no test command detected; pass -test)")
+				}
+				for _, file := range created {
+					fmt.Println(file)
+				}
+				log.Println("Review the files, then apply them to real databases with your usual process")
+				return
+			}
+			log.Printf("\u001b[91m%s failed\u001b[0m (attempt %d of %d)\n", stage, attempt, *attempts)
+			if attempt >= *attempts {
+				fmt.Println(output)
+				log.Fatal("Error: giving up; the generated files are left in place for you to fix")
+			}
+			prompt = fmt.Sprintf("A migration was written for this change: %s\n\nThe new files are: %s\n\n"+
+				"When it was checked against a scratch database, %s failed:\n```\n%s\n```\n\n"+
+				"Fix the new migration files (not existing ones) so it succeeds. Use db_schema to check the current "+
+				"production schema. Finish with a one-paragraph summary of the fix.",
+				change, strings.Join(created, ", "), stage, output)
+		}
+	}
+}
+
+// verifyMigration resets the scratch database, applies the migrations to it and runs
+// the tests. On failure it returns the stage that failed and its output.
+func verifyMigration(reset, apply, test, scratchURL string) (string, string, bool) {
+	env := append(os.Environ(), "DATABASE_URL="+scratchURL)
+	stages := []struct{ name, command string }{
+		{"resetting the scratch database", reset},
+		{"applying the migration", apply},
+		{"the tests", test},
+	}
+	for _, stage := range stages {
+		if stage.command == "" {
+			continue
+		}
+		log.Printf("Running %s: %s\n", stage.name, stage.command)
+		cmd := exec.Command("sh", "-c", stage.command)
+		cmd.Env = env
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			output := string(out)
+			if len(output) > maxTestOutput {
+				output = "..." + output[len(output)-maxTestOutput:]
+			}
+			return stage.name, output + err.Error(), false
+		}
+	}
+	return "", "", true
+}
+
+// migrationFiles lists the files under dir, or the whole project when dir is empty
+func migrationFiles(dir string) []string {
+	if dir == "" {
+		dir = "."
+	}
+	var files []string
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == ".agent" || d.Name() == "node_modules") {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// newFiles returns the files in after that are not in before
+func newFiles(before, after []string) []string {
+	var created []string
+	for _, file := range after {
+		if !slices.Contains(before, file) {
+			created = append(created, file)
+		}
+	}
+	return created
+}
+
+// recentMigrations returns the names of the last n migration files, which sort by
+// their timestamp or sequence prefix
+func recentMigrations(files []string, n int) string {
+	var migrations []string
+	for _, file := range files {
+		if strings.Contains(filepath.ToSlash(file), "migrat") {
+			migrations = append(migrations, file)
+		}
+	}
+	slices.Sort(migrations)
+	if len(migrations) > n {
+		migrations = migrations[len(migrations)-n:]
+	}
+	return strings.Join(migrations, "\n")
+}
+
+// displayDir describes where the framework keeps its migrations
+func displayDir(framework migrationFramework) string {
+	switch {
+	case framework.dir != "":
+		return framework.dir
+	case framework.name == "custom":
+		return "the directory the existing migrations use"
+	default:
+		return "each app's migrations directory"
+	}
+}
+
+// detectTestCommand guesses the project's test command from its manifest files
+func detectTestCommand() string {
+	candidates := []struct{ file, command string }{
+		{"go.mod", "go test ./..."},
+		{"Cargo.toml", "cargo test"},
+		{"package.json", "npm test"},
+		{"manage.py", "python manage.py test"},
+		{"bin/rails", "bin/rails test"},
+		{"pyproject.toml", "pytest"},
+		{"Makefile", "make test"},
+	}
+	for _, c := range candidates {
+		if fileExists(c.file) {
+			return c.command
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"agent/pkg/agent"
+)
+
+// defaultOnboardingPath is where `agent onboard` writes its report and where chat
+// sessions look for it as standing context
+const defaultOnboardingPath = ".agent/onboarding.md"
+
+// runOnboard explores the repository and writes an architecture summary for newcomers
+func runOnboard(flags *flag.FlagSet) func() {
+	output := flags.String("o", defaultOnboardingPath, "File to write the report to.")
+	maxTurns := flags.Int("max-turns", 40, "Maximum model calls while exploring.")
+	return func() {
+		hint := ""
+		if command := detectBuildCommand(); command != "" {
+			hint = fmt.Sprintf(" A manifest suggests the build command is `%s`; confirm it and find the test command.", command)
+		}
+		prompt := "You are onboarding a new contributor to the repository in the working directory. " +
+			"Explore it with your tools: read the README and manifests, list the directory layout, and open the " +
+			"main entry points and core packages." + hint + "\n\n" +
+			"Then reply with only a Markdown report with these sections: Overview, Directory layout, Entry points, " +
+			"Building and testing (exact commands), Key abstractions (the central types and interfaces and how " +
+			"they fit together), Conventions, and Where to start. Reference real paths and identifiers, keep it " +
+			"concise, and do not modify any files."
+
+		explorer := agent.NewAgent(newClient(), nil, readOnlyTools(), agent.WithMaxTurns(*maxTurns), agent.WithMaxTokens(8192), toolExamples())
+		report, err := explorer.RunTask(context.Background(), prompt)
+		if err != nil {
+			log.Fatalf("Error exploring the repository: %s", err.Error())
+		}
+
+		if err := os.MkdirAll(filepath.Dir(*output), 0755); err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		if err := os.WriteFile(*output, []byte(strings.TrimSpace(report)+"\n"), 0644); err != nil {
+			log.Fatalf("Error writing '%s': %s", *output, err.Error())
+		}
+		log.Printf("Wrote onboarding report to %s\n", *output)
+	}
+}
+
+// loadContext reads the standing project context given to chat sessions. A missing
+// file is not an error, so the default path can be used before `agent onboard` has run.
+func loadContext(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read context file '%s': %w", path, err)
+	}
+	return fmt.Sprintf("Project context from %s:\n\n%s", path, content), nil
+}
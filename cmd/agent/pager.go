@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"agent/pkg/agent"
+)
+
+// pager shows model replies longer than the terminal one screen at a time, taking its
+// commands from the same line input as the chat so nothing else competes for the
+// keyboard. The full reply stays in the transcript either way.
+type pager struct {
+	input *terminalInput
+	rows  int
+}
+
+// newPager returns a pager sized to the terminal, or nil when stdout is not a terminal
+// and output should flow unpaged
+func newPager(input *terminalInput) *pager {
+	if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	var rows, cols int
+	if err != nil {
+		return nil
+	}
+	if _, err := fmt.Sscan(string(out), &rows, &cols); err != nil || rows < 10 {
+		return nil
+	}
+	return &pager{input: input, rows: rows}
+}
+
+// events pages long model text and passes everything else on to next
+func (p *pager) events(next agent.EventHandler) agent.EventHandler {
+	return func(e agent.Event) {
+		lines := strings.Split(strings.TrimRight(e.Text, "\n"), "\n")
+		if e.Type != agent.EventText || len(lines) <= p.rows-2 {
+			next(e)
+			return
+		}
+		log.Printf("%s\u001b[93mClaude\u001b[0m: (%d lines)\n", e.Label(false), len(lines))
+		p.page(lines)
+	}
+}
+
+// page prints lines a screen at a time. Enter shows the next screen, b the previous
+// one, /text jumps to the next line containing text, n repeats the search and q
+// skips the rest.
+func (p *pager) page(lines []string) {
+	height := p.rows - 2
+	top, search := 0, ""
+	for {
+		end := min(top+height, len(lines))
+		for _, line := range lines[top:end] {
+			fmt.Println(highlight(line, search))
+		}
+		if end == len(lines) {
+			return
+		}
+		command, err := p.input.answer(fmt.Sprintf("\u001b[7m lines %d-%d of %d: Enter more, b back, /text search, n next match, q skip \u001b[0m ", top+1, end, len(lines)))
+		if err != nil {
+			// Nobody is left to page for, so show the rest
+			for _, line := range lines[end:] {
+				fmt.Println(line)
+			}
+			return
+		}
+		command = strings.TrimSpace(command)
+		switch {
+		case command == "q":
+			return
+		case command == "b":
+			top = max(0, top-height)
+		case strings.HasPrefix(command, "/") || command == "n":
+			if command != "n" {
+				search = command[1:]
+			}
+			match := -1
+			for i := top + 1; i < len(lines) && search != ""; i++ {
+				if strings.Contains(strings.ToLower(lines[i]), strings.ToLower(search)) {
+					match = i
+					break
+				}
+			}
+			if match < 0 {
+				fmt.Printf("\u001b[90m(no further match for %q)\u001b[0m\n", search)
+				top = end - height
+				continue
+			}
+			top = match
+		default:
+			top = end
+		}
+	}
+}
+
+// highlight shows occurrences of search in line in reverse video
+func highlight(line, search string) string {
+	if search == "" {
+		return line
+	}
+	lower, needle := strings.ToLower(line), strings.ToLower(search)
+	var b strings.Builder
+	for {
+		i := strings.Index(lower, needle)
+		if i < 0 {
+			b.WriteString(line)
+			return b.String()
+		}
+		b.WriteString(line[:i] + "\u001b[7m" + line[i:i+len(needle)] + "\u001b[27m")
+		line, lower = line[i+len(needle):], lower[i+len(needle):]
+	}
+}
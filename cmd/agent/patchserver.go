@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"agent/pkg/agent"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// maxPatchRequest bounds the size of a file an editor may post
+const maxPatchRequest = 4 << 20
+
+// runPatchServer serves POST /patch for editor integrations: the editor sends a file,
+// cursor and instruction, and gets back a patch for the function around the cursor,
+// from a single tool-free model call
+func runPatchServer(flags *flag.FlagSet) func() {
+	addr := flags.String("addr", "127.0.0.1:7077", "Address to listen on. Keep it on loopback unless -token is set.")
+	token := flags.String("token", os.Getenv("AGENT_PATCH_TOKEN"), "Bearer token editors must send, if set. Defaults to $AGENT_PATCH_TOKEN.")
+	timeout := flags.Duration("timeout", 60*time.Second, "Deadline for each patch.")
+	return func() {
+		client := newClient()
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /patch", func(w http.ResponseWriter, r *http.Request) {
+			servePatch(w, r, client, *token, *timeout)
+		})
+		mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok\n"))
+		})
+		log.Printf("Serving patches on http://%s/patch\n", *addr)
+		if err := http.ListenAndServe(*addr, mux); err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+	}
+}
+
+// servePatch handles one patch request, replying with the patch or {"error": ...}
+func servePatch(w http.ResponseWriter, r *http.Request, client *anthropic.Client, token string, timeout time.Duration) {
+	reply := func(status int, body any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+	fail := func(status int, message string) {
+		reply(status, map[string]string{"error": message})
+	}
+	if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		fail(http.StatusUnauthorized, "missing or wrong bearer token")
+		return
+	}
+	// Without a token, a web page could post here. Pages cannot send JSON without a
+	// preflight this server never answers, browsers mark their requests with Origin,
+	// and a loopback Host rules out DNS rebinding.
+	if r.Header.Get("Origin") != "" {
+		fail(http.StatusForbidden, "requests from web pages are not accepted")
+		return
+	}
+	if token == "" && !isLoopbackHost(r.Host) {
+		fail(http.StatusForbidden, "without -token, only requests to a loopback host are accepted")
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		fail(http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+	var req agent.PatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPatchRequest)).Decode(&req); err != nil {
+		fail(http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	start := time.Now()
+	patch, err := agent.GeneratePatch(ctx, client, req)
+	if err != nil {
+		log.Printf("Error patching '%s': %s\n", req.Path, err.Error())
+		fail(http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	log.Printf("Patched %s:%d-%d in %s\n", patch.Path, patch.StartLine, patch.EndLine, time.Since(start).Round(time.Millisecond))
+	reply(http.StatusOK, patch)
+}
+
+// isLoopbackHost reports whether the Host header names this machine: localhost or a
+// loopback address, with or without a port
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"agent/internal/config"
+	"agent/internal/policy"
+	"agent/pkg/tools"
+)
+
+// toolPolicy returns an authorizer checking each tool call against the configured
+// Rego policy. It exits if the policy cannot be used at all, rather than run unchecked.
+func toolPolicy(cfg config.Policy) tools.Authorizer {
+	files := make([]string, len(cfg.Files))
+	for i, file := range cfg.Files {
+		files[i] = expandHome(filepath.FromSlash(file))
+	}
+	engine, err := policy.New(cfg.URL, files, cfg.Query)
+	if err != nil {
+		log.Fatalf("Error: %s", err.Error())
+	}
+	workspace, _ := os.Getwd()
+	name := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	return func(tool tools.ToolDefinition, input json.RawMessage) error {
+		var fields struct {
+			Path    string `json:"path"`
+			Command string `json:"command"`
+			Name    string `json:"name"`
+		}
+		json.Unmarshal(input, &fields)
+		if tool.Name == "run_action" {
+			// The model names an action; the policy judges the command it runs
+			for _, action := range projectActions() {
+				if action.Name == fields.Name {
+					fields.Command = action.Command
+				}
+			}
+		}
+		return engine.Decide(policy.Input{
+			Tool:      tool.Name,
+			Mutating:  tool.Mutating,
+			Path:      fields.Path,
+			Command:   fields.Command,
+			Arguments: input,
+			User:      name,
+			Workspace: workspace,
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent/pkg/eval"
+)
+
+// defaultBenchCache is where prompt-bench keeps results to warm-start the next run
+const defaultBenchCache = ".agent/prompt-bench.json"
+
+// runPromptBench runs the evaluation suite against each variant of the system prompt
+// or configuration and compares their pass rate, cost and latency. Results are cached
+// by variant and task, so only what changed since the last run is run again.
+func runPromptBench(flags *flag.FlagSet) func() {
+	suitePath := flags.String("suite", "", "Suite file listing the tasks. Defaults to the bench file's suite, then evals/suite.yaml.")
+	repeat := flags.Int("repeat", 0, "Runs per task and variant. Defaults to the bench file's repeat, then 3.")
+	concurrency := flags.Int("concurrency", 1, "Task runs executed in parallel.")
+	timeout := flags.Duration("timeout", 10*time.Minute, "Time limit for tasks that do not set one.")
+	cachePath := flags.String("cache", defaultBenchCache, "File results are cached in, to reuse for unchanged variants. Empty disables.")
+	fresh := flags.Bool("fresh", false, "Run everything again, ignoring cached results.")
+	jsonOut := flags.String("json", "", "Also write every result, by variant, as JSON to this file.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: agent prompt-bench [flags] <bench.yaml | system-prompt-file...>")
+		flags.PrintDefaults()
+	}
+	return func() {
+		bench, err := loadBench(flags.Args())
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		if *suitePath != "" {
+			bench.Suite = *suitePath
+		}
+		if bench.Suite == "" {
+			bench.Suite = "evals/suite.yaml"
+		}
+		if *repeat > 0 {
+			bench.Repeat = *repeat
+		}
+		if bench.Repeat <= 0 {
+			bench.Repeat = 3
+		}
+		suite, err := eval.LoadSuite(bench.Suite)
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			log.Fatalf("Error locating the agent executable: %s", err.Error())
+		}
+		cache := eval.Cache{}
+		if *cachePath != "" && !*fresh {
+			if cache, err = eval.LoadCache(*cachePath); err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+		}
+
+		byVariant := map[string][]eval.Result{}
+		cached := map[string]int{}
+		for _, variant := range bench.Variants {
+			args, err := variant.AgentArgs()
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			keys := map[string]string{}
+			pending := &eval.Suite{Dir: suite.Dir}
+			for _, task := range suite.Tasks {
+				key, err := variant.Key(suite, task)
+				if err != nil {
+					log.Fatalf("Error: %s", err.Error())
+				}
+				keys[task.Name] = key
+				if results := cache[key]; len(results) >= bench.Repeat {
+					byVariant[variant.Name] = append(byVariant[variant.Name], results[:bench.Repeat]...)
+					cached[variant.Name] += bench.Repeat
+					continue
+				}
+				pending.Tasks = append(pending.Tasks, task)
+			}
+			if len(pending.Tasks) == 0 {
+				log.Printf("%s: all %d tasks cached\n", variant.Name, len(suite.Tasks))
+				continue
+			}
+			runner := &eval.Runner{
+				Executable:  exe,
+				Repeat:      bench.Repeat,
+				Concurrency: *concurrency,
+				Timeout:     *timeout,
+				Args:        args,
+				Progress: func(r eval.Result) {
+					status := "\u001b[92mpass\u001b[0m"
+					if !r.Passed {
+						status = "\u001b[91mfail\u001b[0m"
+					}
+					log.Printf("%s: %s #%d: %s ($%.4f, %.0fs) %s\n", variant.Name, r.Task, r.Run, status, r.Cost, r.Duration, r.Error)
+				},
+			}
+			results := runner.Run(context.Background(), pending)
+			byVariant[variant.Name] = append(byVariant[variant.Name], results...)
+			for _, r := range results {
+				key := keys[r.Task]
+				if r.Run == 1 {
+					cache[key] = nil
+				}
+				cache[key] = append(cache[key], r)
+			}
+			if *cachePath != "" {
+				if err := cache.Save(*cachePath); err != nil {
+					log.Printf("Error: %s\n", err.Error())
+				}
+			}
+		}
+
+		if *jsonOut != "" {
+			data, _ := json.MarshalIndent(byVariant, "", "  ")
+			if err := os.WriteFile(*jsonOut, data, 0644); err != nil {
+				log.Fatalf("Error writing '%s': %s", *jsonOut, err.Error())
+			}
+		}
+		printBench(bench.Variants, suite, byVariant, cached)
+	}
+}
+
+// loadBench reads the variants from a bench file, or makes one variant per system
+// prompt file, compared against the agent's default prompt
+func loadBench(args []string) (*eval.Bench, error) {
+	if len(args) == 1 && (strings.HasSuffix(args[0], ".yaml") || strings.HasSuffix(args[0], ".yml")) {
+		return eval.LoadBench(args[0])
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("pass a bench file or system prompt files to compare")
+	}
+	bench := &eval.Bench{Variants: []eval.Variant{{Name: "default"}}}
+	for _, path := range args {
+		if !fileExists(path) {
+			return nil, fmt.Errorf("system prompt file '%s' does not exist", path)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		bench.Variants = append(bench.Variants, eval.Variant{Name: name, SystemPrompt: path})
+	}
+	return bench, eval.CheckVariants(bench.Variants)
+}
+
+// printBench reports each variant's totals, then the pass rate of each task by variant
+func printBench(variants []eval.Variant, suite *eval.Suite, byVariant map[string][]eval.Result, cached map[string]int) {
+	fmt.Printf("\n%-20s %9s %6s %10s %10s %9s %7s\n", "VARIANT", "PASS", "RATE", "COST/RUN", "TOKENS", "LATENCY", "CACHED")
+	for _, v := range variants {
+		results := byVariant[v.Name]
+		if len(results) == 0 {
+			continue
+		}
+		// Summarize one group holding all the variant's runs
+		all := make([]eval.Result, len(results))
+		for i, r := range results {
+			r.Task = v.Name
+			all[i] = r
+		}
+		s := eval.Summarize(all)[0]
+		fmt.Printf("%-20s %4d/%-4d %5.0f%% $%9.4f %10d %8.0fs %7d\n", v.Name, s.Passed, s.Runs, 100*s.PassRate, s.Cost, s.Tokens, s.Duration, cached[v.Name])
+	}
+	if len(suite.Tasks) < 2 {
+		return
+	}
+	fmt.Printf("\n%-30s", "TASK")
+	for _, v := range variants {
+		fmt.Printf(" %12.12s", v.Name)
+	}
+	fmt.Println()
+	rates := map[string]map[string]eval.Summary{}
+	for _, v := range variants {
+		rates[v.Name] = map[string]eval.Summary{}
+		for _, s := range eval.Summarize(byVariant[v.Name]) {
+			rates[v.Name][s.Task] = s
+		}
+	}
+	for _, task := range suite.Tasks {
+		fmt.Printf("%-30s", task.Name)
+		for _, v := range variants {
+			s := rates[v.Name][task.Name]
+			fmt.Printf(" %12s", fmt.Sprintf("%d/%d", s.Passed, s.Runs))
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"agent/internal/forge"
+	"agent/pkg/agent"
+	"agent/pkg/tools"
+)
+
+// maxReviewDiff bounds how much of the diff is inlined into the review prompt
+const maxReviewDiff = 100_000
+
+type reviewCommentInput struct {
+	Path       string  `json:"path" jsonschema_description:"File path relative to the repository root, as shown in the diff."`
+	Line       int     `json:"line" jsonschema_description:"Last line, numbered in the new version of the file, that the comment applies to."`
+	StartLine  int     `json:"start_line,omitempty" jsonschema_description:"First line of a multi-line range. Omit for a single line."`
+	Body       string  `json:"body" jsonschema_description:"The finding, written for the pull request author."`
+	Suggestion *string `json:"suggestion,omitempty" jsonschema_description:"Exact replacement text for lines start_line through line, preserving indentation. Omit when there is no concrete fix."`
+}
+
+// runReview reviews the checked-out pull or merge request and posts the findings as a
+// review on f, using suggestions so fixes can be applied with one click
+func runReview(ctx context.Context, f forge.Forge, number int, request string, opts ...agent.Option) error {
+	pr, err := f.GetChangeRequest(ctx, number)
+	if err != nil {
+		return err
+	}
+	if _, err := git("fetch", "origin", pr.BaseRef); err != nil {
+		return err
+	}
+	diff, err := git("diff", "FETCH_HEAD...HEAD")
+	if err != nil {
+		return err
+	}
+	lines := forge.ParseDiffLines(diff)
+
+	var inDiff, outside []forge.ReviewComment
+	reviewTool := tools.New("submit_review_comment",
+		"Record one review finding on lines changed by the pull request. "+
+			"Include a suggestion with the exact replacement text whenever the fix is concrete.",
+		func(ctx context.Context, in reviewCommentInput) (string, error) {
+			comment := forge.ReviewComment{Path: in.Path, StartLine: in.StartLine, Line: in.Line, Body: in.Body, Suggestion: in.Suggestion}
+			if !lines.Contains(comment) {
+				if comment.Suggestion == nil {
+					outside = append(outside, comment)
+					return "Lines are outside the diff; the finding will be listed in the review summary.", nil
+				}
+				return "", fmt.Errorf("%s:%d is not part of the diff, so a suggestion cannot be attached; comment on changed lines or omit the suggestion", in.Path, in.Line)
+			}
+			inDiff = append(inDiff, comment)
+			return "Comment recorded.", nil
+		})
+
+	// Reviews never modify the branch
+	reviewTools := append(readOnlyTools(), reviewTool)
+
+	if len(diff) > maxReviewDiff {
+		diff = diff[:maxReviewDiff] + "\n... (diff truncated; read the files for the rest)"
+	}
+	var pipeline string
+	if status, err := f.PipelineStatus(ctx, pr.HeadRef); err == nil && status != forge.PipelineNone {
+		pipeline = fmt.Sprintf("CI for the branch: %s.\n\n", status)
+	}
+	prompt := fmt.Sprintf("Review pull request #%d, \"%s\".\n\n%s\n\n%sReviewer request: %s\n\n"+
+		"Call submit_review_comment once per finding, anchored to lines in the new version of the file. "+
+		"Finish with a short overall summary, which becomes the review body.\n\n```diff\n%s\n```",
+		pr.Number, pr.Title, pr.Body, pipeline, request, diff)
+
+	agentInstance := agent.NewAgent(newClient(), nil, reviewTools, opts...)
+	summary, err := agentInstance.RunTask(ctx, prompt)
+	if err != nil {
+		return err
+	}
+
+	if len(outside) > 0 {
+		var b strings.Builder
+		b.WriteString(summary)
+		b.WriteString("\n\n**Other findings**\n")
+		for _, c := range outside {
+			fmt.Fprintf(&b, "\n- `%s:%d`: %s", c.Path, c.Line, c.Body)
+		}
+		summary = b.String()
+	}
+	usage := agentInstance.Usage()
+	summary += fmt.Sprintf("\n\n<sub>%d model calls, %d tokens</sub>", usage.Requests, usage.Total())
+	return f.SubmitReview(ctx, number, summary, inDiff)
+}
+
+// runReviewCommand reviews a pull or merge request from any CI system forge.FromEnv
+// detects, taking the reviewer's request from the arguments
+func runReviewCommand(flags *flag.FlagSet) func() {
+	number := flags.Int("number", 0, "Pull or merge request to review. Defaults to the one the CI job runs for.")
+	maxTurns := flags.Int("max-turns", 30, "Maximum model calls for the review.")
+	tokenBudget := flags.Int64("token-budget", 1_000_000, "Maximum tokens the review may consume.")
+	return func() {
+		f, err := forge.FromEnv()
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		if *number == 0 {
+			*number = forge.ChangeRequestFromEnv()
+		}
+		if *number == 0 {
+			log.Fatalf("Error: no pull or merge request to review; pass -number")
+		}
+		request := strings.Join(flags.Args(), " ")
+		if request == "" {
+			request = "review"
+		}
+		limits := []agent.Option{agent.WithMaxTurns(*maxTurns), agent.WithTokenBudget(*tokenBudget), toolExamples()}
+		if err := runReview(context.Background(), f, *number, request, limits...); err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+	}
+}
+
+// readOnlyTools returns the tools that cannot modify the working tree
+func readOnlyTools() []tools.ToolDefinition {
+	var readOnly []tools.ToolDefinition
+	for _, tool := range projectTools() {
+		if !tool.Mutating {
+			readOnly = append(readOnly, tool)
+		}
+	}
+	return readOnly
+}
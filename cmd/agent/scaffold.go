@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"agent/pkg/agent"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateManifest is the file in a template directory describing it; it is not copied
+const templateManifest = "scaffold.yaml"
+
+// defaultTemplateDir is searched for templates after the configured directories
+const defaultTemplateDir = ".agent/templates"
+
+// scaffoldTemplate is what a template's scaffold.yaml declares. Every field is optional.
+type scaffoldTemplate struct {
+	Description string `yaml:"description"`
+	// Destination is where the new module goes, e.g. services/{{name}}
+	Destination string `yaml:"destination"`
+	// Parameters are the blanks in the template. Those not passed with -set and
+	// without a default are filled in by the model.
+	Parameters map[string]struct {
+		Description string `yaml:"description"`
+		Default     string `yaml:"default"`
+	} `yaml:"parameters"`
+	// Instructions tell the model how to wire the module into the build, such as
+	// which workspace, Makefile or CI files list the services
+	Instructions string `yaml:"instructions"`
+	// Build checks the result; detected from the project when empty
+	Build string `yaml:"build"`
+}
+
+// placeholder matches {{name}}, the template syntax for parameters
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// parameterName matches the names placeholders can refer to
+var parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// runScaffold generates a new module from a template directory, substituting the
+// parameters it is given, then has the agent fill in the rest and wire it into the
+// build, feeding build failures back for fixes
+func runScaffold(flags *flag.FlagSet) func() {
+	params := parameterFlags{}
+	flags.Var(params, "set", "Template parameter as key=value. Repeat for several.")
+	output := flags.String("o", "", "Directory to create. Defaults to the template's destination, or the name.")
+	build := flags.String("build", "", "Command that checks the result. Defaults to the template's, or one detected from the project.")
+	attempts := flags.Int("attempts", 3, "How many times a failed build is sent back to the model for a fix.")
+	maxTurns := flags.Int("max-turns", 40, "Maximum model calls per attempt.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: agent scaffold [flags] <template> <name>")
+		flags.PrintDefaults()
+		if names := templateNames(); len(names) > 0 {
+			fmt.Fprintf(flags.Output(), "\nTemplates: %s\n", strings.Join(names, ", "))
+		}
+	}
+	return func() {
+		if flags.NArg() != 2 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		name := flags.Arg(1)
+		if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+			log.Fatalf("Error: '%s' is not a valid name; pass a single path element", name)
+		}
+		dir, err := findTemplate(flags.Arg(0))
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		tmpl, err := loadTemplate(dir)
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+
+		values := map[string]string{"name": name}
+		var blanks []string
+		for key, param := range tmpl.Parameters {
+			if value, ok := params[key]; ok {
+				values[key] = value
+			} else if param.Default != "" {
+				values[key] = param.Default
+			} else if key != "name" {
+				blanks = append(blanks, key)
+			}
+		}
+		for key, value := range params {
+			values[key] = value
+		}
+		slices.Sort(blanks)
+
+		dest := *output
+		if dest == "" && tmpl.Destination != "" {
+			dest = fill(tmpl.Destination, values)
+		}
+		if dest == "" {
+			dest = name
+		}
+		dest = filepath.Clean(dest)
+		if fileExists(dest) {
+			log.Fatalf("Error: '%s' already exists", dest)
+		}
+		created, err := copyTemplate(dir, dest, values)
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		log.Printf("Generated %d files in %s from %s\n", len(created), dest, dir)
+
+		if *build == "" {
+			*build = tmpl.Build
+		}
+		if *build == "" {
+			*build = detectBuildCommand()
+		}
+		ctx := context.Background()
+		opts := []agent.Option{agent.WithMaxTurns(*maxTurns), agent.WithMaxTokens(8192), toolExamples()}
+		prompt := scaffoldPrompt(name, dest, tmpl, values, blanks, remainingBlanks(created, tmpl))
+
+		for attempt := 1; ; attempt++ {
+			scaffolder := agent.NewAgent(newClient(), nil, projectTools(), opts...)
+			summary, err := scaffolder.RunTask(ctx, prompt)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			fmt.Printf("\u001b[1mScaffolded %s\u001b[0m\n%s\n", dest, summary)
+
+			problem, detail := "", ""
+			if left := remainingBlanks(created, tmpl); len(left) > 0 {
+				problem, detail = "blanks were left unfilled", strings.Join(left, "\n")
+			} else if out, ok := runBuild(*build); !ok {
+				problem, detail = "the build failed", out
+			}
+			if problem == "" {
+				if *build != "" {
+					log.Printf("\u001b[92m%s is wired in and the build passed\u001b[0m\n", dest)
+				} else {
+					log.Printf("\u001b[92m%s is filled in\u001b[0m (no build command detected; pass -build)\n", dest)
+				}
+				log.Println("Review the changes with git diff and git status before committing them")
+				return
+			}
+			log.Printf("\u001b[91m%s: %s\u001b[0m (attempt %d of %d)\n", dest, problem, attempt, *attempts)
+			if attempt >= *attempts {
+				fmt.Println(detail)
+				log.Fatal("Error: giving up; the generated files are left in place for you to fix")
+			}
+			prompt = fmt.Sprintf("A new module named %s was generated from a template into %s and wired into the build, "+
+				"but %s:\n```\n%s\n```\n\nFix it, changing the new module and only the build files that must mention it. "+
+				"Finish with a one-paragraph summary of the fix.", name, dest, problem, detail)
+		}
+	}
+}
+
+// scaffoldPrompt asks the model to complete the generated module and wire it in
+func scaffoldPrompt(name, dest string, tmpl scaffoldTemplate, values map[string]string, blanks, left []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "A new module named %s was generated from a template into %s", name, dest)
+	if tmpl.Description != "" {
+		fmt.Fprintf(&b, " (%s)", tmpl.Description)
+	}
+	b.WriteString(". The parameters given were:\n")
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "- %s: %s\n", key, values[key])
+	}
+	if len(blanks) > 0 {
+		b.WriteString("\nChoose values for these parameters, consistent with the rest of the repository, and replace their {{placeholders}} in the new files:\n")
+		for _, key := range blanks {
+			fmt.Fprintf(&b, "- %s: %s\n", key, tmpl.Parameters[key].Description)
+		}
+	}
+	if len(left) > 0 {
+		fmt.Fprintf(&b, "\nThese placeholders are still in the new files; fill in each one:\n%s\n", strings.Join(left, "\n"))
+	}
+	b.WriteString("\nRead the new files and a similar existing module, then finish anything the template left as a " +
+		"TODO for the new module. Wire it into the build the way the existing modules are: register it in the " +
+		"workspace, build, CI and deployment files that list them. Change only the new module and the files that " +
+		"must mention it, and do not rename or restructure the generated files.")
+	if tmpl.Instructions != "" {
+		fmt.Fprintf(&b, "\n\nThe template's instructions:\n%s", strings.TrimSpace(tmpl.Instructions))
+	}
+	b.WriteString("\n\nFinish with the files you changed outside the new module and a one-paragraph summary.")
+	return b.String()
+}
+
+// templateDirs are the directories templates are looked up in by name
+func templateDirs() []string {
+	var dirs []string
+	for _, dir := range projectConfig().Templates {
+		dirs = append(dirs, expandHome(filepath.FromSlash(dir)))
+	}
+	return append(dirs, defaultTemplateDir)
+}
+
+// findTemplate returns the template directory for name, which is either a path or the
+// name of a directory in one of the template directories
+func findTemplate(name string) (string, error) {
+	if info, err := os.Stat(name); err == nil && info.IsDir() && strings.ContainsAny(name, `/\.`) {
+		return name, nil
+	}
+	for _, dir := range templateDirs() {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return path, nil
+		}
+	}
+	if names := templateNames(); len(names) > 0 {
+		return "", fmt.Errorf("no template named '%s'; the templates are %s", name, strings.Join(names, ", "))
+	}
+	return "", fmt.Errorf("no template named '%s'; add template directories to %s or list them under templates in the config", name, defaultTemplateDir)
+}
+
+// templateNames lists the templates in the template directories
+func templateNames() []string {
+	var names []string
+	for _, dir := range templateDirs() {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if entry.IsDir() && !slices.Contains(names, entry.Name()) {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	return names
+}
+
+// loadTemplate reads the template's manifest, if it has one
+func loadTemplate(dir string) (scaffoldTemplate, error) {
+	var tmpl scaffoldTemplate
+	data, err := os.ReadFile(filepath.Join(dir, templateManifest))
+	if os.IsNotExist(err) {
+		return tmpl, nil
+	}
+	if err != nil {
+		return tmpl, fmt.Errorf("failed to read template manifest: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &tmpl); err != nil {
+		return tmpl, fmt.Errorf("failed to parse '%s': %w", filepath.Join(dir, templateManifest), err)
+	}
+	return tmpl, nil
+}
+
+// copyTemplate copies the template into dest, filling in the known parameters in
+// file names and text files, and returns the files created
+func copyTemplate(dir, dest string, values map[string]string) ([]string, error) {
+	var created []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || rel == templateManifest {
+			return nil
+		}
+		target := filepath.Join(dest, fill(rel, values))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(content, []byte{0}) {
+			content = []byte(fill(string(content), values))
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, content, info.Mode().Perm()); err != nil {
+			return err
+		}
+		created = append(created, target)
+		return nil
+	})
+	if err != nil {
+		return created, fmt.Errorf("failed to copy template '%s': %w", dir, err)
+	}
+	return created, nil
+}
+
+// fill replaces the placeholders of known parameters in s, leaving the others
+func fill(s string, values map[string]string) string {
+	return placeholder.ReplaceAllStringFunc(s, func(match string) string {
+		if value, ok := values[placeholder.FindStringSubmatch(match)[1]]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// remainingBlanks lists the placeholders still in files, as path:line: placeholder.
+// When the template declares its parameters only theirs count, so text in other
+// template languages is left alone.
+func remainingBlanks(files []string, tmpl scaffoldTemplate) []string {
+	var left []string
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil || bytes.Contains(content, []byte{0}) {
+			continue
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			for _, match := range placeholder.FindAllStringSubmatch(line, -1) {
+				if _, declared := tmpl.Parameters[match[1]]; len(tmpl.Parameters) > 0 && !declared && match[1] != "name" {
+					continue
+				}
+				left = append(left, fmt.Sprintf("%s:%d: %s", file, i+1, match[0]))
+			}
+		}
+	}
+	return left
+}
+
+// runBuild runs the build command, returning its output when it fails
+func runBuild(command string) (string, bool) {
+	if command == "" {
+		return "", true
+	}
+	log.Printf("Verifying with: %s\n", command)
+	out, err := exec.Command("sh", "-c", command).CombinedOutput()
+	if err != nil {
+		output := string(out)
+		if len(output) > maxTestOutput {
+			output = "..." + output[len(output)-maxTestOutput:]
+		}
+		return output + err.Error(), false
+	}
+	return "", true
+}
+
+// parameterFlags collects the template parameters given with repeated -set flags
+type parameterFlags map[string]string
+
+func (p parameterFlags) String() string {
+	pairs := make([]string, 0, len(p))
+	for key, value := range p {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (p parameterFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || !parameterName.MatchString(key) {
+		return fmt.Errorf("invalid parameter '%s'; use key=value", value)
+	}
+	p[key] = val
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"agent/internal/keychain"
+	"agent/pkg/session"
+)
+
+// defaultSessionStore is where sessions are kept unless -session-store says otherwise
+const defaultSessionStore = ".agent/sessions"
+
+// defaultFileHistory is where the versions of files the tools saw in sessions are
+// kept, relative to the project
+const defaultFileHistory = ".agent/history"
+
+// sessionKeyAccount is the keychain account holding the session encryption key
+const sessionKeyAccount = "session-key"
+
+// openSessionStore opens the store at location, wrapping it so sessions are encrypted
+// at rest when encryption is "keychain" or "passphrase", and compressed if requested
+func openSessionStore(ctx context.Context, location, encryption string, compress bool) (session.Store, error) {
+	store, err := session.Open(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	switch encryption {
+	case "":
+	case "keychain":
+		key, err := sessionKey()
+		if err != nil {
+			return nil, err
+		}
+		if store, err = session.NewEncryptedStore(store, key); err != nil {
+			return nil, err
+		}
+	case "passphrase":
+		passphrase := os.Getenv("AGENT_SESSION_PASSPHRASE")
+		if passphrase == "" {
+			return nil, errors.New("AGENT_SESSION_PASSPHRASE must be set to encrypt sessions with a passphrase")
+		}
+		if store, err = session.NewPassphraseStore(store, passphrase); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown session encryption '%s' (want keychain or passphrase)", encryption)
+	}
+	if compress {
+		store = session.NewCompressedStore(store)
+	}
+	return store, nil
+}
+
+// sessionKey returns the session encryption key from the OS keychain, generating and
+// storing a new one on first use. An existing key is never replaced, since the
+// sessions encrypted with it could not be read again.
+func sessionKey() ([]byte, error) {
+	encoded, err := keychain.Get(sessionKeyAccount)
+	if errors.Is(err, keychain.ErrNotFound) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate session key: %w", err)
+		}
+		encoded = base64.StdEncoding.EncodeToString(key)
+		err = keychain.Add(sessionKeyAccount, encoded)
+		if errors.Is(err, keychain.ErrExists) {
+			// Another process stored one first
+			encoded, err = keychain.Get(sessionKeyAccount)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("session key in the keychain is corrupt: %w", err)
+	}
+	return key, nil
+}
+
+// sessionError describes an error loading a session, saying which flag reads it when
+// it is encrypted
+func sessionError(err error) string {
+	if errors.Is(err, session.ErrEncrypted) {
+		return err.Error() + "; pass -encrypt-sessions keychain or passphrase"
+	}
+	return err.Error()
+}
+
+// sessionStoreFlags defines the flags the commands that read stored sessions share
+func sessionStoreFlags(flags *flag.FlagSet) (location, encryption *string) {
+	location = flags.String("session-store", defaultSessionStore, "Where sessions are stored: a directory, redis://host:port/db or postgres://... URL.")
+	encryption = flags.String("encrypt-sessions", "", "How the sessions are encrypted, if they are: keychain or passphrase.")
+	return location, encryption
+}
+
+// runSessions lists the stored sessions, shows one as a transcript or deletes one
+func runSessions(flags *flag.FlagSet) func() {
+	location, encryption := sessionStoreFlags(flags)
+	maxResult := flags.Int("max-result", 2000, "With show and export, abbreviate each tool result to this many bytes.")
+	asJSON := flags.Bool("json", false, "With export, write the scrubbed session as JSON instead of a transcript.")
+	var redactions patternFlags
+	flags.Var(&redactions, "redact", "With export, also replace text matching this regular expression. Repeat for several.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: agent sessions [flags] [list | show <id> | export <id> | delete <id>]")
+		flags.PrintDefaults()
+	}
+	return func() {
+		ctx := context.Background()
+		store, err := openSessionStore(ctx, *location, *encryption, true)
+		if err != nil {
+			log.Fatalf("Error opening session store: %s", err.Error())
+		}
+		action, id := flags.Arg(0), flags.Arg(1)
+		switch {
+		case action == "" || action == "list":
+			ids, err := store.List(ctx)
+			if err != nil {
+				log.Fatalf("Error listing sessions: %s", err.Error())
+			}
+			slices.Sort(ids)
+			for _, id := range ids {
+				s, err := store.Load(ctx, id)
+				if err != nil {
+					fmt.Printf("%s  (%s)\n", id, sessionError(err))
+					continue
+				}
+				fmt.Printf("%s  %s  %3d messages  %s\n", id, s.UpdatedAt.Local().Format("2006-01-02 15:04"), len(s.Messages), firstUserText(s))
+			}
+		case action == "show" && id != "":
+			s, err := store.Load(ctx, id)
+			if err != nil {
+				log.Fatalf("Error loading session '%s': %s", id, sessionError(err))
+			}
+			fmt.Print(s.CitedTranscript(*maxResult))
+		case action == "export" && id != "":
+			s, err := store.Load(ctx, id)
+			if err != nil {
+				log.Fatalf("Error loading session '%s': %s", id, sessionError(err))
+			}
+			scrubbed, err := s.Scrubbed(redactions)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			if !*asJSON {
+				fmt.Print(scrubbed.CitedTranscript(*maxResult))
+				break
+			}
+			// Only the conversation is shared; file history and spend stay private
+			data, err := json.MarshalIndent(session.Session{ID: scrubbed.ID, CreatedAt: scrubbed.CreatedAt,
+				UpdatedAt: scrubbed.UpdatedAt, Messages: scrubbed.Messages}, "", "  ")
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			fmt.Println(string(data))
+		case action == "delete" && id != "":
+			if err := store.Delete(ctx, id); err != nil {
+				log.Fatalf("Error deleting session '%s': %s", id, err.Error())
+			}
+			log.Printf("Deleted session %s\n", id)
+		default:
+			flags.Usage()
+			os.Exit(2)
+		}
+	}
+}
+
+// patternFlags collects the regular expressions given with repeated -redact flags
+type patternFlags []string
+
+func (p *patternFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternFlags) Set(value string) error {
+	if _, err := regexp.Compile(value); err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+// firstUserText returns the start of the session's first message, to recognise it by
+func firstUserText(s *session.Session) string {
+	for _, message := range s.Messages {
+		for _, block := range message.Content {
+			if message.Role == "user" && block.Type == "text" {
+				text, _, _ := strings.Cut(block.Text, "\n")
+				if len(text) > 60 {
+					text = text[:60] + "..."
+				}
+				return text
+			}
+		}
+	}
+	return ""
+}
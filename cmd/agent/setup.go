@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"agent/pkg/agent"
+)
+
+var (
+	// versionNumber finds the first dotted version in a tool's --version output
+	versionNumber = regexp.MustCompile(`\d+(\.\d+)+`)
+	// versionPrefix finds a version that may be just a major number, as in ">=18"
+	versionPrefix = regexp.MustCompile(`\d+(\.\d+)*`)
+)
+
+// envTemplates are the files projects use to document their environment variables
+var envTemplates = []string{".env.example", ".env.sample", ".env.template", ".env.dist"}
+
+// packageManagers are the system package managers setup plans can use, if installed
+var packageManagers = []string{"brew", "apt-get", "dnf", "yum", "pacman", "apk", "zypper", "winget", "choco", "scoop", "nix-env"}
+
+// prerequisite is something the project needs on this machine
+type prerequisite struct {
+	name   string
+	reason string
+	want   string // the version or value required, if any
+	found  string // the version installed, empty when missing
+	ok     bool
+}
+
+// setupStep is one fix the model proposes for a missing prerequisite
+type setupStep struct {
+	Name        string `json:"name"`
+	Explanation string `json:"explanation"`
+	Command     string `json:"command"`
+}
+
+// runSetup checks the machine for what the project needs, has the agent explain what
+// is missing with commands to install it, and runs each command once approved
+func runSetup(flags *flag.FlagSet) func() {
+	dryRun := flags.Bool("dry-run", false, "Only explain what is missing and show the commands; never run them.")
+	maxTurns := flags.Int("max-turns", 20, "Maximum model calls while planning.")
+	return func() {
+		prereqs := checkPrerequisites()
+		printPrerequisites(prereqs)
+		var missing []prerequisite
+		for _, p := range prereqs {
+			if !p.ok {
+				missing = append(missing, p)
+			}
+		}
+		if len(missing) == 0 {
+			log.Println("\u001b[92mEverything the project needs is installed\u001b[0m")
+			return
+		}
+		if !hasCredentials() {
+			log.Fatal("Error: no API key or login, so the agent cannot plan the setup; run `agent login` first")
+		}
+
+		steps, err := planSetup(missing, *maxTurns)
+		if err != nil {
+			log.Fatalf("Error planning the setup: %s", err.Error())
+		}
+		input := bufio.NewReader(os.Stdin)
+		for _, step := range steps {
+			fmt.Printf("\n\u001b[1m%s\u001b[0m\n%s\n", step.Name, step.Explanation)
+			if step.Command == "" {
+				continue
+			}
+			fmt.Printf("  $ %s\n", step.Command)
+			if *dryRun {
+				continue
+			}
+			switch ask(input, "Run this command? [y]es/[n]o/[q]uit: ") {
+			case "y", "yes":
+			case "q", "quit":
+				return
+			default:
+				continue
+			}
+			cmd := exec.Command("sh", "-c", step.Command)
+			cmd.Stdin = os.Stdin
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				log.Printf("\u001b[91mCommand failed\u001b[0m: %s\n", err.Error())
+			}
+		}
+		if *dryRun {
+			return
+		}
+
+		fmt.Println()
+		prereqs = checkPrerequisites()
+		printPrerequisites(prereqs)
+		for _, p := range prereqs {
+			if !p.ok {
+				log.Fatal("Error: some prerequisites are still missing; a new shell may be needed to pick up PATH changes")
+			}
+		}
+		log.Println("\u001b[92mSetup complete\u001b[0m")
+	}
+}
+
+// checkPrerequisites detects the toolchains, tools and environment variables the
+// project's files call for and whether this machine has them
+func checkPrerequisites() []prerequisite {
+	prereqs := []prerequisite{
+		commandPrerequisite("git", "version control; the agent inspects history and diffs with it", "", "--version"),
+		commandPrerequisite("rg", "ripgrep, used by the agent's ripgrep_search tool", "", "--version"),
+	}
+	if fileExists("go.mod") {
+		prereqs = append(prereqs, commandPrerequisite("go", "the Go toolchain named in go.mod", goModVersion(), "version"))
+	}
+	if fileExists("package.json") {
+		prereqs = append(prereqs, commandPrerequisite("node", "Node.js for package.json", nodeVersion(), "--version"))
+	}
+	if fileExists("pyproject.toml") || fileExists("requirements.txt") || fileExists(".python-version") {
+		prereqs = append(prereqs, commandPrerequisite("python3", "Python for the project's Python code", versionPrefix.FindString(firstLine(".python-version")), "--version"))
+	}
+	if fileExists("Cargo.toml") {
+		prereqs = append(prereqs, commandPrerequisite("cargo", "the Rust toolchain for Cargo.toml", "", "--version"))
+	}
+	for _, compose := range []string{"Dockerfile", "docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"} {
+		if fileExists(compose) {
+			prereqs = append(prereqs, commandPrerequisite("docker", "container builds and services from "+compose, "", "--version"))
+			break
+		}
+	}
+	for _, template := range envTemplates {
+		if fileExists(template) {
+			prereqs = append(prereqs, envPrerequisites(template)...)
+			break
+		}
+	}
+	credentials := prerequisite{name: "Anthropic credentials", reason: "the agent's model calls; set ANTHROPIC_API_KEY or run `agent login`", ok: hasCredentials()}
+	if credentials.ok {
+		credentials.found = "configured"
+	}
+	return append(prereqs, credentials)
+}
+
+// commandPrerequisite checks that command is installed and, when want is set, at least
+// that version
+func commandPrerequisite(command, reason, want string, versionArgs ...string) prerequisite {
+	p := prerequisite{name: command, reason: reason, want: want}
+	if _, err := exec.LookPath(command); err != nil {
+		return p
+	}
+	out, _ := exec.Command(command, versionArgs...).CombinedOutput()
+	p.found = versionNumber.FindString(string(out))
+	if p.found == "" {
+		p.found = "installed"
+	}
+	p.ok = want == "" || compareVersions(p.found, want) >= 0
+	return p
+}
+
+// envPrerequisites lists the variables in an env template that are neither set nor in .env
+func envPrerequisites(template string) []prerequisite {
+	defined := map[string]bool{}
+	for _, name := range envFileKeys(".env") {
+		defined[name] = true
+	}
+	var prereqs []prerequisite
+	for _, name := range envFileKeys(template) {
+		_, set := os.LookupEnv(name)
+		p := prerequisite{name: "$" + name, reason: "listed in " + template, ok: set || defined[name]}
+		if p.ok {
+			p.found = "set"
+		}
+		prereqs = append(prereqs, p)
+	}
+	return prereqs
+}
+
+// envFileKeys returns the variable names assigned in a dotenv file
+func envFileKeys(path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	var keys []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "export ")
+		if name, _, ok := strings.Cut(line, "="); ok && !strings.HasPrefix(line, "#") {
+			keys = append(keys, strings.TrimSpace(name))
+		}
+	}
+	return keys
+}
+
+// goModVersion returns the toolchain or go version go.mod requires
+func goModVersion() string {
+	content, err := os.ReadFile("go.mod")
+	if err != nil {
+		return ""
+	}
+	version := ""
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "toolchain":
+			return strings.TrimPrefix(fields[1], "go")
+		case "go":
+			version = fields[1]
+		}
+	}
+	return version
+}
+
+// nodeVersion returns the Node.js version pinned by .nvmrc or package.json's engines
+func nodeVersion() string {
+	if version := versionPrefix.FindString(firstLine(".nvmrc")); version != "" {
+		return version
+	}
+	content, err := os.ReadFile("package.json")
+	if err != nil {
+		return ""
+	}
+	var pkg struct {
+		Engines struct {
+			Node string `json:"node"`
+		} `json:"engines"`
+	}
+	if json.Unmarshal(content, &pkg) != nil {
+		return ""
+	}
+	// Only the lower bound of a range such as ">=18.17" is checked
+	return versionPrefix.FindString(pkg.Engines.Node)
+}
+
+// firstLine returns the first line of a file, or the empty string if it cannot be read
+func firstLine(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(content), "\n")
+	return strings.TrimSpace(line)
+}
+
+// compareVersions compares dotted version numbers, treating missing parts as zero
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// hasCredentials reports whether the agent can authenticate to the model
+func hasCredentials() bool {
+	if _, err := apiKey("anthropic"); err == nil {
+		return true
+	}
+	_, err := loadOAuth()
+	return err == nil
+}
+
+// printPrerequisites shows each prerequisite with a tick or cross
+func printPrerequisites(prereqs []prerequisite) {
+	for _, p := range prereqs {
+		status := "\u001b[92m✓\u001b[0m"
+		if !p.ok {
+			status = "\u001b[91m✗\u001b[0m"
+		}
+		detail := p.found
+		if detail == "" {
+			detail = "missing"
+		}
+		if p.want != "" {
+			detail += ", needs " + p.want
+		}
+		fmt.Printf("%s %s (%s): %s\n", status, p.name, detail, p.reason)
+	}
+}
+
+// planSetup has the agent read the project's setup docs and propose a command for each
+// missing prerequisite on this OS
+func planSetup(missing []prerequisite, maxTurns int) ([]setupStep, error) {
+	var list strings.Builder
+	for _, p := range missing {
+		fmt.Fprintf(&list, "- %s: %s", p.name, p.reason)
+		if p.want != "" {
+			fmt.Fprintf(&list, "; version %s or later is required", p.want)
+		}
+		if p.found != "" {
+			fmt.Fprintf(&list, "; %s is installed", p.found)
+		}
+		list.WriteString("\n")
+	}
+	var managers []string
+	for _, manager := range packageManagers {
+		if _, err := exec.LookPath(manager); err == nil {
+			managers = append(managers, manager)
+		}
+	}
+	if len(managers) == 0 {
+		managers = []string{"none detected"}
+	}
+
+	prompt := fmt.Sprintf("Help set up this machine to work on the project in the working directory. "+
+		"It runs %s/%s, and the package managers available are: %s. These prerequisites are missing:\n\n%s\n"+
+		"Read the README, CONTRIBUTING and similar docs for the project's own setup instructions and "+
+		"prefer them. Do not modify any files. Then reply with only a JSON array with one object per "+
+		"missing prerequisite: {\"name\": ..., \"explanation\": what it is for and why the project needs "+
+		"it, in one or two sentences, \"command\": one shell command that installs or upgrades it on this "+
+		"machine, or \"\" if it cannot be installed automatically (such as a secret), in which case the "+
+		"explanation says where to get the value}.",
+		runtime.GOOS, runtime.GOARCH, strings.Join(managers, ", "), list.String())
+
+	planner := agent.NewAgent(newClient(), nil, readOnlyTools(), agent.WithMaxTurns(maxTurns), toolExamples())
+	reply, err := planner.RunTask(context.Background(), prompt)
+	if err != nil {
+		return nil, err
+	}
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("the reply was not a JSON array: %s", reply)
+	}
+	var steps []setupStep
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &steps); err != nil {
+		return nil, fmt.Errorf("failed to parse the setup plan: %w", err)
+	}
+	return steps, nil
+}
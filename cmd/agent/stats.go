@@ -0,0 +1,154 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"agent/pkg/agent"
+	"agent/pkg/session"
+)
+
+// toolStats counts the calls to one tool across sessions
+type toolStats struct {
+	name   string
+	calls  int
+	errors int
+}
+
+// labelSpend totals the tokens attributed to one cost label across sessions
+type labelSpend struct {
+	label string
+	usage agent.Usage
+	cost  float64
+}
+
+// runStats summarises the stored sessions: how many there are, their turns, the tool
+// calls made with how often each failed, and the tokens and cost by label
+func runStats(flags *flag.FlagSet) func() {
+	location, encryption := sessionStoreFlags(flags)
+	since := flags.Duration("since", 0, "Only count sessions updated within this long, e.g. 168h. Zero counts all.")
+	label := flags.String("label", "", "Only count sessions with tokens attributed to this label, e.g. billing:team-x, and only those tokens.")
+	return func() {
+		ctx := context.Background()
+		store, err := openSessionStore(ctx, *location, *encryption, true)
+		if err != nil {
+			log.Fatalf("Error opening session store: %s", err.Error())
+		}
+		ids, err := store.List(ctx)
+		if err != nil {
+			log.Fatalf("Error listing sessions: %s", err.Error())
+		}
+
+		sessions, turns, messages := 0, 0, 0
+		byTool := map[string]*toolStats{}
+		byLabel := map[string]*labelSpend{}
+		for _, id := range ids {
+			s, err := store.Load(ctx, id)
+			if err != nil {
+				log.Printf("Skipping session '%s': %s\n", id, sessionError(err))
+				continue
+			}
+			if *since > 0 && time.Since(s.UpdatedAt) > *since {
+				continue
+			}
+			if *label != "" && !slices.Contains(s.Labels, *label) &&
+				!slices.ContainsFunc(s.Spend, func(spend session.Spend) bool { return slices.Contains(spend.Labels, *label) }) {
+				continue
+			}
+			for _, spend := range s.Spend {
+				if *label != "" && !slices.Contains(spend.Labels, *label) {
+					continue
+				}
+				usage := agent.Usage{Requests: spend.Requests, InputTokens: spend.InputTokens, OutputTokens: spend.OutputTokens,
+					CacheReadInputTokens: spend.CacheReadInputTokens, CacheCreationInputTokens: spend.CacheCreationInputTokens}
+				labels := spend.Labels
+				if len(labels) == 0 {
+					labels = []string{"(unlabelled)"}
+				}
+				for _, name := range labels {
+					if byLabel[name] == nil {
+						byLabel[name] = &labelSpend{label: name}
+					}
+					addUsage(&byLabel[name].usage, usage)
+					byLabel[name].cost += usage.Cost(spend.Model)
+				}
+			}
+			sessions++
+			messages += len(s.Messages)
+			turns += countTurns(s)
+			names := map[string]string{}
+			for _, message := range s.Messages {
+				for _, block := range message.Content {
+					switch block.Type {
+					case "tool_use":
+						names[block.ID] = block.Name
+						if byTool[block.Name] == nil {
+							byTool[block.Name] = &toolStats{name: block.Name}
+						}
+						byTool[block.Name].calls++
+					case "tool_result":
+						if stats := byTool[names[block.ToolUseID]]; stats != nil && block.IsError {
+							stats.errors++
+						}
+					}
+				}
+			}
+		}
+
+		fmt.Printf("Sessions: %d\nTurns:    %d\nMessages: %d\n", sessions, turns, messages)
+		if len(byLabel) > 0 {
+			var all []labelSpend
+			for _, spend := range byLabel {
+				all = append(all, *spend)
+			}
+			slices.SortFunc(all, func(a, b labelSpend) int { return cmp.Compare(b.cost, a.cost) })
+			fmt.Println("\nSpend by label:")
+			for _, spend := range all {
+				fmt.Printf("  %-22s %6d requests  %10d tokens  $%.2f\n", spend.label, spend.usage.Requests, spend.usage.Total(), spend.cost)
+			}
+		}
+		if len(byTool) == 0 {
+			return
+		}
+		var all []toolStats
+		total := 0
+		for _, stats := range byTool {
+			all = append(all, *stats)
+			total += stats.calls
+		}
+		slices.SortFunc(all, func(a, b toolStats) int { return b.calls - a.calls })
+		fmt.Printf("\nTool calls: %d\n", total)
+		for _, stats := range all {
+			fmt.Printf("  %-22s %6d calls  %5.1f%% failed\n", stats.name, stats.calls, 100*float64(stats.errors)/float64(stats.calls))
+		}
+	}
+}
+
+// addUsage adds more to total
+func addUsage(total *agent.Usage, more agent.Usage) {
+	total.Requests += more.Requests
+	total.InputTokens += more.InputTokens
+	total.OutputTokens += more.OutputTokens
+	total.CacheReadInputTokens += more.CacheReadInputTokens
+	total.CacheCreationInputTokens += more.CacheCreationInputTokens
+}
+
+// countTurns counts the user messages that start a turn, rather than carry tool results
+func countTurns(s *session.Session) int {
+	turns := 0
+	for _, message := range s.Messages {
+		if message.Role != "user" {
+			continue
+		}
+		results := slices.ContainsFunc(message.Content, func(block session.Block) bool { return block.Type == "tool_result" })
+		if !results {
+			turns++
+		}
+	}
+	return turns
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"agent/internal/config"
+	"agent/pkg/agent"
+	"agent/pkg/tools"
+)
+
+// telemetryInterval is how long usage is aggregated before it is sent
+const telemetryInterval = 24 * time.Hour
+
+// usageReport is everything telemetry sends: counts of the commands run and of the
+// built-in tools called, with the agent's version and platform. It never holds
+// messages, file names, paths, tool inputs or output, or anything identifying the
+// user or machine.
+type usageReport struct {
+	Version  string               `json:"version"`
+	OS       string               `json:"os"`
+	Arch     string               `json:"arch"`
+	Since    time.Time            `json:"since"`
+	Commands map[string]int       `json:"commands"`
+	Tools    map[string]toolUsage `json:"tools"`
+}
+
+// toolUsage counts the calls to one tool and how many of them failed
+type toolUsage struct {
+	Calls  int `json:"calls"`
+	Errors int `json:"errors"`
+}
+
+// telemetryState is the telemetry file: the user's consent and the usage not yet sent
+type telemetryState struct {
+	Enabled bool        `json:"enabled"`
+	Pending usageReport `json:"pending"`
+}
+
+// telemetry aggregates this process's usage and adds it to the pending report when
+// saved. Nothing is recorded unless the user has enabled it with agent telemetry enable,
+// and nothing is sent unless the config also names an endpoint.
+type telemetry struct {
+	path    string
+	enabled bool
+
+	mu    sync.Mutex
+	delta usageReport // recorded by this process, not yet saved
+}
+
+// usageTelemetry loads the telemetry consent once per process
+var usageTelemetry = sync.OnceValue(func() *telemetry {
+	t := &telemetry{delta: newUsageReport()}
+	path, err := telemetryPath()
+	if err != nil {
+		return t
+	}
+	t.path = path
+	state, err := loadTelemetryState(path)
+	t.enabled = err == nil && state.Enabled
+	return t
+})
+
+func newUsageReport() usageReport {
+	return usageReport{
+		Version:  version,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Since:    time.Now().UTC().Truncate(time.Hour),
+		Commands: map[string]int{},
+		Tools:    map[string]toolUsage{},
+	}
+}
+
+// telemetryPath returns the telemetry file, next to the user config
+func telemetryPath() (string, error) {
+	user, err := config.UserPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(user), "telemetry.json"), nil
+}
+
+func loadTelemetryState(path string) (telemetryState, error) {
+	state := telemetryState{Pending: newUsageReport()}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+	if state.Pending.Commands == nil {
+		state.Pending.Commands = map[string]int{}
+	}
+	if state.Pending.Tools == nil {
+		state.Pending.Tools = map[string]toolUsage{}
+	}
+	return state, nil
+}
+
+func saveTelemetryState(path string, state telemetryState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode telemetry: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create '%s': %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	return nil
+}
+
+// command counts a run of the named command
+func (t *telemetry) command(name string) {
+	if !t.enabled {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.delta.Commands[name]++
+}
+
+// events passes events on to next and counts the calls to built-in tools. Other
+// tools, which may come from a project's own config, are counted together as other,
+// so their names are never sent.
+func (t *telemetry) events(next agent.EventHandler) agent.EventHandler {
+	builtin := map[string]bool{}
+	for _, tool := range tools.GetTools() {
+		builtin[tool.Name] = true
+	}
+	return func(e agent.Event) {
+		next(e)
+		if !t.enabled || e.Type != agent.EventToolResult {
+			return
+		}
+		name := e.ToolName
+		if !builtin[name] {
+			name = "other"
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		usage := t.delta.Tools[name]
+		usage.Calls++
+		if e.IsError {
+			usage.Errors++
+		}
+		t.delta.Tools[name] = usage
+	}
+}
+
+// save adds this process's usage to the pending report, and sends the report once it
+// covers telemetryInterval and the config names an endpoint. Errors are only logged:
+// telemetry never gets in the way of the command.
+func (t *telemetry) save() {
+	if !t.enabled || t.path == "" {
+		return
+	}
+	t.mu.Lock()
+	delta := t.delta
+	t.delta = newUsageReport()
+	t.mu.Unlock()
+
+	// Other agents may have saved since this one started, so merge into the file as it is now
+	state, err := loadTelemetryState(t.path)
+	if err != nil {
+		log.Printf("Error saving telemetry: %s\n", err.Error())
+		return
+	}
+	if !state.Enabled {
+		return
+	}
+	for name, n := range delta.Commands {
+		state.Pending.Commands[name] += n
+	}
+	for name, usage := range delta.Tools {
+		total := state.Pending.Tools[name]
+		total.Calls += usage.Calls
+		total.Errors += usage.Errors
+		state.Pending.Tools[name] = total
+	}
+	state.Pending.Version, state.Pending.OS, state.Pending.Arch = delta.Version, delta.OS, delta.Arch
+
+	endpoint := projectConfig().Telemetry.Endpoint
+	if endpoint != "" && time.Since(state.Pending.Since) >= telemetryInterval {
+		if err := sendUsage(endpoint, state.Pending); err != nil {
+			log.Printf("Error sending telemetry (kept for next time): %s\n", err.Error())
+		} else {
+			state.Pending = newUsageReport()
+		}
+	}
+	if err := saveTelemetryState(t.path, state); err != nil {
+		log.Printf("Error saving telemetry: %s\n", err.Error())
+	}
+}
+
+// sendUsage posts the report to the endpoint as JSON
+func sendUsage(endpoint string, report usageReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode telemetry: %w", err)
+	}
+	transport, err := projectConfig().Network.Transport()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request for '%s': %w", endpoint, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", endpoint, resp.Status)
+	}
+	return nil
+}
+
+// runTelemetry shows or changes the user's telemetry consent, and previews the exact
+// report that would be sent next
+func runTelemetry(flags *flag.FlagSet) func() {
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: agent telemetry status|enable|disable|preview")
+	}
+	return func() {
+		path, err := telemetryPath()
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		state, err := loadTelemetryState(path)
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		endpoint := projectConfig().Telemetry.Endpoint
+		switch flags.Arg(0) {
+		case "", "status":
+			switch {
+			case !state.Enabled:
+				fmt.Println("Telemetry is off. Nothing is recorded or sent.")
+			case endpoint == "":
+				fmt.Println("Telemetry is on, but no telemetry.endpoint is configured, so usage is only counted locally.")
+			default:
+				fmt.Printf("Telemetry is on. Usage is sent to %s once a day.\n", endpoint)
+			}
+			fmt.Printf("Stored in %s. Run agent telemetry preview to see the next report.\n", path)
+		case "enable":
+			if !state.Enabled {
+				state.Enabled = true
+				state.Pending = newUsageReport()
+			}
+			if err := saveTelemetryState(path, state); err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			fmt.Println("Telemetry enabled. The agent will count the commands you run and the built-in tools it calls,")
+			fmt.Println("with how many calls failed, and its version and platform. It never records messages, code,")
+			fmt.Println("file names, tool inputs or output. Run agent telemetry preview at any time to see the report.")
+		case "disable":
+			// The pending counts are dropped too, so nothing collected earlier is sent later
+			if err := saveTelemetryState(path, telemetryState{Pending: newUsageReport()}); err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			fmt.Println("Telemetry disabled; the unsent usage was deleted.")
+		case "preview":
+			if !state.Enabled {
+				fmt.Println("Telemetry is off, so there is nothing to send. This is what an enabled report looks like:")
+			} else if endpoint != "" {
+				fmt.Printf("This is the exact report that will be posted to %s:\n", endpoint)
+			}
+			data, err := json.MarshalIndent(state.Pending, "", "  ")
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			fmt.Println(string(data))
+		default:
+			flags.Usage()
+			os.Exit(2)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/internal/capability"
+	"agent/pkg/tools"
+)
+
+// runToken issues capability tokens for worker tasks, or creates the key they are
+// signed with
+func runToken(flags *flag.FlagSet) func() {
+	keyFile := flags.String("key", os.Getenv("AGENT_CAPABILITY_SIGNING_KEY"), "Private key file tokens are signed with. Defaults to $AGENT_CAPABILITY_SIGNING_KEY.")
+	toolList := flags.String("tools", "", "Comma-separated tools the session may call. Empty allows all.")
+	paths := flags.String("paths", "", "Comma-separated directories, relative to the task's repository, that tool paths must lie in. Empty allows all.")
+	maxTurns := flags.Int("max-turns", 0, "Maximum model calls per message the session may make. Zero leaves the worker's limit.")
+	budget := flags.Int64("budget", 0, "Maximum tokens the session may use. Zero means no limit.")
+	ttl := flags.Duration("ttl", 24*time.Hour, "How long the token is valid.")
+	subject := flags.String("task", "", "ID of the only task the token is valid for, if set.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: agent token [flags] [issue | keygen <private-key-file>]")
+		flags.PrintDefaults()
+	}
+	return func() {
+		switch flags.Arg(0) {
+		case "", "issue":
+			if *keyFile == "" {
+				log.Fatal("Error: pass -key or set AGENT_CAPABILITY_SIGNING_KEY; create a key with agent token keygen")
+			}
+			key, err := readSigningKey(*keyFile)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			token, err := capability.Issue(capability.Capability{
+				Subject:  *subject,
+				Tools:    splitList(*toolList),
+				Paths:    splitList(*paths),
+				MaxTurns: *maxTurns,
+				Budget:   *budget,
+				Expires:  time.Now().Add(*ttl).UTC().Truncate(time.Second),
+			}, key)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			fmt.Println(token)
+		case "keygen":
+			path := flags.Arg(1)
+			if path == "" {
+				flags.Usage()
+				os.Exit(2)
+			}
+			public, err := writeSigningKey(path)
+			if err != nil {
+				log.Fatalf("Error: %s", err.Error())
+			}
+			fmt.Printf("Wrote the signing key to %s. Issue tokens with agent token -key %s issue.\n", path, path)
+			fmt.Printf("Public key, for agent worker -capability-key:\n%s\n", public)
+		default:
+			flags.Usage()
+			os.Exit(2)
+		}
+	}
+}
+
+// splitList splits a comma-separated flag, dropping empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// sessionCapability is the capability a worker started this session with, if any.
+// A token that fails its check stops the session rather than run it unscoped.
+var sessionCapability = sync.OnceValue(func() *capability.Capability {
+	c, err := capability.FromEnv()
+	if err != nil {
+		log.Fatalf("Error: %s", err.Error())
+	}
+	return c
+})
+
+// capabilityTools drops the tools the session's capability does not allow, so the
+// model is not offered them
+func capabilityTools(defs []tools.ToolDefinition) []tools.ToolDefinition {
+	c := sessionCapability()
+	if c == nil || len(c.Tools) == 0 {
+		return defs
+	}
+	return slices.DeleteFunc(defs, func(def tools.ToolDefinition) bool { return !slices.Contains(c.Tools, def.Name) })
+}
+
+// capabilityAuthorizer checks each call against the session's capability
+func capabilityAuthorizer(c *capability.Capability) tools.Authorizer {
+	workspace, _ := os.Getwd()
+	return func(tool tools.ToolDefinition, input json.RawMessage) error {
+		var fields struct {
+			Path string `json:"path"`
+		}
+		json.Unmarshal(input, &fields)
+		return c.Check(tool.Name, fields.Path, workspace)
+	}
+}
+
+// allOf combines authorizers, allowing a call only if each of them does
+func allOf(authorizers []tools.Authorizer) tools.Authorizer {
+	return func(tool tools.ToolDefinition, input json.RawMessage) error {
+		for _, authorize := range authorizers {
+			if err := authorize(tool, input); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"agent/internal/config"
+	"agent/pkg/agent"
+	"agent/pkg/tools"
+)
+
+// projectConfig loads the config files once per process
+var projectConfig = sync.OnceValue(func() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Error: %s", err.Error())
+	}
+	return cfg
+})
+
+// projectTools returns the built-in tools with description overrides from the config
+// applied, and sets the post-processors edits go through and the monorepo scope. When
+// several search tools are available a search tool querying them all is added.
+func projectTools() []tools.ToolDefinition {
+	if processors := projectConfig().PostProcess; processors != nil {
+		if err := tools.SetPostProcessors(processors); err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+	}
+	if projects := projectConfig().Monorepo.Projects; len(projects) > 0 {
+		for _, project := range projects {
+			if info, err := os.Stat(project); err != nil || !info.IsDir() {
+				log.Fatalf("Error: monorepo project '%s' is not a directory", project)
+			}
+		}
+		tools.SetScope(projects)
+	}
+	if masked := projectConfig().MaskedFiles; len(masked.Paths) > 0 {
+		if err := tools.SetMaskedFiles(masked.Paths, masked.Patterns); err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+	}
+	var authorizers []tools.Authorizer
+	if policy := projectConfig().Policy; policy.URL != "" || len(policy.Files) > 0 {
+		authorizers = append(authorizers, toolPolicy(policy))
+	}
+	if c := sessionCapability(); c != nil {
+		authorizers = append(authorizers, capabilityAuthorizer(c))
+	}
+	if len(authorizers) > 0 {
+		tools.SetAuthorizer(allOf(authorizers))
+	}
+	defs := append(tools.GetTools(), tools.IndexTools(".")...)
+	if actions := projectActions(); len(actions) > 0 {
+		defs = append(defs, tools.ActionTool(actions))
+	}
+	overrides := projectConfig().Tools
+	for i, def := range defs {
+		if description := overrides[def.Name].Description; description != "" {
+			defs[i].Description = description
+		}
+	}
+	defs = capabilityTools(defs)
+	sources := tools.LocalSearchSources
+	for _, source := range projectConfig().SearchSources {
+		sources = append(sources, tools.SearchSource(source))
+	}
+	if search, ok := tools.SearchTool(defs, sources); ok {
+		defs = append(defs, search)
+	}
+	return defs
+}
+
+// actionsCache is where the inferred build, test and lint commands are cached,
+// relative to the project
+const actionsCache = ".agent/actions.json"
+
+// projectActions infers the project's build, test and lint commands once per process,
+// with the actions set in the config replacing or adding to them
+var projectActions = sync.OnceValue(func() []tools.Action {
+	actions := tools.InferActions(".", actionsCache)
+	configured := projectConfig().Actions
+	for i, action := range actions {
+		if command, ok := configured[action.Name]; ok {
+			actions[i] = tools.Action{Name: action.Name, Command: command, Source: "config"}
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(configured)) {
+		if !slices.ContainsFunc(actions, func(action tools.Action) bool { return action.Name == name }) {
+			actions = append(actions, tools.Action{Name: name, Command: configured[name], Source: "config"})
+		}
+	}
+	return slices.DeleteFunc(actions, func(action tools.Action) bool { return action.Command == "" })
+})
+
+// toolExamples returns an option adding the config's few-shot tool examples to the system prompt
+func toolExamples() agent.Option {
+	examples := map[string][]string{}
+	for name, tool := range projectConfig().Tools {
+		if len(tool.Examples) > 0 {
+			examples[name] = tool.Examples
+		}
+	}
+	return agent.WithToolExamples(examples)
+}
+
+// experiments combines the config's experimental section with the -experimental flag,
+// a comma-separated list where a leading - turns an experiment off
+func experiments(cfg *config.Config, flag string) (agent.Experiments, error) {
+	enabled := maps.Clone(cfg.Experimental)
+	if enabled == nil {
+		enabled = map[string]bool{}
+	}
+	for _, name := range strings.Split(flag, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			off := strings.HasPrefix(name, "-")
+			enabled[strings.TrimPrefix(name, "-")] = !off
+		}
+	}
+	return agent.ParseExperiments(enabled)
+}
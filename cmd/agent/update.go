@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultReleaseFeed is the latest release in the GitHub releases API
+const defaultReleaseFeed = "https://api.github.com/repos/joshuaisaact/Go-AI-Agent/releases/latest"
+
+// releaseKey is the base64 ed25519 public key release checksums are signed with, set
+// at build time with -ldflags "-X main.releaseKey=..."
+var releaseKey = ""
+
+// release is the part of a GitHub release the update reads
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// asset returns the download URL of the release asset called name
+func (r release) asset(name string) (string, error) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, nil
+		}
+	}
+	return "", fmt.Errorf("release %s has no asset '%s'", r.Tag, name)
+}
+
+// runUpdate replaces the running binary with the latest release. The release's
+// checksums.txt must carry a valid signature from the release key and name the
+// release, and the binary for this platform must match its checksum there, before
+// anything is replaced.
+func runUpdate(flags *flag.FlagSet) func() {
+	feed := flags.String("feed", defaultReleaseFeed, "URL of the latest release, in the GitHub releases API format.")
+	check := flags.Bool("check", false, "Only report whether a newer release is available.")
+	force := flags.Bool("force", false, "Install the latest release even if it is not newer than this build.")
+	publicKey := flags.String("public-key", releaseKey, "Base64 ed25519 public key the release checksums must be signed with.")
+	return func() {
+		transport, err := projectConfig().Network.Transport()
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		client := &http.Client{Transport: transport, Timeout: 5 * time.Minute}
+		ctx := context.Background()
+
+		var latest release
+		data, err := download(ctx, client, *feed)
+		if err == nil {
+			err = json.Unmarshal(data, &latest)
+		}
+		if err != nil {
+			log.Fatalf("Error reading release feed: %s", err.Error())
+		}
+		available := strings.TrimPrefix(latest.Tag, "v")
+		newer := version == "dev" || compareVersions(available, version) > 0
+		fmt.Printf("Current: %s\nLatest:  %s\n", version, available)
+		if *check {
+			if newer {
+				fmt.Println("An update is available; run agent update to install it.")
+			}
+			return
+		}
+		if !newer && !*force {
+			fmt.Println("Already up to date.")
+			return
+		}
+
+		if *publicKey == "" {
+			log.Fatal("Error: this build has no release key, so updates cannot be verified; pass -public-key")
+		}
+		key, err := base64.StdEncoding.DecodeString(*publicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			log.Fatal("Error: -public-key is not a base64 ed25519 public key")
+		}
+		name := "agent_" + runtime.GOOS + "_" + runtime.GOARCH
+		if runtime.GOOS == "windows" {
+			name += ".exe"
+		}
+		sums, err := verifiedChecksums(ctx, client, latest, ed25519.PublicKey(key))
+		if err != nil {
+			log.Fatalf("Error verifying release %s: %s", latest.Tag, err.Error())
+		}
+		sum, ok := sums[name]
+		if !ok {
+			log.Fatalf("Error: release %s has no checksum for '%s'", latest.Tag, name)
+		}
+		url, err := latest.asset(name)
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+		binary, err := download(ctx, client, url)
+		if err != nil {
+			log.Fatalf("Error downloading '%s': %s", name, err.Error())
+		}
+		if got := sha256.Sum256(binary); hex.EncodeToString(got[:]) != sum {
+			log.Fatalf("Error: '%s' does not match its checksum; not installing it", name)
+		}
+
+		path, err := replaceExecutable(binary)
+		if err != nil {
+			log.Fatalf("Error installing update: %s", err.Error())
+		}
+		fmt.Printf("Updated %s to %s\n", path, available)
+	}
+}
+
+// verifiedChecksums downloads the release's checksums.txt and its detached signature,
+// checks the signature against key and that the file names release r, and returns the
+// SHA-256 sums by file name. Binding the tag stops a feed from serving an older
+// signed release as the latest one.
+func verifiedChecksums(ctx context.Context, client *http.Client, r release, key ed25519.PublicKey) (map[string]string, error) {
+	sumsURL, err := r.asset("checksums.txt")
+	if err != nil {
+		return nil, err
+	}
+	sigURL, err := r.asset("checksums.txt.sig")
+	if err != nil {
+		return nil, err
+	}
+	content, err := download(ctx, client, sumsURL)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := download(ctx, client, sigURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) != ed25519.SignatureSize {
+		// Signatures are published raw or base64 encoded
+		signature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode signature: %w", err)
+		}
+	}
+	if !ed25519.Verify(key, content, signature) {
+		return nil, fmt.Errorf("checksums.txt is not signed by the release key")
+	}
+
+	// Lines are in sha256sum format: the hex sum, then the file name. A comment line,
+	// which sha256sum -c skips, names the release: # release v1.4.0
+	sums := map[string]string{}
+	var tag string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 3 && fields[0] == "#" && fields[1] == "release":
+			tag = fields[2]
+		case len(fields) == 2:
+			sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+		}
+	}
+	if tag == "" {
+		return nil, fmt.Errorf("checksums.txt does not name its release")
+	}
+	if tag != r.Tag {
+		return nil, fmt.Errorf("checksums.txt is signed for release %s, not %s", tag, r.Tag)
+	}
+	return sums, nil
+}
+
+// download fetches url, failing on any status other than 200
+func download(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request for '%s': %w", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// replaceExecutable writes binary next to the running executable and moves it into
+// place, so the old binary is only replaced once the new one is complete. The old one
+// is renamed aside first, which also works on Windows while it is running.
+func replaceExecutable(binary []byte) (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the running executable: %w", err)
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return "", fmt.Errorf("failed to resolve '%s': %w", path, err)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), ".agent-update-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write next to '%s': %w", path, err)
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(binary); err != nil {
+		temp.Close()
+		return "", fmt.Errorf("failed to write '%s': %w", temp.Name(), err)
+	}
+	if err := temp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write '%s': %w", temp.Name(), err)
+	}
+	if err := os.Chmod(temp.Name(), 0755); err != nil {
+		return "", fmt.Errorf("failed to make '%s' executable: %w", temp.Name(), err)
+	}
+
+	old := path + ".old"
+	if err := os.Rename(path, old); err != nil {
+		return "", fmt.Errorf("failed to move '%s' aside: %w", path, err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		os.Rename(old, path)
+		return "", fmt.Errorf("failed to move the update into '%s': %w", path, err)
+	}
+	// Windows keeps a running binary locked, so the old one may have to stay until next time
+	os.Remove(old)
+	return path, nil
+}
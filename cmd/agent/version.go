@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// version is the release this binary was built from, set at build time with
+// -ldflags "-X main.version=1.4.0". Builds from source report dev.
+var version = "dev"
+
+// versionString describes the build: the release, the commit and its time, whether
+// the tree had uncommitted changes, the Go version and the platform
+func versionString() string {
+	details := []string{runtime.Version(), runtime.GOOS + "/" + runtime.GOARCH}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		settings := map[string]string{}
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+		if revision := settings["vcs.revision"]; revision != "" {
+			if len(revision) > 12 {
+				revision = revision[:12]
+			}
+			if settings["vcs.modified"] == "true" {
+				revision += "-dirty"
+			}
+			commit := "commit " + revision
+			if built := settings["vcs.time"]; built != "" {
+				commit += " at " + built
+			}
+			details = append([]string{commit}, details...)
+		}
+	}
+	return fmt.Sprintf("agent %s (%s)", version, strings.Join(details, ", "))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"agent/pkg/agent"
+	"agent/pkg/tools"
+)
+
+// minViewerRows is the smallest terminal the file viewer will split
+const minViewerRows = 24
+
+// fileViewer keeps a pane at the top of the terminal showing the file the agent is
+// reading or editing, with the edited lines highlighted, while the conversation
+// scrolls below it. It uses a terminal scroll region rather than a full-screen UI, so
+// everything written with log and fmt keeps working.
+type fileViewer struct {
+	mu         sync.Mutex
+	rows, cols int
+	height     int                            // lines of file shown
+	pending    map[string]tools.EditFileInput // edit_file calls awaiting their result, by tool ID
+}
+
+// newFileViewer splits the terminal, failing when stdout is not a large enough terminal
+func newFileViewer() (*fileViewer, error) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("the file viewer needs a terminal")
+	}
+	var rows, cols int
+	if _, err := fmt.Sscan(string(out), &rows, &cols); err != nil || rows < minViewerRows {
+		return nil, fmt.Errorf("the terminal needs at least %d rows for the file viewer", minViewerRows)
+	}
+	v := &fileViewer{rows: rows, cols: cols, height: min(rows/3, 20), pending: map[string]tools.EditFileInput{}}
+	// Clear the screen, confine scrolling to the rows below the pane and start at the bottom
+	fmt.Printf("\u001b[2J\u001b[%d;%dr\u001b[%d;1H", v.height+2, rows, rows)
+	v.draw("no file open", nil, 0, 0)
+	return v, nil
+}
+
+// Close gives the whole terminal back to normal scrolling
+func (v *fileViewer) Close() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fmt.Printf("\u001b[r\u001b[%d;1H\n", v.rows)
+}
+
+// events shows the files named by read_file and edit_file calls, then passes every
+// event on to next
+func (v *fileViewer) events(next agent.EventHandler) agent.EventHandler {
+	return func(e agent.Event) {
+		switch {
+		case e.Type == agent.EventToolUse && e.ToolName == "read_file":
+			var in tools.ReadFileInput
+			if json.Unmarshal(e.Input, &in) == nil {
+				v.show(in.Path, "reading", "")
+			}
+		case e.Type == agent.EventToolUse && e.ToolName == "edit_file":
+			var in tools.EditFileInput
+			if json.Unmarshal(e.Input, &in) == nil {
+				v.mu.Lock()
+				v.pending[e.ToolID] = in
+				v.mu.Unlock()
+				v.show(in.Path, "editing", in.OldStr)
+			}
+		case e.Type == agent.EventToolResult && e.ToolName == "edit_file":
+			v.mu.Lock()
+			in, ok := v.pending[e.ToolID]
+			delete(v.pending, e.ToolID)
+			v.mu.Unlock()
+			if ok && !e.IsError {
+				v.show(in.Path, "edited", in.NewStr)
+			}
+		}
+		next(e)
+	}
+}
+
+// show displays path around the first occurrence of focus, highlighting it, or from
+// the top when focus is empty or not found
+func (v *fileViewer) show(path, action, focus string) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		v.draw(fmt.Sprintf("%s %s: %s", action, path, err.Error()), nil, 0, 0)
+		return
+	}
+	lines := strings.Split(string(content), "\n")
+	first, last := 0, -1
+	if index := strings.Index(string(content), focus); focus != "" && index >= 0 {
+		first = strings.Count(string(content)[:index], "\n")
+		last = first + strings.Count(focus, "\n")
+	}
+	v.draw(fmt.Sprintf("%s %s", action, path), lines, first, last)
+}
+
+// draw paints the pane: a window of lines centred on first..last, which are
+// highlighted, and a title bar beneath. The cursor is saved and restored around it
+// so the conversation carries on where it was.
+func (v *fileViewer) draw(title string, lines []string, first, last int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	top := 0
+	if last >= first {
+		pad := max(0, (v.height-(last-first+1))/2)
+		top = max(0, min(first-pad, len(lines)-v.height))
+	}
+	var b strings.Builder
+	b.WriteString("\u001b7")
+	for row := 0; row < v.height; row++ {
+		fmt.Fprintf(&b, "\u001b[%d;1H\u001b[2K", row+1)
+		n := top + row
+		if n >= len(lines) {
+			continue
+		}
+		text := fmt.Sprintf("%5d  %s", n+1, strings.ReplaceAll(lines[n], "\t", "    "))
+		if len(text) > v.cols {
+			text = text[:v.cols]
+		}
+		if n >= first && n <= last {
+			fmt.Fprintf(&b, "\u001b[30;102m%s\u001b[0m", text)
+		} else {
+			fmt.Fprintf(&b, "\u001b[90m%s\u001b[0m", text)
+		}
+	}
+	bar := " " + title + " "
+	if len(bar) > v.cols {
+		bar = bar[:v.cols]
+	}
+	fmt.Fprintf(&b, "\u001b[%d;1H\u001b[2K\u001b[7m%s%s\u001b[0m", v.height+1, bar, strings.Repeat(" ", v.cols-len(bar)))
+	b.WriteString("\u001b8")
+	fmt.Print(b.String())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"agent/pkg/agent"
+)
+
+const (
+	// sampleTemperature is the API's highest, so the samples explore different reasoning
+	sampleTemperature = 1.0
+	// judgeTemperature keeps the comparison of the samples deterministic
+	judgeTemperature = 0.0
+)
+
+// answerByVote samples n answers to a question in parallel with read-only tools, then
+// has a judge compare them and write the final answer
+func answerByVote(ctx context.Context, question string, n int, opts ...agent.Option) (string, error) {
+	client := newClient()
+	answers := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sampler := agent.NewAgent(client, nil, readOnlyTools(),
+				slices.Concat(opts, []agent.Option{agent.WithTemperature(sampleTemperature), agent.WithEventHandler(func(agent.Event) {})})...)
+			answers[i], errs[i] = sampler.RunTask(ctx, question)
+			log.Printf("Sample %d of %d done\n", i+1, n)
+		}()
+	}
+	wg.Wait()
+
+	var collected []string
+	for i, answer := range answers {
+		if errs[i] != nil {
+			log.Printf("Sample %d failed: %s\n", i+1, errs[i].Error())
+			continue
+		}
+		collected = append(collected, answer)
+	}
+	switch len(collected) {
+	case 0:
+		return "", fmt.Errorf("every sample failed: %w", errs[0])
+	case 1:
+		return collected[0], nil
+	}
+
+	var b strings.Builder
+	for i, answer := range collected {
+		fmt.Fprintf(&b, "<answer index=\"%d\">\n%s\n</answer>\n\n", i+1, answer)
+	}
+
+	prompt := fmt.Sprintf("%d answers were written independently to the question below. Compare them: where they "+
+		"agree, that is likely correct; where they disagree, work out which is right, using the tools to check "+
+		"the code if needed. Then write the single best final answer to the question. Do not mention the "+
+		"individual answers or this comparison.\n\n<question>\n%s\n</question>\n\n%s", len(collected), question, b.String())
+	judge := agent.NewAgent(client, nil, readOnlyTools(), slices.Concat(opts, []agent.Option{agent.WithTemperature(judgeTemperature)})...)
+	return judge.RunTask(ctx, prompt)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent/internal/capability"
+	"agent/internal/jobs"
+)
+
+// runWorker consumes tasks from a queue and runs each one as a non-interactive agent job
+func runWorker(flags *flag.FlagSet) func() {
+	queueURL := flags.String("queue", "-", "Task source: nats://host:4222, an SQS queue URL (sqs:// or https://sqs.), a JSON-lines file, or - for stdin (results go to stdout).")
+	subject := flags.String("subject", "agent.tasks", "NATS subject to consume tasks from.")
+	group := flags.String("group", "agent-workers", "NATS queue group shared by cooperating workers.")
+	resultSubject := flags.String("results", "agent.results", "NATS subject, or SQS queue URL, for results of tasks sent without a reply subject or ReplyTo attribute.")
+	concurrency := flags.Int("concurrency", 2, "Maximum number of tasks run at once.")
+	maxTurns := flags.Int("max-turns", 50, "Default maximum model calls per task.")
+	taskTimeout := flags.Duration("task-timeout", 30*time.Minute, "Default deadline for each task.")
+	shutdownTimeout := flags.Duration("shutdown-timeout", 5*time.Minute, "How long to let in-flight tasks finish after SIGINT/SIGTERM.")
+	capabilityKey := flags.String("capability-key", os.Getenv(capability.KeyEnv), "Base64 ed25519 public key task tokens are signed with. When set, tasks need a valid token. Defaults to $AGENT_CAPABILITY_KEY.")
+	return func() {
+		// Tasks would fail one by one without credentials, from the environment, the
+		// keychain or a login, so check for them up front
+		newClient()
+		var key ed25519.PublicKey
+		if *capabilityKey != "" {
+			var err error
+			if key, err = parsePublicKey(*capabilityKey); err != nil {
+				log.Fatal("Error: -capability-key is not a base64 ed25519 public key")
+			}
+		}
+		executable, err := os.Executable()
+		if err != nil {
+			log.Fatalf("Error locating agent executable: %s", err.Error())
+		}
+		dir, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Error: %s", err.Error())
+		}
+
+		ctx, stopReceiving := context.WithCancel(context.Background())
+		defer stopReceiving()
+		jobCtx, cancelJobs := context.WithCancel(context.Background())
+		defer cancelJobs()
+
+		var queue jobs.Queue
+		switch {
+		case strings.HasPrefix(*queueURL, "nats://"):
+			natsQueue, err := jobs.DialNATS(ctx, *queueURL, *subject, *group, *resultSubject)
+			if err != nil {
+				log.Fatalf("Error connecting to queue: %s", err.Error())
+			}
+			defer natsQueue.Close()
+			queue = natsQueue
+		case strings.HasPrefix(*queueURL, "sqs://") || strings.HasPrefix(*queueURL, "https://sqs."):
+			results := *resultSubject
+			if !strings.Contains(results, "://") {
+				results = ""
+			}
+			sqsQueue, err := jobs.NewSQSQueue(*queueURL, results)
+			if err != nil {
+				log.Fatalf("Error connecting to queue: %s", err.Error())
+			}
+			queue = sqsQueue
+		case *queueURL == "-":
+			queue = jobs.NewLineQueue(os.Stdin, os.Stdout)
+		default:
+			file, err := os.Open(*queueURL)
+			if err != nil {
+				log.Fatalf("Error opening task file: %s", err.Error())
+			}
+			defer file.Close()
+			queue = jobs.NewLineQueue(file, os.Stdout)
+		}
+
+		worker := &jobs.Worker{
+			Queue:         queue,
+			Concurrency:   *concurrency,
+			Executable:    executable,
+			MaxTurns:      *maxTurns,
+			Timeout:       *taskTimeout,
+			CapabilityKey: key,
+			AuditLog:      filepath.Join(dir, defaultAuditLog),
+			ArtifactDir:   filepath.Join(dir, defaultArtifactDir),
+		}
+
+		go func() {
+			sig := <-notifyShutdown()
+			log.Printf("Received %s, waiting up to %s for in-flight tasks (signal again to force)\n", sig, *shutdownTimeout)
+			stopReceiving()
+			time.AfterFunc(*shutdownTimeout, cancelJobs)
+		}()
+
+		log.Printf("Worker started with concurrency %d\n", *concurrency)
+		if err := worker.Run(ctx, jobCtx); err != nil {
+			log.Fatalf("Worker stopped: %s", err.Error())
+		}
+	}
+}
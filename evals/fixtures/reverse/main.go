@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+// reverse returns s with its characters in reverse order
+func reverse(s string) string {
+	runes := []rune(s)
+	for i := range runes {
+		j := len(runes) - 1 - i
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func main() {
+	fmt.Println(reverse("hello"))
+}
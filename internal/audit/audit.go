@@ -0,0 +1,260 @@
+// Package audit keeps an append-only JSON-lines record of what the agent did, kept
+// apart from the terminal output so nothing important is lost to scrollback. Entries
+// are hash-chained, and optionally signed, so changes to the record can be detected.
+package audit
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is one audited action
+type Entry struct {
+	Time     time.Time       `json:"time"`
+	Session  string          `json:"session,omitempty"`
+	Ref      string          `json:"ref,omitempty"`
+	Type     string          `json:"type"`
+	Tool     string          `json:"tool,omitempty"`
+	Input    json.RawMessage `json:"input,omitempty"`
+	Text     string          `json:"text,omitempty"`
+	Severity string          `json:"severity,omitempty"`
+	IsError  bool            `json:"is_error,omitempty"`
+	// Prev is the hash of the entry before, so removing, inserting or editing an
+	// entry breaks the chain from there on
+	Prev string `json:"prev,omitempty"`
+	// Hash is the SHA-256 of the entry without Hash and Sig, in hex
+	Hash string `json:"hash,omitempty"`
+	// Sig is the base64 ed25519 signature of Hash, when the log is signed
+	Sig string `json:"sig,omitempty"`
+}
+
+// digest computes the entry's hash over everything but Hash and Sig
+func (e Entry) digest() (string, error) {
+	e.Hash, e.Sig = "", ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends entries to a file. It is safe for concurrent use, including by several
+// processes sharing the file, such as best-of-N candidates.
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+	key  ed25519.PrivateKey
+}
+
+// Open opens the audit log at path for appending, creating it and its directory if
+// needed. Entries are signed with key unless it is nil.
+func Open(path string, key ed25519.PrivateKey) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory for '%s': %w", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log '%s': %w", path, err)
+	}
+	return &Log{file: file, key: key}, nil
+}
+
+// Record appends e, stamping it with the current time if it has none, and chains it
+// to the entry last written by any process
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	unlock, err := lockFile(l.file.Name() + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	prev, intact, err := lastHash(l.file)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log '%s': %w", l.file.Name(), err)
+	}
+	e.Prev = prev
+	if e.Hash, err = e.digest(); err != nil {
+		return err
+	}
+	if l.key != nil {
+		e.Sig = base64.StdEncoding.EncodeToString(ed25519.Sign(l.key, []byte(e.Hash)))
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	if !intact {
+		// Start a new line after a partly written one; Verify reports the break
+		line = append([]byte{'\n'}, line...)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log '%s': %w", l.file.Name(), err)
+	}
+	return nil
+}
+
+// Close closes the underlying file
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// lockTimeout is how long Record waits for another process to finish writing, and
+// how old a lock file must be to be taken as left behind by a crash
+const lockTimeout = 5 * time.Second
+
+// lockFile takes an exclusive lock by creating path, returning the function that
+// releases it
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		lock, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			lock.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock audit log: %w", err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockTimeout {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the audit log lock '%s'", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// lastHash returns the hash of the file's last entry, or "" when it is empty or the
+// entry predates hashing. It reports false if the last line is not a whole entry.
+func lastHash(file *os.File) (string, bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", false, err
+	}
+	// Read backwards until the start of the last line
+	var tail []byte
+	for end := info.Size(); end > 0; {
+		start := max(0, end-4096)
+		chunk := make([]byte, end-start)
+		if _, err := file.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return "", false, err
+		}
+		tail = append(chunk, tail...)
+		end = start
+		if i := lastLineStart(tail); i >= 0 {
+			tail = tail[i:]
+			break
+		}
+	}
+	var last struct {
+		Hash string `json:"hash"`
+	}
+	if len(tail) > 0 && (tail[len(tail)-1] != '\n' || json.Unmarshal(tail, &last) != nil) {
+		return "", false, nil
+	}
+	return last.Hash, true, nil
+}
+
+// lastLineStart returns where the last line of data begins, or -1 if data may not
+// hold all of it
+func lastLineStart(data []byte) int {
+	end := len(data)
+	for end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	for i := end - 1; i >= 0; i-- {
+		if data[i] == '\n' {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// Report summarises a verified log
+type Report struct {
+	// Entries counts all entries; Unchained the ones written before hashing was added
+	Entries, Unchained, Signed int
+	// Last is the hash of the final entry. Recording it elsewhere lets a later check
+	// detect entries removed from the end, which the chain alone cannot.
+	Last string
+}
+
+// Verify checks that every entry of the log in r is intact and chained to the one
+// before, and when key is not nil that each carries a valid signature by it. Only the
+// first unhashed entries, written before hashing was added, may lack a hash; any
+// further unhashed entry fails, since stripping the hashes would otherwise pass as
+// an old log. A signed log has none. The error names the first line that fails.
+func Verify(r io.Reader, key ed25519.PublicKey, unhashed int) (Report, error) {
+	var report Report
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	chained := false
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return report, fmt.Errorf("line %d is not a valid entry: %w", line, err)
+		}
+		report.Entries++
+		if e.Hash == "" {
+			switch {
+			case chained:
+				return report, fmt.Errorf("line %d has no hash, though the entries before it are chained", line)
+			case key != nil:
+				return report, fmt.Errorf("line %d has no hash, so it is not signed", line)
+			case report.Unchained >= unhashed:
+				return report, fmt.Errorf("line %d has no hash; %d entries were expected from before hashing", line, unhashed)
+			}
+			report.Unchained++
+			continue
+		}
+		if !chained && e.Prev != "" {
+			return report, fmt.Errorf("line %d continues a chain whose earlier entries are missing", line)
+		}
+		if chained && e.Prev != report.Last {
+			return report, fmt.Errorf("line %d does not follow the entry before it; entries were removed, inserted or reordered", line)
+		}
+		digest, err := e.digest()
+		if err != nil {
+			return report, err
+		}
+		if digest != e.Hash {
+			return report, fmt.Errorf("line %d was modified after it was written", line)
+		}
+		if e.Sig != "" {
+			signature, err := base64.StdEncoding.DecodeString(e.Sig)
+			if err != nil || (key != nil && !ed25519.Verify(key, []byte(e.Hash), signature)) {
+				return report, fmt.Errorf("line %d has an invalid signature", line)
+			}
+			report.Signed++
+		} else if key != nil {
+			return report, fmt.Errorf("line %d is not signed", line)
+		}
+		chained, report.Last = true, e.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLog records n entries signed with key, or unsigned if it is nil, and returns
+// the log's lines
+func writeLog(t *testing.T, n int, key ed25519.PrivateKey) []string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range n {
+		if err := l.Record(Entry{Type: "tool_call", Tool: "edit_file", Text: strings.Repeat("x", i+1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// strip removes the hash, prev and sig of a line, as if it was written before hashing
+func strip(t *testing.T, line string) string {
+	var e Entry
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		t.Fatal(err)
+	}
+	e.Hash, e.Prev, e.Sig = "", "", ""
+	data, _ := json.Marshal(e)
+	return string(data)
+}
+
+func TestVerify(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	otherPublic, _, _ := ed25519.GenerateKey(nil)
+	tests := []struct {
+		name     string
+		signed   bool
+		key      ed25519.PublicKey
+		unhashed int
+		tamper   func(lines []string) []string
+		err      string
+	}{
+		{name: "intact", tamper: func(l []string) []string { return l }},
+		{name: "intact signed", signed: true, key: public, tamper: func(l []string) []string { return l }},
+		{name: "edit", tamper: func(l []string) []string {
+			l[1] = strings.Replace(l[1], `"text":"xx"`, `"text":"yy"`, 1)
+			return l
+		}, err: "line 2 was modified"},
+		{name: "delete", tamper: func(l []string) []string { return append(l[:1], l[2:]...) }, err: "line 2 does not follow"},
+		{name: "reorder", tamper: func(l []string) []string {
+			l[1], l[2] = l[2], l[1]
+			return l
+		}, err: "line 2 does not follow"},
+		{name: "truncate front", tamper: func(l []string) []string { return l[1:] }, err: "line 1 continues a chain"},
+		{name: "downgrade", tamper: func(l []string) []string {
+			for i := range l {
+				l[i] = strip(t, l[i])
+			}
+			return l
+		}, err: "line 1 has no hash"},
+		{name: "downgrade signed", signed: true, key: public, tamper: func(l []string) []string {
+			for i := range l {
+				l[i] = strip(t, l[i])
+			}
+			return l
+		}, err: "line 1 has no hash, so it is not signed"},
+		{name: "downgrade beyond legacy prefix", unhashed: 1, tamper: func(l []string) []string {
+			for i := range l {
+				l[i] = strip(t, l[i])
+			}
+			return l
+		}, err: "line 2 has no hash"},
+		{name: "legacy prefix", unhashed: 1, tamper: func(l []string) []string {
+			// A chain starting after one old entry, as when hashing was turned on
+			return append([]string{strip(t, l[0])}, writeLog(t, 2, nil)...)
+		}},
+		{name: "unhashed after chain", unhashed: 4, tamper: func(l []string) []string {
+			l[2] = strip(t, l[2])
+			return l
+		}, err: "line 3 has no hash, though the entries before it are chained"},
+		{name: "wrong key", signed: true, key: otherPublic, tamper: func(l []string) []string { return l }, err: "line 1 has an invalid signature"},
+		{name: "unsigned with key", key: public, tamper: func(l []string) []string { return l }, err: "line 1 is not signed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var key ed25519.PrivateKey
+			if tt.signed {
+				key = private
+			}
+			lines := tt.tamper(writeLog(t, 4, key))
+			report, err := Verify(strings.NewReader(strings.Join(lines, "\n")+"\n"), tt.key, tt.unhashed)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("Verify = %v; want intact", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("Verify = %+v, %v; want error %q", report, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package capability issues and checks signed tokens that scope what one agent session
+// may do, so a single worker deployment can serve sessions with different privileges
+package capability
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// prefix versions the token format
+const prefix = "v1."
+
+// TokenEnv and KeyEnv pass a session its token and the public key it is checked by
+const (
+	TokenEnv = "AGENT_CAPABILITY_TOKEN"
+	KeyEnv   = "AGENT_CAPABILITY_KEY"
+)
+
+// Capability is what a token allows. Empty fields do not restrict.
+type Capability struct {
+	// Subject is the ID of the task the token was issued for, if it is bound to one
+	Subject string `json:"sub,omitempty"`
+	// Tools are the names of the tools the session may call
+	Tools []string `json:"tools,omitempty"`
+	// Paths are the directories, relative to the workspace, that tool paths must lie in
+	Paths []string `json:"paths,omitempty"`
+	// MaxTurns caps the model calls per message, and Budget the tokens of the session
+	MaxTurns int       `json:"max_turns,omitempty"`
+	Budget   int64     `json:"budget,omitempty"`
+	Expires  time.Time `json:"exp"`
+}
+
+// Issue signs c into a token
+func Issue(c Capability, key ed25519.PrivateKey) (string, error) {
+	claims, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal capability: %w", err)
+	}
+	payload := prefix + base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(payload))), nil
+}
+
+// Parse checks the token's signature by key and its expiry, and returns what it allows
+func Parse(token string, key ed25519.PublicKey) (Capability, error) {
+	payload, signature, ok := strings.Cut(strings.TrimPrefix(token, prefix), ".")
+	if !ok || !strings.HasPrefix(token, prefix) {
+		return Capability{}, errors.New("malformed capability token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(key, []byte(prefix+payload), sig) {
+		return Capability{}, errors.New("capability token has an invalid signature")
+	}
+	claims, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Capability{}, errors.New("malformed capability token")
+	}
+	var c Capability
+	if err := json.Unmarshal(claims, &c); err != nil {
+		return Capability{}, fmt.Errorf("malformed capability token: %w", err)
+	}
+	if !c.Expires.IsZero() && time.Now().After(c.Expires) {
+		return Capability{}, fmt.Errorf("capability token expired at %s", c.Expires.Format(time.RFC3339))
+	}
+	return c, nil
+}
+
+// Check returns an error unless c allows calling tool on path, which is relative to
+// the workspace or absolute. An empty path stands for the workspace itself.
+func (c Capability) Check(tool, path, workspace string) error {
+	if len(c.Tools) > 0 && !slices.Contains(c.Tools, tool) {
+		return fmt.Errorf("this session's capability does not include %s; it allows %s", tool, strings.Join(c.Tools, ", "))
+	}
+	if len(c.Paths) == 0 {
+		return nil
+	}
+	target := resolve(workspace, path)
+	for _, root := range c.Paths {
+		root = resolve(workspace, root)
+		if rel, err := filepath.Rel(root, target); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	if path == "" {
+		path = "the workspace root"
+	}
+	return fmt.Errorf("this session's capability does not cover %s; pass a path under %s", path, strings.Join(c.Paths, ", "))
+}
+
+// resolve makes path absolute against workspace, following symlinks where it exists,
+// so a link cannot lead outside the allowed roots
+func resolve(workspace, path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workspace, path)
+	}
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	// A file about to be created: resolve the directory it goes in
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		return filepath.Join(dir, filepath.Base(path))
+	}
+	return path
+}
+
+// FromEnv reads the token a worker hands the session it starts, with the key to check
+// it by. It returns nil when the session has no capability.
+func FromEnv() (*Capability, error) {
+	token := os.Getenv(TokenEnv)
+	if token == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(os.Getenv(KeyEnv))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New(KeyEnv + " is not a base64 ed25519 public key")
+	}
+	c, err := Parse(token, key)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
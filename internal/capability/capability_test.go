@@ -0,0 +1,107 @@
+package capability
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	workspace := t.TempDir()
+	outside := t.TempDir()
+	for _, dir := range []string{"src/app", "srcs", "docs"} {
+		if err := os.MkdirAll(filepath.Join(workspace, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Links inside the allowed root that lead out of it, and one leading into it
+	if err := os.Symlink(outside, filepath.Join(workspace, "src", "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(workspace, "src", "app"), filepath.Join(workspace, "docs", "app")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Capability{Tools: []string{"read_file", "edit_file"}, Paths: []string{"src"}}
+	tests := []struct {
+		tool, path string
+		want       string // substring of the error, or empty when allowed
+	}{
+		{"read_file", "src/app/main.go", ""},
+		{"read_file", "src", ""},
+		{"read_file", "./src/../src/app", ""},
+		{"edit_file", "src/app/new.go", ""},
+		{"read_file", filepath.Join(workspace, "src", "app"), ""},
+		{"read_file", "docs/app/main.go", ""},
+		{"ripgrep", "src/app", "does not include ripgrep"},
+		{"read_file", "", "does not cover the workspace root"},
+		{"read_file", "srcs/x.go", "does not cover"},
+		{"read_file", "src/../docs/readme.md", "does not cover"},
+		{"read_file", "../outside", "does not cover"},
+		{"read_file", outside, "does not cover"},
+		{"read_file", "src/escape/secret", "does not cover"},
+		{"edit_file", "src/escape/new.go", "does not cover"},
+	}
+	for _, tt := range tests {
+		err := c.Check(tt.tool, tt.path, workspace)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("Check(%s, %q) = %v; want allowed", tt.tool, tt.path, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("Check(%s, %q) = %v; want error containing %q", tt.tool, tt.path, err, tt.want)
+		}
+	}
+
+	if err := (Capability{}).Check("run_action", "../anywhere", workspace); err != nil {
+		t.Errorf("empty capability refused a call: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(c Capability) string {
+		token, err := Issue(c, private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := issue(Capability{Subject: "task-1", Tools: []string{"read_file"}, Expires: time.Now().Add(time.Hour)})
+
+	c, err := Parse(valid, public)
+	if err != nil || c.Subject != "task-1" || len(c.Tools) != 1 {
+		t.Errorf("Parse = %+v, %v", c, err)
+	}
+
+	payload, _, _ := strings.Cut(strings.TrimPrefix(valid, prefix), ".")
+	_, signature, _ := strings.Cut(strings.TrimPrefix(issue(Capability{Subject: "task-2"}), prefix), ".")
+	tests := map[string]struct {
+		token string
+		key   ed25519.PublicKey
+		want  string
+	}{
+		"other key":         {valid, otherPublic, "invalid signature"},
+		"swapped signature": {prefix + payload + "." + signature, public, "invalid signature"},
+		"no version":        {strings.TrimPrefix(valid, prefix), public, "malformed"},
+		"no signature":      {prefix + payload, public, "malformed"},
+		"expired":           {issue(Capability{Expires: time.Now().Add(-time.Minute)}), public, "expired"},
+	}
+	for name, tt := range tests {
+		if _, err := Parse(tt.token, tt.key); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Parse = %v; want error containing %q", name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectPath is the per-project config file, relative to the working directory
+const ProjectPath = ".agent/config.yaml"
+
+// Config is the agent's file-based configuration
+type Config struct {
+	Network Network `yaml:"network"`
+	// Tools tunes the built-in tools by name
+	Tools map[string]Tool `yaml:"tools"`
+	// Language is the language the model replies in: auto to match the user's
+	// messages, a language name, or off
+	Language string `yaml:"language"`
+	// Keys remaps the line editor's actions (submit, newline, cancel, expand and
+	// history-search) to comma-separated keys such as ctrl+j or alt+enter
+	Keys map[string]string `yaml:"keys"`
+	// Experimental turns experimental behaviours on or off by name, such as
+	// parallel_tools: true. A project setting overrides the user's for the same name.
+	Experimental map[string]bool `yaml:"experimental"`
+	Telemetry    Telemetry       `yaml:"telemetry"`
+	// PostProcess lists the post-processors applied to the text edit_file writes, in
+	// order. Unset means tools.DefaultPostProcessors; an empty list turns them off.
+	PostProcess   []string      `yaml:"post_process"`
+	SensitiveDirs SensitiveDirs `yaml:"sensitive_dirs"`
+	MaskedFiles   MaskedFiles   `yaml:"masked_files"`
+	Monorepo      Monorepo      `yaml:"monorepo"`
+	// Actions sets commands run_action runs by name, over the build, test and lint
+	// commands inferred from the project, e.g. test: go test -race ./...
+	Actions   map[string]string `yaml:"actions"`
+	SubAgents SubAgents         `yaml:"sub_agents"`
+	// Templates are directories of templates agent scaffold generates modules from,
+	// looked up by directory name
+	Templates []string `yaml:"templates"`
+	// SearchSources are more tools the search tool fans queries out to, alongside
+	// ripgrep and the symbol indexes, such as a code search server's tool
+	SearchSources []SearchSource `yaml:"search_sources"`
+	// Policy is only read from the user config, so a project cannot loosen it
+	Policy Policy `yaml:"policy"`
+}
+
+// Policy checks every tool call against Rego policies with Open Policy Agent, given
+// the tool, its path or command, the user and the workspace
+type Policy struct {
+	// URL is an OPA decision endpoint, e.g. http://localhost:8181/v1/data/agent/tools
+	URL string `yaml:"url"`
+	// Files are Rego files or directories evaluated locally with opa eval, when no
+	// URL is set
+	Files []string `yaml:"files"`
+	// Query is the rule opa eval evaluates, data.agent.tools by default
+	Query string `yaml:"query"`
+}
+
+// SubAgents lets the model hand sub-tasks to sub-agents with the delegate tool
+type SubAgents struct {
+	// MaxDepth is how many levels of sub-agents may nest below the top agent. Zero
+	// disables sub-agents.
+	MaxDepth int `yaml:"max_depth"`
+	// Budget caps the tokens the agent and all its sub-agents use between them. Zero
+	// means no shared limit.
+	Budget int64 `yaml:"budget"`
+}
+
+// SearchSource is a tool the search tool sends queries to
+type SearchSource struct {
+	Tool string `yaml:"tool"`
+	// Field is the input field the query goes in, query by default
+	Field string `yaml:"field"`
+	// Regex says the tool takes a regular expression, so plain queries are quoted
+	Regex bool `yaml:"regex"`
+	// Symbols says the tool looks up exact symbol names, so only identifiers are sent
+	Symbols bool `yaml:"symbols"`
+}
+
+// Monorepo declares the sub-projects of a large monorepo that matter, relative to the
+// project directory. Listings, searches and indexes default to them instead of the
+// whole tree, and /expand adds more during a session.
+type Monorepo struct {
+	Projects []string `yaml:"projects"`
+}
+
+// MaskedFiles marks files holding personal data, such as fixtures built from customer
+// records or database dumps. What the tools read from them has emails, phone numbers
+// and names masked before it reaches the model.
+type MaskedFiles struct {
+	// Paths are glob patterns relative to the project directory, in which ** matches
+	// any number of directories, e.g. testdata/fixtures/** or **/*.sql
+	Paths []string `yaml:"paths"`
+	// Patterns are regular expressions also masked in those files, such as account
+	// numbers
+	Patterns []string `yaml:"patterns"`
+}
+
+// SensitiveDirs guards against starting the agent in a directory no project lives in,
+// such as the home directory or /etc
+type SensitiveDirs struct {
+	// Paths are added to the built-in list. A leading ~ is the home directory, and a
+	// trailing /** covers the directories below as well.
+	Paths []string `yaml:"paths"`
+	// Action is read-only, the default, to run without the tools that change files,
+	// or refuse to not start at all
+	Action string `yaml:"action"`
+}
+
+// Telemetry says where anonymous usage reports go for users who enable them with
+// agent telemetry enable. Without an endpoint nothing is sent. The endpoint is only
+// read from the user config.
+type Telemetry struct {
+	Endpoint string `yaml:"endpoint"`
+}
+
+// Tool adjusts how a tool is presented to the model
+type Tool struct {
+	// Description replaces the built-in description
+	Description string `yaml:"description"`
+	// Examples are few-shot usage notes added to the system prompt
+	Examples []string `yaml:"examples"`
+}
+
+// Network configures how the agent reaches the model API. It is only read from the
+// user config.
+type Network struct {
+	// BaseURL replaces the API endpoint, e.g. for an internal gateway
+	BaseURL string `yaml:"base_url"`
+	// Proxy is an http(s):// proxy URL. When empty, HTTPS_PROXY, HTTP_PROXY and
+	// NO_PROXY from the environment are used.
+	Proxy string `yaml:"proxy"`
+	// CACerts lists PEM files trusted in addition to the system roots
+	CACerts []string `yaml:"ca_certs"`
+	// LowBandwidth truncates tool results and compresses stored sessions, for
+	// metered or high-latency links
+	LowBandwidth bool `yaml:"low_bandwidth"`
+}
+
+// UserPath returns the per-user config file location
+func UserPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "agent", "config.yaml"), nil
+}
+
+// Load reads the user config and then the project config, so settings in the
+// project file override the user's. Missing files are skipped. The policy, the
+// network settings and the telemetry endpoint are only read from the user config:
+// they decide where requests and credentials go, which a cloned repository must not.
+func Load() (*Config, error) {
+	cfg := &Config{}
+	paths := []string{ProjectPath}
+	if user, err := UserPath(); err == nil {
+		paths = []string{user, ProjectPath}
+	}
+	var policy Policy
+	var network Network
+	var endpoint string
+	for _, path := range paths {
+		if err := cfg.merge(path); err != nil {
+			return nil, err
+		}
+		if path != ProjectPath {
+			policy, network, endpoint = cfg.Policy, cfg.Network, cfg.Telemetry.Endpoint
+		}
+	}
+	cfg.Policy, cfg.Network, cfg.Telemetry.Endpoint = policy, network, endpoint
+	return cfg, nil
+}
+
+// merge decodes the file at path over cfg; fields the file does not set are kept
+func (c *Config) merge(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config '%s': %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("failed to parse config '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package conflict
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Hunk is one conflicted region of a file
+type Hunk struct {
+	// The labels are the names git wrote after each marker
+	OursLabel   string
+	BaseLabel   string
+	TheirsLabel string
+	Ours        string
+	// Base is only available with merge.conflictStyle=diff3 or zdiff3, which HasBase
+	// reports. It is empty when both sides added the code.
+	Base    string
+	HasBase bool
+	Theirs  string
+	// StartLine is the 1-based line of the opening marker
+	StartLine int
+}
+
+// File is a conflicted file split into the text between hunks and the hunks themselves.
+// Segments has len(Hunks)+1 entries: Segments[i] precedes Hunks[i].
+type File struct {
+	Segments []string
+	Hunks    []Hunk
+}
+
+// Parse splits content at git conflict markers
+func Parse(content string) (*File, error) {
+	const (
+		outside = iota
+		inOurs
+		inBase
+		inTheirs
+	)
+
+	file := &File{}
+	var segment, ours, base, theirs strings.Builder
+	var hunk Hunk
+	state := outside
+
+	lines := strings.SplitAfter(content, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case state == outside && strings.HasPrefix(trimmed, "<<<<<<<"):
+			hunk = Hunk{OursLabel: strings.TrimSpace(trimmed[7:]), StartLine: i + 1}
+			state = inOurs
+		case state == inOurs && strings.HasPrefix(trimmed, "|||||||"):
+			hunk.BaseLabel = strings.TrimSpace(trimmed[7:])
+			hunk.HasBase = true
+			state = inBase
+		case (state == inOurs || state == inBase) && trimmed == "=======":
+			state = inTheirs
+		case state == inTheirs && strings.HasPrefix(trimmed, ">>>>>>>"):
+			hunk.TheirsLabel = strings.TrimSpace(trimmed[7:])
+			hunk.Ours, hunk.Base, hunk.Theirs = ours.String(), base.String(), theirs.String()
+			file.Segments = append(file.Segments, segment.String())
+			file.Hunks = append(file.Hunks, hunk)
+			segment.Reset()
+			ours.Reset()
+			base.Reset()
+			theirs.Reset()
+			state = outside
+		case state == inOurs:
+			ours.WriteString(line)
+		case state == inBase:
+			base.WriteString(line)
+		case state == inTheirs:
+			theirs.WriteString(line)
+		default:
+			segment.WriteString(line)
+		}
+	}
+	if state != outside {
+		return nil, fmt.Errorf("unterminated conflict starting at line %d", hunk.StartLine)
+	}
+	file.Segments = append(file.Segments, segment.String())
+	return file, nil
+}
+
+// Context returns up to n lines of the file immediately before and after hunk i
+func (f *File) Context(i, n int) (before, after string) {
+	beforeLines := strings.SplitAfter(strings.TrimSuffix(f.Segments[i], "\n"), "\n")
+	if len(beforeLines) > n {
+		beforeLines = beforeLines[len(beforeLines)-n:]
+	}
+	afterLines := strings.SplitAfter(f.Segments[i+1], "\n")
+	if len(afterLines) > n {
+		afterLines = afterLines[:n]
+	}
+	before = strings.Join(beforeLines, "")
+	if before != "" {
+		before += "\n"
+	}
+	return before, strings.Join(afterLines, "")
+}
+
+// Render rebuilds the file, replacing each hunk with its entry in resolutions. A nil
+// entry keeps the original conflict markers so the hunk stays unresolved.
+func (f *File) Render(resolutions []*string) string {
+	var b strings.Builder
+	for i, hunk := range f.Hunks {
+		b.WriteString(f.Segments[i])
+		if i < len(resolutions) && resolutions[i] != nil {
+			b.WriteString(*resolutions[i])
+			continue
+		}
+		b.WriteString(markers(hunk))
+	}
+	b.WriteString(f.Segments[len(f.Segments)-1])
+	return b.String()
+}
+
+func markers(h Hunk) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace("<<<<<<< "+h.OursLabel) + "\n")
+	b.WriteString(h.Ours)
+	if h.HasBase {
+		b.WriteString(strings.TrimSpace("||||||| "+h.BaseLabel) + "\n")
+		b.WriteString(h.Base)
+	}
+	b.WriteString("=======\n")
+	b.WriteString(h.Theirs)
+	b.WriteString(strings.TrimSpace(">>>>>>> "+h.TheirsLabel) + "\n")
+	return b.String()
+}
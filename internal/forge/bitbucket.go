@@ -0,0 +1,156 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Bitbucket implements Forge for a Bitbucket Cloud repository
+type Bitbucket struct {
+	api  apiClient
+	repo string
+}
+
+// NewBitbucket creates a Bitbucket forge for repo ("workspace/slug"). The token is
+// either an access token or "username:app-password".
+func NewBitbucket(repo, token string) *Bitbucket {
+	return &Bitbucket{
+		repo: repo,
+		api: apiClient{
+			name:    "bitbucket",
+			baseURL: "https://api.bitbucket.org/2.0",
+			authorize: func(req *http.Request) {
+				if user, password, ok := strings.Cut(token, ":"); ok {
+					req.SetBasicAuth(user, password)
+				} else if token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+			},
+		},
+	}
+}
+
+// Name identifies the forge
+func (b *Bitbucket) Name() string { return "bitbucket" }
+
+type bitbucketPullRequest struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Links       struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
+	Source      bitbucketEndpoint `json:"source"`
+	Destination bitbucketEndpoint `json:"destination"`
+}
+
+type bitbucketEndpoint struct {
+	Branch struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+func (p bitbucketPullRequest) toChangeRequest() *ChangeRequest {
+	return &ChangeRequest{
+		Number:   p.ID,
+		Title:    p.Title,
+		Body:     p.Description,
+		URL:      p.Links.HTML.Href,
+		HeadRef:  p.Source.Branch.Name,
+		BaseRef:  p.Destination.Branch.Name,
+		FromFork: p.Source.Repository.FullName != p.Destination.Repository.FullName,
+	}
+}
+
+func bitbucketComment(body string) map[string]any {
+	return map[string]any{"content": map[string]string{"raw": body}}
+}
+
+// CommentOnIssue comments on an issue in the repository's issue tracker
+func (b *Bitbucket) CommentOnIssue(ctx context.Context, number int, body string) error {
+	path := fmt.Sprintf("/repositories/%s/issues/%d/comments", b.repo, number)
+	return b.api.do(ctx, http.MethodPost, path, bitbucketComment(body), nil)
+}
+
+// CommentOnChangeRequest comments on a pull request
+func (b *Bitbucket) CommentOnChangeRequest(ctx context.Context, number int, body string) error {
+	path := fmt.Sprintf("/repositories/%s/pullrequests/%d/comments", b.repo, number)
+	return b.api.do(ctx, http.MethodPost, path, bitbucketComment(body), nil)
+}
+
+// GetChangeRequest fetches a pull request by ID
+func (b *Bitbucket) GetChangeRequest(ctx context.Context, number int) (*ChangeRequest, error) {
+	var pr bitbucketPullRequest
+	path := fmt.Sprintf("/repositories/%s/pullrequests/%d", b.repo, number)
+	if err := b.api.do(ctx, http.MethodGet, path, nil, &pr); err != nil {
+		return nil, err
+	}
+	return pr.toChangeRequest(), nil
+}
+
+// OpenChangeRequest opens a pull request
+func (b *Bitbucket) OpenChangeRequest(ctx context.Context, req NewChangeRequest) (*ChangeRequest, error) {
+	var pr bitbucketPullRequest
+	path := fmt.Sprintf("/repositories/%s/pullrequests", b.repo)
+	body := map[string]any{
+		"title":       req.Title,
+		"description": req.Body,
+		"source":      map[string]any{"branch": map[string]string{"name": req.Head}},
+		"destination": map[string]any{"branch": map[string]string{"name": req.Base}},
+	}
+	if err := b.api.do(ctx, http.MethodPost, path, body, &pr); err != nil {
+		return nil, err
+	}
+	return pr.toChangeRequest(), nil
+}
+
+// PipelineStatus returns the state of the most recent pipeline for ref
+func (b *Bitbucket) PipelineStatus(ctx context.Context, ref string) (PipelineStatus, error) {
+	var page struct {
+		Values []struct {
+			State struct {
+				Name   string `json:"name"`
+				Result struct {
+					Name string `json:"name"`
+				} `json:"result"`
+			} `json:"state"`
+		} `json:"values"`
+	}
+	path := fmt.Sprintf("/repositories/%s/pipelines/?sort=-created_on&pagelen=1&target.ref_name=%s", b.repo, url.QueryEscape(ref))
+	if err := b.api.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+		return "", err
+	}
+	if len(page.Values) == 0 {
+		return PipelineNone, nil
+	}
+	state := page.Values[0].State
+	if state.Name != "COMPLETED" {
+		return PipelinePending, nil
+	}
+	if state.Result.Name == "SUCCESSFUL" {
+		return PipelineSuccess, nil
+	}
+	return PipelineFailed, nil
+}
+
+// SubmitReview posts each comment inline on its line of the pull request, then the
+// summary. Bitbucket cannot apply suggestions, so they are shown as code blocks.
+func (b *Bitbucket) SubmitReview(ctx context.Context, number int, summary string, comments []ReviewComment) error {
+	path := fmt.Sprintf("/repositories/%s/pullrequests/%d/comments", b.repo, number)
+	for _, c := range comments {
+		body := bitbucketComment(c.render(""))
+		body["inline"] = map[string]any{"path": c.Path, "to": c.Line}
+		if err := b.api.do(ctx, http.MethodPost, path, body, nil); err != nil {
+			return err
+		}
+	}
+	return b.CommentOnChangeRequest(ctx, number, summary)
+}
@@ -0,0 +1,146 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Forge is a code hosting service the agent reports back to. Implementations are
+// scoped to a single repository.
+type Forge interface {
+	// Name identifies the forge, e.g. "github"
+	Name() string
+	CommentOnIssue(ctx context.Context, number int, body string) error
+	CommentOnChangeRequest(ctx context.Context, number int, body string) error
+	GetChangeRequest(ctx context.Context, number int) (*ChangeRequest, error)
+	OpenChangeRequest(ctx context.Context, req NewChangeRequest) (*ChangeRequest, error)
+	// PipelineStatus returns the CI state of the latest pipeline for ref
+	PipelineStatus(ctx context.Context, ref string) (PipelineStatus, error)
+	// SubmitReview posts a review of a change request: the summary, and comments
+	// anchored to lines of its diff
+	SubmitReview(ctx context.Context, number int, summary string, comments []ReviewComment) error
+}
+
+// ChangeRequest is a pull request (GitHub, Bitbucket) or merge request (GitLab)
+type ChangeRequest struct {
+	Number  int
+	Title   string
+	Body    string
+	URL     string
+	HeadRef string
+	BaseRef string
+	// FromFork is true when the head branch lives in another repository and cannot be pushed to
+	FromFork bool
+}
+
+// NewChangeRequest describes a change request to open from Head into Base
+type NewChangeRequest struct {
+	Title string
+	Body  string
+	Head  string
+	Base  string
+}
+
+// PipelineStatus is a forge-neutral CI state
+type PipelineStatus string
+
+// Pipeline states
+const (
+	PipelinePending PipelineStatus = "pending"
+	PipelineSuccess PipelineStatus = "success"
+	PipelineFailed  PipelineStatus = "failed"
+	PipelineNone    PipelineStatus = "none"
+)
+
+// FromEnv builds the Forge for the CI system the agent is running in, using the
+// repository and token variables each system provides
+func FromEnv() (Forge, error) {
+	switch {
+	case os.Getenv("GITLAB_CI") != "":
+		token := os.Getenv("GITLAB_TOKEN")
+		return NewGitLab(os.Getenv("CI_API_V4_URL"), os.Getenv("CI_PROJECT_PATH"), token), nil
+	case os.Getenv("BITBUCKET_BUILD_NUMBER") != "":
+		repo := os.Getenv("BITBUCKET_REPO_FULL_NAME")
+		return NewBitbucket(repo, os.Getenv("BITBUCKET_TOKEN")), nil
+	case os.Getenv("GITHUB_ACTIONS") != "" || os.Getenv("GITHUB_REPOSITORY") != "":
+		return NewGitHub(os.Getenv("GITHUB_API_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_TOKEN")), nil
+	default:
+		return nil, fmt.Errorf("could not detect a supported forge from the environment")
+	}
+}
+
+// ChangeRequestFromEnv returns the number of the pull or merge request the CI job
+// runs for, or zero when it runs for none
+func ChangeRequestFromEnv() int {
+	for _, name := range []string{"CI_MERGE_REQUEST_IID", "BITBUCKET_PR_ID"} {
+		if number, err := strconv.Atoi(os.Getenv(name)); err == nil {
+			return number
+		}
+	}
+	// refs/pull/<number>/merge
+	if ref, ok := strings.CutPrefix(os.Getenv("GITHUB_REF"), "refs/pull/"); ok {
+		number, _ := strconv.Atoi(strings.TrimSuffix(ref, "/merge"))
+		return number
+	}
+	return 0
+}
+
+// apiClient sends JSON requests to a forge REST API
+type apiClient struct {
+	name       string
+	baseURL    string
+	authorize  func(req *http.Request)
+	httpClient *http.Client
+}
+
+// do sends body as JSON and decodes a JSON response into out, if non-nil
+func (c *apiClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.authorize != nil {
+		c.authorize(req)
+	}
+
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s %s: %w", c.name, method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s %s: %s: %s", c.name, method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("%s %s %s: failed to decode response: %w", c.name, method, path, err)
+		}
+	}
+	return nil
+}
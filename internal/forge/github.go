@@ -0,0 +1,126 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GitHub implements Forge for a github.com or GitHub Enterprise repository
+type GitHub struct {
+	api  apiClient
+	repo string
+}
+
+// NewGitHub creates a GitHub forge for repo ("owner/name"). An empty baseURL means api.github.com.
+func NewGitHub(baseURL, repo, token string) *GitHub {
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+	return &GitHub{
+		repo: repo,
+		api: apiClient{
+			name:    "github",
+			baseURL: strings.TrimSuffix(baseURL, "/"),
+			authorize: func(req *http.Request) {
+				req.Header.Set("Accept", "application/vnd.github+json")
+				req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+				if token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+			},
+		},
+	}
+}
+
+// Name identifies the forge
+func (g *GitHub) Name() string { return "github" }
+
+type githubPullRequest struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		Ref  string `json:"ref"`
+		Repo struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+func (p githubPullRequest) toChangeRequest(repo string) *ChangeRequest {
+	return &ChangeRequest{
+		Number:   p.Number,
+		Title:    p.Title,
+		Body:     p.Body,
+		URL:      p.HTMLURL,
+		HeadRef:  p.Head.Ref,
+		BaseRef:  p.Base.Ref,
+		FromFork: p.Head.Repo.FullName != repo,
+	}
+}
+
+// CommentOnIssue posts a comment on an issue
+func (g *GitHub) CommentOnIssue(ctx context.Context, number int, body string) error {
+	path := fmt.Sprintf("/repos/%s/issues/%d/comments", g.repo, number)
+	return g.api.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil)
+}
+
+// CommentOnChangeRequest posts a comment on a pull request; GitHub treats these as issue comments
+func (g *GitHub) CommentOnChangeRequest(ctx context.Context, number int, body string) error {
+	return g.CommentOnIssue(ctx, number, body)
+}
+
+// GetChangeRequest fetches a pull request by number
+func (g *GitHub) GetChangeRequest(ctx context.Context, number int) (*ChangeRequest, error) {
+	var pr githubPullRequest
+	path := fmt.Sprintf("/repos/%s/pulls/%d", g.repo, number)
+	if err := g.api.do(ctx, http.MethodGet, path, nil, &pr); err != nil {
+		return nil, err
+	}
+	return pr.toChangeRequest(g.repo), nil
+}
+
+// OpenChangeRequest opens a pull request
+func (g *GitHub) OpenChangeRequest(ctx context.Context, req NewChangeRequest) (*ChangeRequest, error) {
+	var pr githubPullRequest
+	path := fmt.Sprintf("/repos/%s/pulls", g.repo)
+	body := map[string]string{"title": req.Title, "body": req.Body, "head": req.Head, "base": req.Base}
+	if err := g.api.do(ctx, http.MethodPost, path, body, &pr); err != nil {
+		return nil, err
+	}
+	return pr.toChangeRequest(g.repo), nil
+}
+
+// PipelineStatus aggregates the check runs reported for ref
+func (g *GitHub) PipelineStatus(ctx context.Context, ref string) (PipelineStatus, error) {
+	var checks struct {
+		CheckRuns []struct {
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+		} `json:"check_runs"`
+	}
+	path := fmt.Sprintf("/repos/%s/commits/%s/check-runs", g.repo, ref)
+	if err := g.api.do(ctx, http.MethodGet, path, nil, &checks); err != nil {
+		return "", err
+	}
+	if len(checks.CheckRuns) == 0 {
+		return PipelineNone, nil
+	}
+
+	status := PipelineSuccess
+	for _, run := range checks.CheckRuns {
+		switch {
+		case run.Status != "completed":
+			status = PipelinePending
+		case run.Conclusion != "success" && run.Conclusion != "neutral" && run.Conclusion != "skipped":
+			return PipelineFailed, nil
+		}
+	}
+	return status, nil
+}
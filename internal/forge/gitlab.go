@@ -0,0 +1,155 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitLab implements Forge for a gitlab.com or self-managed GitLab project
+type GitLab struct {
+	api     apiClient
+	project string
+}
+
+// NewGitLab creates a GitLab forge for the project path ("group/name"). An empty
+// baseURL means https://gitlab.com/api/v4.
+func NewGitLab(baseURL, project, token string) *GitLab {
+	if baseURL == "" {
+		baseURL = "https://gitlab.com/api/v4"
+	}
+	return &GitLab{
+		project: url.PathEscape(project),
+		api: apiClient{
+			name:    "gitlab",
+			baseURL: strings.TrimSuffix(baseURL, "/"),
+			authorize: func(req *http.Request) {
+				if token != "" {
+					req.Header.Set("PRIVATE-TOKEN", token)
+				}
+			},
+		},
+	}
+}
+
+// Name identifies the forge
+func (g *GitLab) Name() string { return "gitlab" }
+
+type gitlabMergeRequest struct {
+	IID             int    `json:"iid"`
+	Title           string `json:"title"`
+	Description     string `json:"description"`
+	WebURL          string `json:"web_url"`
+	SourceBranch    string `json:"source_branch"`
+	TargetBranch    string `json:"target_branch"`
+	SourceProjectID int    `json:"source_project_id"`
+	TargetProjectID int    `json:"target_project_id"`
+}
+
+func (m gitlabMergeRequest) toChangeRequest() *ChangeRequest {
+	return &ChangeRequest{
+		Number:   m.IID,
+		Title:    m.Title,
+		Body:     m.Description,
+		URL:      m.WebURL,
+		HeadRef:  m.SourceBranch,
+		BaseRef:  m.TargetBranch,
+		FromFork: m.SourceProjectID != m.TargetProjectID,
+	}
+}
+
+// CommentOnIssue adds a note to an issue
+func (g *GitLab) CommentOnIssue(ctx context.Context, number int, body string) error {
+	path := fmt.Sprintf("/projects/%s/issues/%d/notes", g.project, number)
+	return g.api.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil)
+}
+
+// CommentOnChangeRequest adds a note to a merge request
+func (g *GitLab) CommentOnChangeRequest(ctx context.Context, number int, body string) error {
+	path := fmt.Sprintf("/projects/%s/merge_requests/%d/notes", g.project, number)
+	return g.api.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil)
+}
+
+// GetChangeRequest fetches a merge request by IID
+func (g *GitLab) GetChangeRequest(ctx context.Context, number int) (*ChangeRequest, error) {
+	var mr gitlabMergeRequest
+	path := fmt.Sprintf("/projects/%s/merge_requests/%d", g.project, number)
+	if err := g.api.do(ctx, http.MethodGet, path, nil, &mr); err != nil {
+		return nil, err
+	}
+	return mr.toChangeRequest(), nil
+}
+
+// OpenChangeRequest opens a merge request
+func (g *GitLab) OpenChangeRequest(ctx context.Context, req NewChangeRequest) (*ChangeRequest, error) {
+	var mr gitlabMergeRequest
+	path := fmt.Sprintf("/projects/%s/merge_requests", g.project)
+	body := map[string]string{
+		"title":         req.Title,
+		"description":   req.Body,
+		"source_branch": req.Head,
+		"target_branch": req.Base,
+	}
+	if err := g.api.do(ctx, http.MethodPost, path, body, &mr); err != nil {
+		return nil, err
+	}
+	return mr.toChangeRequest(), nil
+}
+
+// PipelineStatus returns the state of the most recent pipeline for ref
+func (g *GitLab) PipelineStatus(ctx context.Context, ref string) (PipelineStatus, error) {
+	var pipelines []struct {
+		Status string `json:"status"`
+	}
+	path := fmt.Sprintf("/projects/%s/pipelines?per_page=1&ref=%s", g.project, url.QueryEscape(ref))
+	if err := g.api.do(ctx, http.MethodGet, path, nil, &pipelines); err != nil {
+		return "", err
+	}
+	if len(pipelines) == 0 {
+		return PipelineNone, nil
+	}
+	switch pipelines[0].Status {
+	case "success":
+		return PipelineSuccess, nil
+	case "failed", "canceled":
+		return PipelineFailed, nil
+	default:
+		return PipelinePending, nil
+	}
+}
+
+// SubmitReview posts each comment as a discussion on its line of the merge request's
+// diff, with suggestions GitLab can apply, then the summary as a note
+func (g *GitLab) SubmitReview(ctx context.Context, number int, summary string, comments []ReviewComment) error {
+	var mr struct {
+		DiffRefs struct {
+			BaseSHA  string `json:"base_sha"`
+			HeadSHA  string `json:"head_sha"`
+			StartSHA string `json:"start_sha"`
+		} `json:"diff_refs"`
+	}
+	path := fmt.Sprintf("/projects/%s/merge_requests/%d", g.project, number)
+	if err := g.api.do(ctx, http.MethodGet, path, nil, &mr); err != nil {
+		return err
+	}
+	for _, c := range comments {
+		// suggestion:-N+0 replaces the N lines above the commented one as well
+		body := map[string]any{
+			"body": c.render(fmt.Sprintf("suggestion:-%d+0", c.Line-c.firstLine())),
+			"position": map[string]any{
+				"position_type": "text",
+				"base_sha":      mr.DiffRefs.BaseSHA,
+				"head_sha":      mr.DiffRefs.HeadSHA,
+				"start_sha":     mr.DiffRefs.StartSHA,
+				"new_path":      c.Path,
+				"new_line":      c.Line,
+			},
+		}
+		if err := g.api.do(ctx, http.MethodPost, path+"/discussions", body, nil); err != nil {
+			return err
+		}
+	}
+	return g.CommentOnChangeRequest(ctx, number, summary)
+}
@@ -0,0 +1,164 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ReviewComment is a finding anchored to lines of the new version of a file
+type ReviewComment struct {
+	Path string `json:"path"`
+	// StartLine..Line is the commented range; StartLine is zero for a single line
+	StartLine int    `json:"start_line,omitempty"`
+	Line      int    `json:"line"`
+	Body      string `json:"body"`
+	// Suggestion, when set, replaces the commented lines and can be applied with one click
+	Suggestion *string `json:"suggestion,omitempty"`
+}
+
+// Markdown renders the comment body, appending the suggestion as a GitHub suggestion block
+func (c ReviewComment) Markdown() string {
+	return c.render("suggestion")
+}
+
+// render appends the suggestion to the body in a fenced block with the info string
+func (c ReviewComment) render(info string) string {
+	if c.Suggestion == nil {
+		return c.Body
+	}
+	suggestion := strings.TrimSuffix(*c.Suggestion, "\n")
+	fence := "```"
+	for strings.Contains(suggestion, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%s\n\n%s%s\n%s\n%s", c.Body, fence, info, suggestion, fence)
+}
+
+// firstLine returns the first line the comment covers
+func (c ReviewComment) firstLine() int {
+	if c.StartLine == 0 {
+		return c.Line
+	}
+	return c.StartLine
+}
+
+// DiffLines maps each file in a unified diff to the new-side line numbers that appear
+// in its hunks, which are the only lines review comments can be attached to
+type DiffLines map[string]map[int]bool
+
+// ParseDiffLines extracts the commentable lines from a unified diff. The line counts
+// in each hunk header say where the hunk ends, so removed or added lines that look
+// like --- and +++ file headers are read as part of it.
+func ParseDiffLines(diff string) DiffLines {
+	lines := DiffLines{}
+	var file string
+	var newLine, oldLeft, newLeft int
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		if oldLeft > 0 || newLeft > 0 {
+			inHunk := true
+			switch {
+			case strings.HasPrefix(line, "+"):
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+				continue
+			case strings.HasPrefix(line, " "), line == "":
+				// Some tools strip the space from empty context lines
+				oldLeft--
+				newLeft--
+			case strings.HasPrefix(line, "\\"):
+				// \ No newline at end of file
+				continue
+			default:
+				// The counts were wrong, and the hunk has already ended
+				oldLeft, newLeft, inHunk = 0, 0, false
+			}
+			if inHunk {
+				if file != "" {
+					if lines[file] == nil {
+						lines[file] = map[int]bool{}
+					}
+					lines[file][newLine] = true
+				}
+				newLine++
+				continue
+			}
+		}
+		switch {
+		case strings.HasPrefix(line, "diff "), strings.HasPrefix(line, "--- "):
+			file = ""
+		case strings.HasPrefix(line, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+		case strings.HasPrefix(line, "@@"):
+			// @@ -a,b +c,d @@, where a missing count is 1
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			_, oldLeft = hunkRange(fields[1])
+			newLine, newLeft = hunkRange(fields[2])
+		}
+	}
+	return lines
+}
+
+// hunkRange parses one side of a hunk header, such as -10,3 or +4, into its first line
+// and line count
+func hunkRange(field string) (start, count int) {
+	first, n, ok := strings.Cut(field[1:], ",")
+	start, _ = strconv.Atoi(first)
+	count = 1
+	if ok {
+		count, _ = strconv.Atoi(n)
+	}
+	return start, count
+}
+
+// Contains reports whether every line the comment covers is part of the diff
+func (d DiffLines) Contains(c ReviewComment) bool {
+	start := c.firstLine()
+	if start > c.Line {
+		return false
+	}
+	for line := start; line <= c.Line; line++ {
+		if !d[c.Path][line] {
+			return false
+		}
+	}
+	return true
+}
+
+// SubmitReview posts a pull request review with a summary and inline comments
+func (g *GitHub) SubmitReview(ctx context.Context, number int, summary string, comments []ReviewComment) error {
+	type reviewComment struct {
+		Path      string `json:"path"`
+		Line      int    `json:"line"`
+		Side      string `json:"side"`
+		StartLine int    `json:"start_line,omitempty"`
+		StartSide string `json:"start_side,omitempty"`
+		Body      string `json:"body"`
+	}
+	body := struct {
+		Event    string          `json:"event"`
+		Body     string          `json:"body"`
+		Comments []reviewComment `json:"comments"`
+	}{Event: "COMMENT", Body: summary, Comments: []reviewComment{}}
+
+	for _, c := range comments {
+		rc := reviewComment{Path: c.Path, Line: c.Line, Side: "RIGHT", Body: c.Markdown()}
+		if c.StartLine != 0 && c.StartLine != c.Line {
+			rc.StartLine = c.StartLine
+			rc.StartSide = "RIGHT"
+		}
+		body.Comments = append(body.Comments, rc)
+	}
+
+	path := fmt.Sprintf("/repos/%s/pulls/%d/reviews", g.repo, number)
+	return g.api.do(ctx, http.MethodPost, path, body, nil)
+}
@@ -0,0 +1,64 @@
+package forge
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want map[string][]int
+	}{
+		{"added and context lines", "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1,3 +1,4 @@\n package a\n+import \"fmt\"\n \n-var x = 1\n+var x = 2\n",
+			map[string][]int{"a.go": {1, 2, 3, 4}}},
+		{"several hunks", "--- a/a.go\n+++ b/a.go\n@@ -1,1 +1,1 @@\n-a\n+b\n@@ -10,2 +10,2 @@\n c\n+d\n",
+			map[string][]int{"a.go": {1, 10, 11}}},
+		{"several files", "diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n+a\ndiff --git a/b.go b/b.go\n--- a/b.go\n+++ b/b.go\n@@ -5 +5 @@\n+b\n",
+			map[string][]int{"a.go": {1}, "b.go": {5}}},
+		{"new file", "--- /dev/null\n+++ b/new.go\n@@ -0,0 +1,2 @@\n+package new\n+\n",
+			map[string][]int{"new.go": {1, 2}}},
+		{"deleted file", "--- a/old.go\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-package old\n-\n",
+			map[string][]int{}},
+		{"header-like lines inside a hunk", "--- a/notes.md\n+++ b/notes.md\n@@ -1,2 +1,2 @@\n--- old rule\n+++ new rule\n kept\n",
+			map[string][]int{"notes.md": {1, 2}}},
+		{"hunk without a trailing newline", "--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n",
+			map[string][]int{"a.go": {1}}},
+		{"empty context line without its space", "--- a/a.go\n+++ b/a.go\n@@ -1,3 +1,3 @@\n a\n\n-b\n+c\n",
+			map[string][]int{"a.go": {1, 2, 3}}},
+		{"lines before a hunk", "diff --git a/a.go b/a.go\nindex 1..2 100644\n--- a/a.go\n+++ b/a.go\n+not in a hunk\n",
+			map[string][]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string][]int{}
+			for file, lines := range ParseDiffLines(tt.diff) {
+				got[file] = slices.Sorted(maps.Keys(lines))
+			}
+			if !maps.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("ParseDiffLines = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesContains(t *testing.T) {
+	lines := ParseDiffLines("--- a/a.go\n+++ b/a.go\n@@ -1,3 +1,3 @@\n a\n+b\n c\n@@ -20 +20 @@\n+d\n")
+	tests := []struct {
+		comment ReviewComment
+		want    bool
+	}{
+		{ReviewComment{Path: "a.go", Line: 2}, true},
+		{ReviewComment{Path: "a.go", StartLine: 1, Line: 3}, true},
+		{ReviewComment{Path: "a.go", StartLine: 3, Line: 20}, false},
+		{ReviewComment{Path: "a.go", StartLine: 3, Line: 1}, false},
+		{ReviewComment{Path: "b.go", Line: 1}, false},
+	}
+	for _, tt := range tests {
+		if got := lines.Contains(tt.comment); got != tt.want {
+			t.Errorf("Contains(%+v) = %v; want %v", tt.comment, got, tt.want)
+		}
+	}
+}
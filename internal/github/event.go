@@ -0,0 +1,60 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Event is the subset of an Actions event payload (issues, issue_comment) the agent reads
+type Event struct {
+	Action     string   `json:"action"`
+	Comment    *Comment `json:"comment"`
+	Issue      Issue    `json:"issue"`
+	Repository struct {
+		FullName      string `json:"full_name"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+// Comment is an issue or pull request comment
+type Comment struct {
+	Body              string `json:"body"`
+	AuthorAssociation string `json:"author_association"`
+	User              User   `json:"user"`
+}
+
+// Issue is an issue, or the issue side of a pull request
+type Issue struct {
+	Number            int    `json:"number"`
+	Title             string `json:"title"`
+	Body              string `json:"body"`
+	AuthorAssociation string `json:"author_association"`
+	User              User   `json:"user"`
+	PullRequest       *struct {
+		URL string `json:"url"`
+	} `json:"pull_request"`
+}
+
+// User is a GitHub account
+type User struct {
+	Login string `json:"login"`
+}
+
+// IsPullRequest reports whether the event's issue is a pull request
+func (e *Event) IsPullRequest() bool {
+	return e.Issue.PullRequest != nil
+}
+
+// LoadEvent reads the event payload written by Actions at GITHUB_EVENT_PATH
+func LoadEvent(path string) (*Event, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event payload '%s': %w", path, err)
+	}
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode event payload '%s': %w", path, err)
+	}
+	return &event, nil
+}
@@ -0,0 +1,324 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/internal/capability"
+)
+
+// Task is a unit of non-interactive agent work received from a queue
+type Task struct {
+	ID     string `json:"id"`
+	Prompt string `json:"prompt"`
+	// Repo is a local path or git URL to run the task in; empty means the worker's directory
+	Repo string `json:"repo,omitempty"`
+	Ref  string `json:"ref,omitempty"`
+	// Timeout and MaxTurns override the worker's defaults when non-zero
+	Timeout  int `json:"timeout_seconds,omitempty"`
+	MaxTurns int `json:"max_turns,omitempty"`
+	// Token is a capability token scoping the task's tools, paths and budgets
+	Token string `json:"token,omitempty"`
+}
+
+// Result reports the outcome of a Task
+type Result struct {
+	ID       string  `json:"id"`
+	Status   string  `json:"status"`
+	Output   string  `json:"output,omitempty"`
+	Diff     string  `json:"diff,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+// Result statuses
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Delivery is a task received from a queue along with a way to report its result
+type Delivery struct {
+	Task    Task
+	Respond func(ctx context.Context, result Result) error
+}
+
+// Queue hands out tasks. Receive blocks until a task is available and returns io.EOF
+// once the queue is exhausted.
+type Queue interface {
+	Receive(ctx context.Context) (*Delivery, error)
+}
+
+// Worker consumes tasks from a Queue and runs each one as a separate agent process
+type Worker struct {
+	Queue       Queue
+	Concurrency int
+	// Executable is the agent binary run for each task
+	Executable string
+	// MaxTurns is the default model call limit for tasks that do not set one
+	MaxTurns int
+	// Timeout is the default per-task deadline for tasks that do not set one
+	Timeout time.Duration
+	// CapabilityKey, when set, is the public key task tokens must be signed with, and
+	// tasks without a valid token are refused
+	CapabilityKey ed25519.PublicKey
+	// AuditLog and ArtifactDir are where tasks record tool calls and save artifacts.
+	// Tasks run in worktrees removed when they finish, so these must lie outside them;
+	// empty disables them.
+	AuditLog    string
+	ArtifactDir string
+}
+
+// Run receives and executes tasks until ctx is cancelled or the queue is exhausted,
+// then waits for in-flight tasks. Tasks run under jobCtx so that the caller can let
+// them finish after it stops receiving.
+func (w *Worker) Run(ctx, jobCtx context.Context) error {
+	concurrency := w.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		delivery, err := w.Queue.Receive(ctx)
+		if err != nil {
+			<-slots
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to receive task: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			result := w.execute(jobCtx, delivery.Task)
+			log.Printf("Task %s %s in %.1fs\n", result.ID, result.Status, result.Duration)
+			if err := delivery.Respond(context.WithoutCancel(jobCtx), result); err != nil {
+				log.Printf("Error publishing result for task %s: %v", result.ID, err)
+			}
+		}()
+	}
+}
+
+// execute prepares the task's working directory and runs the agent in it
+func (w *Worker) execute(ctx context.Context, task Task) Result {
+	start := time.Now()
+	result := Result{ID: task.ID}
+	fail := func(err error) Result {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		result.Duration = time.Since(start).Seconds()
+		return result
+	}
+
+	if strings.TrimSpace(task.Prompt) == "" {
+		return fail(errors.New("task has no prompt"))
+	}
+	var scope *capability.Capability
+	switch {
+	case w.CapabilityKey != nil && task.Token == "":
+		return fail(errors.New("task has no capability token, which this worker requires"))
+	case w.CapabilityKey != nil:
+		c, err := capability.Parse(task.Token, w.CapabilityKey)
+		if err != nil {
+			return fail(err)
+		}
+		if c.Subject != "" && c.Subject != task.ID {
+			return fail(fmt.Errorf("capability token was issued for task '%s', not '%s'", c.Subject, task.ID))
+		}
+		scope = &c
+	case task.Token != "":
+		return fail(errors.New("task has a capability token, but the worker has no -capability-key to check it"))
+	}
+
+	timeout := w.Timeout
+	if task.Timeout > 0 {
+		timeout = time.Duration(task.Timeout) * time.Second
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	dir, cleanup, err := prepareWorkdir(ctx, task)
+	if err != nil {
+		return fail(err)
+	}
+	defer cleanup()
+
+	maxTurns := w.MaxTurns
+	if task.MaxTurns > 0 {
+		maxTurns = task.MaxTurns
+	}
+	if scope != nil && scope.MaxTurns > 0 && (maxTurns <= 0 || maxTurns > scope.MaxTurns) {
+		maxTurns = scope.MaxTurns
+	}
+	// File history would be written into the worktree and show up in the diff
+	args := []string{"-p", task.Prompt, "-session-store", "", "-file-history", "", "-max-turns", strconv.Itoa(maxTurns),
+		"-audit-log", w.AuditLog, "-artifacts", w.ArtifactDir}
+	cmd := exec.CommandContext(ctx, w.Executable, args...)
+	cmd.Dir = dir
+	if scope != nil {
+		// The session checks the token again and enforces it on every tool call
+		cmd.Env = append(os.Environ(), capability.TokenEnv+"="+task.Token,
+			capability.KeyEnv+"="+base64.StdEncoding.EncodeToString(w.CapabilityKey))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	runErr := cmd.Run()
+	result.Output = strings.TrimSpace(stdout.String())
+	result.Diff = gitDiff(dir)
+	if runErr != nil {
+		if ctx.Err() != nil {
+			runErr = fmt.Errorf("task timed out: %w", ctx.Err())
+		}
+		return fail(fmt.Errorf("%w: %s", runErr, tail(stderr.String(), 2000)))
+	}
+
+	result.Status = StatusSucceeded
+	result.Duration = time.Since(start).Seconds()
+	return result
+}
+
+// worktreeMu serialises adding and removing worktrees, which lock the repository
+var worktreeMu sync.Mutex
+
+// prepareWorkdir clones remote repositories into a temporary directory. The worker's
+// directory and local paths get a worktree of their own per task, at Ref or HEAD, so
+// concurrent tasks do not see or report each other's changes; a directory that is
+// not a git checkout is used in place.
+func prepareWorkdir(ctx context.Context, task Task) (string, func(), error) {
+	noop := func() {}
+	if !isRemote(task.Repo) {
+		local := task.Repo
+		if local == "" {
+			local = "."
+		} else if _, err := os.Stat(local); err != nil {
+			return "", noop, fmt.Errorf("repo path '%s' is not accessible: %w", task.Repo, err)
+		}
+		return worktree(ctx, local, task.Ref)
+	}
+
+	dir, err := os.MkdirTemp("", "agent-job-*")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to create job directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	args := []string{"clone", "--depth", "1"}
+	if task.Ref != "" {
+		args = append(args, "--branch", task.Ref)
+	}
+	args = append(args, "--", task.Repo, dir)
+	if out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput(); err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("failed to clone '%s': %w: %s", task.Repo, err, tail(string(out), 2000))
+	}
+	return dir, cleanup, nil
+}
+
+// worktree adds a detached worktree of the checkout dir is in at ref, returning the
+// directory matching dir inside it
+func worktree(ctx context.Context, dir, ref string) (string, func(), error) {
+	noop := func() {}
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		if ref != "" {
+			return "", noop, fmt.Errorf("cannot check out ref '%s': '%s' is not a git checkout", ref, dir)
+		}
+		return dir, noop, nil
+	}
+	root := strings.TrimSpace(string(out))
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", noop, err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", noop, err
+	}
+
+	tmp, err := os.MkdirTemp("", "agent-job-*")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to create job directory: %w", err)
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	worktreeMu.Lock()
+	out, err = exec.CommandContext(ctx, "git", "-C", root, "worktree", "add", "--detach", tmp, ref).CombinedOutput()
+	worktreeMu.Unlock()
+	if err != nil {
+		os.RemoveAll(tmp)
+		return "", noop, fmt.Errorf("failed to create a worktree of '%s' at '%s': %w: %s", root, ref, err, tail(string(out), 2000))
+	}
+	cleanup := func() {
+		worktreeMu.Lock()
+		defer worktreeMu.Unlock()
+		if exec.Command("git", "-C", root, "worktree", "remove", "--force", tmp).Run() != nil {
+			os.RemoveAll(tmp)
+			exec.Command("git", "-C", root, "worktree", "prune").Run()
+		}
+	}
+	return filepath.Join(tmp, rel), cleanup, nil
+}
+
+func isRemote(repo string) bool {
+	return strings.Contains(repo, "://") || strings.HasPrefix(repo, "git@")
+}
+
+// gitDiff returns the changes in dir since HEAD, new files included, or "" if it is
+// not a git checkout. The agent's own .agent directory is left out.
+func gitDiff(dir string) string {
+	// Intent-to-add makes untracked files show up in the diff without staging them
+	add := exec.Command("git", "add", "-N", "--", ":/", ":!.agent")
+	add.Dir = dir
+	add.Run()
+	cmd := exec.Command("git", "diff", "HEAD", "--", ":/", ":!.agent")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// tail returns at most the last n bytes of s
+func tail(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		return "..." + s[len(s)-n:]
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// LineQueue reads tasks as JSON lines from a reader and writes results as JSON lines,
+// which is handy for local runs and for piping from other tools
+type LineQueue struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+	mu      sync.Mutex
+	lineNo  int
+}
+
+// NewLineQueue creates a LineQueue reading tasks from in and writing results to out
+func NewLineQueue(in io.Reader, out io.Writer) *LineQueue {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &LineQueue{scanner: scanner, out: out}
+}
+
+// Receive returns the next task, skipping blank lines, or io.EOF at the end of input
+func (q *LineQueue) Receive(ctx context.Context) (*Delivery, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !q.scanner.Scan() {
+			if err := q.scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		q.lineNo++
+		line := q.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var task Task
+		if err := json.Unmarshal(line, &task); err != nil {
+			return nil, fmt.Errorf("invalid task on line %d: %w", q.lineNo, err)
+		}
+		if task.ID == "" {
+			task.ID = fmt.Sprintf("line-%d", q.lineNo)
+		}
+		return &Delivery{Task: task, Respond: q.write}, nil
+	}
+}
+
+func (q *LineQueue) write(_ context.Context, result Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, err = q.out.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,226 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NATSQueue subscribes to a NATS subject as part of a queue group, so tasks are
+// spread across every worker in the group. Results go to the message's reply subject
+// when the publisher set one (request/reply), otherwise to ResultSubject.
+//
+// Only the core NATS text protocol is implemented; delivery is at-most-once.
+type NATSQueue struct {
+	conn          net.Conn
+	writeMu       sync.Mutex
+	resultSubject string
+
+	// The read loop queues messages rather than handing them over, so it keeps
+	// answering PINGs while every worker slot is busy and the server does not drop
+	// the connection
+	mu      sync.Mutex
+	pending []natsMessage
+	done    bool
+	readErr error
+	ready   chan struct{}
+}
+
+type natsMessage struct {
+	replyTo string
+	payload []byte
+}
+
+// DialNATS connects to the server at rawURL (nats://[user:pass@]host[:port]) and
+// subscribes to subject in the given queue group
+func DialNATS(ctx context.Context, rawURL, subject, group, resultSubject string) (*NATSQueue, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nats url: %w", err)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats at %s: %w", addr, err)
+	}
+	reader := bufio.NewReader(conn)
+
+	// The server greets with INFO before anything else
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "INFO") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected nats greeting %q: %v", line, err)
+	}
+
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "agent-worker", "protocol": 1}
+	if u.User != nil {
+		options["user"] = u.User.Username()
+		if pass, ok := u.User.Password(); ok {
+			options["pass"] = pass
+		} else {
+			options["auth_token"] = u.User.Username()
+			delete(options, "user")
+		}
+	}
+	connect, _ := json.Marshal(options)
+
+	q := &NATSQueue{
+		conn:          conn,
+		ready:         make(chan struct{}, 1),
+		resultSubject: resultSubject,
+	}
+	if err := q.write(fmt.Sprintf("CONNECT %s\r\nSUB %s %s 1\r\nPING\r\n", connect, subject, group)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to '%s': %w", subject, err)
+	}
+	go q.readLoop(reader)
+	return q, nil
+}
+
+// Close disconnects from the server
+func (q *NATSQueue) Close() error {
+	return q.conn.Close()
+}
+
+// Receive returns the next task published on the subscribed subject
+func (q *NATSQueue) Receive(ctx context.Context) (*Delivery, error) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) > 0 {
+			msg := q.pending[0]
+			q.pending = q.pending[1:]
+			q.mu.Unlock()
+
+			var task Task
+			if err := json.Unmarshal(msg.payload, &task); err != nil {
+				// A malformed task cannot be retried, so report it and move on
+				q.publishFailure(msg.replyTo, fmt.Errorf("invalid task: %w", err))
+				continue
+			}
+			replyTo := msg.replyTo
+			return &Delivery{
+				Task: task,
+				Respond: func(_ context.Context, result Result) error {
+					return q.publish(replyTo, result)
+				},
+			}, nil
+		}
+		if q.done {
+			err := q.readErr
+			q.mu.Unlock()
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.ready:
+		}
+	}
+}
+
+// signal wakes a waiting Receive
+func (q *NATSQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// readLoop parses server messages, answering PINGs and queueing MSG payloads
+func (q *NATSQueue) readLoop(reader *bufio.Reader) {
+	var readErr error
+	defer func() {
+		q.mu.Lock()
+		q.done, q.readErr = true, readErr
+		q.mu.Unlock()
+		q.signal()
+	}()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			readErr = err
+			return
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+
+		switch {
+		case line == "PING":
+			if err := q.write("PONG\r\n"); err != nil {
+				readErr = err
+				return
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			readErr = fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+			return
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				readErr = fmt.Errorf("nats: malformed message header %q", line)
+				return
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				readErr = fmt.Errorf("nats: malformed message size %q", line)
+				return
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				readErr = err
+				return
+			}
+			msg := natsMessage{payload: payload[:size]}
+			if len(fields) == 5 {
+				msg.replyTo = fields[3]
+			}
+			q.mu.Lock()
+			q.pending = append(q.pending, msg)
+			q.mu.Unlock()
+			q.signal()
+		}
+	}
+}
+
+func (q *NATSQueue) publishFailure(replyTo string, err error) {
+	_ = q.publish(replyTo, Result{Status: StatusFailed, Error: err.Error()})
+}
+
+// publish sends result to replyTo, falling back to the configured result subject
+func (q *NATSQueue) publish(replyTo string, result Result) error {
+	subject := replyTo
+	if subject == "" {
+		subject = q.resultSubject
+	}
+	if subject == "" {
+		return nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	return q.write(fmt.Sprintf("PUB %s %d\r\n%s\r\n", subject, len(data), data))
+}
+
+func (q *NATSQueue) write(s string) error {
+	q.writeMu.Lock()
+	defer q.writeMu.Unlock()
+	_, err := io.WriteString(q.conn, s)
+	return err
+}
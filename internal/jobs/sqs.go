@@ -0,0 +1,304 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// sqsVisibility is how long a received task stays hidden from other workers;
+	// it is extended while the task runs
+	sqsVisibility = 60 * time.Second
+	// sqsWait is the long-polling wait of each receive, the most SQS allows
+	sqsWait = 20
+)
+
+// SQSQueue receives tasks from an Amazon SQS queue. A task is deleted once its result
+// is sent, and stays hidden from other workers while it runs, so delivery is
+// at-least-once: a task whose worker dies reappears. Results go to the queue named
+// by the message's ReplyTo attribute, otherwise to ResultQueue.
+//
+// Requests use the SQS JSON protocol, signed with the credentials in
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type SQSQueue struct {
+	queueURL    string
+	resultQueue string
+	endpoint    string
+	region      string
+	creds       awsCredentials
+	client      *http.Client
+}
+
+type awsCredentials struct {
+	accessKey, secretKey, sessionToken string
+}
+
+// NewSQSQueue returns a queue receiving from the queue at queueURL, such as
+// https://sqs.eu-west-1.amazonaws.com/123456789012/agent-tasks, with sqs:// standing
+// for https://. The region is taken from the host, or else AWS_REGION, and
+// AWS_ENDPOINT_URL_SQS points requests at another endpoint, such as a local emulator.
+func NewSQSQueue(queueURL, resultQueue string) (*SQSQueue, error) {
+	queueURL = sqsURL(queueURL)
+	u, err := url.Parse(queueURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid sqs queue url '%s'", queueURL)
+	}
+	q := &SQSQueue{
+		queueURL:    queueURL,
+		resultQueue: sqsURL(resultQueue),
+		endpoint:    u.Scheme + "://" + u.Host + "/",
+		creds: awsCredentials{
+			accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		client: &http.Client{Timeout: (sqsWait + 10) * time.Second},
+	}
+	if q.creds.accessKey == "" || q.creds.secretKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to use sqs")
+	}
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL_SQS"); endpoint != "" {
+		q.endpoint = strings.TrimSuffix(endpoint, "/") + "/"
+	}
+	// sqs.<region>.amazonaws.com
+	if parts := strings.Split(u.Hostname(), "."); len(parts) >= 4 && parts[0] == "sqs" {
+		q.region = parts[1]
+	}
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if q.region == "" {
+			q.region = os.Getenv(env)
+		}
+	}
+	if q.region == "" {
+		return nil, fmt.Errorf("cannot tell the region of '%s'; set AWS_REGION", queueURL)
+	}
+	return q, nil
+}
+
+// sqsURL turns an sqs:// URL into the https:// one SQS knows the queue by
+func sqsURL(raw string) string {
+	if rest, ok := strings.CutPrefix(raw, "sqs://"); ok {
+		return "https://" + rest
+	}
+	return raw
+}
+
+type sqsMessage struct {
+	Body              string `json:"Body"`
+	ReceiptHandle     string `json:"ReceiptHandle"`
+	MessageAttributes map[string]struct {
+		StringValue string `json:"StringValue"`
+	} `json:"MessageAttributes"`
+}
+
+// Receive long-polls the queue for the next task
+func (q *SQSQueue) Receive(ctx context.Context) (*Delivery, error) {
+	for {
+		var out struct {
+			Messages []sqsMessage `json:"Messages"`
+		}
+		err := q.call(ctx, "ReceiveMessage", map[string]any{
+			"QueueUrl":              q.queueURL,
+			"MaxNumberOfMessages":   1,
+			"WaitTimeSeconds":       sqsWait,
+			"VisibilityTimeout":     int(sqsVisibility.Seconds()),
+			"MessageAttributeNames": []string{"ReplyTo"},
+		}, &out)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if len(out.Messages) == 0 {
+			continue
+		}
+		msg := out.Messages[0]
+		replyTo := msg.MessageAttributes["ReplyTo"].StringValue
+
+		var task Task
+		if err := json.Unmarshal([]byte(msg.Body), &task); err != nil {
+			// A malformed task cannot succeed on another try, so report it and drop it
+			q.send(ctx, replyTo, Result{Status: StatusFailed, Error: fmt.Sprintf("invalid task: %s", err.Error())})
+			q.delete(ctx, msg.ReceiptHandle)
+			continue
+		}
+		stop := q.keepHidden(msg.ReceiptHandle)
+		return &Delivery{
+			Task: task,
+			Respond: func(ctx context.Context, result Result) error {
+				stop()
+				if err := q.send(ctx, replyTo, result); err != nil {
+					return err
+				}
+				return q.delete(ctx, msg.ReceiptHandle)
+			},
+		}, nil
+	}
+}
+
+// keepHidden extends the message's visibility timeout until the returned function
+// is called, so no other worker takes the task while it runs
+func (q *SQSQueue) keepHidden(receipt string) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(sqsVisibility / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				q.call(context.Background(), "ChangeMessageVisibility", map[string]any{
+					"QueueUrl":          q.queueURL,
+					"ReceiptHandle":     receipt,
+					"VisibilityTimeout": int(sqsVisibility.Seconds()),
+				}, nil)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// send sends result to replyTo, falling back to the result queue
+func (q *SQSQueue) send(ctx context.Context, replyTo string, result Result) error {
+	target := sqsURL(replyTo)
+	if target == "" {
+		target = q.resultQueue
+	}
+	if target == "" {
+		return nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+	return q.call(ctx, "SendMessage", map[string]any{"QueueUrl": target, "MessageBody": string(data)}, nil)
+}
+
+func (q *SQSQueue) delete(ctx context.Context, receipt string) error {
+	return q.call(ctx, "DeleteMessage", map[string]any{"QueueUrl": q.queueURL, "ReceiptHandle": receipt}, nil)
+}
+
+// call makes a signed SQS JSON request, decoding the response into out unless it is nil
+func (q *SQSQueue) call(ctx context.Context, action string, in map[string]any, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to encode sqs %s: %w", action, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("sqs %s: %w", action, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	signV4(req, body, q.creds, q.region, "sqs", time.Now())
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sqs %s: %w", action, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("sqs %s: %w", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("sqs %s failed with %s: %s %s", action, resp.Status, apiErr.Type, apiErr.Message)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode sqs %s response: %w", action, err)
+		}
+	}
+	return nil
+}
+
+// signV4 signs req with AWS Signature Version 4, covering its host, body and every
+// header already set
+func signV4(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	// Query parameters are sorted by key, then value
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{req.Method, path, strings.Join(params, "&"),
+		canonicalHeaders.String(), signedHeaders, hex.EncodeToString(bodyHash[:])}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + creds.secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, as SigV4 wants
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
@@ -0,0 +1,143 @@
+package keychain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when the keychain holds no secret for the service and account
+	ErrNotFound = errors.New("secret not found in keychain")
+	// ErrExists is returned by Add when a secret is already stored for the account
+	ErrExists = errors.New("secret already in keychain")
+)
+
+// Service is the keychain service name secrets are stored under
+const Service = "go-ai-agent"
+
+// securityNotFound and securityDuplicate are the exit codes of the macOS security
+// command for errSecItemNotFound and errSecDuplicateItem
+const (
+	securityNotFound  = 44
+	securityDuplicate = 45
+)
+
+// Get returns the secret stored for account, using the macOS Keychain or the
+// freedesktop Secret Service (via secret-tool) on Linux. Only a lookup that found
+// nothing is ErrNotFound; a locked keychain or a denied prompt is another error.
+func Get(account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", Service, "-a", account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", Service, "account", account)
+	default:
+		return "", unsupported()
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", fmt.Errorf("failed to read '%s' from the keychain: %w", account, err)
+		}
+		stderr := strings.TrimSpace(string(exitErr.Stderr))
+		switch {
+		case runtime.GOOS == "darwin" && exitErr.ExitCode() == securityNotFound:
+			return "", ErrNotFound
+		// secret-tool exits 1 without a word when nothing matches
+		case runtime.GOOS == "linux" && exitErr.ExitCode() == 1 && len(out) == 0 && stderr == "":
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to read '%s' from the keychain: %s", account, strings.TrimSpace(stderr+" "+err.Error()))
+	}
+	secret := strings.TrimRight(string(out), "\n")
+	if secret == "" {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Set stores secret for account, replacing any existing value
+func Set(account, secret string) error {
+	return store(account, secret, true)
+}
+
+// Add stores secret for account, failing with ErrExists rather than replacing a
+// secret already stored, such as a key that data is encrypted with
+func Add(account, secret string) error {
+	return store(account, secret, false)
+}
+
+func store(account, secret string, replace bool) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// Arguments are visible to every local user in ps, so the command is read
+		// from stdin, with the secret hex-encoded to need no quoting
+		command := fmt.Sprintf("add-generic-password -s %q -a %q -X %s", Service, account, hex.EncodeToString([]byte(secret)))
+		if replace {
+			command += " -U"
+		}
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(command + "\n")
+	case "linux":
+		// secret-tool store always replaces, so check first
+		if !replace {
+			if _, err := Get(account); err == nil {
+				return ErrExists
+			} else if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+		cmd = exec.Command("secret-tool", "store", "--label", Service+" "+account, "service", Service, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	default:
+		return unsupported()
+	}
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == securityDuplicate && runtime.GOOS == "darwin" {
+		return ErrExists
+	}
+	// security -i reports failed commands in its output but still exits 0
+	if err == nil && runtime.GOOS == "darwin" && strings.Contains(string(out), "SecKeychainItemCreateFromContent") {
+		if strings.Contains(string(out), "already exists") {
+			return ErrExists
+		}
+		err = errors.New("security failed")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store '%s' in the keychain: %s", account, strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	return nil
+}
+
+// Delete removes the secret stored for account
+func Delete(account string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", Service, "-a", account)
+	case "linux":
+		cmd = exec.Command("secret-tool", "clear", "service", Service, "account", account)
+	default:
+		return unsupported()
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && runtime.GOOS == "darwin" && exitErr.ExitCode() == securityNotFound {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete '%s' from the keychain: %s", account, strings.TrimSpace(string(out)+" "+err.Error()))
+	}
+	return nil
+}
+
+func unsupported() error {
+	return fmt.Errorf("no keychain support on %s", runtime.GOOS)
+}
@@ -0,0 +1,235 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes an OAuth 2.0 client using the authorization code flow with PKCE
+type Config struct {
+	ClientID string   `json:"client_id"`
+	AuthURL  string   `json:"auth_url"`
+	TokenURL string   `json:"token_url"`
+	Scopes   []string `json:"scopes,omitempty"`
+	// Transport carries token requests, for a proxy or custom CAs; nil uses the default
+	Transport http.RoundTripper `json:"-"`
+}
+
+// Token is an access token and the refresh token used to renew it
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+}
+
+// requestTimeout bounds each token request, so a stalled server cannot hang a login
+// or the API request waiting on a refresh
+const requestTimeout = 30 * time.Second
+
+// expiryMargin renews tokens slightly early so requests in flight do not race expiry
+const expiryMargin = time.Minute
+
+// Valid reports whether the access token can still be used
+func (t *Token) Valid() bool {
+	return t != nil && t.AccessToken != "" && (t.ExpiresAt.IsZero() || time.Now().Add(expiryMargin).Before(t.ExpiresAt))
+}
+
+// Login runs the browser flow: it listens on a loopback port for the redirect, passes
+// the authorization URL to open, and exchanges the returned code for a token
+func Login(ctx context.Context, cfg Config, open func(authURL string) error) (*Token, error) {
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the OAuth redirect: %w", err)
+	}
+	defer listener.Close()
+	redirectURI := fmt.Sprintf("http://%s/callback", listener.Addr())
+
+	type callback struct {
+		code string
+		err  error
+	}
+	result := make(chan callback, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		var cb callback
+		switch {
+		case query.Get("error") != "":
+			cb.err = fmt.Errorf("authorization failed: %s %s", query.Get("error"), query.Get("error_description"))
+		case query.Get("state") != state:
+			cb.err = errors.New("authorization failed: state mismatch")
+		default:
+			cb.code = query.Get("code")
+		}
+		if cb.err != nil {
+			http.Error(w, cb.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Logged in. You can close this window and return to the terminal.")
+		}
+		select {
+		case result <- cb:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {redirectURI},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if len(cfg.Scopes) > 0 {
+		params.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	if err := open(cfg.AuthURL + "?" + params.Encode()); err != nil {
+		return nil, err
+	}
+
+	select {
+	case cb := <-result:
+		if cb.err != nil {
+			return nil, cb.err
+		}
+		return exchange(ctx, cfg, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {cb.code},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {verifier},
+		})
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Refresh uses the refresh token to obtain a new access token
+func Refresh(ctx context.Context, cfg Config, token *Token) (*Token, error) {
+	if token.RefreshToken == "" {
+		return nil, errors.New("token has expired and has no refresh token; log in again")
+	}
+	refreshed, err := exchange(ctx, cfg, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Servers may omit the refresh token when it is not rotated
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+	return refreshed, nil
+}
+
+// exchange posts a token request and decodes the response
+func exchange(ctx context.Context, cfg Config, form url.Values) (*Token, error) {
+	form.Set("client_id", cfg.ClientID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{Transport: cfg.Transport, Timeout: requestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if payload.AccessToken == "" {
+		return nil, errors.New("token response had no access_token")
+	}
+	token := &Token{AccessToken: payload.AccessToken, RefreshToken: payload.RefreshToken}
+	if payload.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(payload.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// Source hands out a valid access token, refreshing it when it expires
+type Source struct {
+	Config Config
+	// OnRefresh, if set, is called with each refreshed token so it can be persisted
+	OnRefresh func(*Token) error
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewSource creates a Source starting from token
+func NewSource(cfg Config, token *Token, onRefresh func(*Token) error) *Source {
+	return &Source{Config: cfg, OnRefresh: onRefresh, token: token}
+}
+
+// AccessToken returns a currently valid access token
+func (s *Source) AccessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token.Valid() {
+		return s.token.AccessToken, nil
+	}
+	token, err := Refresh(ctx, s.Config, s.token)
+	if err != nil {
+		return "", err
+	}
+	s.token = token
+	if s.OnRefresh != nil {
+		if err := s.OnRefresh(token); err != nil {
+			return "", err
+		}
+	}
+	return token.AccessToken, nil
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,194 @@
+// Package policy asks Open Policy Agent whether a tool call is allowed, so what agents
+// may do can be defined centrally in Rego rather than per user
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultQuery is the rule evaluated when the config names none
+const DefaultQuery = "data.agent.tools"
+
+// timeout bounds one decision, so an unreachable server denies the call instead of
+// hanging the session
+const timeout = 10 * time.Second
+
+// Input is the document a policy is evaluated against, as input in Rego
+type Input struct {
+	Tool      string          `json:"tool"`
+	Mutating  bool            `json:"mutating"`
+	Path      string          `json:"path,omitempty"`
+	Command   string          `json:"command,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	User      string          `json:"user"`
+	Workspace string          `json:"workspace"`
+}
+
+// Engine evaluates tool calls against Rego policies, either on an OPA server or with
+// the opa binary and local policy files
+type Engine struct {
+	url    string
+	files  []string
+	query  string
+	client *http.Client
+}
+
+// New returns an engine asking the OPA server's decision endpoint at url, such as
+// http://localhost:8181/v1/data/agent/tools, or when url is empty, evaluating query
+// over files with opa eval
+func New(url string, files []string, query string) (*Engine, error) {
+	if url == "" && len(files) == 0 {
+		return nil, errors.New("a policy needs a server url or Rego files")
+	}
+	if url == "" {
+		if _, err := exec.LookPath("opa"); err != nil {
+			return nil, errors.New("policy files need the opa binary on PATH; install it or point the policy at an OPA server")
+		}
+	}
+	if query == "" {
+		query = DefaultQuery
+	}
+	return &Engine{url: url, files: files, query: query, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// Decide returns nil if the policy allows the call, or an error giving its reason
+// otherwise. A policy that cannot be evaluated, or has no decision for the call,
+// denies it.
+func (e *Engine) Decide(input Input) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var result json.RawMessage
+	var err error
+	if e.url != "" {
+		result, err = e.server(ctx, input)
+	} else {
+		result, err = e.eval(ctx, input)
+	}
+	if err != nil {
+		return fmt.Errorf("the tool policy could not be evaluated: %w", err)
+	}
+	return decision(result)
+}
+
+// server posts input to the OPA decision endpoint and returns its result
+func (e *Engine) server(ctx context.Context, input Input) (json.RawMessage, error) {
+	body, err := json.Marshal(map[string]Input{"input": input})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OPA returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("failed to parse OPA response: %w", err)
+	}
+	return reply.Result, nil
+}
+
+// eval runs opa eval over the policy files and returns the query's value
+func (e *Engine) eval(ctx context.Context, input Input) (json.RawMessage, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"eval", "--format", "json", "--stdin-input"}
+	for _, file := range e.files {
+		args = append(args, "--data", file)
+	}
+	cmd := exec.CommandContext(ctx, "opa", append(args, e.query)...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String() + string(output))
+		return nil, fmt.Errorf("opa eval failed: %w: %s", err, message)
+	}
+	var reply struct {
+		Result []struct {
+			Expressions []struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(output, &reply); err != nil {
+		return nil, fmt.Errorf("failed to parse opa eval output: %w", err)
+	}
+	if len(reply.Result) == 0 || len(reply.Result[0].Expressions) == 0 {
+		return nil, nil
+	}
+	return reply.Result[0].Expressions[0].Value, nil
+}
+
+// decision reads a policy's result, which may be a boolean, an object with allow and
+// reason, or a list of reasons to deny that is empty when the call is allowed
+func decision(result json.RawMessage) error {
+	if len(result) == 0 || string(result) == "null" {
+		return errors.New("the tool policy has no decision for this call")
+	}
+	var allow bool
+	if err := json.Unmarshal(result, &allow); err == nil {
+		if !allow {
+			return errors.New("the tool policy does not allow this call")
+		}
+		return nil
+	}
+	var verdict struct {
+		Allow  *bool  `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(result, &verdict); err == nil && verdict.Allow != nil {
+		if !*verdict.Allow {
+			return denied([]string{verdict.Reason})
+		}
+		return nil
+	}
+	var deny []string
+	if err := json.Unmarshal(result, &deny); err == nil {
+		if len(deny) > 0 {
+			return denied(deny)
+		}
+		return nil
+	}
+	return fmt.Errorf("the tool policy returned %s, which is not a boolean, an {allow, reason} object or a list of reasons", result)
+}
+
+// denied builds the error for a call the policy refused, with its reasons
+func denied(reasons []string) error {
+	var given []string
+	for _, reason := range reasons {
+		if reason = strings.TrimSpace(reason); reason != "" {
+			given = append(given, reason)
+		}
+	}
+	if len(given) == 0 {
+		return errors.New("the tool policy does not allow this call")
+	}
+	return fmt.Errorf("the tool policy does not allow this call: %s", strings.Join(given, "; "))
+}
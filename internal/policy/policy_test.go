@@ -0,0 +1,82 @@
+package policy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecision(t *testing.T) {
+	tests := []struct {
+		result string
+		want   string // substring of the error, or empty when allowed
+	}{
+		{`true`, ""},
+		{`false`, "does not allow this call"},
+		{`{"allow": true}`, ""},
+		{`{"allow": true, "reason": "ignored"}`, ""},
+		{`{"allow": false, "reason": "edits to migrations need review"}`, "does not allow this call: edits to migrations need review"},
+		{`{"allow": false}`, "does not allow this call"},
+		{`[]`, ""},
+		{`["no network", " ", "no secrets"]`, "does not allow this call: no network; no secrets"},
+		{`[""]`, "does not allow this call"},
+		{``, "no decision"},
+		{`null`, "no decision"},
+		{`{"reason": "missing allow"}`, "not a boolean"},
+		{`"yes"`, "not a boolean"},
+		{`1`, "not a boolean"},
+	}
+	for _, tt := range tests {
+		err := decision(json.RawMessage(tt.result))
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("decision(%s) = %v; want allowed", tt.result, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("decision(%s) = %v; want error containing %q", tt.result, err, tt.want)
+		}
+	}
+}
+
+func TestDecideServer(t *testing.T) {
+	var got map[string]Input
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		if got["input"].Mutating {
+			w.Write([]byte(`{"result": {"allow": false, "reason": "read-only session"}}`))
+			return
+		}
+		w.Write([]byte(`{"result": true}`))
+	}))
+	defer srv.Close()
+
+	engine, err := New(srv.URL, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Decide(Input{Tool: "read_file", Path: "main.go", User: "ada"}); err != nil {
+		t.Errorf("Decide(read_file) = %v", err)
+	}
+	if got["input"].Tool != "read_file" || got["input"].Path != "main.go" || got["input"].User != "ada" {
+		t.Errorf("server got input %+v", got["input"])
+	}
+	if err := engine.Decide(Input{Tool: "edit_file", Mutating: true}); err == nil || !strings.Contains(err.Error(), "read-only session") {
+		t.Errorf("Decide(edit_file) = %v; want the policy's reason", err)
+	}
+
+	// A server that fails denies the call
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "policy not found", http.StatusNotFound)
+	}))
+	defer failing.Close()
+	engine, err = New(failing.URL, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Decide(Input{Tool: "read_file"}); err == nil || !strings.Contains(err.Error(), "could not be evaluated") {
+		t.Errorf("Decide against a failing server = %v; want an error", err)
+	}
+}
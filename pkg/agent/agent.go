@@ -3,22 +3,84 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"agent/pkg/session"
 	"agent/pkg/tools"
 
 	"github.com/anthropics/anthropic-sdk-go"
 )
 
-// MessageHandler defines the signature for a function that gets user input
-type MessageHandler func() (string, bool)
+// MessageHandler gets the next user message. It returns io.EOF when there is no more
+// input, and should return ctx.Err() if ctx is cancelled while waiting.
+type MessageHandler func(ctx context.Context) (string, error)
 
 // Agent handles the conversation flow and tool execution
 type Agent struct {
 	client         *anthropic.Client
 	getUserMessage MessageHandler
 	tools          []tools.ToolDefinition
+	store          session.Store
+	session        *session.Session
+	maxTurns       int
+	tokenBudget    int64
+	system         string
+	maxTokens      int64
+	maxToolResult  int
+	temperature    *float64
+	toolExamples   map[string][]string
+	phased         bool
+	notifications  bool
+	scratchpad     bool
+	scratch        map[string]string // scratchpad notes when there is no session
+	marks          []string          // refs tagged with /mark when there is no session
+	historyDir     string
+	files          []session.FileVersion // file history when there is no session
+	traceSources   bool
+	citations      bool
+	features       Features
+	experiments    Experiments
+	prefetched     prefetchCache
+	anonymizer     *anonymizer // set while the anonymize_code experiment is on, shared with sub-agents
+	chaos          *chaos      // set by WithChaos, shared with sub-agents
+	hunkReviewer   HunkReviewer
+	language       string // LanguageAuto, a language name, or empty for no instruction
+	replyLanguage  string // detected from the user's messages when language is LanguageAuto
+	artifactRoot   string
+	artifactID     string          // names the artifact directory, set on first use
+	artifacts      []string        // paths saved this run
+	tree           *agentTree      // shared with sub-agents when they are enabled
+	node           *agentNode      // this agent's place in the tree
+	runCtx         context.Context // context of the turn in progress, for sub-agents
+	phase          Phase
+	usage          Usage
+	modelUsage     map[string]Usage // usage by the model that served it
+	lastModel      string           // model that answered the latest request
+	recorded       Usage            // usage already added to the session's spend
+	labels         []string         // session labels when there is no session
+	taskLabels     []string         // set with /label for the following messages
+	contextTokens  int64            // size of the conversation as of the latest request
+	statusLine     bool
+	turn           int               // number of the turn in progress, 0 before the first
+	callRefs       map[string]string // IDs of the turn's tool calls, by tool use ID
+	override       *turnOverride     // set by /retry for the turn it starts
+
+	confirmQueue func(question string) bool
+	steering     func() []string
+	onEvent      EventHandler
+
+	mu       sync.Mutex
+	draining bool
+	drained  chan struct{} // closed when draining starts
+	turnDone chan struct{} // non-nil while a turn is in flight, closed when it finishes
 }
 
 // NewAgent creates a new Agent instance
@@ -26,82 +88,395 @@ func NewAgent(
 	client *anthropic.Client,
 	getUserMessage MessageHandler,
 	tools []tools.ToolDefinition,
+	opts ...Option,
 ) *Agent {
-	return &Agent{
+	a := &Agent{
 		client:         client,
 		getUserMessage: getUserMessage,
 		tools:          tools,
+		maxTokens:      1024,
+		features:       AllFeatures,
+		drained:        make(chan struct{}),
+		onEvent:        LogEvents,
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
+	handler := a.onEvent
+	a.onEvent = func(e Event) { handler(a.stamp(e)) }
+	a.noticeFeatures()
+	a.noticeExperiments()
+	a.observeFiles()
+	a.applyLabels()
+	a.noticeHandoff()
+	return a
 }
 
+// ErrMaxTurns is returned when a turn is cut short by the WithMaxTurns limit
+var ErrMaxTurns = errors.New("maximum number of model turns reached")
+
 // Run starts the agent's conversation loop
 func (a *Agent) Run(ctx context.Context) error {
-	conversation := []anthropic.MessageParam{}
+	activeSessions.Inc()
+	defer activeSessions.Dec()
+
+	defer a.endTurn()
+
+	conversation := a.initialConversation()
 
 	log.Println("Chat with Claude (use 'ctrl-c' to quit)")
 
-	readUserInput := true
+	// A resumed conversation that ends with a user message is still waiting for a reply
+	readUserInput := len(conversation) == 0 || conversation[len(conversation)-1].Role != anthropic.MessageParamRoleUser
 	for {
 		if readUserInput {
+			a.endTurn()
+			a.override = nil
+			if a.isDraining() {
+				break
+			}
+
+			if a.statusLine {
+				fmt.Print(a.Status().String() + " ")
+			}
 			fmt.Print("\u001b[94mYou\u001b[0m: ")
-			userInput, ok := a.getUserMessage()
-			if !ok {
+			userInput, err := a.getUserMessage(ctx)
+			if errors.Is(err, io.EOF) {
 				break
 			}
+			if err != nil {
+				return fmt.Errorf("failed to read user input: %w", err)
+			}
+			if !a.beginTurn() {
+				log.Println("Shutting down, discarding input")
+				break
+			}
+			if strings.HasPrefix(userInput, "/") {
+				var handled bool
+				conversation, userInput, handled = a.runCommand(ctx, conversation, userInput)
+				if handled && userInput == "" {
+					continue
+				}
+			}
 
-			userMessage := anthropic.NewUserMessage(anthropic.NewTextBlock(userInput))
-			conversation = append(conversation, userMessage)
+			a.observeLanguage(userInput)
+			conversation = appendUserText(conversation, userInput)
+			conversation = a.attachTraceSources(conversation, userInput)
+			a.startPhases()
 		}
+		readUserInput = true
+		a.numberTurn(conversation)
 
-		message, err := a.runInference(ctx, conversation)
+		var err error
+		conversation, _, err = a.runTurn(ctx, conversation)
+		if isConnectivityError(err) && a.confirmQueue != nil {
+			log.Printf("Error: %s\n", err.Error())
+			if !a.confirmQueue("The API is unreachable. Queue this turn and retry automatically when connectivity returns?") {
+				log.Println("Not queued; the message will be sent along with your next one")
+				continue
+			}
+			conversation, _, err = a.retryWhenOnline(ctx, conversation)
+		}
+		if errors.Is(err, errQueuedAtShutdown) {
+			log.Println(err.Error())
+			break
+		}
+		if errors.Is(err, ErrMaxTurns) || errors.Is(err, ErrBudgetExceeded) {
+			log.Printf("Stopped: %s\n", err.Error())
+			continue
+		}
 		if err != nil {
-			return fmt.Errorf("error running inference: %w", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunTask runs a single prompt to completion without reading user input and returns
+// the model's final text. It is the entry point for non-interactive jobs.
+func (a *Agent) RunTask(ctx context.Context, prompt string) (string, error) {
+	activeSessions.Inc()
+	defer activeSessions.Dec()
+
+	if !a.beginTurn() {
+		return "", errors.New("agent is shutting down")
+	}
+	defer a.endTurn()
+
+	a.override = nil
+	a.observeLanguage(prompt)
+	conversation := appendUserText(a.initialConversation(), prompt)
+	conversation = a.attachTraceSources(conversation, prompt)
+	a.startPhases()
+	a.numberTurn(conversation)
+	_, text, err := a.runTurn(ctx, conversation)
+	return text, err
+}
+
+// initialConversation returns the resumed session's messages, or an empty conversation
+func (a *Agent) initialConversation() []anthropic.MessageParam {
+	if a.session != nil {
+		return a.session.Conversation()
+	}
+	return []anthropic.MessageParam{}
+}
+
+// appendUserText adds text as a new user message, or onto the trailing user message
+// (e.g. unanswered tool results) so roles keep alternating
+func appendUserText(conversation []anthropic.MessageParam, text string) []anthropic.MessageParam {
+	if n := len(conversation); n > 0 && conversation[n-1].Role == anthropic.MessageParamRoleUser {
+		conversation[n-1].Content = append(conversation[n-1].Content, anthropic.NewTextBlock(text))
+		return conversation
+	}
+	return append(conversation, anthropic.NewUserMessage(anthropic.NewTextBlock(text)))
+}
+
+// runTurn calls the model, executing any tools it requests, until it replies without
+// tool calls. It returns the extended conversation and the text of the final reply.
+func (a *Agent) runTurn(ctx context.Context, conversation []anthropic.MessageParam) ([]anthropic.MessageParam, string, error) {
+	a.runCtx = ctx
+	for inferences := 0; ; inferences++ {
+		if a.maxTurns > 0 && inferences >= a.maxTurns {
+			return conversation, "", fmt.Errorf("%w (%d)", ErrMaxTurns, a.maxTurns)
+		}
+		if used := a.Usage().Total(); a.tokenBudget > 0 && used >= a.tokenBudget {
+			return conversation, "", fmt.Errorf("%w (%d of %d tokens used)", ErrBudgetExceeded, used, a.tokenBudget)
+		}
+		if err := a.checkTreeBudget(); err != nil {
+			return conversation, "", err
+		}
+
+		if inferences > 0 {
+			conversation = a.deliverSteering(conversation)
+		} else {
+			a.prefetch(conversation)
+			a.routeTurn(ctx, conversation)
+		}
+		var message *anthropic.Message
+		if inferences == 0 {
+			message = a.takePending()
+		}
+		if message == nil {
+			var err error
+			if message, err = a.runInference(ctx, conversation); err != nil {
+				return conversation, "", fmt.Errorf("error running inference: %w", err)
+			}
+		}
+		if a.awaitsReview(message.Content) {
+			a.savePending(ctx, conversation, message)
 		}
-		conversation = append(conversation, message.ToParam())
 
+		var text strings.Builder
 		toolResults := []anthropic.ContentBlockParamUnion{}
+		var resultTexts []string
+		rejected := a.reviewHunks(message.Content)
+		a.reviewed()
+		conversation = append(conversation, message.ToParam())
+		parallel := a.startParallelTools(message.Content, rejected)
 		for _, content := range message.Content {
 			switch content.Type {
 			case "text":
-				log.Printf("\u001b[93mClaude\u001b[0m: %s\n", content.Text)
+				a.onEvent(Event{Type: EventText, Text: content.Text})
+				text.WriteString(content.Text)
 			case "tool_use":
-				log.Printf("\u001b[92mtool\u001b[0m: requesting %s(%s)\n", content.Name, content.Input)
-				result := a.executeTool(content.ID, content.Name, content.Input)
+				a.onEvent(Event{Type: EventToolUse, ToolID: content.ID, ToolName: content.Name, Input: content.Input})
+				if rejected[content.ID] {
+					a.onEvent(Event{Type: EventToolResult, ToolID: content.ID, ToolName: content.Name, Text: rejectedHunkMessage, IsError: true})
+					toolResults = append(toolResults, anthropic.NewToolResultBlock(content.ID, rejectedHunkMessage, true))
+					continue
+				}
+				var result anthropic.ContentBlockParamUnion
+				var resultText string
+				if outcome, ok := parallel[content.ID]; ok {
+					done := <-outcome
+					result, resultText = a.toolResult(content.ID, content.Name, done.text, done.isError)
+				} else {
+					result, resultText = a.executeTool(content.ID, content.Name, content.Input)
+				}
 				toolResults = append(toolResults, result)
+				resultTexts = append(resultTexts, resultText)
 			}
 		}
 		if len(toolResults) == 0 {
-			readUserInput = true
-			continue
+			if a.chaos != nil {
+				if err := checkConversation(conversation); err != nil {
+					return conversation, "", fmt.Errorf("chaos mode left the conversation invalid: %w", err)
+				}
+			}
+			a.saveSession(ctx, conversation)
+			return conversation, text.String(), nil
 		}
-		readUserInput = false
 		conversation = append(conversation, anthropic.NewUserMessage(toolResults...))
+		conversation = a.attachTraceSources(conversation, resultTexts...)
+		a.saveSession(ctx, conversation)
 	}
+}
 
-	return nil
+// saveSession persists the conversation if the agent has a session store. It is only
+// called at points where every tool_use has its matching tool_result, and it uses a
+// context that survives cancellation so the final state is kept during shutdown.
+func (a *Agent) saveSession(ctx context.Context, conversation []anthropic.MessageParam) {
+	if a.store == nil || a.session == nil {
+		return
+	}
+	a.session.SetConversation(conversation)
+	a.recordSpend()
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := a.store.Save(saveCtx, a.session); err != nil {
+		log.Printf("Error saving session '%s': %v", a.session.ID, err)
+	}
+}
+
+// Shutdown stops the agent from starting new turns and waits for the in-flight turn,
+// if any, to finish. It returns ctx's error if the deadline passes first; the caller
+// should then cancel the context passed to Run to abort the remaining work.
+func (a *Agent) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.draining {
+		a.draining = true
+		close(a.drained)
+	}
+	done := a.turnDone
+	a.mu.Unlock()
+
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// beginTurn marks a turn as in flight, or reports false if the agent is shutting down
+func (a *Agent) beginTurn() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.draining {
+		return false
+	}
+	a.turnDone = make(chan struct{})
+	return true
+}
+
+// endTurn marks the in-flight turn, if any, as finished
+func (a *Agent) endTurn() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.turnDone != nil {
+		close(a.turnDone)
+		a.turnDone = nil
+	}
+}
+
+// drainSignal returns a channel that is closed once Shutdown has been called
+func (a *Agent) drainSignal() <-chan struct{} {
+	return a.drained
+}
+
+func (a *Agent) isDraining() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.draining
 }
 
-// executeTool handles execution of tools based on model requests
-func (a *Agent) executeTool(id, name string, input json.RawMessage) anthropic.ContentBlockParamUnion {
-	var toolDef tools.ToolDefinition
-	var found bool
-	for _, tool := range a.tools {
+// activeTools returns the tools offered to the model right now: the caller's tools
+// allowed in the current phase plus the agent's own
+func (a *Agent) activeTools() []tools.ToolDefinition {
+	active := a.phaseTools()
+	if a.notifications {
+		active = append(slices.Clip(active), a.notifyUserDefinition())
+	}
+	if a.scratchpad {
+		active = append(slices.Clip(active), a.scratchpadDefinitions()...)
+	}
+	if a.artifactRoot != "" {
+		active = append(slices.Clip(active), a.saveArtifactDefinition(), a.renderDiagramDefinition())
+	}
+	if a.canDelegate() {
+		active = append(slices.Clip(active), a.delegateDefinition())
+	}
+	return active
+}
+
+// findTool returns the active tool called name
+func (a *Agent) findTool(name string) (tools.ToolDefinition, bool) {
+	for _, tool := range a.activeTools() {
 		if tool.Name == name {
-			toolDef = tool
-			found = true
-			break
+			return tool, true
 		}
 	}
+	return tools.ToolDefinition{}, false
+}
+
+// executeTool handles execution of tools based on model requests, returning the result
+// block and its text
+func (a *Agent) executeTool(id, name string, input json.RawMessage) (anthropic.ContentBlockParamUnion, string) {
+	text, isError := a.callTool(name, input)
+	return a.toolResult(id, name, text, isError)
+}
+
+// callTool runs the tool called name, returning its output or error message. It sends
+// no events, so calls can run concurrently.
+func (a *Agent) callTool(name string, input json.RawMessage) (string, bool) {
+	toolDef, found := a.findTool(name)
 	if !found {
-		log.Printf("Error: tool '%s' not found", name)
-		return anthropic.NewToolResultBlock(id, "tool not found", true)
+		toolCallsTotal.Inc(name, "not_found")
+		message := "tool not found"
+		if a.phased && a.Phase() == PhaseExplore {
+			message = fmt.Sprintf("tool not available in the %s phase; call %s first", PhaseExplore, beginImplementationTool)
+		}
+		return message, true
+	}
+	if err := tools.Authorize(toolDef, input); err != nil {
+		toolCallsTotal.Inc(name, "denied")
+		return err.Error() + "; do not retry this call, and tell the user if the task needs it", true
+	}
+	if toolDef.Mutating {
+		a.dropPrefetched()
+	} else if response, ok := a.takePrefetched(name, input); ok {
+		toolCallsTotal.Inc(name, "prefetched")
+		return a.truncateResult(response), false
 	}
 
-	response, err := toolDef.Function(input)
+	start := time.Now()
+	if fault, ok := a.chaos.tool(name); ok {
+		toolCallsTotal.Inc(name, "error")
+		return fault, true
+	}
+	response, err := toolDef.Call(a.runCtx, input)
+	toolDuration.Observe(time.Since(start).Seconds(), name)
+	toolCallsTotal.Inc(name, statusLabel(err))
 	if err != nil {
-		log.Printf("Error executing tool '%s': %v", name, err)
-		return anthropic.NewToolResultBlock(id, err.Error(), true)
+		return strings.ToValidUTF8(err.Error(), "\uFFFD"), true
 	}
-	log.Printf("\u001b[92mtool\u001b[0m: result %s -> %s\n", name, response)
-	return anthropic.NewToolResultBlock(id, response, false)
-}
\ No newline at end of file
+	// Binary files and cut-off output must not put invalid UTF-8 in the conversation
+	response = strings.ToValidUTF8(a.chaos.result(response), "\uFFFD")
+	return a.truncateResult(response), false
+}
+
+// truncateResult applies the WithMaxToolResult limit
+func (a *Agent) truncateResult(response string) string {
+	if a.maxToolResult > 0 && len(response) > a.maxToolResult {
+		cut := a.maxToolResult
+		for cut > 0 && !utf8.RuneStart(response[cut]) {
+			cut--
+		}
+		return fmt.Sprintf("%s\n... (%d more bytes truncated)", response[:cut], len(response)-cut)
+	}
+	return response
+}
+
+// toolResult reports a finished tool call and returns its result block and text. With
+// citations the block starts with the call's reference, for the model to cite.
+func (a *Agent) toolResult(id, name, text string, isError bool) (anthropic.ContentBlockParamUnion, string) {
+	a.onEvent(Event{Type: EventToolResult, ToolID: id, ToolName: name, Text: text, IsError: isError})
+	if ref, ok := a.callRefs[id]; ok && a.citations {
+		return anthropic.NewToolResultBlock(id, "["+ref+"] "+text, isError), text
+	}
+	return anthropic.NewToolResultBlock(id, text, isError), text
+}
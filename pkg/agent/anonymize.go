@@ -0,0 +1,245 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+var (
+	// codeToken matches a one-line string literal or an identifier
+	codeToken = regexp.MustCompile("\"(?:[^\"\\\\\\n]|\\\\.)*\"|`[^`\\n]*`|\\b[A-Za-z_][A-Za-z0-9_]*\\b")
+	// pseudonym matches the names the anonymizer hands out
+	pseudonym = regexp.MustCompile(`\b(?:[Ss]ym|str)_\d+\b`)
+)
+
+// plainWords are left as they are: keywords and builtins of common languages, and
+// words common in comments, so code sent anonymized still reads as code
+var plainWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+		break case chan const continue default defer else fallthrough for func go goto if import interface map
+		package range return select struct switch type var nil true false append cap close copy delete len make
+		new panic print println recover string int int8 int16 int32 int64 uint uint8 uint16 uint32 uint64 uintptr
+		float32 float64 byte rune bool error any iota complex64 complex128 min max clear
+		and as assert async await class def del elif except finally from global in is lambda None nonlocal not or
+		pass raise try while with yield self True False str dict list set tuple len range print isinstance
+		abstract boolean catch extends final implements instanceof native private protected public static super
+		synchronized this throw throws transient void volatile null undefined let function typeof export enum
+		readonly declare namespace keyof never unknown number object symbol require module exports console
+		crate dyn impl loop match mod move mut pub ref Self trait unsafe use where fn usize isize Box Vec Option
+		Some Ok Err Result char double float long short signed unsigned sizeof struct union auto extern register
+		include define ifdef ifndef endif std cout endl template typename virtual operator delete nullptr
+		the The this This that That these those with With from From for For not Not are Are was were has have had
+		but But can should would could will may might must use Use see See when When then Then also Also only
+		returns Returns return Return each Each all All any Any one two first last new New get Get set Set add
+		Add TODO FIXME NOTE XXX http https www com org json yaml html
+	`) {
+		plainWords[word] = true
+	}
+}
+
+// anonymizer replaces the identifiers and string literals in code sent to the model
+// with pseudonyms, and maps the pseudonyms in its replies back. The mapping lives
+// only in memory, and is shared by an agent and its sub-agents.
+type anonymizer struct {
+	mu      sync.Mutex
+	forward map[string]string
+	reverse map[string]string
+	counter int
+}
+
+// newAnonymizer returns an anonymizer with an empty mapping
+func newAnonymizer() *anonymizer {
+	return &anonymizer{forward: map[string]string{}, reverse: map[string]string{}}
+}
+
+// anonymizing returns the agent's anonymizer, or nil when code is sent as it is
+func (a *Agent) anonymizing() *anonymizer {
+	if a.anonymizer == nil && a.experiments.AnonymizeCode {
+		a.anonymizer = newAnonymizer()
+	}
+	return a.anonymizer
+}
+
+// code pseudonymizes the identifiers and literals of text, which is a tool result,
+// adding new names to the mapping
+func (z *anonymizer) code(text string) string {
+	return z.replace(text, true)
+}
+
+// known pseudonymizes only the names already in the mapping, for the user's messages
+// and the model's own text, which are prose as much as code
+func (z *anonymizer) known(text string) string {
+	return z.replace(text, false)
+}
+
+// replace substitutes the pseudonyms for the tokens of text, creating them if add
+func (z *anonymizer) replace(text string, add bool) string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var token func(string) string
+	token = func(t string) string {
+		if t[0] == '"' || t[0] == '`' {
+			quote, content := t[:1], t[1:len(t)-1]
+			if alias, ok := z.forward[quote+content]; ok {
+				return quote + alias + quote
+			}
+			if !add || len(strings.TrimSpace(content)) < 3 {
+				// Quoted names in prose, like `runTurn`, are still names
+				return quote + codeToken.ReplaceAllStringFunc(content, token) + quote
+			}
+			return quote + z.alias(quote+content, content, "str") + quote
+		}
+		if alias, ok := z.forward[t]; ok {
+			return alias
+		}
+		if !add || !isCodeName(t) {
+			return t
+		}
+		prefix := "sym"
+		if unicode.IsUpper(rune(t[0])) {
+			prefix = "Sym"
+		}
+		return z.alias(t, t, prefix)
+	}
+	return codeToken.ReplaceAllStringFunc(text, token)
+}
+
+// alias adds a pseudonym such as "Sym_4" or "str_9" for the token key, restored as
+// value, to the mapping. Callers hold z.mu.
+func (z *anonymizer) alias(key, value, prefix string) string {
+	z.counter++
+	alias := fmt.Sprintf("%s_%d", prefix, z.counter)
+	z.forward[key] = alias
+	z.reverse[alias] = value
+	return alias
+}
+
+// isCodeName reports whether t is worth hiding: a name of three or more characters
+// that is neither a keyword nor a plain lowercase word
+func isCodeName(t string) bool {
+	if len(t) < 3 || plainWords[t] {
+		return false
+	}
+	return strings.ContainsAny(t, "_0123456789") || strings.ToLower(t) != t
+}
+
+// restore replaces the pseudonyms in text with what they stand for
+func (z *anonymizer) restore(text string) string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return pseudonym.ReplaceAllStringFunc(text, func(alias string) string {
+		if value, ok := z.reverse[alias]; ok {
+			return value
+		}
+		return alias
+	})
+}
+
+// request returns a copy of the conversation with its code pseudonymized: tool results
+// in full, and the names already known in everything else
+func (z *anonymizer) request(conversation []anthropic.MessageParam) []anthropic.MessageParam {
+	anonymized := make([]anthropic.MessageParam, len(conversation))
+	for i, message := range conversation {
+		content := make([]anthropic.ContentBlockParamUnion, len(message.Content))
+		for j, block := range message.Content {
+			switch {
+			case block.OfRequestTextBlock != nil:
+				text := *block.OfRequestTextBlock
+				text.Text = z.known(text.Text)
+				block.OfRequestTextBlock = &text
+			case block.OfRequestToolUseBlock != nil:
+				use := *block.OfRequestToolUseBlock
+				if input, err := json.Marshal(use.Input); err == nil {
+					use.Input = json.RawMessage(mapStrings(input, z.known))
+				}
+				block.OfRequestToolUseBlock = &use
+			case block.OfRequestToolResultBlock != nil:
+				result := *block.OfRequestToolResultBlock
+				result.Content = make([]anthropic.ToolResultBlockParamContentUnion, len(block.OfRequestToolResultBlock.Content))
+				for k, part := range block.OfRequestToolResultBlock.Content {
+					if part.OfRequestTextBlock != nil {
+						text := *part.OfRequestTextBlock
+						text.Text = z.code(text.Text)
+						part.OfRequestTextBlock = &text
+					}
+					result.Content[k] = part
+				}
+				block.OfRequestToolResultBlock = &result
+			}
+			content[j] = block
+		}
+		anonymized[i] = anthropic.MessageParam{Role: message.Role, Content: content}
+	}
+	return anonymized
+}
+
+// response maps the pseudonyms in the model's text and tool calls back, so the user
+// reads, and the tools act on, the real names
+func (z *anonymizer) response(message *anthropic.Message) (*anthropic.Message, error) {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(message.RawJSON()), &raw); err != nil {
+		return nil, fmt.Errorf("failed to restore names in the response: %w", err)
+	}
+	blocks, _ := raw["content"].([]any)
+	for _, block := range blocks {
+		block, ok := block.(map[string]any)
+		if !ok {
+			continue
+		}
+		if text, ok := block["text"].(string); ok {
+			block["text"] = z.restore(text)
+		}
+		if input, ok := block["input"]; ok {
+			data, _ := json.Marshal(input)
+			block["input"] = json.RawMessage(mapStrings(data, z.restore))
+		}
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore names in the response: %w", err)
+	}
+	// The SDK reads content blocks from the raw JSON, so the message is decoded afresh
+	var restored anthropic.Message
+	if err := json.Unmarshal(data, &restored); err != nil {
+		return nil, fmt.Errorf("failed to restore names in the response: %w", err)
+	}
+	return &restored, nil
+}
+
+// mapStrings applies f to each string value in a tool input, leaving keys, which
+// name the tool's parameters, alone
+func mapStrings(input []byte, f func(string) string) []byte {
+	var value any
+	if err := json.Unmarshal(input, &value); err != nil {
+		return input
+	}
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			return f(v)
+		case []any:
+			for i := range v {
+				v[i] = walk(v[i])
+			}
+		case map[string]any:
+			for key, item := range v {
+				v[key] = walk(item)
+			}
+		}
+		return v
+	}
+	data, err := json.Marshal(walk(value))
+	if err != nil {
+		return input
+	}
+	return data
+}
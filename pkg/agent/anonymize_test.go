@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+func TestAnonymizeRoundTrip(t *testing.T) {
+	z := newAnonymizer()
+	source := "func runTurn(ctx context.Context) error {\n\treturn errors.New(\"failed to connect\")\n}\n"
+	conversation := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Why does runTurn fail?")),
+		anthropic.NewAssistantMessage(anthropic.ContentBlockParamUnion{OfRequestToolUseBlock: &anthropic.ToolUseBlockParam{
+			ID: "toolu_1", Name: "read_file", Input: json.RawMessage(`{"path":"loop.go"}`),
+		}}),
+		anthropic.NewUserMessage(anthropic.NewToolResultBlock("toolu_1", source, false)),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Make runTurn retry")),
+	}
+
+	sent := z.request(conversation)
+	result := sent[2].Content[0].OfRequestToolResultBlock.Content[0].OfRequestTextBlock.Text
+	for _, name := range []string{"runTurn", "failed to connect", "Context"} {
+		if strings.Contains(result, name) {
+			t.Errorf("tool result still contains %q:\n%s", name, result)
+		}
+	}
+	for _, word := range []string{"func", "ctx", "error", "return"} {
+		if !strings.Contains(result, word) {
+			t.Errorf("tool result lost %q:\n%s", word, result)
+		}
+	}
+	turn, literal := z.forward["runTurn"], z.forward[`"failed to connect`]
+	if turn == "" || literal == "" {
+		t.Fatalf("no pseudonyms for the code: %v", z.forward)
+	}
+	// Names are only known once a tool result has shown them
+	if got := sent[0].Content[0].OfRequestTextBlock.Text; got != "Why does runTurn fail?" {
+		t.Errorf("first message = %q; want it unchanged", got)
+	}
+	if got := z.known("Make runTurn retry"); got != "Make "+turn+" retry" {
+		t.Errorf("known = %q; want the known name replaced", got)
+	}
+	if got := conversation[2].Content[0].OfRequestToolResultBlock.Content[0].OfRequestTextBlock.Text; got != source {
+		t.Errorf("request modified the conversation: %q", got)
+	}
+
+	reply, err := json.Marshal(map[string]any{
+		"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-3-7-sonnet-latest",
+		"stop_reason": "tool_use", "usage": map[string]int{"input_tokens": 1, "output_tokens": 1},
+		"content": []map[string]any{
+			{"type": "text", "text": turn + " gives up after one attempt; " + literal + " is returned unchanged."},
+			{"type": "tool_use", "id": "toolu_2", "name": "edit_file", "input": map[string]string{
+				"path": "loop.go", "old_str": `return errors.New("` + literal + `")`,
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message anthropic.Message
+	if err := json.Unmarshal(reply, &message); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := z.response(&message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restored.Content[0].Text, "runTurn gives up after one attempt; failed to connect is returned unchanged."; got != want {
+		t.Errorf("restored text = %q; want %q", got, want)
+	}
+	var input map[string]string
+	if err := json.Unmarshal(restored.Content[1].Input, &input); err != nil {
+		t.Fatal(err)
+	}
+	if input["old_str"] != `return errors.New("failed to connect")` || input["path"] != "loop.go" {
+		t.Errorf("restored input = %v", input)
+	}
+}
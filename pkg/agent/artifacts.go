@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"agent/pkg/session"
+	"agent/pkg/tools"
+)
+
+const saveArtifactTool = "save_artifact"
+
+type saveArtifactInput struct {
+	Name     string `json:"name" jsonschema_description:"File name within the artifacts directory, e.g. report.md or diagrams/flow.svg."`
+	Content  string `json:"content" jsonschema_description:"The file contents."`
+	Encoding string `json:"encoding,omitempty" jsonschema:"enum=text,enum=base64" jsonschema_description:"base64 for binary content such as images. Defaults to text."`
+}
+
+// ArtifactDir returns the directory this agent's artifacts are written to, named after
+// the session, or the empty string if artifacts are disabled
+func (a *Agent) ArtifactDir() string {
+	if a.artifactRoot == "" {
+		return ""
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.artifactID == "" {
+		a.artifactID = session.NewID()
+		if a.session != nil {
+			a.artifactID = a.session.ID
+		}
+	}
+	return filepath.Join(a.artifactRoot, a.artifactID)
+}
+
+// Artifacts returns the paths of the artifacts saved so far, in the order they were
+// first written
+func (a *Agent) Artifacts() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.artifacts)
+}
+
+// SaveArtifact writes data to name within ArtifactDir, records it and emits an
+// EventArtifact so a UI can preview it. Tools that produce artifacts of their own use
+// it too. It returns the path written.
+func (a *Agent) SaveArtifact(name string, data []byte) (string, error) {
+	dir := a.ArtifactDir()
+	if dir == "" {
+		return "", fmt.Errorf("artifacts are not enabled")
+	}
+	if name == "" || filepath.IsAbs(name) || !filepath.IsLocal(name) {
+		return "", fmt.Errorf("artifact name '%s' must be a relative path inside the artifacts directory", name)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory for artifact '%s': %w", name, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write artifact '%s': %w", name, err)
+	}
+	a.mu.Lock()
+	if !slices.Contains(a.artifacts, path) {
+		a.artifacts = append(a.artifacts, path)
+	}
+	a.mu.Unlock()
+	a.onEvent(Event{Type: EventArtifact, Text: path})
+	return path, nil
+}
+
+func (a *Agent) saveArtifactDefinition() tools.ToolDefinition {
+	return tools.New(saveArtifactTool,
+		"Save a generated file that is not part of the code, such as a report, diagram or data export, "+
+			"to this session's artifacts directory. Use this instead of writing such files into the repository.",
+		func(ctx context.Context, in saveArtifactInput) (string, error) {
+			data := []byte(in.Content)
+			switch in.Encoding {
+			case "", "text":
+			case "base64":
+				decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(in.Content))
+				if err != nil {
+					return "", fmt.Errorf("content is not valid base64: %w", err)
+				}
+				data = decoded
+			default:
+				return "", fmt.Errorf("encoding must be text or base64")
+			}
+			path, err := a.SaveArtifact(in.Name, data)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Saved %s (%d bytes).", path, len(data)), nil
+		})
+}
+
+const renderDiagramTool = "render_diagram"
+
+type renderDiagramInput struct {
+	Name     string `json:"name" jsonschema_description:"Base file name for the diagram without extension, e.g. architecture or diagrams/request-flow."`
+	Language string `json:"language" jsonschema:"enum=mermaid,enum=plantuml" jsonschema_description:"The diagram language."`
+	Source   string `json:"source" jsonschema_description:"The diagram source."`
+	Format   string `json:"format,omitempty" jsonschema:"enum=svg,enum=png" jsonschema_description:"Image format. Defaults to svg."`
+}
+
+func (a *Agent) renderDiagramDefinition() tools.ToolDefinition {
+	return tools.New(renderDiagramTool,
+		"Validate a Mermaid or PlantUML diagram and render it to an image in the artifacts directory, "+
+			"with its source saved alongside. Use this for architecture and flow documentation. A syntax error is "+
+			"returned so you can fix the source and try again.",
+		func(ctx context.Context, in renderDiagramInput) (string, error) {
+			if in.Format == "" {
+				in.Format = "svg"
+			}
+			image, renderErr := tools.RenderDiagram(in.Language, in.Format, in.Source)
+			if renderErr != nil && !errors.Is(renderErr, tools.ErrRendererMissing) {
+				return "", renderErr
+			}
+			sourcePath, err := a.SaveArtifact(in.Name+tools.DiagramExtension(in.Language), []byte(in.Source))
+			if err != nil {
+				return "", err
+			}
+			if renderErr != nil {
+				return fmt.Sprintf("Saved the source to %s but could not render it: %s", sourcePath, renderErr.Error()), nil
+			}
+			imagePath, err := a.SaveArtifact(in.Name+"."+in.Format, image)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Rendered %s (source in %s).", imagePath, sourcePath), nil
+		})
+}
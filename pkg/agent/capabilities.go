@@ -0,0 +1,63 @@
+package agent
+
+// CapabilitiesVersion is bumped whenever the shape of Capabilities changes incompatibly
+const CapabilitiesVersion = 1
+
+// Capabilities describes what an agent can do, for front ends that build their UI from it
+type Capabilities struct {
+	Version         int              `json:"version"`
+	Tools           []ToolCapability `json:"tools"`
+	Models          []string         `json:"models"`
+	DefaultModel    string           `json:"default_model"`
+	Features        Features         `json:"features"`
+	Experiments     Experiments      `json:"experiments"`
+	PermissionModes []PermissionMode `json:"permission_modes"`
+}
+
+// ToolCapability is a tool as the model sees it
+type ToolCapability struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema InputSchema `json:"input_schema"`
+}
+
+// InputSchema is a tool's JSON schema. The SDK's param type is not used directly
+// because it marshals internal fields that are meaningless to integrators.
+type InputSchema struct {
+	Type       string `json:"type"`
+	Properties any    `json:"properties,omitempty"`
+}
+
+// PermissionMode is a way of answering the questions tools ask before risky actions
+type PermissionMode struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// permissionModes are the Prompter behaviours the tools package supports
+var permissionModes = []PermissionMode{
+	{Name: "ask", Description: "Each confirmation is put to the user and the action is skipped unless approved."},
+	{Name: "decline", Description: "Every confirmation is declined; used for unattended runs."},
+}
+
+// Capabilities returns the agent's tools, models, model features, experiments and
+// permission modes
+func (a *Agent) Capabilities() Capabilities {
+	caps := Capabilities{
+		Version:         CapabilitiesVersion,
+		Tools:           []ToolCapability{},
+		Models:          []string{string(DefaultModel)},
+		DefaultModel:    string(DefaultModel),
+		Features:        a.features,
+		Experiments:     a.experiments,
+		PermissionModes: permissionModes,
+	}
+	for _, tool := range a.tools {
+		caps.Tools = append(caps.Tools, ToolCapability{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: InputSchema{Type: "object", Properties: tool.Schema().Properties},
+		})
+	}
+	return caps
+}
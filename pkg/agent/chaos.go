@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// overloadedBody is the error body the API sends with a 529
+const overloadedBody = `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded (injected by chaos mode)"}}`
+
+// chaos injects faults at a fixed rate: overloaded API responses, tool timeouts and
+// malformed tool results. It is shared with sub-agents.
+type chaos struct {
+	mu   sync.Mutex
+	rate float64
+	rand *rand.Rand
+}
+
+// WithChaos injects faults into a fraction rate of API requests and tool calls, to
+// test that the agent loop degrades gracefully: requests fail with 529 Overloaded
+// before reaching the API, tools time out without running, or return truncated
+// output mixed with invalid UTF-8. The same seed injects the same faults. After each
+// turn the conversation is checked, and a turn that left it invalid fails.
+func WithChaos(rate float64, seed int64) Option {
+	return func(a *Agent) {
+		a.chaos = &chaos{rate: rate, rand: rand.New(rand.NewSource(seed))}
+	}
+}
+
+// roll reports whether to inject a fault, and picks a number below n for its kind
+func (c *chaos) roll(n int) (int, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rand.Float64() >= c.rate {
+		return 0, false
+	}
+	return c.rand.Intn(n), true
+}
+
+// requestOptions returns the options that make API requests fail, with each retry
+// the client makes rolled for separately
+func (c *chaos) requestOptions() []option.RequestOption {
+	if c == nil {
+		return nil
+	}
+	return []option.RequestOption{option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		if _, ok := c.roll(1); !ok {
+			return next(req)
+		}
+		chaosTotal.Inc("api_overloaded")
+		return &http.Response{
+			Status:     "529 Overloaded",
+			StatusCode: 529,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewBufferString(overloadedBody)),
+			Request:    req,
+		}, nil
+	})}
+}
+
+// tool returns the fault to report instead of running a tool, if one is injected
+func (c *chaos) tool(name string) (string, bool) {
+	if kind, ok := c.roll(2); ok && kind == 0 {
+		chaosTotal.Inc("tool_timeout")
+		return fmt.Sprintf("tool %s timed out after 30s (injected by chaos mode)", name), true
+	}
+	return "", false
+}
+
+// result returns response malformed, if a fault is injected: cut short and ending
+// in bytes that are not valid UTF-8
+func (c *chaos) result(response string) string {
+	if kind, ok := c.roll(2); !ok || kind == 0 {
+		return response
+	}
+	chaosTotal.Inc("malformed_result")
+	c.mu.Lock()
+	cut := c.rand.Intn(len(response) + 1)
+	c.mu.Unlock()
+	return response[:cut] + "\xff\xfe\x00{\"unterminated"
+}
+
+// checkConversation returns an error if conversation could not be sent again: roles
+// must alternate from the user, each tool call must be answered by a result in the
+// next message, and results only answer the calls before them
+func checkConversation(conversation []anthropic.MessageParam) error {
+	var calls map[string]bool
+	for i, message := range conversation {
+		want := anthropic.MessageParamRoleUser
+		if i%2 == 1 {
+			want = anthropic.MessageParamRoleAssistant
+		}
+		if message.Role != want {
+			return fmt.Errorf("message %d is from the %s, where the %s should be", i+1, message.Role, want)
+		}
+		answered := map[string]bool{}
+		for _, block := range message.Content {
+			switch {
+			case block.OfRequestToolResultBlock != nil:
+				id := block.OfRequestToolResultBlock.ToolUseID
+				if !calls[id] {
+					return fmt.Errorf("message %d answers tool call %s, which the message before does not make", i+1, id)
+				}
+				answered[id] = true
+				for _, content := range block.OfRequestToolResultBlock.Content {
+					if content.OfRequestTextBlock != nil && !utf8.ValidString(content.OfRequestTextBlock.Text) {
+						return fmt.Errorf("message %d has a tool result that is not valid UTF-8", i+1)
+					}
+				}
+			case block.OfRequestTextBlock != nil && !utf8.ValidString(block.OfRequestTextBlock.Text):
+				return fmt.Errorf("message %d has text that is not valid UTF-8", i+1)
+			}
+		}
+		for id := range calls {
+			if !answered[id] {
+				return fmt.Errorf("message %d does not answer tool call %s", i+1, id)
+			}
+		}
+		calls = map[string]bool{}
+		for _, block := range message.Content {
+			if block.OfRequestToolUseBlock != nil {
+				calls[block.OfRequestToolUseBlock.ID] = true
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"agent/pkg/session"
+	"agent/pkg/tools"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// commandHelp describes the slash commands the interactive loop handles itself
+var commandHelp = []string{
+	"/turns                 list the conversation's turns",
+	"/show-tool <t4|t4.2>   show the tool calls of a turn, or one call, in full",
+	"/retry [t4] [model=M] [temperature=T]",
+	"                       discard the last turn, or t4 and everything after it, and send its message",
+	"                       again, optionally to another model or at another temperature",
+	"/edit [message]        replace your last message and send it again; without a message, show the",
+	"                       last one and read its replacement",
+	"/mark [t4|t4.2]        mark the last turn, or a turn or tool call, as important, so compaction",
+	"                       keeps it word for word",
+	"/unmark <t4|t4.2>      remove a mark",
+	"/compact               replace the conversation with a summary of it, keeping marked items",
+	"/redact <regexp>       replace text matching the pattern with [redacted] throughout the conversation,",
+	"                       and again whenever the session is exported",
+	"/show <path>[@t4]      list the versions of a file the tools read or wrote, or print the file as",
+	"                       they last saw it by turn t4",
+	"/scope                 show the monorepo sub-projects listings and searches default to",
+	"/expand <dir>          add a directory to the scope; /expand . covers the whole tree",
+	"/label [key:value...]  attribute the tokens of the following messages to these labels as well as",
+	"                       the session's; /label off clears them, and /label alone lists them",
+	"/context               show how full the context window is, and how much of it each tool's",
+	"                       results, the messages and the system prompt take up",
+	"/handoff               save the session and stop, to continue it on another machine with -resume",
+	"/help                  show these commands",
+}
+
+// turnOverride changes the request parameters for a single retried turn
+type turnOverride struct {
+	model       anthropic.Model
+	temperature *float64
+}
+
+// runCommand handles line if it is a slash command, reporting false when it is not so
+// it goes to the model as usual. It returns the conversation to continue with and the
+// message to send next, which is empty when the command needs no reply.
+func (a *Agent) runCommand(ctx context.Context, conversation []anthropic.MessageParam, line string) ([]anthropic.MessageParam, string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return conversation, "", false
+	}
+	switch fields[0] {
+	case "/help":
+		log.Println(strings.Join(commandHelp, "\n"))
+	case "/handoff":
+		if err := a.handoff(ctx, conversation); err != nil {
+			log.Printf("Error: %s\n", err.Error())
+		}
+	case "/context":
+		a.showContext(conversation)
+	case "/turns":
+		for _, turn := range turns(conversation) {
+			message, _, _ := strings.Cut(turn.message, "\n")
+			if len(message) > 72 {
+				message = message[:72] + "..."
+			}
+			marker := ""
+			if a.isMarked(turn.ref) {
+				marker = " \u001b[93m*\u001b[0m"
+			}
+			log.Printf("\u001b[90m[%s]\u001b[0m%s %s\n", turn.ref, marker, message)
+		}
+	case "/mark":
+		if len(fields) > 2 {
+			log.Println("Usage: /mark [turn or tool call ID]")
+			break
+		}
+		ref, err := a.mark(conversation, strings.Join(fields[1:], ""))
+		if err != nil {
+			log.Printf("Error: %s\n", err.Error())
+			break
+		}
+		a.saveSession(ctx, conversation)
+		log.Printf("Marked %s as important\n", ref)
+	case "/unmark":
+		if len(fields) != 2 {
+			log.Println("Usage: /unmark <turn or tool call ID>")
+			break
+		}
+		if err := a.unmark(fields[1]); err != nil {
+			log.Printf("Error: %s\n", err.Error())
+			break
+		}
+		a.saveSession(ctx, conversation)
+		log.Printf("Unmarked %s\n", fields[1])
+	case "/compact":
+		compacted, err := a.compact(ctx, conversation)
+		if err != nil {
+			log.Printf("Error: %s\n", err.Error())
+			break
+		}
+		log.Printf("Compacted %d messages into a summary\n", len(conversation))
+		a.saveSession(ctx, compacted)
+		return compacted, "", true
+	case "/redact":
+		pattern := strings.TrimSpace(strings.TrimPrefix(line, "/redact"))
+		if pattern == "" {
+			log.Println("Usage: /redact <regular expression>")
+			break
+		}
+		redacted, n, err := a.redact(conversation, pattern)
+		if err != nil {
+			log.Printf("Error: %s\n", err.Error())
+			break
+		}
+		a.saveSession(ctx, redacted)
+		log.Printf("Redacted %d matches\n", n)
+		return redacted, "", true
+	case "/scope":
+		if roots := tools.Scope(); roots != nil {
+			log.Printf("Listings and searches without a path cover: %s\n", strings.Join(roots, ", "))
+		} else {
+			log.Println("Listings and searches cover the whole working tree")
+		}
+	case "/expand":
+		if len(fields) != 2 {
+			log.Println("Usage: /expand <directory>")
+			break
+		}
+		if err := tools.ExpandScope(fields[1]); err != nil {
+			log.Printf("Error: %s\n", err.Error())
+			break
+		}
+		if roots := tools.Scope(); roots != nil {
+			log.Printf("Scope: %s\n", strings.Join(roots, ", "))
+		} else {
+			log.Println("Scope: the whole working tree")
+		}
+	case "/label":
+		switch {
+		case len(fields) == 1:
+			a.showLabels()
+		case len(fields) == 2 && fields[1] == "off":
+			a.setTaskLabels(nil)
+			log.Println("Task labels cleared")
+		default:
+			if err := a.setTaskLabels(fields[1:]); err != nil {
+				log.Printf("Error: %s\n", err.Error())
+				break
+			}
+			log.Printf("Attributing the following messages to %s\n", strings.Join(a.spendLabels(), " "))
+		}
+	case "/show":
+		if len(fields) != 2 {
+			log.Println("Usage: /show <path>[@turn ID]")
+			break
+		}
+		if a.historyDir == "" {
+			log.Println("Error: file history is disabled")
+			break
+		}
+		if err := a.showFile(fields[1]); err != nil {
+			log.Printf("Error: %s\n", err.Error())
+		}
+	case "/show-tool":
+		if len(fields) != 2 {
+			log.Println("Usage: /show-tool <turn or tool call ID>")
+			break
+		}
+		if err := showTools(conversation, fields[1]); err != nil {
+			log.Printf("Error: %s\n", err.Error())
+		}
+	case "/retry":
+		turn, override, err := parseRetry(conversation, fields[1:])
+		if err != nil {
+			log.Printf("Error: %s\n", err.Error())
+			break
+		}
+		a.override = override
+		a.dropMarks(turn.ref)
+		log.Printf("Retrying %s, discarding %d messages\n", turn.ref, len(conversation)-turn.start)
+		return conversation[:turn.start], turn.message, true
+	case "/edit":
+		list := turns(conversation)
+		if len(list) == 0 {
+			log.Println("Error: there is no message to edit yet")
+			break
+		}
+		turn := list[len(list)-1]
+		message := strings.TrimSpace(strings.TrimPrefix(line, "/edit"))
+		if message == "" {
+			log.Printf("Your last message (%s):\n%s\n", turn.ref, turn.message)
+			fmt.Print("\u001b[94mNew message\u001b[0m (empty to cancel): ")
+			replacement, err := a.getUserMessage(ctx)
+			if err != nil || strings.TrimSpace(replacement) == "" {
+				log.Println("Edit cancelled")
+				break
+			}
+			message = replacement
+		}
+		a.dropMarks(turn.ref)
+		log.Printf("Replacing %s, discarding %d messages\n", turn.ref, len(conversation)-turn.start)
+		return conversation[:turn.start], message, true
+	default:
+		return conversation, "", false
+	}
+	return conversation, "", true
+}
+
+// parseRetry reads /retry's arguments: an optional turn ID, the last turn by default,
+// and model= or temperature= settings for the retried turn
+func parseRetry(conversation []anthropic.MessageParam, args []string) (turnSpan, *turnOverride, error) {
+	list := turns(conversation)
+	if len(list) == 0 {
+		return turnSpan{}, nil, fmt.Errorf("there is no turn to retry yet")
+	}
+	turn := list[len(list)-1]
+	var override *turnOverride
+	for _, arg := range args {
+		key, value, isSetting := strings.Cut(arg, "=")
+		if !isSetting {
+			var call int
+			var err error
+			turn, call, err = findTurn(conversation, arg)
+			if err != nil {
+				return turnSpan{}, nil, err
+			}
+			if call > 0 {
+				return turnSpan{}, nil, fmt.Errorf("/retry takes a turn ID such as %s, not a tool call", turn.ref)
+			}
+			continue
+		}
+		if override == nil {
+			override = &turnOverride{}
+		}
+		switch key {
+		case "model":
+			override.model = anthropic.Model(value)
+		case "temperature":
+			t, err := strconv.ParseFloat(value, 64)
+			if err != nil || t < 0 || t > 1 {
+				return turnSpan{}, nil, fmt.Errorf("temperature must be a number between 0 and 1, not '%s'", value)
+			}
+			override.temperature = &t
+		default:
+			return turnSpan{}, nil, fmt.Errorf("unknown /retry setting '%s'; use model= or temperature=", key)
+		}
+	}
+	return turn, override, nil
+}
+
+// showTools prints the input and full result of the tool calls ref names
+func showTools(conversation []anthropic.MessageParam, ref string) error {
+	turn, call, err := findTurn(conversation, ref)
+	if err != nil {
+		return err
+	}
+	messages := session.FromParams(conversation[turn.start:turn.end])
+	results := map[string]session.Block{}
+	for _, message := range messages {
+		for _, block := range message.Content {
+			if block.Type == "tool_result" {
+				results[block.ToolUseID] = block
+			}
+		}
+	}
+	n, shown := 0, 0
+	for _, message := range messages {
+		for _, block := range message.Content {
+			if block.Type != "tool_use" {
+				continue
+			}
+			n++
+			if call != 0 && n != call {
+				continue
+			}
+			shown++
+			log.Printf("\u001b[90m[%s.%d]\u001b[0m \u001b[92mtool\u001b[0m: %s(%s)\n", turn.ref, n, block.Name, block.Input)
+			switch result, ok := results[block.ID]; {
+			case !ok:
+				log.Println("(no result)")
+			case result.IsError:
+				log.Printf("Error: %s\n", result.Text)
+			default:
+				log.Println(result.Text)
+			}
+		}
+	}
+	if shown == 0 && call != 0 {
+		return fmt.Errorf("turn %s has %d tool calls", turn.ref, n)
+	}
+	if shown == 0 {
+		log.Printf("Turn %s made no tool calls\n", turn.ref)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"agent/pkg/session"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// charsPerToken is the rough size of a token in English text and code, used where the
+// API has not counted
+const charsPerToken = 4
+
+// contextShare is how many tokens one part of the context takes up
+type contextShare struct {
+	name   string
+	tokens int64
+}
+
+// contextShares splits the next request's context into the system prompt, the tool
+// definitions, the messages and replies, and the results of each tool. The parts are
+// sized by their length, then scaled so they add up to the size the API reported for
+// the latest request when there has been one, as scaled reports.
+func (a *Agent) contextShares(conversation []anthropic.MessageParam) (shares []contextShare, scaled bool) {
+	params := a.requestParams(conversation)
+	sizes := map[string]int{}
+	for _, block := range params.System {
+		sizes["system prompt"] += len(block.Text)
+	}
+	if definitions, err := json.Marshal(params.Tools); err == nil && len(params.Tools) > 0 {
+		sizes["tool definitions"] = len(definitions)
+	}
+	names := map[string]string{}
+	for _, message := range session.FromParams(conversation) {
+		for _, block := range message.Content {
+			switch {
+			case block.Type == "tool_use":
+				names[block.ID] = block.Name
+				sizes["tool calls"] += len(block.Name) + len(block.Input)
+			case block.Type == "tool_result":
+				sizes[names[block.ToolUseID]+" results"] += len(block.Text)
+			case message.Role == "assistant":
+				sizes["replies"] += len(block.Text)
+			default:
+				sizes["your messages"] += len(block.Text)
+			}
+		}
+	}
+
+	var estimate int64
+	for name, size := range sizes {
+		if size > 0 {
+			shares = append(shares, contextShare{name: name, tokens: int64(size/charsPerToken) + 1})
+			estimate += int64(size/charsPerToken) + 1
+		}
+	}
+	a.mu.Lock()
+	measured := a.contextTokens
+	a.mu.Unlock()
+	scaled = measured > 0 && estimate > 0
+	if scaled {
+		for i := range shares {
+			shares[i].tokens = shares[i].tokens * measured / estimate
+		}
+	}
+	slices.SortFunc(shares, func(x, y contextShare) int { return int(y.tokens - x.tokens) })
+	return shares, scaled
+}
+
+// showContext prints how full the context window is and what fills it, largest first
+func (a *Agent) showContext(conversation []anthropic.MessageParam) {
+	shares, scaled := a.contextShares(conversation)
+	var total int64
+	for _, share := range shares {
+		total += share.tokens
+	}
+	status := a.Status()
+	if status.ContextWindow > 0 {
+		log.Printf("Context: ~%d of %d tokens (%d%%)\n", total, status.ContextWindow, total*100/status.ContextWindow)
+	} else {
+		log.Printf("Context: ~%d tokens\n", total)
+	}
+	for _, share := range shares {
+		percent := 0
+		if total > 0 {
+			percent = int(share.tokens * 100 / total)
+		}
+		fmt.Printf("  %-28s %8d  %3d%%  \u001b[90m%s\u001b[0m\n", share.name, share.tokens, percent, strings.Repeat("█", percent/5))
+	}
+	note := "Shares are estimated from each part's length"
+	if scaled {
+		note += ", scaled to the size of the last request"
+	}
+	fmt.Println("\u001b[90m" + note + ".\u001b[0m")
+}
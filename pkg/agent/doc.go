@@ -0,0 +1,23 @@
+// Package agent is the stable, embeddable API of this module: the Agent itself, its
+// options, the events it emits and the types its callers need, re-exported here so
+// most programs import only this package.
+//
+// The exported identifiers of pkg/agent, pkg/tools and pkg/session follow semantic
+// versioning: within a major version they are only added to, never changed or
+// removed. Code under internal/ backs the command-line tool and may change at any
+// time.
+package agent
+
+import (
+	"agent/pkg/session"
+	"agent/pkg/tools"
+)
+
+// ToolDefinition is a tool the model can call
+type ToolDefinition = tools.ToolDefinition
+
+// Session is a persisted conversation
+type Session = session.Session
+
+// SessionStore persists sessions so they can be resumed
+type SessionStore = session.Store
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// EventType identifies what happened during a turn
+type EventType string
+
+const (
+	// EventText is text written by the model
+	EventText EventType = "text"
+	// EventToolUse is a tool call requested by the model
+	EventToolUse EventType = "tool_use"
+	// EventToolResult is the outcome of a tool call
+	EventToolResult EventType = "tool_result"
+	// EventNotice is something the model flagged for the user with notify_user, which
+	// should stand out from ordinary output
+	EventNotice EventType = "notice"
+	// EventArtifact is a file saved to the artifacts directory; Text is its path
+	EventArtifact EventType = "artifact"
+)
+
+// Event is emitted to the EventHandler as a turn progresses
+type Event struct {
+	Type EventType `json:"type"`
+	// Text is the model's text, or the tool's output or error message
+	Text     string          `json:"text,omitempty"`
+	ToolID   string          `json:"tool_id,omitempty"`
+	ToolName string          `json:"tool_name,omitempty"`
+	Input    json.RawMessage `json:"input,omitempty"`
+	IsError  bool            `json:"is_error,omitempty"`
+	// Severity is set on notices: SeverityInfo or SeverityWarning
+	Severity string `json:"severity,omitempty"`
+	// Ref is the ID of the turn the event belongs to, such as t42, or of the tool call
+	// for tool events, such as t42.3. Commands like /show-tool accept it.
+	Ref  string    `json:"ref,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// Label is the bracketed tag shown before the event in the transcript, such as
+// [t42.3], with the time added when timestamps is set for handlers whose output is not
+// already timestamped. It is empty for events outside a turn when there is no time to show.
+func (e Event) Label(timestamps bool) string {
+	tag := e.Ref
+	if timestamps && !e.Time.IsZero() {
+		tag = strings.TrimSpace(tag + " " + e.Time.Format(time.TimeOnly))
+	}
+	if tag == "" {
+		return ""
+	}
+	return fmt.Sprintf("\u001b[90m[%s]\u001b[0m ", tag)
+}
+
+// EventHandler receives the agent's events. It is called synchronously from the turn,
+// so it should return quickly.
+type EventHandler func(Event)
+
+// LogEvents is the default EventHandler, which writes events to the standard logger.
+// The logger already stamps each line with the time, so the label leaves it out.
+func LogEvents(e Event) {
+	label := e.Label(false)
+	switch {
+	case e.Type == EventText:
+		log.Printf("%s\u001b[93mClaude\u001b[0m: %s\n", label, e.Text)
+	case e.Type == EventToolUse:
+		log.Printf("%s\u001b[92mtool\u001b[0m: requesting %s(%s)\n", label, e.ToolName, e.Input)
+	case e.Type == EventToolResult && e.IsError:
+		log.Printf("%sError executing tool '%s': %s", label, e.ToolName, e.Text)
+	case e.Type == EventToolResult:
+		log.Printf("%s\u001b[92mtool\u001b[0m: result %s -> %s\n", label, e.ToolName, e.Text)
+	case e.Type == EventArtifact:
+		log.Printf("%s\u001b[92martifact\u001b[0m: saved %s\n", label, e.Text)
+	case e.Type == EventNotice && e.Severity == SeverityWarning:
+		log.Printf("%s\u001b[1;97;41m WARNING \u001b[0m \u001b[1m%s\u001b[0m\n", label, e.Text)
+	case e.Type == EventNotice:
+		log.Printf("%s\u001b[1;97;44m NOTE \u001b[0m \u001b[1m%s\u001b[0m\n", label, e.Text)
+	}
+}
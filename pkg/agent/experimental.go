@@ -0,0 +1,281 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"agent/pkg/tools"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Experiments are behaviours still being tried out. Each is off unless enabled by
+// name, so they can ship in every build and be turned on per user or per project.
+type Experiments struct {
+	// ParallelTools runs the read-only tool calls at the start of a response
+	// concurrently instead of one after another
+	ParallelTools bool `json:"parallel_tools"`
+	// SpeculativePrefetch reads the files a message names while the model is still
+	// answering, so the read_file calls it then makes return at once
+	SpeculativePrefetch bool `json:"speculative_prefetch"`
+	// RouterModel has RouterModel judge each message first, and answers the ones it
+	// finds simple with RouterModel instead of DefaultModel
+	RouterModel bool `json:"router_model"`
+	// AnonymizeCode replaces the identifiers and string literals in code sent to the
+	// model with pseudonyms, and maps them back in its replies
+	AnonymizeCode bool `json:"anonymize_code"`
+}
+
+// RouterModel is the small model the router_model experiment consults, and answers
+// simple messages with
+const RouterModel = anthropic.ModelClaude3_5HaikuLatest
+
+// maxPrefetchFiles and maxPrefetchSize bound how much one message can prefetch
+const (
+	maxPrefetchFiles = 8
+	maxPrefetchSize  = 256 << 10
+)
+
+// switches returns each experiment's name and the field that enables it
+func (e *Experiments) switches() map[string]*bool {
+	return map[string]*bool{
+		"parallel_tools":       &e.ParallelTools,
+		"speculative_prefetch": &e.SpeculativePrefetch,
+		"router_model":         &e.RouterModel,
+		"anonymize_code":       &e.AnonymizeCode,
+	}
+}
+
+// ExperimentNames lists the experiments that can be enabled, sorted
+func ExperimentNames() []string {
+	var e Experiments
+	var names []string
+	for name := range e.switches() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ParseExperiments turns the experiments named in enabled on or off, and fails on a
+// name that is not an experiment, so a typo does not silently leave one off
+func ParseExperiments(enabled map[string]bool) (Experiments, error) {
+	var e Experiments
+	switches := e.switches()
+	for name, on := range enabled {
+		field, ok := switches[name]
+		if !ok {
+			return Experiments{}, fmt.Errorf("unknown experiment '%s'; the experiments are %s", name, strings.Join(ExperimentNames(), ", "))
+		}
+		*field = on
+	}
+	return e, nil
+}
+
+// Enabled returns the names of the experiments that are on, sorted
+func (e Experiments) Enabled() []string {
+	var names []string
+	for name, on := range e.switches() {
+		if *on {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// noticeExperiments tells the user which experiments this session runs with
+func (a *Agent) noticeExperiments() {
+	if enabled := a.experiments.Enabled(); len(enabled) > 0 {
+		a.onEvent(Event{Type: EventNotice, Severity: SeverityInfo, Text: "Experimental: " + strings.Join(enabled, ", ") + "."})
+	}
+}
+
+// toolOutcome is the output or error message of a finished tool call
+type toolOutcome struct {
+	text    string
+	isError bool
+}
+
+// startParallelTools starts the read-only calls that open the response together,
+// returning where each call's outcome will arrive. Calls after the first one that
+// could change files, or ask the user, are left to run in order, so a read never
+// overtakes an edit the model made before it.
+func (a *Agent) startParallelTools(content []anthropic.ContentBlockUnion, rejected map[string]bool) map[string]<-chan toolOutcome {
+	if !a.experiments.ParallelTools {
+		return nil
+	}
+	var batch []anthropic.ContentBlockUnion
+	for _, block := range content {
+		if block.Type != "tool_use" {
+			continue
+		}
+		if rejected[block.ID] || !a.parallelSafe(block.Name) {
+			break
+		}
+		batch = append(batch, block)
+	}
+	if len(batch) < 2 {
+		return nil
+	}
+	pending := map[string]<-chan toolOutcome{}
+	for _, block := range batch {
+		outcome := make(chan toolOutcome, 1)
+		pending[block.ID] = outcome
+		go func() {
+			text, isError := a.callTool(block.Name, block.Input)
+			outcome <- toolOutcome{text: text, isError: isError}
+		}()
+	}
+	return pending
+}
+
+// parallelSafe reports whether the tool called name can run alongside others: one of
+// the caller's tools that neither changes the working tree nor waits on the user
+func (a *Agent) parallelSafe(name string) bool {
+	if name == tools.AskUserDefinition.Name {
+		return false
+	}
+	for _, tool := range a.phaseTools() {
+		if tool.Name == name {
+			return !tool.Mutating
+		}
+	}
+	return false
+}
+
+// prefetchCache holds read_file results fetched ahead of the model asking for them,
+// keyed by tool input. Any call to a tool that changes files empties it.
+type prefetchCache struct {
+	mu      sync.Mutex
+	results map[string]string
+}
+
+// prefetchKey identifies a tool call by its name and input, ignoring formatting
+func prefetchKey(name string, input json.RawMessage) string {
+	var value any
+	if err := json.Unmarshal(input, &value); err != nil {
+		return name + string(input)
+	}
+	canonical, _ := json.Marshal(value)
+	return name + string(canonical)
+}
+
+// prefetch starts reading the files named in the message that opens the turn, in the
+// background, replacing whatever the previous turn prefetched
+func (a *Agent) prefetch(conversation []anthropic.MessageParam) {
+	if !a.experiments.SpeculativePrefetch {
+		return
+	}
+	a.prefetched.mu.Lock()
+	a.prefetched.results = map[string]string{}
+	a.prefetched.mu.Unlock()
+	readFile, ok := a.findTool(tools.ReadFileDefinition.Name)
+	starts := turnStarts(conversation)
+	if !ok || len(starts) == 0 {
+		return
+	}
+	var text strings.Builder
+	for _, block := range conversation[starts[len(starts)-1]].Content {
+		if block.OfRequestTextBlock != nil {
+			text.WriteString(block.OfRequestTextBlock.Text + "\n")
+		}
+	}
+	for _, path := range mentionedFiles(text.String()) {
+		input, _ := json.Marshal(tools.ReadFileInput{Path: path})
+		go func() {
+			output, err := readFile.Call(context.Background(), input)
+			if err != nil {
+				return
+			}
+			a.prefetched.mu.Lock()
+			defer a.prefetched.mu.Unlock()
+			// A nil map means a tool has changed files since the read started
+			if a.prefetched.results != nil {
+				a.prefetched.results[prefetchKey(readFile.Name, input)] = output
+			}
+		}()
+	}
+}
+
+// mentionedFiles returns the words of text that name small files in the working
+// directory, such as `pkg/agent/agent.go` or "README.md"
+func mentionedFiles(text string) []string {
+	var files []string
+	for _, word := range strings.Fields(text) {
+		word = strings.TrimRight(strings.Trim(word, "`'\"()[]<>,;:"), ".?!")
+		if !strings.ContainsAny(word, "./") || slices.Contains(files, word) {
+			continue
+		}
+		if info, err := os.Stat(word); err == nil && info.Mode().IsRegular() && info.Size() <= maxPrefetchSize {
+			files = append(files, word)
+		}
+		if len(files) == maxPrefetchFiles {
+			break
+		}
+	}
+	return files
+}
+
+// takePrefetched returns the prefetched output of the call, if there is one
+func (a *Agent) takePrefetched(name string, input json.RawMessage) (string, bool) {
+	a.prefetched.mu.Lock()
+	defer a.prefetched.mu.Unlock()
+	output, ok := a.prefetched.results[prefetchKey(name, input)]
+	return output, ok
+}
+
+// dropPrefetched discards everything prefetched, before a tool that may change files
+func (a *Agent) dropPrefetched() {
+	a.prefetched.mu.Lock()
+	defer a.prefetched.mu.Unlock()
+	a.prefetched.results = nil
+}
+
+// routerPrompt asks the router model to sort a message by how capable a model it needs
+const routerPrompt = "You route a coding assistant's requests. Reply with one word: SIMPLE if the request below " +
+	"can be handled well by a small, fast model (greetings, short factual questions, explaining a snippet, " +
+	"a small self-contained edit), or COMPLEX if it needs a stronger model (debugging, design, changes " +
+	"across files, anything ambiguous).\n\nRequest:\n"
+
+// routeTurn asks RouterModel whether the message that opens the turn is simple, and if
+// so answers the whole turn with RouterModel. A failed routing request leaves the turn
+// on the default model.
+func (a *Agent) routeTurn(ctx context.Context, conversation []anthropic.MessageParam) {
+	if !a.experiments.RouterModel || a.override != nil {
+		return
+	}
+	list := turns(conversation)
+	if len(list) == 0 || strings.TrimSpace(list[len(list)-1].message) == "" {
+		return
+	}
+	request := list[len(list)-1].message
+	if z := a.anonymizing(); z != nil {
+		request = z.known(request)
+	}
+	message, err := a.client.Messages.New(ctx, anthropic.MessageNewParams{
+		Model:     RouterModel,
+		MaxTokens: 5,
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(routerPrompt + request))},
+	})
+	requestsTotal.Inc(string(RouterModel), statusLabel(err))
+	if err != nil {
+		return
+	}
+	recordUsage(string(RouterModel), message.Usage)
+	a.mu.Lock()
+	a.countUsage(string(RouterModel), message.Usage)
+	a.mu.Unlock()
+	for _, block := range message.Content {
+		if block.Type == "text" && strings.HasPrefix(strings.ToUpper(strings.TrimSpace(block.Text)), "SIMPLE") {
+			a.override = &turnOverride{model: RouterModel}
+			a.onEvent(Event{Type: EventNotice, Severity: SeverityInfo, Text: "Routed to " + string(RouterModel) + " as a simple request."})
+			return
+		}
+	}
+}
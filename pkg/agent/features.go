@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// probeImage is a transparent 1x1 PNG, the smallest image a vision probe can send
+const probeImage = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII="
+
+// Features are the optional API features a model or provider may lack, as
+// compatibility endpoints for other providers often do
+type Features struct {
+	Tools  bool `json:"tools"`
+	Vision bool `json:"vision"`
+}
+
+// AllFeatures is what DefaultModel supports on the Anthropic API
+var AllFeatures = Features{Tools: true, Vision: true}
+
+// ProbeFeatures sends the smallest possible request using each feature to find out
+// which ones the model supports. A feature is only reported missing when the API
+// rejects its request as invalid; failures that say nothing about the model, such as
+// timeouts, rate limits or bad credentials, leave it assumed supported so the real
+// error surfaces on the first turn instead.
+func ProbeFeatures(ctx context.Context, client *anthropic.Client, model anthropic.Model) Features {
+	base := func(content ...anthropic.ContentBlockParamUnion) anthropic.MessageNewParams {
+		return anthropic.MessageNewParams{
+			Model:     model,
+			MaxTokens: 1,
+			Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(content...)},
+		}
+	}
+	features := AllFeatures
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		params := base(anthropic.NewTextBlock("ping"))
+		params.Tools = []anthropic.ToolUnionParam{{OfTool: &anthropic.ToolParam{
+			Name:        "ping",
+			Description: anthropic.String("Replies pong."),
+			InputSchema: anthropic.ToolInputSchemaParam{Properties: map[string]any{}},
+		}}}
+		_, err := client.Messages.New(ctx, params)
+		features.Tools = !rejected(err)
+	}()
+	go func() {
+		defer wg.Done()
+		_, err := client.Messages.New(ctx, base(anthropic.NewImageBlockBase64("image/png", probeImage), anthropic.NewTextBlock("ping")))
+		features.Vision = !rejected(err)
+	}()
+	wg.Wait()
+	return features
+}
+
+// rejected reports whether err is the API refusing a request it does not support
+func rejected(err error) bool {
+	var apiErr *anthropic.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// noticeFeatures tells the user which features are disabled because the model lacks them
+func (a *Agent) noticeFeatures() {
+	if !a.features.Tools {
+		a.onEvent(Event{Type: EventNotice, Severity: SeverityWarning,
+			Text: "The model does not support tool use, so tools are disabled and it can only reply with text."})
+	}
+	if !a.features.Vision {
+		a.onEvent(Event{Type: EventNotice, Severity: SeverityInfo, Text: "The model does not accept images, so image input is disabled."})
+	}
+}
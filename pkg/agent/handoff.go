@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"agent/pkg/session"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// handoff saves the session for another machine to resume, and ends this run so the
+// two do not both write it
+func (a *Agent) handoff(ctx context.Context, conversation []anthropic.MessageParam) error {
+	if a.store == nil || a.session == nil {
+		return errors.New("this session is not being saved; start the agent with a -session-store both machines can reach")
+	}
+	host, _ := os.Hostname()
+	a.session.HandedOff = &session.Handoff{Host: host, At: time.Now().UTC()}
+	a.saveSession(ctx, conversation)
+	a.mu.Lock()
+	if !a.draining {
+		a.draining = true
+		close(a.drained)
+	}
+	a.mu.Unlock()
+	log.Printf("Handed off session %s. Continue it on the other machine with: agent -resume %s\n", a.session.ID, a.session.ID)
+	return nil
+}
+
+// noticeHandoff tells the user where a resumed session left off: handed over from
+// another machine, or with changes still waiting for review
+func (a *Agent) noticeHandoff() {
+	if a.session == nil {
+		return
+	}
+	if h := a.session.HandedOff; h != nil {
+		a.onEvent(Event{Type: EventNotice, Severity: SeverityInfo,
+			Text: fmt.Sprintf("Continuing the session handed off from %s at %s.", h.Host, h.At.Local().Format("15:04 on Jan 2"))})
+		a.session.HandedOff = nil
+	}
+	if len(a.session.Pending) > 0 {
+		a.onEvent(Event{Type: EventNotice, Severity: SeverityInfo, Text: "The last response's changes were waiting for review; they are shown again."})
+	}
+}
+
+// awaitsReview reports whether the response has changes the hunk reviewer will be asked about
+func (a *Agent) awaitsReview(content []anthropic.ContentBlockUnion) bool {
+	if a.hunkReviewer == nil {
+		return false
+	}
+	for _, block := range content {
+		if tool, ok := a.findTool(block.Name); ok && block.Type == "tool_use" && tool.Preview != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// savePending saves the conversation with message, whose changes are about to be put
+// to review, as pending, so the review survives the session being resumed elsewhere
+// before it is answered
+func (a *Agent) savePending(ctx context.Context, conversation []anthropic.MessageParam, message *anthropic.Message) {
+	if a.store == nil || a.session == nil {
+		return
+	}
+	a.session.Pending = json.RawMessage(message.RawJSON())
+	a.saveSession(ctx, conversation)
+}
+
+// reviewed clears the pending response once its review is answered; the next save
+// stores the outcome instead
+func (a *Agent) reviewed() {
+	if a.session != nil {
+		a.session.Pending = nil
+	}
+}
+
+// takePending returns the response a resumed session was reviewing, once
+func (a *Agent) takePending() *anthropic.Message {
+	if a.session == nil || len(a.session.Pending) == 0 {
+		return nil
+	}
+	var message anthropic.Message
+	err := json.Unmarshal(a.session.Pending, &message)
+	a.session.Pending = nil
+	if err != nil {
+		log.Printf("Error: the response pending review could not be restored: %s\n", err.Error())
+		return nil
+	}
+	return &message
+}
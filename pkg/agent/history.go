@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent/pkg/session"
+	"agent/pkg/tools"
+)
+
+// observeFiles records every version of a file the tools see, with WithFileHistory
+func (a *Agent) observeFiles() {
+	if a.historyDir != "" {
+		tools.SetFileObserver(a.recordFile)
+	}
+}
+
+// fileVersions returns the versions of files the tools have seen, stored in the
+// session when there is one so the history can be inspected after resuming
+func (a *Agent) fileVersions() []session.FileVersion {
+	if a.session != nil {
+		return a.session.Files
+	}
+	return a.files
+}
+
+// recordFile stores content under its hash in the history directory and notes the
+// version against the turn in progress. Identical contents are stored once.
+func (a *Agent) recordFile(path, content string, wrote bool) {
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	blob := a.blobPath(hash)
+	if _, err := os.Stat(blob); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+			log.Printf("Error saving file history: %s\n", err.Error())
+			return
+		}
+		if err := os.WriteFile(blob, []byte(content), 0644); err != nil {
+			log.Printf("Error saving file history: %s\n", err.Error())
+			return
+		}
+	}
+	version := session.FileVersion{
+		Path:  filepath.Clean(path),
+		Ref:   turnRef(a.turn),
+		Hash:  hash,
+		Wrote: wrote,
+		Lines: strings.Count(content, "\n"),
+		Time:  time.Now().UTC(),
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.session != nil {
+		a.session.Files = append(a.session.Files, version)
+	} else {
+		a.files = append(a.files, version)
+	}
+}
+
+// blobPath is where the content with hash is stored, fanned out by its first byte
+func (a *Agent) blobPath(hash string) string {
+	return filepath.Join(a.historyDir, hash[:2], hash)
+}
+
+// showFile handles /show: given path@t12 it prints the file as the tools last saw it
+// in turn 12 or before, and given just a path it lists the versions seen
+func (a *Agent) showFile(arg string) error {
+	path, ref, at := strings.Cut(arg, "@")
+	path = filepath.Clean(path)
+	a.mu.Lock()
+	var versions []session.FileVersion
+	for _, version := range a.fileVersions() {
+		if version.Path == path {
+			versions = append(versions, version)
+		}
+	}
+	a.mu.Unlock()
+	if len(versions) == 0 {
+		return fmt.Errorf("no tool has read or written %s in this session", path)
+	}
+
+	if !at {
+		for _, version := range versions {
+			action := "read"
+			if version.Wrote {
+				action = "wrote"
+			}
+			log.Printf("\u001b[90m[%s]\u001b[0m %-5s %s  %d lines  %s\n", version.Ref, action, version.Hash[:12],
+				version.Lines, version.Time.Local().Format(time.TimeOnly))
+		}
+		log.Printf("Show one with /show %s@%s\n", path, versions[len(versions)-1].Ref)
+		return nil
+	}
+
+	turn, call, err := parseRef(ref)
+	if err != nil {
+		return err
+	}
+	if call > 0 {
+		return fmt.Errorf("/show takes a turn ID such as %s, not a tool call", turnRef(turn))
+	}
+	var seen *session.FileVersion
+	for i, version := range versions {
+		if n, _, _ := parseRef(version.Ref); n <= turn {
+			seen = &versions[i]
+		}
+	}
+	if seen == nil {
+		return fmt.Errorf("%s was first seen in %s", path, versions[0].Ref)
+	}
+	content, err := os.ReadFile(a.blobPath(seen.Hash))
+	if err != nil {
+		return fmt.Errorf("failed to read the stored version of %s: %w", path, err)
+	}
+	action := "read"
+	if seen.Wrote {
+		action = "written"
+	}
+	log.Printf("%s as of %s, %s in %s (sha256 %s):\n", path, ref, action, seen.Ref, seen.Hash[:12])
+	fmt.Print(string(content))
+	if !strings.HasSuffix(string(content), "\n") {
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package agent
+
+import "github.com/anthropics/anthropic-sdk-go"
+
+// rejectedHunkMessage is the tool result for a change the user declined, so the model
+// does not assume the file was modified
+const rejectedHunkMessage = "The user reviewed this change and rejected it, so the file was not modified. " +
+	"Do not make the same change again; continue without it, or ask the user what they want instead."
+
+// Hunk is one change a model response would make, put to the user before it is written
+type Hunk struct {
+	ToolID string
+	Tool   string
+	Path   string
+	// Diff is the change as a unified diff hunk
+	Diff string
+}
+
+// HunkReviewer decides which of a response's changes are written. It returns one
+// verdict per hunk, true to accept.
+type HunkReviewer func(hunks []Hunk) []bool
+
+// reviewHunks puts the changes the response's tool calls would make to the reviewer
+// and returns the IDs of the calls it rejected. Calls whose change cannot be
+// previewed, such as edits that will fail, run unreviewed and report their own error.
+func (a *Agent) reviewHunks(content []anthropic.ContentBlockUnion) map[string]bool {
+	if a.hunkReviewer == nil {
+		return nil
+	}
+	var hunks []Hunk
+	for _, block := range content {
+		if block.Type != "tool_use" {
+			continue
+		}
+		tool, ok := a.findTool(block.Name)
+		if !ok || tool.Preview == nil {
+			continue
+		}
+		change, err := tool.Preview(block.Input)
+		if err != nil {
+			continue
+		}
+		hunks = append(hunks, Hunk{ToolID: block.ID, Tool: block.Name, Path: change.Path, Diff: change.Diff})
+	}
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	verdicts := a.hunkReviewer(hunks)
+	rejected := map[string]bool{}
+	for i, hunk := range hunks {
+		if i >= len(verdicts) || !verdicts[i] {
+			rejected[hunk.ToolID] = true
+		}
+	}
+	return rejected
+}
@@ -2,28 +2,118 @@ package agent
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"agent/pkg/tools"
 
 	"github.com/anthropics/anthropic-sdk-go"
 )
 
 // runInference sends the conversation to the model and gets a response
 func (a *Agent) runInference(ctx context.Context, conversation []anthropic.MessageParam) (*anthropic.Message, error) {
-	anthropicTools := []anthropic.ToolUnionParam{}
-	for _, tool := range a.tools {
-		anthropicTools = append(anthropicTools, anthropic.ToolUnionParam{
-			OfTool: &anthropic.ToolParam{
-				Name:        tool.Name,
-				Description: anthropic.String(tool.Description),
-				InputSchema: tool.InputSchema,
-			},
-		})
-	}
-
-	message, err := a.client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.ModelClaude3_7SonnetLatest,
-		MaxTokens: int64(1024),
+	params := a.requestParams(conversation)
+	z := a.anonymizing()
+	if z != nil {
+		params.Messages = z.request(params.Messages)
+		for i := range params.System {
+			params.System[i].Text = z.known(params.System[i].Text)
+		}
+	}
+	model := params.Model
+	start := time.Now()
+	message, err := a.client.Messages.New(ctx, params, a.chaos.requestOptions()...)
+	inferenceDuration.Observe(time.Since(start).Seconds(), string(model))
+	requestsTotal.Inc(string(model), statusLabel(err))
+	if err != nil {
+		return message, err
+	}
+	recordUsage(string(model), message.Usage)
+	a.addUsage(string(model), message.Usage)
+	if z != nil {
+		return z.response(message)
+	}
+	return message, nil
+}
+
+// requestParams builds the API request for the conversation in the agent's current state
+func (a *Agent) requestParams(conversation []anthropic.MessageParam) anthropic.MessageNewParams {
+	params := anthropic.MessageNewParams{
+		Model:     DefaultModel,
+		MaxTokens: a.maxTokens,
 		Messages:  conversation,
-		Tools:     anthropicTools,
-	})
-	return message, err
-}
\ No newline at end of file
+	}
+	// A model without tool use may reject a request that defines tools at all
+	if a.features.Tools {
+		params.Tools = []anthropic.ToolUnionParam{}
+		for _, tool := range a.activeTools() {
+			params.Tools = append(params.Tools, anthropic.ToolUnionParam{
+				OfTool: &anthropic.ToolParam{
+					Name:        tool.Name,
+					Description: anthropic.String(tool.Description),
+					InputSchema: tool.Schema(),
+				},
+			})
+		}
+	}
+	if a.temperature != nil {
+		params.Temperature = anthropic.Float(*a.temperature)
+	}
+	if a.override != nil && a.override.model != "" {
+		params.Model = a.override.model
+	}
+	if a.override != nil && a.override.temperature != nil {
+		params.Temperature = anthropic.Float(*a.override.temperature)
+	}
+	if system := a.systemPrompt(); system != "" {
+		params.System = []anthropic.TextBlockParam{{Text: system}}
+	}
+	return params
+}
+
+// systemPrompt combines the configured system prompt, the reply language, the tool
+// examples and the summary of the earlier session, if any, that the current one continues
+func (a *Agent) systemPrompt() string {
+	var parts []string
+	if a.system != "" {
+		parts = append(parts, a.system)
+	}
+	if language := a.languagePrompt(); language != "" {
+		parts = append(parts, language)
+	}
+	if a.citations {
+		parts = append(parts, citationPrompt)
+	}
+	if examples := a.toolExamplesPrompt(); examples != "" {
+		parts = append(parts, examples)
+	}
+	if roots := tools.Scope(); roots != nil {
+		parts = append(parts, fmt.Sprintf("This is a large monorepo. list_files and ripgrep_search without a path only cover "+
+			"the sub-projects in scope: %s. Pass a path to look elsewhere.", strings.Join(roots, ", ")))
+	}
+	if a.session != nil && a.session.Seed != "" {
+		parts = append(parts, fmt.Sprintf("This session continues session %s, summarized below. Pick up where it left off.\n\n%s",
+			a.session.SeededFrom, a.session.Seed))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// citationPrompt asks the model to cite the tool results its claims rest on
+const citationPrompt = "Each tool result starts with its reference in brackets, such as [t3.2] for the second tool call of turn 3. " +
+	"When your answer states something you learned from a tool result, cite it by putting its reference after the claim, " +
+	"as in \"The client retries three times [t3.2].\" Cite only the results you relied on."
+
+// toolExamplesPrompt renders the examples for the agent's tools
+func (a *Agent) toolExamplesPrompt() string {
+	var b strings.Builder
+	for _, tool := range a.tools {
+		for _, example := range a.toolExamples[tool.Name] {
+			fmt.Fprintf(&b, "- %s: %s\n", tool.Name, example)
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "Examples of how to use your tools in this project:\n" + b.String()
+}
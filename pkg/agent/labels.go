@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"agent/pkg/session"
+)
+
+// ParseLabel checks that label has the key:value form cost labels take, such as
+// billing:team-x
+func ParseLabel(label string) (key, value string, err error) {
+	key, value, ok := strings.Cut(label, ":")
+	if !ok || strings.TrimSpace(key) == "" || strings.TrimSpace(value) == "" || strings.ContainsAny(label, " \t") {
+		return "", "", fmt.Errorf("invalid label '%s': expected key:value, such as billing:team-x", label)
+	}
+	return key, value, nil
+}
+
+// mergeLabels returns base with overrides applied, an override replacing the base
+// label with the same key, sorted so equal sets compare equal
+func mergeLabels(base, overrides []string) []string {
+	merged := slices.Clone(overrides)
+	for _, label := range base {
+		key, _, _ := strings.Cut(label, ":")
+		if !slices.ContainsFunc(overrides, func(o string) bool { return strings.HasPrefix(o, key+":") }) {
+			merged = append(merged, label)
+		}
+	}
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
+
+// applyLabels stores the labels given with WithLabels in the session, if any
+func (a *Agent) applyLabels() {
+	if a.session != nil && a.labels != nil {
+		a.session.Labels = a.labels
+	}
+}
+
+// sessionLabels returns the labels the whole session is tagged with
+func (a *Agent) sessionLabels() []string {
+	if a.session != nil {
+		return a.session.Labels
+	}
+	return a.labels
+}
+
+// spendLabels returns the labels the tokens used now are attributed to: the session's
+// labels with those set for the current task by /label
+func (a *Agent) spendLabels() []string {
+	return mergeLabels(a.sessionLabels(), a.taskLabels)
+}
+
+// setTaskLabels validates labels and attributes the following messages to them as
+// well as the session's labels. No labels go back to the session's alone.
+func (a *Agent) setTaskLabels(labels []string) error {
+	for _, label := range labels {
+		if _, _, err := ParseLabel(label); err != nil {
+			return err
+		}
+	}
+	a.recordSpend()
+	a.taskLabels = labels
+	return nil
+}
+
+// recordSpend adds the tokens used since it last ran to the session's spend under the
+// current labels, so each stored session says who its cost belongs to
+func (a *Agent) recordSpend() {
+	if a.session == nil {
+		return
+	}
+	a.mu.Lock()
+	usage := a.usage
+	delta := Usage{
+		Requests:                 usage.Requests - a.recorded.Requests,
+		InputTokens:              usage.InputTokens - a.recorded.InputTokens,
+		OutputTokens:             usage.OutputTokens - a.recorded.OutputTokens,
+		CacheReadInputTokens:     usage.CacheReadInputTokens - a.recorded.CacheReadInputTokens,
+		CacheCreationInputTokens: usage.CacheCreationInputTokens - a.recorded.CacheCreationInputTokens,
+	}
+	a.recorded = usage
+	a.mu.Unlock()
+	if delta.Requests == 0 {
+		return
+	}
+
+	labels, model := a.spendLabels(), string(DefaultModel)
+	i := slices.IndexFunc(a.session.Spend, func(s session.Spend) bool {
+		return s.Model == model && slices.Equal(s.Labels, labels)
+	})
+	if i < 0 {
+		a.session.Spend = append(a.session.Spend, session.Spend{Labels: labels, Model: model})
+		i = len(a.session.Spend) - 1
+	}
+	spend := &a.session.Spend[i]
+	spend.Requests += delta.Requests
+	spend.InputTokens += delta.InputTokens
+	spend.OutputTokens += delta.OutputTokens
+	spend.CacheReadInputTokens += delta.CacheReadInputTokens
+	spend.CacheCreationInputTokens += delta.CacheCreationInputTokens
+}
+
+// showLabels lists the labels the session's cost is attributed to
+func (a *Agent) showLabels() {
+	whole, task := a.sessionLabels(), a.taskLabels
+	if len(whole) == 0 && len(task) == 0 {
+		log.Println("No labels; tokens are not attributed to anything")
+		return
+	}
+	if len(whole) > 0 {
+		log.Printf("Session labels: %s\n", strings.Join(whole, " "))
+	}
+	if len(task) > 0 {
+		log.Printf("Task labels:    %s\n", strings.Join(task, " "))
+	}
+}
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// LanguageAuto makes the agent reply in the language of the user's latest message
+const LanguageAuto = "auto"
+
+// minLanguageWords is how many stopwords a Latin-script message needs before its
+// language is trusted; shorter messages keep the previous language
+const minLanguageWords = 2
+
+// languageScripts identify languages that have a script of their own
+var languageScripts = []struct {
+	language string
+	table    *unicode.RangeTable
+}{
+	{"Japanese", unicode.Hiragana},
+	{"Japanese", unicode.Katakana},
+	{"Korean", unicode.Hangul},
+	{"Chinese", unicode.Han},
+	{"Greek", unicode.Greek},
+	{"Arabic", unicode.Arabic},
+	{"Hebrew", unicode.Hebrew},
+	{"Hindi", unicode.Devanagari},
+	{"Thai", unicode.Thai},
+	{"Russian", unicode.Cyrillic},
+}
+
+// languageStopwords are frequent words that tell Latin-script languages apart
+var languageStopwords = map[string][]string{
+	"English":    {"the", "and", "is", "are", "this", "that", "with", "what", "how", "why", "please", "can", "you", "it", "of", "to", "in", "for", "should", "does"},
+	"Spanish":    {"el", "la", "los", "las", "que", "es", "por", "para", "con", "una", "del", "cómo", "qué", "esto", "puedes", "favor", "está", "pero", "también", "hay"},
+	"French":     {"le", "les", "des", "est", "une", "pour", "avec", "que", "qui", "dans", "pas", "ce", "cette", "comment", "pourquoi", "peux", "vous", "je", "et", "sur"},
+	"German":     {"der", "die", "das", "und", "ist", "nicht", "mit", "ein", "eine", "ich", "wie", "warum", "kannst", "bitte", "auf", "für", "dem", "den", "zu", "es"},
+	"Portuguese": {"o", "os", "uma", "não", "com", "para", "que", "é", "isso", "como", "por", "você", "pode", "está", "do", "da", "dos", "em", "mas", "também"},
+	"Italian":    {"il", "gli", "che", "è", "non", "per", "una", "con", "questo", "come", "perché", "puoi", "della", "sono", "anche", "ma", "di", "del", "lo", "si"},
+	"Dutch":      {"de", "het", "een", "en", "is", "niet", "met", "van", "dat", "ik", "hoe", "waarom", "kun", "je", "graag", "voor", "op", "wat", "ook", "maar"},
+}
+
+// detectLanguage guesses the natural language of text, ignoring code. It returns the
+// empty string when the text is too short or too mixed to tell.
+func detectLanguage(text string) string {
+	text = stripCode(text)
+
+	scripts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range languageScripts {
+			if unicode.Is(s.table, r) {
+				scripts[s.language]++
+				break
+			}
+		}
+	}
+	// Kana marks Japanese even though most of its characters are Han
+	if scripts["Japanese"] > 0 {
+		scripts["Japanese"] += scripts["Chinese"]
+		delete(scripts, "Chinese")
+	}
+	best, count := "", 0
+	for language, n := range scripts {
+		if n > count {
+			best, count = language, n
+		}
+	}
+	if count >= 4 && count*2 >= letters {
+		if best == "Russian" && strings.ContainsAny(text, "іїєґІЇЄҐ") {
+			return "Ukrainian"
+		}
+		return best
+	}
+
+	hits := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for language, stopwords := range languageStopwords {
+			for _, stopword := range stopwords {
+				if word == stopword {
+					hits[language]++
+				}
+			}
+		}
+	}
+	best, count, second := "", 0, 0
+	for language, n := range hits {
+		switch {
+		case n > count:
+			best, count, second = language, n, count
+		case n > second:
+			second = n
+		}
+	}
+	if count < minLanguageWords || count == second {
+		return ""
+	}
+	return best
+}
+
+// stripCode removes fenced and inline code, whose keywords say nothing about the
+// language the user writes in
+func stripCode(text string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(text, "```") {
+		if i%2 == 0 {
+			for j, span := range strings.Split(part, "`") {
+				if j%2 == 0 {
+					b.WriteString(span)
+					b.WriteString(" ")
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// observeLanguage updates the reply language from a user message when detecting it
+func (a *Agent) observeLanguage(text string) {
+	if a.language != LanguageAuto {
+		return
+	}
+	if detected := detectLanguage(text); detected != "" {
+		a.replyLanguage = detected
+	}
+}
+
+// languagePrompt tells the model which language to reply in, if one is known
+func (a *Agent) languagePrompt() string {
+	switch {
+	case a.language == "":
+		return ""
+	case a.language != LanguageAuto:
+		return fmt.Sprintf("Reply in %s unless the user asks for another language. Keep code, identifiers, "+
+			"commands and quoted output as they are.", a.language)
+	case a.replyLanguage != "":
+		return fmt.Sprintf("The user is writing in %s: reply in %s unless they ask for another language. Keep "+
+			"code, identifiers, commands and quoted output as they are.", a.replyLanguage, a.replyLanguage)
+	}
+	return ""
+}
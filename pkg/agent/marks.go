@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"agent/pkg/session"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// markedRefs returns the turns and tool calls tagged with /mark, stored in the session
+// when there is one so the marks are saved and resumed with the conversation
+func (a *Agent) markedRefs() []string {
+	if a.session != nil {
+		return a.session.Marks
+	}
+	return a.marks
+}
+
+func (a *Agent) setMarks(refs []string) {
+	slices.SortFunc(refs, compareRefs)
+	if a.session != nil {
+		a.session.Marks = refs
+		return
+	}
+	a.marks = refs
+}
+
+// compareRefs orders turn and tool call IDs as they happened, a turn before its calls
+func compareRefs(x, y string) int {
+	xTurn, xCall, _ := parseRef(x)
+	yTurn, yCall, _ := parseRef(y)
+	if xTurn != yTurn {
+		return xTurn - yTurn
+	}
+	return xCall - yCall
+}
+
+// mark tags ref, or the latest turn when ref is empty, as important
+func (a *Agent) mark(conversation []anthropic.MessageParam, ref string) (string, error) {
+	list := turns(conversation)
+	if ref == "" {
+		if len(list) == 0 {
+			return "", fmt.Errorf("there is no turn to mark yet")
+		}
+		ref = list[len(list)-1].ref
+	}
+	turn, call, err := findTurn(conversation, ref)
+	if err != nil {
+		return "", err
+	}
+	ref = turn.ref
+	if call > 0 {
+		messages := session.FromParams(conversation[turn.start:turn.end])
+		if toolCall(messages, call) == nil {
+			return "", fmt.Errorf("turn %s has no tool call %d", turn.ref, call)
+		}
+		ref = fmt.Sprintf("%s.%d", turn.ref, call)
+	}
+	if marks := a.markedRefs(); !slices.Contains(marks, ref) {
+		a.setMarks(append(slices.Clone(marks), ref))
+	}
+	return ref, nil
+}
+
+// unmark removes the mark from ref
+func (a *Agent) unmark(ref string) error {
+	marks := a.markedRefs()
+	i := slices.Index(marks, ref)
+	if i < 0 {
+		return fmt.Errorf("%s is not marked", ref)
+	}
+	a.setMarks(slices.Delete(slices.Clone(marks), i, i+1))
+	return nil
+}
+
+// dropMarks forgets the marks on turn ref and the turns after it, which /retry and
+// /edit discard
+func (a *Agent) dropMarks(ref string) {
+	from, _, err := parseRef(ref)
+	if err != nil {
+		return
+	}
+	a.setMarks(slices.DeleteFunc(slices.Clone(a.markedRefs()), func(mark string) bool {
+		turn, _, _ := parseRef(mark)
+		return turn >= from
+	}))
+}
+
+// isMarked reports whether ref, or any tool call within turn ref, is marked
+func (a *Agent) isMarked(ref string) bool {
+	return slices.ContainsFunc(a.markedRefs(), func(mark string) bool {
+		return mark == ref || strings.HasPrefix(mark, ref+".")
+	})
+}
+
+// toolCall returns the nth tool call among messages and its result, or nil if there
+// are fewer calls
+func toolCall(messages []session.Message, n int) []session.Message {
+	var use *session.Block
+	for _, message := range messages {
+		for _, block := range message.Content {
+			if block.Type == "tool_use" {
+				if n--; n == 0 {
+					use = &block
+				}
+			}
+			if use != nil && block.Type == "tool_result" && block.ToolUseID == use.ID {
+				return []session.Message{
+					{Role: "assistant", Content: []session.Block{*use}},
+					{Role: "user", Content: []session.Block{block}},
+				}
+			}
+		}
+	}
+	if use != nil {
+		return []session.Message{{Role: "assistant", Content: []session.Block{*use}}}
+	}
+	return nil
+}
+
+// markedItems renders each marked turn or tool call of conversation in full, in the
+// order they happened. Marks that no longer match the conversation are skipped.
+func markedItems(conversation []anthropic.MessageParam, marks []string) string {
+	var b strings.Builder
+	for _, ref := range marks {
+		turn, call, err := findTurn(conversation, ref)
+		if err != nil {
+			continue
+		}
+		messages := session.FromParams(conversation[turn.start:turn.end])
+		if call > 0 {
+			if messages = toolCall(messages, call); messages == nil {
+				continue
+			}
+		}
+		fmt.Fprintf(&b, "[%s]\n%s", ref, (&session.Session{Messages: messages}).Transcript(math.MaxInt))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Preserved returns what compacting s must keep word for word: the turns and tool
+// calls the user marked with /mark, after those kept from the session s continues
+func Preserved(s *session.Session) string {
+	marked := markedItems(s.Conversation(), s.Marks)
+	if s.Kept == "" || marked == "" {
+		return s.Kept + marked
+	}
+	return s.Kept + "\n\n" + marked
+}
+
+// withPreserved appends the preserved items, if any, to a summary
+func withPreserved(summary, preserved string) string {
+	if preserved == "" {
+		return summary
+	}
+	return summary + "\n\nThe user marked these parts of the conversation as important. They are kept word for word:\n\n" + preserved
+}
+
+// compact replaces the conversation with a summary of it, followed by the marked
+// items word for word. The summary becomes the first turn, marked when it keeps any
+// items, so they survive later compactions too.
+func (a *Agent) compact(ctx context.Context, conversation []anthropic.MessageParam) ([]anthropic.MessageParam, error) {
+	if len(turns(conversation)) == 0 {
+		return nil, fmt.Errorf("there is nothing to compact yet")
+	}
+	// Summarize a copy, so the summary is not cached on the session for messages it is about to replace
+	s := &session.Session{ID: "current", Messages: session.FromParams(conversation), Marks: a.markedRefs()}
+	if a.session != nil {
+		s.ID, s.Seed, s.Kept = a.session.ID, a.session.Seed, a.session.Kept
+	}
+	summary, err := summarize(ctx, a.client, s, a.anonymizing())
+	if err != nil {
+		return nil, err
+	}
+	preserved := Preserved(s) != ""
+	compacted := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("The conversation so far was compacted into this summary. Continue from it.\n\n" + summary)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("Understood. I will continue from the summary.")),
+	}
+	if a.session != nil {
+		// The first turn now holds the kept items itself
+		a.session.Kept = ""
+	}
+	a.setMarks(nil)
+	if preserved {
+		a.setMarks([]string{turnRef(1)})
+	}
+	return compacted, nil
+}
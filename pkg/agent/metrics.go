@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"agent/internal/metrics"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec(
+		"agent_inference_requests_total",
+		"Model inference requests by model and outcome.",
+		"model", "status",
+	)
+	tokensTotal = metrics.NewCounterVec(
+		"agent_tokens_total",
+		"Tokens consumed by model and token type.",
+		"model", "type",
+	)
+	inferenceDuration = metrics.NewHistogramVec(
+		"agent_inference_duration_seconds",
+		"Latency of model inference requests.",
+		nil,
+		"model",
+	)
+	toolCallsTotal = metrics.NewCounterVec(
+		"agent_tool_calls_total",
+		"Tool executions by tool and outcome.",
+		"tool", "status",
+	)
+	toolDuration = metrics.NewHistogramVec(
+		"agent_tool_duration_seconds",
+		"Latency of tool executions.",
+		nil,
+		"tool",
+	)
+	chaosTotal = metrics.NewCounterVec(
+		"agent_chaos_faults_total",
+		"Faults injected by chaos mode, by kind.",
+		"kind",
+	)
+	activeSessions = metrics.NewGaugeVec(
+		"agent_active_sessions",
+		"Conversation loops currently running.",
+	)
+)
+
+// recordUsage adds a response's token usage to the token counters
+func recordUsage(model string, usage anthropic.Usage) {
+	tokensTotal.Add(float64(usage.InputTokens), model, "input")
+	tokensTotal.Add(float64(usage.OutputTokens), model, "output")
+	tokensTotal.Add(float64(usage.CacheReadInputTokens), model, "cache_read")
+	tokensTotal.Add(float64(usage.CacheCreationInputTokens), model, "cache_creation")
+}
+
+// statusLabel maps an error to the status label used by the counters
+func statusLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
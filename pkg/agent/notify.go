@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"agent/pkg/tools"
+)
+
+const notifyUserTool = "notify_user"
+
+// Notice severities
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+)
+
+type notifyUserInput struct {
+	Message  string `json:"message" jsonschema_description:"One or two sentences the user must not miss, e.g. that a change alters a public API or deletes data."`
+	Severity string `json:"severity,omitempty" jsonschema:"enum=info,enum=warning" jsonschema_description:"warning for risks and breaking changes, info for everything else. Defaults to info."`
+}
+
+func (a *Agent) notifyUserDefinition() tools.ToolDefinition {
+	return tools.New(notifyUserTool,
+		"Flag something important to the user, shown prominently and kept on record. Use it "+
+			"sparingly, for facts they must act on or review: breaking or public API changes, data loss, security "+
+			"concerns, or work you skipped. Not for progress updates.",
+		func(ctx context.Context, in notifyUserInput) (string, error) {
+			switch in.Severity {
+			case "":
+				in.Severity = SeverityInfo
+			case SeverityInfo, SeverityWarning:
+			default:
+				return "", fmt.Errorf("severity must be %q or %q", SeverityInfo, SeverityWarning)
+			}
+			a.onEvent(Event{Type: EventNotice, ToolName: notifyUserTool, Text: in.Message, Severity: in.Severity})
+			return "The user has been notified.", nil
+		})
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+const (
+	offlineRetryMin = 5 * time.Second
+	offlineRetryMax = time.Minute
+)
+
+// errQueuedAtShutdown ends Run when the agent is asked to stop while a turn is queued
+var errQueuedAtShutdown = errors.New("shutting down with a queued turn; resume the session to send it")
+
+// isConnectivityError reports whether err means the API could not be reached at all,
+// as opposed to the API rejecting the request. A dial cut short by cancelling the turn
+// or by its deadline is not one.
+func isConnectivityError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr)
+}
+
+// retryWhenOnline re-runs the queued turn with backoff until the API is reachable,
+// printing the queue state on each attempt. The conversation is saved first so the
+// queued turn survives the process exiting.
+func (a *Agent) retryWhenOnline(ctx context.Context, conversation []anthropic.MessageParam) ([]anthropic.MessageParam, string, error) {
+	a.saveSession(ctx, conversation)
+	wait := offlineRetryMin
+	for attempt := 1; ; attempt++ {
+		log.Printf("\u001b[90mOffline: 1 turn queued, retrying in %s (attempt %d)\u001b[0m\n", wait, attempt)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return conversation, "", ctx.Err()
+		case <-a.drainSignal():
+			timer.Stop()
+			return conversation, "", errQueuedAtShutdown
+		}
+		wait = min(wait*2, offlineRetryMax)
+
+		var text string
+		var err error
+		conversation, text, err = a.runTurn(ctx, conversation)
+		if !isConnectivityError(err) {
+			if err == nil {
+				log.Println("\u001b[90mBack online, queued turn sent\u001b[0m")
+			}
+			return conversation, text, err
+		}
+	}
+}
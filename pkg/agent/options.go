@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"agent/pkg/session"
+)
+
+// Option configures optional Agent behaviour
+type Option func(*Agent)
+
+// WithSession resumes the conversation held in s and saves it to store as it progresses
+func WithSession(store session.Store, s *session.Session) Option {
+	return func(a *Agent) {
+		a.store = store
+		a.session = s
+	}
+}
+
+// WithMaxTurns limits how many times the model is called while answering a single
+// user message, so a runaway tool loop stops with ErrMaxTurns. Zero means no limit.
+func WithMaxTurns(n int) Option {
+	return func(a *Agent) {
+		a.maxTurns = n
+	}
+}
+
+// WithTokenBudget stops the agent with ErrBudgetExceeded once it has consumed n tokens
+// across all model calls. Zero means no limit.
+func WithTokenBudget(n int64) Option {
+	return func(a *Agent) {
+		a.tokenBudget = n
+	}
+}
+
+// WithSystemPrompt sends text as the system prompt on every model call, e.g. to give
+// the model standing context about the project
+func WithSystemPrompt(text string) Option {
+	return func(a *Agent) {
+		a.system = text
+	}
+}
+
+// WithMaxTokens sets the maximum number of tokens the model may generate per call.
+// The default is 1024.
+func WithMaxTokens(n int64) Option {
+	return func(a *Agent) {
+		a.maxTokens = n
+	}
+}
+
+// WithOfflineQueue makes Run ask confirm whether to queue a turn that failed because
+// the API was unreachable, and if so retry it until connectivity returns instead of
+// dropping it
+func WithOfflineQueue(confirm func(question string) bool) Option {
+	return func(a *Agent) {
+		a.confirmQueue = confirm
+	}
+}
+
+// WithMaxToolResult truncates tool results to n bytes before they are sent to the
+// model, trading context for bandwidth. Zero means no limit.
+func WithMaxToolResult(n int) Option {
+	return func(a *Agent) {
+		a.maxToolResult = n
+	}
+}
+
+// WithEventHandler sends the agent's events to h instead of the standard logger
+func WithEventHandler(h EventHandler) Option {
+	return func(a *Agent) {
+		a.onEvent = h
+	}
+}
+
+// WithToolExamples adds few-shot usage examples for tools to the system prompt, keyed
+// by tool name. Examples for tools the agent does not have are ignored.
+func WithToolExamples(examples map[string][]string) Option {
+	return func(a *Agent) {
+		a.toolExamples = examples
+	}
+}
+
+// WithPhases enables the explore/implement phase state machine, which holds back
+// mutating tools until the model has explored the task. See Phase.
+func WithPhases() Option {
+	return func(a *Agent) {
+		a.phased = true
+		a.phase = PhaseExplore
+	}
+}
+
+// WithTemperature sets the sampling temperature, between 0 and 1. The API default is
+// used when this option is not given.
+func WithTemperature(t float64) Option {
+	return func(a *Agent) {
+		a.temperature = &t
+	}
+}
+
+// WithSteering lets the user correct course while a turn is running. Before each model
+// call the agent calls pending, which must not block, and delivers whatever it returns
+// to the model as a priority note.
+func WithSteering(pending func() []string) Option {
+	return func(a *Agent) {
+		a.steering = pending
+	}
+}
+
+// WithNotifications offers the model a notify_user tool for flagging things the user
+// must not miss, such as a change to a public API. Each call is emitted as an
+// EventNotice.
+func WithNotifications() Option {
+	return func(a *Agent) {
+		a.notifications = true
+	}
+}
+
+// WithScratchpad offers the model scratchpad_write and scratchpad_read tools for
+// parking notes outside the context window. The notes are kept in the session, so a
+// resumed session keeps them too.
+func WithScratchpad() Option {
+	return func(a *Agent) {
+		a.scratchpad = true
+	}
+}
+
+// WithArtifacts offers the model a save_artifact tool that writes generated files,
+// such as reports and diagrams, to a directory under root named after the session.
+// See Agent.Artifacts.
+func WithArtifacts(root string) Option {
+	return func(a *Agent) {
+		a.artifactRoot = root
+	}
+}
+
+// WithFileHistory stores each version of a file that read_file returned or edit_file
+// wrote under dir, named by its SHA-256, and notes the turn it was seen in, so /show
+// path@t12 can print a file exactly as the model saw it. The tools report to the most
+// recent agent created with this option.
+func WithFileHistory(dir string) Option {
+	return func(a *Agent) {
+		a.historyDir = dir
+	}
+}
+
+// WithTraceSources attaches source snippets for the frames of Go, Python, Java and
+// Node stack traces found in user messages and tool results, resolved to files in the
+// working directory, so crashes can be diagnosed without reading each file first
+func WithTraceSources() Option {
+	return func(a *Agent) {
+		a.traceSources = true
+	}
+}
+
+// WithFeatures declares which optional API features the model supports, usually as
+// detected by ProbeFeatures. Unsupported features are disabled with a notice instead
+// of failing mid-session: without tools, requests carry no tool definitions.
+func WithFeatures(features Features) Option {
+	return func(a *Agent) {
+		a.features = features
+	}
+}
+
+// WithLanguage sets the language the model replies in: a language name such as
+// "German", or LanguageAuto to follow the language each user message is written in,
+// for teams that do not all work in English
+func WithLanguage(language string) Option {
+	return func(a *Agent) {
+		a.language = language
+	}
+}
+
+// WithHunkReview puts the changes in each model response to reviewer before any is
+// written, one hunk per call to a tool with a Preview. Rejected calls are not run, and
+// the model is told the user declined them.
+func WithHunkReview(reviewer HunkReviewer) Option {
+	return func(a *Agent) {
+		a.hunkReviewer = reviewer
+	}
+}
+
+// WithStatusLine prefixes the input prompt with the share of the context window in
+// use, the session cost so far and the model, updated after every turn
+func WithStatusLine() Option {
+	return func(a *Agent) {
+		a.statusLine = true
+	}
+}
+
+// WithExperiments turns on the experimental behaviours set in e
+func WithExperiments(e Experiments) Option {
+	return func(a *Agent) {
+		a.experiments = e
+	}
+}
+
+// WithSubAgents offers the model a delegate tool handing sub-tasks to sub-agents with
+// the same tools, which may delegate in turn up to maxDepth levels below this agent.
+// The agent and all its sub-agents stop with ErrBudgetExceeded once they have used
+// budget tokens between them; zero means no shared limit.
+func WithSubAgents(maxDepth int, budget int64) Option {
+	return func(a *Agent) {
+		a.node = &agentNode{agent: a}
+		a.tree = &agentTree{maxDepth: maxDepth, budget: budget, root: a.node}
+	}
+}
+
+// WithCitations labels each tool result with its reference, such as t3.2, and asks the
+// model to cite the results its answers rest on, so session transcripts footnote the
+// evidence for each claim
+func WithCitations() Option {
+	return func(a *Agent) {
+		a.citations = true
+	}
+}
+
+// WithLabels tags the session with cost labels such as billing:team-x, replacing those
+// it was stored with, so the tokens it uses are attributed to them in the stats
+func WithLabels(labels []string) Option {
+	return func(a *Agent) {
+		a.labels = labels
+	}
+}
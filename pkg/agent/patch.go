@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"agent/pkg/tools"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+const (
+	// patchContext is the number of lines either side of the region sent as context
+	patchContext = 30
+	// patchWindow is the region around the cursor used when no enclosing function is found
+	patchWindow = 15
+	// maxPatchRegion bounds the enclosing function; longer ones fall back to the window
+	maxPatchRegion = 400
+	// patchMaxTokens bounds the rewritten region
+	patchMaxTokens = 4096
+	// cursorMarker marks the cursor in the text sent to the model
+	cursorMarker = "<|cursor|>"
+)
+
+// PatchRequest asks for an edit of the function around a cursor in a file, as an
+// editor sends it. Line and Column are 1-based; a zero Column puts the cursor at the
+// end of the line.
+type PatchRequest struct {
+	Path        string `json:"path"`
+	Content     string `json:"content"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column,omitempty"`
+	Instruction string `json:"instruction,omitempty"`
+}
+
+// Patch replaces lines StartLine to EndLine of the file, inclusive and 1-based, with
+// Replacement. Diff shows the same change as a unified diff hunk.
+type Patch struct {
+	Path        string `json:"path"`
+	StartLine   int    `json:"start_line"`
+	EndLine     int    `json:"end_line"`
+	Replacement string `json:"replacement"`
+	Diff        string `json:"diff"`
+}
+
+const patchSystemPrompt = "You edit code inline in the user's editor. You are given one region of a file, between " +
+	"<region> and </region>, with the cursor marked " + cursorMarker + ", and an instruction. Reply with only the full " +
+	"new text of the region, which replaces it exactly: no explanation, no code fences, no markers. Keep the " +
+	"surrounding indentation and the file's style, and change nothing the instruction does not need."
+
+// GeneratePatch rewrites the function enclosing the cursor as the instruction says,
+// with one model call and no tools, for editors that want a fast inline edit rather
+// than an agent session
+func GeneratePatch(ctx context.Context, client *anthropic.Client, req PatchRequest) (Patch, error) {
+	lines := strings.SplitAfter(req.Content, "\n")
+	if n := len(lines); n > 1 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	if req.Line < 1 || req.Line > len(lines) {
+		return Patch{}, fmt.Errorf("line %d is outside the file's %d lines", req.Line, len(lines))
+	}
+	start, end := enclosingBlock(lines, req.Line-1)
+
+	region := make([]string, 0, end-start+1)
+	region = append(region, lines[start:end+1]...)
+	cursor := req.Line - 1 - start
+	text := strings.TrimRight(region[cursor], "\r\n")
+	column := len(text)
+	if req.Column > 0 {
+		column = min(req.Column-1, len(text))
+	}
+	region[cursor] = text[:column] + cursorMarker + region[cursor][column:]
+
+	instruction := strings.TrimSpace(req.Instruction)
+	if instruction == "" {
+		instruction = "Complete the code at the cursor."
+	}
+	prompt := fmt.Sprintf("File: %s\n\n%s<region>\n%s</region>\n%s\nInstruction: %s",
+		req.Path, strings.Join(lines[max(0, start-patchContext):start], ""), strings.Join(region, ""),
+		strings.Join(lines[end+1:min(len(lines), end+1+patchContext)], ""), instruction)
+
+	begin := time.Now()
+	message, err := client.Messages.New(ctx, anthropic.MessageNewParams{
+		Model:       DefaultModel,
+		MaxTokens:   patchMaxTokens,
+		Temperature: anthropic.Float(0),
+		System:      []anthropic.TextBlockParam{{Text: patchSystemPrompt}},
+		Messages:    []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(prompt))},
+	})
+	inferenceDuration.Observe(time.Since(begin).Seconds(), string(DefaultModel))
+	requestsTotal.Inc(string(DefaultModel), statusLabel(err))
+	if err != nil {
+		return Patch{}, fmt.Errorf("error running inference: %w", err)
+	}
+	recordUsage(string(DefaultModel), message.Usage)
+	var reply strings.Builder
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			reply.WriteString(block.Text)
+		}
+	}
+	if message.StopReason == anthropic.MessageStopReasonMaxTokens {
+		return Patch{}, errors.New("the rewritten region was cut off at the token limit")
+	}
+
+	replacement := strings.ReplaceAll(stripFences(reply.String()), cursorMarker, "")
+	original := strings.Join(lines[start:end+1], "")
+	if strings.HasSuffix(original, "\n") && !strings.HasSuffix(replacement, "\n") {
+		replacement += "\n"
+	}
+	offset := len(strings.Join(lines[:start], ""))
+	return Patch{
+		Path:        req.Path,
+		StartLine:   start + 1,
+		EndLine:     end + 1,
+		Replacement: replacement,
+		Diff:        tools.RangeDiff(req.Content, offset, offset+len(original), replacement),
+	}, nil
+}
+
+// stripFences removes a code fence the model wrapped its reply in despite being told not to
+func stripFences(reply string) string {
+	trimmed := strings.TrimSpace(reply)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") {
+		return strings.Trim(reply, "\n")
+	}
+	_, body, _ := strings.Cut(trimmed, "\n")
+	return strings.TrimSuffix(strings.TrimSuffix(body, "```"), "\n")
+}
+
+var (
+	// functionStart matches the first line of a function or method in common languages
+	functionStart = regexp.MustCompile(`^\s*(?:(?:export|default|public|private|protected|internal|static|async|override|final|inline|virtual|pub(?:\([\w:]+\))?|unsafe|const)\s+)*(?:func|def|function|fn|fun|sub|proc)\b`)
+	// cFunctionStart matches a C-like definition such as "static int parse(char *s) {"
+	cFunctionStart = regexp.MustCompile(`^[A-Za-z_][\w\s\*&:<>,~]*\([^;]*\)\s*(?:const\s*)?(?:\{\s*)?$`)
+	// notFunction rules out control statements that look like C definitions
+	notFunction = regexp.MustCompile(`^\s*(?:if|for|while|switch|else|catch|return|do)\b`)
+)
+
+// enclosingBlock returns the first and last line, 0-based, of the function containing
+// line, or a window around line when there is none
+func enclosingBlock(lines []string, line int) (int, int) {
+	for start := line; start >= 0; start-- {
+		text := lines[start]
+		if notFunction.MatchString(text) || !(functionStart.MatchString(text) || cFunctionStart.MatchString(text)) {
+			continue
+		}
+		end, ok := blockEnd(lines, start)
+		if !ok || end < line {
+			// A function that ends before the cursor does not contain it; one further up may
+			continue
+		}
+		if end-start+1 > maxPatchRegion {
+			break
+		}
+		return start, end
+	}
+	return max(0, line-patchWindow), min(len(lines)-1, line+patchWindow)
+}
+
+// blockEnd finds the last line of the block starting at start: where its braces
+// balance, or, for languages like Python, the last line indented below it
+func blockEnd(lines []string, start int) (int, bool) {
+	depth, opened := 0, false
+	for i := start; i < len(lines) && i < start+maxPatchRegion; i++ {
+		text := lines[i]
+		if !opened && i > start+3 {
+			break
+		}
+		if !opened && strings.HasSuffix(strings.TrimSpace(text), ":") && !strings.Contains(text, "{") {
+			return indentedEnd(lines, start), true
+		}
+		for _, r := range text {
+			switch r {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+			}
+		}
+		if opened && depth <= 0 {
+			return i, true
+		}
+	}
+	if !opened {
+		return indentedEnd(lines, start), true
+	}
+	return 0, false
+}
+
+// indentedEnd returns the last non-blank line indented deeper than start
+func indentedEnd(lines []string, start int) int {
+	base := indentation(lines[start])
+	end := start
+	for i := start + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		if indentation(lines[i]) <= base {
+			break
+		}
+		end = i
+	}
+	return end
+}
+
+// indentation counts a line's leading spaces, with a tab as four
+func indentation(line string) int {
+	n := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return n
+		}
+	}
+	return n
+}
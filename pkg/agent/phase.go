@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+
+	"agent/pkg/tools"
+)
+
+// Phase is a stage of a task. With WithPhases each user message starts in
+// PhaseExplore, where only tools that do not modify the working tree are offered,
+// and the model moves to PhaseImplement by calling begin_implementation.
+type Phase string
+
+const (
+	PhaseExplore   Phase = "explore"
+	PhaseImplement Phase = "implement"
+)
+
+const beginImplementationTool = "begin_implementation"
+
+type beginImplementationInput struct {
+	Plan string `json:"plan" jsonschema_description:"A short plan of the changes you are about to make."`
+}
+
+// Phase returns the current phase, or the empty string if phases are disabled
+func (a *Agent) Phase() Phase {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.phase
+}
+
+func (a *Agent) setPhase(p Phase) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.phase = p
+}
+
+// startPhases resets the state machine at the start of a user message
+func (a *Agent) startPhases() {
+	if a.phased {
+		a.setPhase(PhaseExplore)
+	}
+}
+
+// phaseTools returns the caller's tools that are offered in the current phase
+func (a *Agent) phaseTools() []tools.ToolDefinition {
+	if !a.phased || a.Phase() == PhaseImplement {
+		return a.tools
+	}
+	var active []tools.ToolDefinition
+	hasMutating := false
+	for _, tool := range a.tools {
+		if tool.Mutating {
+			hasMutating = true
+			continue
+		}
+		active = append(active, tool)
+	}
+	if !hasMutating {
+		return a.tools
+	}
+	return append(active, tools.New(beginImplementationTool,
+		"Finish exploring and start making changes. Call this once you understand the code well "+
+			"enough to edit it; the tools that modify files become available afterwards.",
+		func(ctx context.Context, in beginImplementationInput) (string, error) {
+			a.setPhase(PhaseImplement)
+			return "Implementation phase started; the editing tools are now available.", nil
+		}))
+}
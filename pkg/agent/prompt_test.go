@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"agent/pkg/session"
+	"agent/pkg/tools"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// checkGolden compares got with testdata/golden/name, rewriting the file with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (run go test ./pkg/agent -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s changed; if the new prompt is intended, run go test ./pkg/agent -update\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+func marshalParams(t *testing.T, params anthropic.MessageNewParams) []byte {
+	t.Helper()
+	raw, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, raw, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	out.WriteByte('\n')
+	return out.Bytes()
+}
+
+func fixedSession() *session.Session {
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	return &session.Session{ID: "20250101-120000-00000000", CreatedAt: created, UpdatedAt: created}
+}
+
+func toolRoundTrip() []anthropic.MessageParam {
+	return []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("What does main.go do?")),
+		{
+			Role: anthropic.MessageParamRoleAssistant,
+			Content: []anthropic.ContentBlockParamUnion{
+				anthropic.NewTextBlock("Let me read it."),
+				{OfRequestToolUseBlock: &anthropic.ToolUseBlockParam{
+					ID:    "toolu_01",
+					Name:  "read_file",
+					Input: json.RawMessage(`{"path":"main.go"}`),
+				}},
+			},
+		},
+		anthropic.NewUserMessage(anthropic.NewToolResultBlock("toolu_01", "package main\n\nfunc main() {}\n", false)),
+	}
+}
+
+func TestRequestParamsGolden(t *testing.T) {
+	seeded := fixedSession()
+	seeded.SeededFrom = "20241225-090000-11111111"
+	seeded.Seed = "Goal: add retries to the HTTP client. Done: pkg/client/retry.go. Next: wire it into main.go."
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		conversation []anthropic.MessageParam
+	}{
+		{
+			name:         "default",
+			conversation: []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("List the files"))},
+		},
+		{
+			name: "system_and_examples",
+			opts: []Option{
+				WithSystemPrompt("Project context from .agent/onboarding.md:\n\nA Go CLI."),
+				WithToolExamples(map[string][]string{
+					"git_blame":    {"Blame the lines named in a failing stack trace."},
+					"missing_tool": {"Never shown, since the agent has no such tool."},
+				}),
+				WithTemperature(0.5),
+				WithMaxTokens(4096),
+				WithNotifications(),
+				WithScratchpad(),
+				WithArtifacts(".agent/artifacts"),
+				WithLanguage("German"),
+			},
+			conversation: toolRoundTrip(),
+		},
+		{
+			name:         "explore_phase",
+			opts:         []Option{WithPhases()},
+			conversation: []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("Fix the bug in main.go"))},
+		},
+		{
+			name:         "seeded_session",
+			opts:         []Option{WithSession(nil, seeded)},
+			conversation: []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("Carry on"))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAgent(nil, nil, tools.GetTools(), tt.opts...)
+			checkGolden(t, tt.name+".json", marshalParams(t, a.requestParams(tt.conversation)))
+		})
+	}
+}
+
+func TestSummaryPromptGolden(t *testing.T) {
+	s := fixedSession()
+	s.Seed = "Earlier: investigated flaky TestRetry."
+	s.SetConversation(toolRoundTrip())
+	checkGolden(t, "summary_prompt.txt", []byte(summaryPrompt(s)))
+}
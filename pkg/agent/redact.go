@@ -0,0 +1,23 @@
+package agent
+
+import (
+	"agent/pkg/session"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// redact removes the matches of pattern from the conversation and, with a session,
+// from its summaries and notes, recording the pattern so exports remove it too. The
+// model no longer sees the removed text either.
+func (a *Agent) redact(conversation []anthropic.MessageParam, pattern string) ([]anthropic.MessageParam, int, error) {
+	s := a.session
+	if s == nil {
+		s = &session.Session{}
+	}
+	s.SetConversation(conversation)
+	n, err := s.Redact(pattern)
+	if err != nil {
+		return conversation, 0, err
+	}
+	return s.Conversation(), n, nil
+}
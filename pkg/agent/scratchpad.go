@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"agent/pkg/tools"
+)
+
+const (
+	scratchpadWriteTool = "scratchpad_write"
+	scratchpadReadTool  = "scratchpad_read"
+)
+
+type scratchpadWriteInput struct {
+	Key     string `json:"key" jsonschema_description:"Short name for the note, e.g. plan or callers-of-Parse."`
+	Content string `json:"content" jsonschema_description:"The note. An empty note deletes the key."`
+	Append  bool   `json:"append,omitempty" jsonschema_description:"Add to the end of the existing note instead of replacing it."`
+}
+
+type scratchpadReadInput struct {
+	Key string `json:"key,omitempty" jsonschema_description:"The note to read. Omit to list the keys and their sizes."`
+}
+
+// notes returns the scratchpad, stored in the session when there is one so that it
+// is saved and resumed with the conversation
+func (a *Agent) notes() map[string]string {
+	if a.session != nil {
+		if a.session.Scratchpad == nil {
+			a.session.Scratchpad = map[string]string{}
+		}
+		return a.session.Scratchpad
+	}
+	if a.scratch == nil {
+		a.scratch = map[string]string{}
+	}
+	return a.scratch
+}
+
+func (a *Agent) scratchpadDefinitions() []tools.ToolDefinition {
+	return []tools.ToolDefinition{
+		tools.New(scratchpadWriteTool,
+			"Save a note to your scratchpad under a key, such as a plan, a list of symbols to change or "+
+				"findings to come back to. Notes persist for the session, so you need not keep them in mind.",
+			func(ctx context.Context, in scratchpadWriteInput) (string, error) {
+				if in.Key == "" {
+					return "", fmt.Errorf("key must not be empty")
+				}
+				notes := a.notes()
+				if in.Append {
+					in.Content = notes[in.Key] + in.Content
+				}
+				if in.Content == "" {
+					delete(notes, in.Key)
+					return fmt.Sprintf("Deleted note '%s'.", in.Key), nil
+				}
+				notes[in.Key] = in.Content
+				return fmt.Sprintf("Saved note '%s' (%d bytes).", in.Key, len(in.Content)), nil
+			}),
+		tools.New(scratchpadReadTool,
+			"Read a note from your scratchpad, or list the saved keys when no key is given.",
+			func(ctx context.Context, in scratchpadReadInput) (string, error) {
+				notes := a.notes()
+				if in.Key != "" {
+					note, ok := notes[in.Key]
+					if !ok {
+						return "", fmt.Errorf("no note named '%s'", in.Key)
+					}
+					return note, nil
+				}
+				if len(notes) == 0 {
+					return "The scratchpad is empty.", nil
+				}
+				keys := make([]string, 0, len(notes))
+				for key := range notes {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				var b strings.Builder
+				for _, key := range keys {
+					fmt.Fprintf(&b, "%s (%d bytes)\n", key, len(notes[key]))
+				}
+				return b.String(), nil
+			}),
+	}
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Status is a snapshot of the session for a status line
+type Status struct {
+	Model string `json:"model"`
+	// ContextTokens is the size of the conversation as of the latest request, and zero
+	// before the first
+	ContextTokens int64   `json:"context_tokens"`
+	ContextWindow int64   `json:"context_window"`
+	Cost          float64 `json:"cost"`
+}
+
+// Status returns the model that answered the latest request, context use and session
+// cost, with each model's usage priced at that model's rates
+func (a *Agent) Status() Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	model := a.lastModel
+	if model == "" {
+		model = string(DefaultModel)
+	}
+	cost := 0.0
+	for name, usage := range a.modelUsage {
+		cost += usage.Cost(name)
+	}
+	return Status{
+		Model:         model,
+		ContextTokens: a.contextTokens,
+		ContextWindow: ModelContextWindow[model],
+		Cost:          cost,
+	}
+}
+
+// ContextPercent returns how much of the context window the conversation fills, or
+// -1 when that is not known yet
+func (s Status) ContextPercent() int {
+	if s.ContextTokens == 0 || s.ContextWindow == 0 {
+		return -1
+	}
+	return int(s.ContextTokens * 100 / s.ContextWindow)
+}
+
+// String renders the status as a dim segment for the input prompt, with the context
+// share turning yellow from 70% and red from 90% so a full context is noticed early
+func (s Status) String() string {
+	parts := []string{}
+	switch percent := s.ContextPercent(); {
+	case percent >= 90:
+		parts = append(parts, fmt.Sprintf("\u001b[91mctx %d%%\u001b[90m", percent))
+	case percent >= 70:
+		parts = append(parts, fmt.Sprintf("\u001b[93mctx %d%%\u001b[90m", percent))
+	case percent >= 0:
+		parts = append(parts, fmt.Sprintf("ctx %d%%", percent))
+	}
+	parts = append(parts, fmt.Sprintf("$%.2f", s.Cost), s.Model)
+	return "\u001b[90m[" + strings.Join(parts, " · ") + "]\u001b[0m"
+}
@@ -0,0 +1,32 @@
+package agent
+
+import (
+	"math"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+func TestStatusPricesEachModel(t *testing.T) {
+	a := &Agent{}
+	if got := a.Status().Model; got != string(DefaultModel) {
+		t.Errorf("model before any request = %q; want %q", got, DefaultModel)
+	}
+
+	a.mu.Lock()
+	a.countUsage(string(RouterModel), anthropic.Usage{InputTokens: 1_000_000})
+	a.mu.Unlock()
+	a.addUsage(string(DefaultModel), anthropic.Usage{InputTokens: 1_000_000})
+	a.addUsage(string(RouterModel), anthropic.Usage{OutputTokens: 1_000_000})
+
+	status := a.Status()
+	if status.Model != string(RouterModel) {
+		t.Errorf("model = %q; want the one that answered last, %q", status.Model, RouterModel)
+	}
+	if want := 0.80 + 3 + 4; math.Abs(status.Cost-want) > 1e-9 {
+		t.Errorf("cost = %v; want %v", status.Cost, want)
+	}
+	if got := a.Usage().Requests; got != 3 {
+		t.Errorf("requests = %d; want 3", got)
+	}
+}
@@ -0,0 +1,28 @@
+package agent
+
+import (
+	"log"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// steeringHeader introduces guidance sent while the model was working, which next to
+// tool results would otherwise read as an afterthought
+const steeringHeader = "[The user sent this while you were working. It takes priority over earlier " +
+	"instructions; adjust the current plan accordingly before continuing.]"
+
+// deliverSteering appends any pending guidance to the trailing user message, so it
+// reaches the model on the next call rather than after the turn ends
+func (a *Agent) deliverSteering(conversation []anthropic.MessageParam) []anthropic.MessageParam {
+	if a.steering == nil {
+		return conversation
+	}
+	notes := a.steering()
+	if len(notes) == 0 {
+		return conversation
+	}
+	note := strings.Join(notes, "\n")
+	log.Printf("\u001b[95mSteering\u001b[0m: %s\n", note)
+	return appendUserText(conversation, steeringHeader+"\n"+note)
+}
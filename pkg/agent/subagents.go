@@ -0,0 +1,203 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"agent/pkg/tools"
+)
+
+const delegateTool = "delegate"
+
+type delegateInput struct {
+	Task string `json:"task" jsonschema_description:"The sub-task, described in full: the sub-agent sees none of this conversation. Say what to find out or change and what to report back."`
+}
+
+// agentTree is shared by an agent and every sub-agent below it: the depth they may
+// nest to, the tokens they may use between them, and who started whom
+type agentTree struct {
+	maxDepth int
+	budget   int64
+
+	mu   sync.Mutex
+	root *agentNode
+	runs int // sub-agents started, for numbering them
+}
+
+// agentNode is one agent of the tree
+type agentNode struct {
+	id       string // 1, 2.1 and so on; empty for the top agent
+	task     string
+	depth    int
+	agent    *Agent
+	err      error
+	done     bool
+	children []*agentNode
+}
+
+// used totals the tokens every agent of the tree has consumed
+func (t *agentTree) used() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var total int64
+	var walk func(n *agentNode)
+	walk = func(n *agentNode) {
+		total += n.agent.Usage().Total()
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(t.root)
+	return total
+}
+
+// checkTreeBudget returns ErrBudgetExceeded once the tree has used its shared budget
+func (a *Agent) checkTreeBudget() error {
+	if a.tree == nil || a.tree.budget <= 0 {
+		return nil
+	}
+	if used := a.tree.used(); used >= a.tree.budget {
+		return fmt.Errorf("%w (%d of %d tokens used by the agent and its sub-agents)", ErrBudgetExceeded, used, a.tree.budget)
+	}
+	return nil
+}
+
+// canDelegate reports whether this agent may start sub-agents of its own
+func (a *Agent) canDelegate() bool {
+	return a.tree != nil && a.node.depth < a.tree.maxDepth
+}
+
+// delegateTools returns the tools a sub-agent started now gets: the caller's tools,
+// or only the read-only ones while this agent is still exploring
+func (a *Agent) delegateTools() []tools.ToolDefinition {
+	if !a.phased || a.Phase() == PhaseImplement {
+		return a.tools
+	}
+	return slices.DeleteFunc(slices.Clone(a.tools), func(tool tools.ToolDefinition) bool { return tool.Mutating })
+}
+
+func (a *Agent) delegateDefinition() tools.ToolDefinition {
+	childTools := a.delegateTools()
+	tool := tools.New(delegateTool,
+		"Hand a self-contained sub-task to a sub-agent with the same tools, and get its final answer. Use it "+
+			"for independent pieces of work, such as investigating one module or making one well-defined change, so "+
+			"their details stay out of your context.",
+		func(ctx context.Context, in delegateInput) (string, error) {
+			if strings.TrimSpace(in.Task) == "" {
+				return "", fmt.Errorf("task must not be empty")
+			}
+			if !a.canDelegate() {
+				return "", fmt.Errorf("sub-agents at depth %d cannot start sub-agents of their own", a.node.depth)
+			}
+			if err := a.checkTreeBudget(); err != nil {
+				return "", err
+			}
+			return a.delegate(in.Task, childTools)
+		})
+	// A sub-agent can do whatever its tools can, so it is mutating when they are
+	tool.Mutating = slices.ContainsFunc(childTools, func(tool tools.ToolDefinition) bool { return tool.Mutating })
+	return tool
+}
+
+// delegate runs task in a new sub-agent below this one. The sub-agent's events are
+// passed on to this agent's handler, tagged with its ID, such as [sub2.1 t1.3].
+func (a *Agent) delegate(task string, childTools []tools.ToolDefinition) (string, error) {
+	a.tree.mu.Lock()
+	a.tree.runs++
+	id := fmt.Sprint(len(a.node.children) + 1)
+	if a.node.id != "" {
+		id = a.node.id + "." + id
+	}
+	node := &agentNode{id: id, task: task, depth: a.node.depth + 1}
+	a.node.children = append(a.node.children, node)
+	a.tree.mu.Unlock()
+
+	forward := func(e Event) {
+		// Events of deeper sub-agents arrive already tagged
+		if !strings.HasPrefix(e.Ref, "sub") {
+			e.Ref = strings.TrimSpace("sub" + id + " " + e.Ref)
+		}
+		a.onEvent(e)
+	}
+	child := NewAgent(a.client, nil, childTools, WithMaxTokens(a.maxTokens), WithFeatures(a.features), WithEventHandler(forward))
+	child.system, child.toolExamples, child.maxToolResult, child.temperature = a.system, a.toolExamples, a.maxToolResult, a.temperature
+	child.maxTurns, child.tokenBudget, child.hunkReviewer = a.maxTurns, a.tokenBudget, a.hunkReviewer
+	child.language, child.replyLanguage = a.language, a.replyLanguage
+	child.tree, child.node, child.anonymizer = a.tree, node, a.anonymizing()
+	child.chaos = a.chaos
+	a.tree.mu.Lock()
+	node.agent = child
+	a.tree.mu.Unlock()
+
+	ctx := a.runCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	answer, err := child.RunTask(ctx, task)
+	a.tree.mu.Lock()
+	node.done, node.err = true, err
+	a.tree.mu.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("sub-agent %s failed: %w", id, err)
+	}
+	return answer, nil
+}
+
+// SubAgentTree renders the sub-agents started during the run as a tree under the top
+// agent, with the tokens each used and how it ended. It is empty if none were started.
+func (a *Agent) SubAgentTree() string {
+	if a.tree == nil {
+		return ""
+	}
+	a.tree.mu.Lock()
+	defer a.tree.mu.Unlock()
+	if a.tree.runs == 0 {
+		return ""
+	}
+	var b strings.Builder
+	var total int64
+	var walk func(n *agentNode, prefix string, last bool)
+	walk = func(n *agentNode, prefix string, last bool) {
+		var used int64
+		if n.agent != nil {
+			used = n.agent.Usage().Total()
+		}
+		total += used
+		if n == a.tree.root {
+			fmt.Fprintf(&b, "agent  \u001b[90m%d tokens\u001b[0m\n", used)
+		} else {
+			branch, status := "├── ", "\u001b[92mdone\u001b[0m"
+			if last {
+				branch = "└── "
+			}
+			switch {
+			case !n.done:
+				status = "\u001b[93mrunning\u001b[0m"
+			case n.err != nil:
+				status = "\u001b[91mfailed\u001b[0m: " + n.err.Error()
+			}
+			task, _, _ := strings.Cut(n.task, "\n")
+			if len(task) > 60 {
+				task = task[:60] + "..."
+			}
+			fmt.Fprintf(&b, "%s%s%s %q  \u001b[90m%d tokens\u001b[0m  %s\n", prefix, branch, n.id, task, used, status)
+			if last {
+				prefix += "    "
+			} else {
+				prefix += "│   "
+			}
+		}
+		for i, child := range n.children {
+			walk(child, prefix, i == len(n.children)-1)
+		}
+	}
+	walk(a.tree.root, "", true)
+	fmt.Fprintf(&b, "%d sub-agents, %d tokens in total", a.tree.runs, total)
+	if a.tree.budget > 0 {
+		fmt.Fprintf(&b, " of a %d token budget", a.tree.budget)
+	}
+	return b.String()
+}
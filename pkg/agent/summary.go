@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"agent/pkg/session"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// maxSummaryToolResult bounds how much of each tool result is shown to the summarizer
+const maxSummaryToolResult = 2000
+
+// Summarize returns a compacted summary of s, generating it with the model and caching
+// it on the session until the conversation grows. The turns and tool calls marked with
+// /mark follow the summary word for word. The caller is responsible for saving s.
+func Summarize(ctx context.Context, client *anthropic.Client, s *session.Session) (string, error) {
+	return summarize(ctx, client, s, nil)
+}
+
+// summarize is Summarize, sending the transcript through z when it is not nil
+func summarize(ctx context.Context, client *anthropic.Client, s *session.Session, z *anonymizer) (string, error) {
+	if s.Summary != "" && s.SummaryCovers == len(s.Messages) {
+		return withPreserved(s.Summary, Preserved(s)), nil
+	}
+	if len(s.Messages) == 0 {
+		return "", fmt.Errorf("session '%s' has no messages to summarize", s.ID)
+	}
+
+	summarizer := NewAgent(client, nil, nil, WithMaxTokens(2048))
+	summarizer.anonymizer = z
+	summary, err := summarizer.RunTask(ctx, summaryPrompt(s))
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize session '%s': %w", s.ID, err)
+	}
+	s.Summary = summary
+	s.SummaryCovers = len(s.Messages)
+	return withPreserved(summary, Preserved(s)), nil
+}
+
+// summaryPrompt asks the model to compact the session's transcript
+func summaryPrompt(s *session.Session) string {
+	prompt := "Summarize this coding-agent session so the work can be continued in a new session without the " +
+		"transcript. Cover the goal, decisions made and why, files changed or examined, the current state, " +
+		"and open questions or next steps. Be specific about paths and identifiers; omit pleasantries.\n\n" +
+		"<transcript>\n" + s.Transcript(maxSummaryToolResult) + "</transcript>"
+	if s.Seed != "" {
+		prompt = "This session itself continued an earlier one, summarized as:\n\n" + s.Seed + "\n\n" + prompt
+	}
+	return prompt
+}
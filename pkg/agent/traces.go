@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"agent/pkg/tools"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+const (
+	// maxTraceFrames bounds how many frames get a source snippet per message
+	maxTraceFrames = 5
+	// traceContext is the number of lines shown either side of a frame's line
+	traceContext = 5
+	// maxIndexedFiles stops the workspace index growing without bound in huge trees
+	maxIndexedFiles = 50_000
+)
+
+// traceFrame is a file and line named by a stack trace
+type traceFrame struct {
+	file string
+	line int
+}
+
+var traceFramePatterns = []*regexp.Regexp{
+	// Go: "\t/home/ci/src/app/pkg/server.go:42 +0x1d"
+	regexp.MustCompile(`(?m)^\s+(\S+\.go):(\d+)(?:\s|$)`),
+	// Python: `File "/app/service/handlers.py", line 87, in handle`
+	regexp.MustCompile(`File "([^"]+\.py)", line (\d+)`),
+	// Java and Kotlin: "at com.example.billing.Invoice.total(Invoice.java:113)"
+	regexp.MustCompile(`at ([\w$.]+)\.[\w$<>]+\((\w+\.(?:java|kt)):(\d+)\)`),
+	// Node: "at render (/srv/app/src/view.js:10:5)" or "at /srv/app/src/view.ts:10:5"
+	regexp.MustCompile(`at (?:[^\s(]+ \()?([^\s()]+\.(?:js|mjs|cjs|ts|tsx|jsx)):(\d+):\d+\)?`),
+}
+
+// traceFrames extracts the frames of any stack traces in text, innermost first, as
+// traces print them
+func traceFrames(text string) []traceFrame {
+	var frames []traceFrame
+	for i, pattern := range traceFramePatterns {
+		for _, m := range pattern.FindAllStringSubmatch(text, -1) {
+			file, line := m[1], m[2]
+			if i == 2 {
+				// Java names the class's package and source file separately
+				pkg := m[1]
+				if dot := strings.LastIndex(pkg, "."); dot >= 0 {
+					pkg = pkg[:dot]
+				} else {
+					pkg = ""
+				}
+				file = filepath.Join(strings.ReplaceAll(pkg, ".", "/"), m[2])
+				line = m[3]
+			}
+			n, err := strconv.Atoi(line)
+			if err == nil {
+				frames = append(frames, traceFrame{file: file, line: n})
+			}
+		}
+	}
+	return frames
+}
+
+// workspaceFiles indexes the relative paths of files in the working directory, or the
+// monorepo sub-projects in scope, by base name, for matching frames recorded on other
+// machines
+func workspaceFiles() map[string][]string {
+	index := map[string][]string{}
+	count := 0
+	roots := tools.Scope()
+	if roots == nil {
+		roots = []string{"."}
+	}
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				switch d.Name() {
+				case ".git", "node_modules", "vendor", ".agent", "dist", "build", "__pycache__":
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if count++; count > maxIndexedFiles {
+				return filepath.SkipAll
+			}
+			index[d.Name()] = append(index[d.Name()], filepath.ToSlash(path))
+			return nil
+		})
+	}
+	return index
+}
+
+// resolveFrame maps a frame's file to a workspace path: the file whose path shares the
+// longest suffix with the frame's, so /build/src/app/pkg/x.go finds pkg/x.go
+func resolveFrame(file string, index map[string][]string) (string, bool) {
+	file = filepath.ToSlash(file)
+	candidates := index[filepath.Base(file)]
+	best, bestLen := "", 0
+	for _, candidate := range candidates {
+		if pathSuffix(file, candidate) || pathSuffix(candidate, file) {
+			if l := len(candidate); l > bestLen {
+				best, bestLen = candidate, l
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// pathSuffix reports whether path ends with the whole path segments of suffix
+func pathSuffix(path, suffix string) bool {
+	return path == suffix || strings.HasSuffix(path, "/"+suffix)
+}
+
+// traceSources returns source snippets for the workspace frames of stack traces in
+// texts, or the empty string if there are none
+func traceSources(texts ...string) string {
+	var frames []traceFrame
+	for _, text := range texts {
+		frames = append(frames, traceFrames(text)...)
+	}
+	sources, _ := frameSources(frames)
+	return sources
+}
+
+// diagnosticPattern matches the locations of compiler and linter errors, such as
+// "pkg/server.go:42:7: undefined: x", which are not stack frames
+var diagnosticPattern = regexp.MustCompile(`(?m)^(?:\S+: )?([^\s:]+\.\w+):(\d+)(?::\d+)?:\s`)
+
+// TraceSources returns source snippets for the workspace files named by the stack
+// traces and compiler errors in text, and those files, for explaining an error
+func TraceSources(text string) (string, []string) {
+	frames := traceFrames(text)
+	for _, m := range diagnosticPattern.FindAllStringSubmatch(text, -1) {
+		if n, err := strconv.Atoi(m[2]); err == nil {
+			frames = append(frames, traceFrame{file: m[1], line: n})
+		}
+	}
+	return frameSources(frames)
+}
+
+// frameSources returns snippets for the frames that resolve to workspace files, or the
+// empty string if none do, and the files in the order first seen
+func frameSources(frames []traceFrame) (string, []string) {
+	if len(frames) == 0 {
+		return "", nil
+	}
+
+	index := workspaceFiles()
+	seen := map[traceFrame]bool{}
+	var files []string
+	var b strings.Builder
+	shown := 0
+	for _, frame := range frames {
+		path, ok := resolveFrame(frame.file, index)
+		if !ok {
+			continue
+		}
+		key := traceFrame{file: path, line: frame.line}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		snippet, ok := sourceSnippet(path, frame.line)
+		if !ok {
+			continue
+		}
+		if !slices.Contains(files, path) {
+			files = append(files, path)
+		}
+		fmt.Fprintf(&b, "\n%s:%d\n```\n%s```\n", path, frame.line, snippet)
+		if shown++; shown == maxTraceFrames {
+			break
+		}
+	}
+	if shown == 0 {
+		return "", nil
+	}
+	return "[Source of the stack frames above that are in this workspace, attached automatically; the marked line is the frame's.]\n" + b.String(), files
+}
+
+// sourceSnippet returns numbered lines around line in path, marking line itself
+func sourceSnippet(path string, line int) (string, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	lines := strings.Split(string(content), "\n")
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	var b strings.Builder
+	for n := max(1, line-traceContext); n <= min(len(lines), line+traceContext); n++ {
+		marker := "  "
+		if n == line {
+			marker = "> "
+		}
+		fmt.Fprintf(&b, "%s%4d %s\n", marker, n, lines[n-1])
+	}
+	return b.String(), true
+}
+
+// attachTraceSources appends snippets for any stack traces in texts to the trailing
+// user message
+func (a *Agent) attachTraceSources(conversation []anthropic.MessageParam, texts ...string) []anthropic.MessageParam {
+	if !a.traceSources {
+		return conversation
+	}
+	if sources := traceSources(texts...); sources != "" {
+		return appendUserText(conversation, sources)
+	}
+	return conversation
+}
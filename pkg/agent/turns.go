@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// turnRef names turn n, counting from 1. Tool calls add their place in the turn, so
+// t42.3 is the third call of turn 42.
+func turnRef(n int) string {
+	return fmt.Sprintf("t%d", n)
+}
+
+// parseRef reads a turn or tool call ID, returning a call of 0 for a whole turn
+func parseRef(ref string) (turn, call int, err error) {
+	number, callPart, hasCall := strings.Cut(strings.TrimPrefix(ref, "t"), ".")
+	turn, err = strconv.Atoi(number)
+	if err != nil || turn < 1 || !strings.HasPrefix(ref, "t") {
+		return 0, 0, fmt.Errorf("'%s' is not a turn or tool call ID such as t4 or t4.2", ref)
+	}
+	if hasCall {
+		call, err = strconv.Atoi(callPart)
+		if err != nil || call < 1 {
+			return 0, 0, fmt.Errorf("'%s' is not a turn or tool call ID such as t4 or t4.2", ref)
+		}
+	}
+	return turn, call, nil
+}
+
+// turnStarts returns the index of the user message that opens each turn. Messages
+// carrying tool results continue the turn, along with any steering or trace sources
+// attached to them, so the numbering can be recomputed from a resumed conversation.
+func turnStarts(conversation []anthropic.MessageParam) []int {
+	var starts []int
+	for i, message := range conversation {
+		if message.Role != anthropic.MessageParamRoleUser {
+			continue
+		}
+		continues := false
+		for _, block := range message.Content {
+			if block.OfRequestToolResultBlock != nil {
+				continues = true
+				break
+			}
+		}
+		if !continues {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// numberTurn starts numbering the events of the turn the conversation is about to run
+func (a *Agent) numberTurn(conversation []anthropic.MessageParam) {
+	a.turn = len(turnStarts(conversation))
+	a.callRefs = map[string]string{}
+}
+
+// stamp gives an event its time and the ID of the turn or tool call it belongs to
+func (a *Agent) stamp(e Event) Event {
+	e.Time = time.Now()
+	if e.Ref != "" || a.turn == 0 {
+		return e
+	}
+	e.Ref = turnRef(a.turn)
+	if e.ToolID != "" {
+		ref, ok := a.callRefs[e.ToolID]
+		if !ok {
+			ref = fmt.Sprintf("%s.%d", e.Ref, len(a.callRefs)+1)
+			a.callRefs[e.ToolID] = ref
+		}
+		e.Ref = ref
+	}
+	return e
+}
+
+// turnSpan is one turn of the conversation: its messages from start up to end, and
+// the user's message that began it
+type turnSpan struct {
+	ref        string
+	message    string
+	start, end int
+}
+
+// turns splits the conversation into its turns
+func turns(conversation []anthropic.MessageParam) []turnSpan {
+	starts := turnStarts(conversation)
+	var list []turnSpan
+	for i, start := range starts {
+		end := len(conversation)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		var message string
+		for _, block := range conversation[start].Content {
+			if block.OfRequestTextBlock != nil {
+				message = block.OfRequestTextBlock.Text
+				break
+			}
+		}
+		list = append(list, turnSpan{ref: turnRef(i + 1), message: message, start: start, end: end})
+	}
+	return list
+}
+
+// findTurn returns the turn ref names and the tool call within it, 0 for the whole turn
+func findTurn(conversation []anthropic.MessageParam, ref string) (turnSpan, int, error) {
+	number, call, err := parseRef(ref)
+	if err != nil {
+		return turnSpan{}, 0, err
+	}
+	list := turns(conversation)
+	if number > len(list) {
+		return turnSpan{}, 0, fmt.Errorf("there is no turn %s; the conversation has %d", turnRef(number), len(list))
+	}
+	return list[number-1], call, nil
+}
@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"errors"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// ErrBudgetExceeded is returned when a turn is stopped by the WithTokenBudget limit
+var ErrBudgetExceeded = errors.New("token budget exceeded")
+
+// DefaultModel is the model every request is sent to
+const DefaultModel = anthropic.ModelClaude3_7SonnetLatest
+
+// Pricing is a model's list price in US dollars per million tokens
+type Pricing struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cache_read"`
+	CacheWrite float64 `json:"cache_write"`
+}
+
+// ModelPricing holds the list prices of the models the agent uses
+var ModelPricing = map[string]Pricing{
+	string(anthropic.ModelClaude3_7SonnetLatest): {Input: 3, Output: 15, CacheRead: 0.30, CacheWrite: 3.75},
+	string(anthropic.ModelClaude3_5HaikuLatest):  {Input: 0.80, Output: 4, CacheRead: 0.08, CacheWrite: 1},
+}
+
+// ModelContextWindow holds the context window, in tokens, of the models the agent uses
+var ModelContextWindow = map[string]int64{
+	string(anthropic.ModelClaude3_7SonnetLatest): 200_000,
+	string(anthropic.ModelClaude3_5HaikuLatest):  200_000,
+}
+
+// Usage totals the model requests and tokens consumed by an Agent
+type Usage struct {
+	Requests                 int   `json:"requests"`
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+}
+
+// Total returns every token counted against the budget
+func (u Usage) Total() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+}
+
+// Cost estimates the price of the usage in US dollars at the model's list price,
+// or returns zero if the model's pricing is unknown
+func (u Usage) Cost(model string) float64 {
+	p := ModelPricing[model]
+	return (float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheReadInputTokens)*p.CacheRead +
+		float64(u.CacheCreationInputTokens)*p.CacheWrite) / 1_000_000
+}
+
+func (u *Usage) add(usage anthropic.Usage) {
+	u.Requests++
+	u.InputTokens += usage.InputTokens
+	u.OutputTokens += usage.OutputTokens
+	u.CacheReadInputTokens += usage.CacheReadInputTokens
+	u.CacheCreationInputTokens += usage.CacheCreationInputTokens
+}
+
+// Usage returns the tokens consumed so far
+func (a *Agent) Usage() Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.usage
+}
+
+func (a *Agent) addUsage(model string, usage anthropic.Usage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.countUsage(model, usage)
+	a.lastModel = model
+	// The latest request's prompt plus its reply is what the next one will carry
+	a.contextTokens = usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens + usage.OutputTokens
+}
+
+// countUsage adds a request's usage to the totals, overall and for its model. The
+// caller holds a.mu.
+func (a *Agent) countUsage(model string, usage anthropic.Usage) {
+	a.usage.add(usage)
+	if a.modelUsage == nil {
+		a.modelUsage = map[string]Usage{}
+	}
+	total := a.modelUsage[model]
+	total.add(usage)
+	a.modelUsage[model] = total
+}
@@ -0,0 +1,163 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"agent/pkg/agent"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Variant is one configuration of the agent that a bench runs the suite against
+type Variant struct {
+	Name string `yaml:"name" json:"name"`
+	// SystemPrompt is a file sent as the system prompt, relative to the bench file
+	SystemPrompt string `yaml:"system_prompt" json:"system_prompt,omitempty"`
+	// Args are extra agent flags, such as -experimental parallel_tools
+	Args []string `yaml:"args" json:"args,omitempty"`
+}
+
+// Bench compares variants on a suite, loaded from a YAML file
+type Bench struct {
+	// Suite is the suite file, relative to the bench file
+	Suite    string    `yaml:"suite"`
+	Repeat   int       `yaml:"repeat"`
+	Variants []Variant `yaml:"variants"`
+	// Dir is the directory of the bench file, which paths are relative to
+	Dir string `yaml:"-"`
+}
+
+// LoadBench reads a bench file
+func LoadBench(path string) (*Bench, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt bench '%s': %w", path, err)
+	}
+	var bench Bench
+	if err := yaml.Unmarshal(data, &bench); err != nil {
+		return nil, fmt.Errorf("failed to parse prompt bench '%s': %w", path, err)
+	}
+	bench.Dir = filepath.Dir(path)
+	if err := CheckVariants(bench.Variants); err != nil {
+		return nil, fmt.Errorf("%w in '%s'", err, path)
+	}
+	for i, v := range bench.Variants {
+		if v.SystemPrompt != "" && !filepath.IsAbs(v.SystemPrompt) {
+			bench.Variants[i].SystemPrompt = filepath.Join(bench.Dir, v.SystemPrompt)
+		}
+	}
+	if bench.Suite != "" && !filepath.IsAbs(bench.Suite) {
+		bench.Suite = filepath.Join(bench.Dir, bench.Suite)
+	}
+	return &bench, nil
+}
+
+// CheckVariants requires at least one variant, each with a unique name
+func CheckVariants(variants []Variant) error {
+	if len(variants) == 0 {
+		return errors.New("no variants")
+	}
+	seen := map[string]bool{}
+	for i, v := range variants {
+		switch {
+		case v.Name == "":
+			return fmt.Errorf("variant %d has no name", i+1)
+		case seen[v.Name]:
+			return fmt.Errorf("duplicate variant name '%s'", v.Name)
+		}
+		seen[v.Name] = true
+	}
+	return nil
+}
+
+// AgentArgs are the flags that configure the agent as the variant
+func (v Variant) AgentArgs() ([]string, error) {
+	args := v.Args
+	if v.SystemPrompt != "" {
+		abs, err := filepath.Abs(v.SystemPrompt)
+		if err != nil {
+			return nil, err
+		}
+		args = append([]string{"-system-prompt", abs}, args...)
+	}
+	return args, nil
+}
+
+// Key identifies a task run under the variant. It changes with the system prompt's
+// contents, the flags, the task, its fixture and the model, so cached results are
+// only reused for the same setup.
+func (v Variant) Key(suite *Suite, task Task) (string, error) {
+	h := sha256.New()
+	json.NewEncoder(h).Encode([]any{v.Args, task.Prompt, task.Check, task.MaxTurns, task.Timeout, agent.DefaultModel})
+	if v.SystemPrompt != "" {
+		if err := hashFile(h, v.SystemPrompt); err != nil {
+			return "", fmt.Errorf("failed to read system prompt '%s': %w", v.SystemPrompt, err)
+		}
+	}
+	fixture := filepath.Join(suite.Dir, task.Fixture)
+	err := filepath.WalkDir(fixture, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(fixture, path)
+		io.WriteString(h, filepath.ToSlash(rel)+"\x00")
+		return hashFile(h, path)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read fixture '%s': %w", fixture, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Cache keeps the results of earlier bench runs by Variant.Key, so rerunning a bench
+// after changing one variant only runs that variant
+type Cache map[string][]Result
+
+// LoadCache reads the cache at path; a missing file is an empty cache
+func LoadCache(path string) (Cache, error) {
+	cache := Cache{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bench cache '%s': %w", path, err)
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("failed to parse bench cache '%s': %w", path, err)
+	}
+	return cache, nil
+}
+
+// Save writes the cache to path
+func (c Cache) Save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bench cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for '%s': %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write bench cache '%s': %w", path, err)
+	}
+	return nil
+}
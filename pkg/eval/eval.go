@@ -0,0 +1,100 @@
+// Package eval measures the agent on a suite of tasks: each task copies a fixture
+// repository, runs the agent on a prompt and judges the result with a check command.
+package eval
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Task is one evaluation case
+type Task struct {
+	Name string `yaml:"name" json:"name"`
+	// Fixture is the directory copied as the agent's working tree, relative to the suite file
+	Fixture string `yaml:"fixture" json:"fixture"`
+	Prompt  string `yaml:"prompt" json:"prompt"`
+	// Check is a shell command run in the working tree afterwards; exit 0 means success
+	Check    string        `yaml:"check" json:"check"`
+	Timeout  time.Duration `yaml:"timeout" json:"timeout"`
+	MaxTurns int           `yaml:"max_turns" json:"max_turns"`
+}
+
+// Suite is a set of tasks loaded from a YAML file
+type Suite struct {
+	Tasks []Task `yaml:"tasks"`
+	// Dir is the directory of the suite file, which fixture paths are relative to
+	Dir string `yaml:"-"`
+}
+
+// LoadSuite reads a suite file
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read eval suite '%s': %w", path, err)
+	}
+	var suite Suite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("failed to parse eval suite '%s': %w", path, err)
+	}
+	suite.Dir = filepath.Dir(path)
+
+	seen := map[string]bool{}
+	for i, task := range suite.Tasks {
+		switch {
+		case task.Name == "":
+			return nil, fmt.Errorf("task %d in '%s' has no name", i+1, path)
+		case seen[task.Name]:
+			return nil, fmt.Errorf("duplicate task name '%s' in '%s'", task.Name, path)
+		case task.Prompt == "" || task.Check == "" || task.Fixture == "":
+			return nil, fmt.Errorf("task '%s' needs a fixture, prompt and check", task.Name)
+		}
+		seen[task.Name] = true
+	}
+	return &suite, nil
+}
+
+// Summary aggregates the runs of one task
+type Summary struct {
+	Task     string  `json:"task"`
+	Runs     int     `json:"runs"`
+	Passed   int     `json:"passed"`
+	PassRate float64 `json:"pass_rate"`
+	// Cost and Tokens are averages per run
+	Cost     float64 `json:"avg_cost_usd"`
+	Tokens   int64   `json:"avg_tokens"`
+	Duration float64 `json:"avg_duration_seconds"`
+}
+
+// Summarize groups results by task, in the order tasks first appear
+func Summarize(results []Result) []Summary {
+	var summaries []Summary
+	index := map[string]int{}
+	for _, r := range results {
+		i, ok := index[r.Task]
+		if !ok {
+			i = len(summaries)
+			index[r.Task] = i
+			summaries = append(summaries, Summary{Task: r.Task})
+		}
+		s := &summaries[i]
+		s.Runs++
+		if r.Passed {
+			s.Passed++
+		}
+		s.Cost += r.Cost
+		s.Tokens += r.Usage.Total()
+		s.Duration += r.Duration
+	}
+	for i := range summaries {
+		s := &summaries[i]
+		s.PassRate = float64(s.Passed) / float64(s.Runs)
+		s.Cost /= float64(s.Runs)
+		s.Tokens /= int64(s.Runs)
+		s.Duration /= float64(s.Runs)
+	}
+	return summaries
+}
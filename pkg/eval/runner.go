@@ -0,0 +1,205 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/pkg/agent"
+)
+
+// Result is the outcome of one run of a task
+type Result struct {
+	Task     string      `json:"task"`
+	Run      int         `json:"run"`
+	Passed   bool        `json:"passed"`
+	Usage    agent.Usage `json:"usage"`
+	Cost     float64     `json:"cost_usd"`
+	Duration float64     `json:"duration_seconds"`
+	Error    string      `json:"error,omitempty"`
+	// CheckOutput is the tail of the check command's output
+	CheckOutput string `json:"check_output,omitempty"`
+}
+
+// Runner executes suites by running the agent binary once per task run, so every
+// run gets its own working directory and process
+type Runner struct {
+	// Executable is the agent binary
+	Executable string
+	// Repeat runs each task this many times to measure a pass rate
+	Repeat      int
+	Concurrency int
+	// Timeout applies to tasks that do not set their own
+	Timeout time.Duration
+	// Chaos, if above zero, injects faults into this fraction of the agent's API
+	// requests and tool calls, seeded by the run number
+	Chaos float64
+	// Args are extra agent flags, after and so overriding the runner's own
+	Args []string
+	// Progress, if set, is called as each run finishes
+	Progress func(Result)
+}
+
+// Run executes every task Repeat times and returns the results in task order
+func (r *Runner) Run(ctx context.Context, suite *Suite) []Result {
+	repeat := max(r.Repeat, 1)
+	results := make([]Result, len(suite.Tasks)*repeat)
+	sem := make(chan struct{}, max(r.Concurrency, 1))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i, task := range suite.Tasks {
+		for run := range repeat {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				result := r.runTask(ctx, suite, task, run+1)
+				result.Run = run + 1
+				results[i*repeat+run] = result
+				if r.Progress != nil {
+					mu.Lock()
+					r.Progress(result)
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+func (r *Runner) runTask(ctx context.Context, suite *Suite, task Task, run int) Result {
+	start := time.Now()
+	result := Result{Task: task.Name}
+	fail := func(err error) Result {
+		result.Error = err.Error()
+		result.Duration = time.Since(start).Seconds()
+		return result
+	}
+
+	timeout := task.Timeout
+	if timeout == 0 {
+		timeout = r.Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	dir, err := os.MkdirTemp("", "agent-eval-*")
+	if err != nil {
+		return fail(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := copyFixture(filepath.Join(suite.Dir, task.Fixture), dir); err != nil {
+		return fail(err)
+	}
+	// The usage report lives outside the working tree so the check never sees it
+	usageFile := dir + ".usage.json"
+	defer os.Remove(usageFile)
+
+	args := []string{"-p", task.Prompt, "-session-store", "", "-context", "", "-audit-log", "", "-artifacts", "", "-probe=false", "-usage-file", usageFile}
+	if task.MaxTurns > 0 {
+		args = append(args, "-max-turns", strconv.Itoa(task.MaxTurns))
+	}
+	if r.Chaos > 0 {
+		args = append(args, "-chaos", strconv.FormatFloat(r.Chaos, 'f', -1, 64), "-chaos-seed", strconv.Itoa(run))
+	}
+	args = append(args, r.Args...)
+	cmd := exec.CommandContext(ctx, r.Executable, args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	if data, err := os.ReadFile(usageFile); err == nil {
+		json.Unmarshal(data, &result.Usage)
+	}
+	result.Cost = result.Usage.Cost(string(agent.DefaultModel))
+	if runErr != nil {
+		if ctx.Err() != nil {
+			return fail(fmt.Errorf("timed out after %s", timeout))
+		}
+		return fail(fmt.Errorf("agent failed: %w: %s", runErr, lastLine(stderr.String())))
+	}
+
+	check := exec.CommandContext(ctx, "sh", "-c", task.Check)
+	check.Dir = dir
+	out, err := check.CombinedOutput()
+	result.Passed = err == nil
+	if !result.Passed {
+		result.CheckOutput = tail(string(out), 2000)
+	}
+	result.Duration = time.Since(start).Seconds()
+	return result
+}
+
+// copyFixture copies the fixture into dir and commits it, so the agent sees a clean
+// git repository just as it would in a real project
+func copyFixture(fixture, dir string) error {
+	err := filepath.WalkDir(fixture, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(fixture, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy fixture '%s': %w", fixture, err)
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=eval", "-c", "user.email=eval@localhost", "commit", "-qm", "Fixture"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set up fixture repository: git %s: %s", strings.Join(args, " "), out)
+		}
+	}
+	return nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	return s[strings.LastIndex(s, "\n")+1:]
+}
+
+func tail(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		return "..." + s[len(s)-n:]
+	}
+	return s
+}
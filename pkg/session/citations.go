@@ -0,0 +1,240 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// CitationPattern matches the references the model cites tool results with, such
+	// as [t3.2] or [t3.2, t4.1]
+	CitationPattern = regexp.MustCompile(`\[(t\d+\.\d+(?:,\s*t\d+\.\d+)*)\]`)
+	// refPrefix matches the reference a tool result is labelled with for the model
+	refPrefix = regexp.MustCompile(`^\[(t\d+\.\d+)\] `)
+	// sentencePattern splits text into sentences, roughly: up to punctuation followed
+	// by a space, or the end of the line
+	sentencePattern = regexp.MustCompile(`[^\n]*?(?:[.!?]+(?:\s|$)|\n|$)`)
+	// evidencePattern matches what a claim can be traced back by: code spans, paths
+	// and file names, identifiers and longer numbers
+	evidencePattern = regexp.MustCompile("`([^`]+)`|\\b([\\w./-]*[\\w-]\\.[A-Za-z]{1,5})\\b|\\b([A-Za-z]+[a-z0-9][A-Z_]\\w*|[a-z]+_\\w+)\\b|\\b(\\d{3,})\\b")
+)
+
+// maxFootnoteExcerpt is how much of the cited output a footnote quotes
+const maxFootnoteExcerpt = 100
+
+// toolCall is a tool call of the conversation, with the result it got
+type toolCall struct {
+	ref, name string
+	input     json.RawMessage
+	result    string
+	turn      int
+}
+
+// footnote is a citation of a tool call in the transcript
+type footnote struct {
+	call     *toolCall
+	inferred bool
+	// evidence is what an inferred claim shares with the call
+	evidence []string
+}
+
+// CitedTranscript renders the conversation like Transcript, with each tool call
+// labelled with its reference, t3.2 for the second call of turn 3. The claims in the
+// model's replies are given footnotes to the tool results they drew on: the ones the
+// model cited, and, for claims without a citation, those that mention the same paths,
+// identifiers or numbers.
+func (s *Session) CitedTranscript(maxResult int) string {
+	calls, byID := s.toolCalls()
+	var b strings.Builder
+	n, turn := 0, 0
+	for _, message := range s.Messages {
+		if startsTurn(message) {
+			turn++
+		}
+		for _, block := range message.Content {
+			switch block.Type {
+			case "text":
+				if message.Role != "assistant" {
+					fmt.Fprintf(&b, "%s: %s\n\n", message.Role, block.Text)
+					break
+				}
+				text, notes := cite(block.Text, calls, turn, &n)
+				fmt.Fprintf(&b, "%s: %s\n\n", message.Role, text)
+				for i, note := range notes {
+					call := note.call
+					how := ""
+					if note.inferred {
+						how = ", inferred from " + strings.Join(note.evidence, ", ")
+					}
+					fmt.Fprintf(&b, "  [%d] %s %s(%s)%s: %s\n", n-len(notes)+i+1, call.ref, call.name, compactInput(call.input), how, excerpt(call.result, note.evidence))
+				}
+				if len(notes) > 0 {
+					b.WriteString("\n")
+				}
+			case "tool_use":
+				ref := ""
+				if call := byID[block.ID]; call != nil {
+					ref = " [" + call.ref + "]"
+				}
+				fmt.Fprintf(&b, "%s called %s(%s)%s\n\n", message.Role, block.Name, block.Input, ref)
+			case "tool_result":
+				text := refPrefix.ReplaceAllString(block.Text, "")
+				if len(text) > maxResult {
+					text = text[:maxResult] + "..."
+				}
+				ref := ""
+				if call := byID[block.ToolUseID]; call != nil {
+					ref = " [" + call.ref + "]"
+				}
+				fmt.Fprintf(&b, "tool result%s: %s\n\n", ref, text)
+			}
+		}
+	}
+	return b.String()
+}
+
+// toolCalls lists the conversation's tool calls in order, and indexes them by ID. A
+// call is referenced by the label its result carries, or else by its place in the turn.
+func (s *Session) toolCalls() ([]*toolCall, map[string]*toolCall) {
+	var calls []*toolCall
+	byID := map[string]*toolCall{}
+	turn, inTurn := 0, 0
+	for _, message := range s.Messages {
+		if startsTurn(message) {
+			turn, inTurn = turn+1, 0
+		}
+		for _, block := range message.Content {
+			switch block.Type {
+			case "tool_use":
+				inTurn++
+				call := &toolCall{ref: fmt.Sprintf("t%d.%d", turn, inTurn), name: block.Name, input: block.Input, turn: turn}
+				calls = append(calls, call)
+				byID[block.ID] = call
+			case "tool_result":
+				if call := byID[block.ToolUseID]; call != nil {
+					if m := refPrefix.FindStringSubmatch(block.Text); m != nil {
+						call.ref = m[1]
+					}
+					call.result = refPrefix.ReplaceAllString(block.Text, "")
+				}
+			}
+		}
+	}
+	return calls, byID
+}
+
+// startsTurn reports whether message is one the user began a turn with, rather than
+// one carrying tool results
+func startsTurn(message Message) bool {
+	return message.Role == "user" && !slices.ContainsFunc(message.Content, func(block Block) bool { return block.Type == "tool_result" })
+}
+
+// cite replaces the model's citations in text with footnote numbers continuing from
+// *n and adds footnotes to uncited sentences from the calls of turn they draw on
+func cite(text string, calls []*toolCall, turn int, n *int) (string, []footnote) {
+	byRef := map[string]*toolCall{}
+	var candidates []*toolCall
+	for _, call := range calls {
+		byRef[call.ref] = call
+		if call.turn == turn && call.result != "" {
+			candidates = append(candidates, call)
+		}
+	}
+	var notes []footnote
+	add := func(note footnote) string {
+		for i, existing := range notes {
+			if existing.call == note.call {
+				return fmt.Sprintf("[%d]", *n-len(notes)+i+1)
+			}
+		}
+		notes = append(notes, note)
+		*n++
+		return fmt.Sprintf("[%d]", *n)
+	}
+	return sentencePattern.ReplaceAllStringFunc(text, func(sentence string) string {
+		if CitationPattern.MatchString(sentence) {
+			return CitationPattern.ReplaceAllStringFunc(sentence, func(match string) string {
+				var marks []string
+				for _, ref := range strings.Split(CitationPattern.FindStringSubmatch(match)[1], ",") {
+					if call := byRef[strings.TrimSpace(ref)]; call != nil {
+						marks = append(marks, add(footnote{call: call}))
+					}
+				}
+				if len(marks) == 0 {
+					return match
+				}
+				return strings.Join(marks, "")
+			})
+		}
+		call, evidence := bestEvidence(sentence, candidates)
+		if call == nil {
+			return sentence
+		}
+		trimmed := strings.TrimRight(sentence, " \t\n")
+		return trimmed + add(footnote{call: call, inferred: true, evidence: evidence}) + sentence[len(trimmed):]
+	}), notes
+}
+
+// bestEvidence returns the call whose input or result mentions the most of what the
+// sentence refers to, latest first on a tie, and what they share
+func bestEvidence(sentence string, calls []*toolCall) (*toolCall, []string) {
+	var terms []string
+	for _, m := range evidencePattern.FindAllStringSubmatch(sentence, -1) {
+		for _, group := range m[1:] {
+			if len(group) >= 3 && !slices.Contains(terms, group) {
+				terms = append(terms, group)
+			}
+		}
+	}
+	var best *toolCall
+	var shared []string
+	for i := len(calls) - 1; i >= 0; i-- {
+		var found []string
+		for _, term := range terms {
+			if strings.Contains(calls[i].result, term) || strings.Contains(string(calls[i].input), term) {
+				found = append(found, term)
+			}
+		}
+		if len(found) > len(shared) {
+			best, shared = calls[i], found
+		}
+	}
+	return best, shared
+}
+
+// compactInput abbreviates a tool call's input to its path or first value
+func compactInput(input json.RawMessage) string {
+	var fields map[string]any
+	if json.Unmarshal(input, &fields) == nil {
+		for _, key := range []string{"path", "query", "command", "name"} {
+			if value, ok := fields[key].(string); ok {
+				return value
+			}
+		}
+	}
+	if len(input) > 40 {
+		return string(input[:40]) + "..."
+	}
+	return string(input)
+}
+
+// excerpt quotes the first line of result that mentions the evidence, or else its
+// first line
+func excerpt(result string, evidence []string) string {
+	lines := strings.Split(strings.TrimSpace(result), "\n")
+	line := lines[0]
+	for _, l := range lines {
+		if slices.ContainsFunc(evidence, func(term string) bool { return strings.Contains(l, term) }) {
+			line = l
+			break
+		}
+	}
+	line = strings.TrimSpace(line)
+	if len(line) > maxFootnoteExcerpt {
+		line = line[:maxFootnoteExcerpt] + "..."
+	}
+	return fmt.Sprintf("%q", line)
+}
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// CompressedStore gzips session contents before handing them to another Store. Wrap
+// it around an EncryptedStore, not inside one, since encrypted data does not compress.
+// Reading compressed sessions does not need it: the stores in this package detect
+// and decompress them.
+type CompressedStore struct {
+	inner Store
+}
+
+// NewCompressedStore wraps inner so sessions are stored compressed
+func NewCompressedStore(inner Store) *CompressedStore {
+	return &CompressedStore{inner: inner}
+}
+
+// Load reads and decompresses a session. Uncompressed sessions are returned as they are.
+func (c *CompressedStore) Load(ctx context.Context, id string) (*Session, error) {
+	s, err := c.inner.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return inflate(s)
+}
+
+// loadSealed lets an EncryptedStore wrapped around this one open sealed sessions
+func (c *CompressedStore) loadSealed(ctx context.Context, id string) (*Session, error) {
+	s, err := loadSealed(ctx, c.inner, id)
+	if err != nil {
+		return nil, err
+	}
+	return inflate(s)
+}
+
+// inflate returns the session s holds compressed, or s itself if it is not compressed
+func inflate(s *Session) (*Session, error) {
+	if s.Compressed == nil {
+		return s, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(s.Compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress session '%s': %w", s.ID, err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress session '%s': %w", s.ID, err)
+	}
+	var opened Session
+	if err := json.Unmarshal(data, &opened); err != nil {
+		return nil, fmt.Errorf("failed to decode session '%s': %w", s.ID, err)
+	}
+	return &opened, nil
+}
+
+// Save compresses the session and saves it to the wrapped store
+func (c *CompressedStore) Save(ctx context.Context, s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode session '%s': %w", s.ID, err)
+	}
+	var buf bytes.Buffer
+	writer, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("failed to compress session '%s': %w", s.ID, err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to compress session '%s': %w", s.ID, err)
+	}
+	return c.inner.Save(ctx, &Session{
+		ID:         s.ID,
+		CreatedAt:  s.CreatedAt,
+		UpdatedAt:  s.UpdatedAt,
+		Compressed: buf.Bytes(),
+	})
+}
+
+// List returns the IDs of all stored sessions
+func (c *CompressedStore) List(ctx context.Context) ([]string, error) {
+	return c.inner.List(ctx)
+}
+
+// Delete removes the session with the given ID
+func (c *CompressedStore) Delete(ctx context.Context, id string) error {
+	return c.inner.Delete(ctx, id)
+}
@@ -0,0 +1,175 @@
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// pbkdf2Iterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256
+const pbkdf2Iterations = 600_000
+
+// Sealed is the encrypted form of a session's contents. Only the ID and timestamps
+// stay readable so stores can still index and list sessions.
+type Sealed struct {
+	// Salt is set when the key was derived from a passphrase
+	Salt  []byte `json:"salt,omitempty"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// EncryptedStore encrypts sessions with AES-256-GCM before handing them to another Store
+type EncryptedStore struct {
+	inner Store
+
+	// Exactly one of key and passphrase is set
+	key        []byte
+	passphrase string
+	salt       []byte
+
+	mu      sync.Mutex
+	derived map[string][]byte
+}
+
+// NewEncryptedStore wraps inner so sessions are encrypted with a 32-byte key
+func NewEncryptedStore(inner Store, key []byte) (*EncryptedStore, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("session key must be 32 bytes, got %d", len(key))
+	}
+	return &EncryptedStore{inner: inner, key: key}, nil
+}
+
+// NewPassphraseStore wraps inner so sessions are encrypted with a key derived from passphrase
+func NewPassphraseStore(inner Store, passphrase string) (*EncryptedStore, error) {
+	if passphrase == "" {
+		return nil, errors.New("session passphrase is empty")
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return &EncryptedStore{inner: inner, passphrase: passphrase, salt: salt, derived: map[string][]byte{}}, nil
+}
+
+// keyFor returns the key for a sealed session, deriving it from the passphrase with
+// salt if needed. Derived keys are cached because derivation is deliberately slow.
+func (e *EncryptedStore) keyFor(salt []byte) ([]byte, error) {
+	if e.key != nil {
+		return e.key, nil
+	}
+	if len(salt) == 0 {
+		return nil, errors.New("session was not sealed with a passphrase")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if key, ok := e.derived[string(salt)]; ok {
+		return key, nil
+	}
+	key, err := pbkdf2.Key(sha256.New, e.passphrase, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive session key: %w", err)
+	}
+	e.derived[string(salt)] = key
+	return key, nil
+}
+
+// sealedLoader is a Store that can return sessions still sealed, for an
+// EncryptedStore to open
+type sealedLoader interface {
+	loadSealed(ctx context.Context, id string) (*Session, error)
+}
+
+// loadSealed loads a session from store without refusing it for being sealed
+func loadSealed(ctx context.Context, store Store, id string) (*Session, error) {
+	if loader, ok := store.(sealedLoader); ok {
+		return loader.loadSealed(ctx, id)
+	}
+	return store.Load(ctx, id)
+}
+
+// unsealed returns s, or ErrEncrypted if it is sealed
+func unsealed(s *Session) (*Session, error) {
+	if s.Sealed != nil {
+		return nil, fmt.Errorf("%w: session '%s' can only be loaded with its key or passphrase", ErrEncrypted, s.ID)
+	}
+	return s, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Load reads and decrypts a session. Sessions saved before encryption was enabled
+// are returned as they are and get encrypted on their next save.
+func (e *EncryptedStore) Load(ctx context.Context, id string) (*Session, error) {
+	s, err := loadSealed(ctx, e.inner, id)
+	if err != nil || s.Sealed == nil {
+		return s, err
+	}
+	key, err := e.keyFor(s.Sealed.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt session '%s': %w", id, err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt session '%s': %w", id, err)
+	}
+	data, err := gcm.Open(nil, s.Sealed.Nonce, s.Sealed.Data, []byte(s.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt session '%s': wrong key or passphrase, or the data was modified", id)
+	}
+	var opened Session
+	if err := json.Unmarshal(data, &opened); err != nil {
+		return nil, fmt.Errorf("failed to decode session '%s': %w", id, err)
+	}
+	// Sessions are compressed before they are encrypted
+	return inflate(&opened)
+}
+
+// Save encrypts the session and saves it to the wrapped store. The session ID is
+// authenticated so a sealed session cannot be swapped in under another ID.
+func (e *EncryptedStore) Save(ctx context.Context, s *Session) error {
+	key, err := e.keyFor(e.salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt session '%s': %w", s.ID, err)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode session '%s': %w", s.ID, err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return e.inner.Save(ctx, &Session{
+		ID:        s.ID,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+		Sealed:    &Sealed{Salt: e.salt, Nonce: nonce, Data: gcm.Seal(nil, nonce, data, []byte(s.ID))},
+	})
+}
+
+// List returns the IDs of all stored sessions
+func (e *EncryptedStore) List(ctx context.Context) ([]string, error) {
+	return e.inner.List(ctx)
+}
+
+// Delete removes the session with the given ID
+func (e *EncryptedStore) Delete(ctx context.Context, id string) error {
+	return e.inner.Delete(ctx, id)
+}
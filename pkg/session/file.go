@@ -0,0 +1,130 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileStore keeps one JSON file per session in a local directory
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore creates a FileStore rooted at dir
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{Dir: dir}
+}
+
+func (f *FileStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid session id '%s'", id)
+	}
+	return filepath.Join(f.Dir, id+".json"), nil
+}
+
+// Load reads the session with the given ID
+func (f *FileStore) Load(ctx context.Context, id string) (*Session, error) {
+	s, err := f.loadSealed(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return unsealed(s)
+}
+
+// loadSealed reads a session, leaving it sealed if it was saved encrypted
+func (f *FileStore) loadSealed(_ context.Context, id string) (*Session, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session '%s': %w", id, err)
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode session '%s': %w", id, err)
+	}
+	return inflate(&s)
+}
+
+// Save writes the session atomically so a crash never leaves a truncated file
+func (f *FileStore) Save(_ context.Context, s *Session) error {
+	path, err := f.path(s.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create session directory '%s': %w", f.Dir, err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session '%s': %w", s.ID, err)
+	}
+
+	tmp, err := os.CreateTemp(f.Dir, s.ID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for session '%s': %w", s.ID, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session '%s': %w", s.ID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session '%s': %w", s.ID, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save session '%s': %w", s.ID, err)
+	}
+	return nil
+}
+
+// List returns the IDs of all stored sessions, oldest first
+func (f *FileStore) List(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(f.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions in '%s': %w", f.Dir, err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Delete removes the session with the given ID
+func (f *FileStore) Delete(_ context.Context, id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete session '%s': %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package session
+
+import (
+	"context"
+	"strings"
+)
+
+// Open returns the Store described by location: a redis:// or postgres:// URL,
+// or otherwise a local directory path (optionally prefixed with file://)
+func Open(ctx context.Context, location string) (Store, error) {
+	switch {
+	case strings.HasPrefix(location, "redis://"):
+		return NewRedisStore(location)
+	case strings.HasPrefix(location, "postgres://"), strings.HasPrefix(location, "postgresql://"):
+		return NewPostgresStore(ctx, location)
+	default:
+		return NewFileStore(strings.TrimPrefix(location, "file://")), nil
+	}
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresStore keeps sessions in a Postgres table so several agent processes can share them
+type PostgresStore struct {
+	db *sql.DB
+}
+
+const createSessionsTable = `CREATE TABLE IF NOT EXISTS agent_sessions (
+	id         TEXT PRIMARY KEY,
+	data       JSONB NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+)`
+
+// NewPostgresStore connects to the database at dsn and creates the sessions table if needed
+func NewPostgresStore(ctx context.Context, dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres connection: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, createSessionsTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create sessions table: %w", err)
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+// Close releases the underlying connection pool
+func (p *PostgresStore) Close() error {
+	return p.db.Close()
+}
+
+// Load reads the session with the given ID
+func (p *PostgresStore) Load(ctx context.Context, id string) (*Session, error) {
+	s, err := p.loadSealed(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return unsealed(s)
+}
+
+// loadSealed reads a session, leaving it sealed if it was saved encrypted
+func (p *PostgresStore) loadSealed(ctx context.Context, id string) (*Session, error) {
+	var data []byte
+	err := p.db.QueryRowContext(ctx, `SELECT data FROM agent_sessions WHERE id = $1`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session '%s': %w", id, err)
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode session '%s': %w", id, err)
+	}
+	return inflate(&s)
+}
+
+// Save writes the session, replacing any previous version
+func (p *PostgresStore) Save(ctx context.Context, s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode session '%s': %w", s.ID, err)
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO agent_sessions (id, data, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at`,
+		s.ID, data, s.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save session '%s': %w", s.ID, err)
+	}
+	return nil
+}
+
+// List returns the IDs of all stored sessions, oldest first
+func (p *PostgresStore) List(ctx context.Context) ([]string, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT id FROM agent_sessions ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Delete removes the session with the given ID
+func (p *PostgresStore) Delete(ctx context.Context, id string) error {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM agent_sessions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete session '%s': %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+)
+
+// Redacted replaces text removed by Redact and Scrubbed
+const Redacted = "[redacted]"
+
+// SecretPattern matches API keys, tokens and private keys that might appear in tool
+// output, commands or pasted logs
+var SecretPattern = regexp.MustCompile(`(sk-ant-[A-Za-z0-9_-]+|gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,}|` +
+	`xox[abposr]-[A-Za-z0-9-]{10,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35}|` +
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----|` +
+	`(?i)bearer [A-Za-z0-9._~+/-]{20,}=*|(?i)(api[_-]?key|token|password|secret)=\S+)`)
+
+// Redact replaces every match of the regular expression pattern in the session's
+// messages, summaries and notes with Redacted, and records the pattern so exports
+// remove it from anything added later. It returns the number of replacements.
+func (s *Session) Redact(pattern string) (int, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	}
+	n := s.replace([]*regexp.Regexp{re})
+	if !slices.Contains(s.Redactions, pattern) {
+		s.Redactions = append(s.Redactions, pattern)
+	}
+	return n, nil
+}
+
+// Scrubbed returns a copy of the session for sharing, with the patterns recorded by
+// Redact, the extra patterns and anything matching SecretPattern replaced
+func (s *Session) Scrubbed(extra []string) (*Session, error) {
+	patterns := []*regexp.Regexp{SecretPattern}
+	for _, pattern := range append(slices.Clone(s.Redactions), extra...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+	scrubbed := *s
+	scrubbed.Messages = make([]Message, len(s.Messages))
+	for i, message := range s.Messages {
+		scrubbed.Messages[i] = Message{Role: message.Role, Content: slices.Clone(message.Content)}
+	}
+	scrubbed.Scratchpad = maps.Clone(s.Scratchpad)
+	scrubbed.replace(patterns)
+	return &scrubbed, nil
+}
+
+// replace substitutes Redacted for the matches of patterns in every text the session
+// holds, returning how many there were
+func (s *Session) replace(patterns []*regexp.Regexp) int {
+	n := 0
+	text := func(t string) string {
+		for _, re := range patterns {
+			t = re.ReplaceAllStringFunc(t, func(string) string {
+				n++
+				return Redacted
+			})
+		}
+		return t
+	}
+	for i := range s.Messages {
+		for j := range s.Messages[i].Content {
+			block := &s.Messages[i].Content[j]
+			block.Text = text(block.Text)
+			if len(block.Input) > 0 {
+				block.Input = redactJSON(block.Input, text)
+			}
+		}
+	}
+	s.Summary, s.Seed, s.Kept = text(s.Summary), text(s.Seed), text(s.Kept)
+	if len(s.Pending) > 0 {
+		s.Pending = redactJSON(s.Pending, text)
+	}
+	for key, note := range s.Scratchpad {
+		s.Scratchpad[key] = text(note)
+	}
+	return n
+}
+
+// redactJSON applies text to each string in a tool input, keys included, so the
+// result is still valid JSON whatever the patterns match
+func redactJSON(input json.RawMessage, text func(string) string) json.RawMessage {
+	var value any
+	if err := json.Unmarshal(input, &value); err != nil {
+		return json.RawMessage(fmt.Sprintf("%q", text(string(input))))
+	}
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			return text(v)
+		case []any:
+			for i := range v {
+				v[i] = walk(v[i])
+			}
+		case map[string]any:
+			scrubbed := make(map[string]any, len(v))
+			for key, item := range v {
+				scrubbed[text(key)] = walk(item)
+			}
+			return scrubbed
+		}
+		return v
+	}
+	data, err := json.Marshal(walk(value))
+	if err != nil {
+		return input
+	}
+	return data
+}
@@ -0,0 +1,240 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RedisStore keeps sessions in Redis so several agent processes can share them.
+// It speaks just enough of the RESP protocol for GET/SET/DEL/SCAN and opens a
+// connection per operation, which is plenty for one save per turn.
+type RedisStore struct {
+	addr     string
+	username string
+	password string
+	db       int
+	prefix   string
+}
+
+// NewRedisStore creates a RedisStore from a URL of the form
+// redis://[user:password@]host[:port][/db]
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported redis url scheme '%s'", u.Scheme)
+	}
+
+	store := &RedisStore{addr: u.Host, prefix: "agent:session:"}
+	if u.Port() == "" {
+		store.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		store.username = u.User.Username()
+		store.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		store.db, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database '%s': %w", db, err)
+		}
+	}
+	return store, nil
+}
+
+// Load reads the session with the given ID
+func (r *RedisStore) Load(ctx context.Context, id string) (*Session, error) {
+	s, err := r.loadSealed(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return unsealed(s)
+}
+
+// loadSealed reads a session, leaving it sealed if it was saved encrypted
+func (r *RedisStore) loadSealed(ctx context.Context, id string) (*Session, error) {
+	reply, err := r.do(ctx, "GET", r.prefix+id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session '%s': %w", id, err)
+	}
+	if reply == nil {
+		return nil, ErrNotFound
+	}
+	data, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("failed to load session '%s': unexpected reply %T", id, reply)
+	}
+
+	var s Session
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		return nil, fmt.Errorf("failed to decode session '%s': %w", id, err)
+	}
+	return inflate(&s)
+}
+
+// Save writes the session, replacing any previous version
+func (r *RedisStore) Save(ctx context.Context, s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode session '%s': %w", s.ID, err)
+	}
+	if _, err := r.do(ctx, "SET", r.prefix+s.ID, string(data)); err != nil {
+		return fmt.Errorf("failed to save session '%s': %w", s.ID, err)
+	}
+	return nil
+}
+
+// List returns the IDs of all stored sessions, oldest first
+func (r *RedisStore) List(ctx context.Context) ([]string, error) {
+	var ids []string
+	cursor := "0"
+	for {
+		reply, err := r.do(ctx, "SCAN", cursor, "MATCH", r.prefix+"*", "COUNT", "100")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("failed to list sessions: unexpected reply %v", reply)
+		}
+		cursor, _ = parts[0].(string)
+		keys, _ := parts[1].([]any)
+		for _, key := range keys {
+			if name, ok := key.(string); ok {
+				ids = append(ids, strings.TrimPrefix(name, r.prefix))
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Delete removes the session with the given ID
+func (r *RedisStore) Delete(ctx context.Context, id string) error {
+	reply, err := r.do(ctx, "DEL", r.prefix+id)
+	if err != nil {
+		return fmt.Errorf("failed to delete session '%s': %w", id, err)
+	}
+	if n, _ := reply.(int64); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do opens a connection, authenticates, selects the database and runs a single command
+func (r *RedisStore) do(ctx context.Context, args ...string) (any, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	call := func(args ...string) (any, error) {
+		if err := writeCommand(conn, args); err != nil {
+			return nil, err
+		}
+		return readReply(reader)
+	}
+
+	if r.password != "" {
+		authArgs := []string{"AUTH", r.password}
+		if r.username != "" {
+			authArgs = []string{"AUTH", r.username, r.password}
+		}
+		if _, err := call(authArgs...); err != nil {
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := call("SELECT", strconv.Itoa(r.db)); err != nil {
+			return nil, err
+		}
+	}
+	return call(args...)
+}
+
+func writeCommand(w io.Writer, args []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// readReply decodes one RESP reply: strings, integers, nil, arrays or a redisError
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			item, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+	}
+}
@@ -0,0 +1,240 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// ErrNotFound is returned by a Store when no session exists with the requested ID
+var ErrNotFound = errors.New("session not found")
+
+// ErrEncrypted is returned when loading a session saved through an EncryptedStore
+// without one, instead of the empty session its readable fields would make
+var ErrEncrypted = errors.New("session is encrypted")
+
+// Store persists sessions so they can be resumed, possibly by another process. The
+// stores in this package decompress sessions saved through a CompressedStore on
+// their own, and fail with ErrEncrypted for sessions saved through an EncryptedStore.
+type Store interface {
+	Load(ctx context.Context, id string) (*Session, error)
+	Save(ctx context.Context, s *Session) error
+	List(ctx context.Context) ([]string, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Session is a persisted conversation
+type Session struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Messages  []Message `json:"messages"`
+	// Summary is a cached, compacted account of the first SummaryCovers messages
+	Summary       string `json:"summary,omitempty"`
+	SummaryCovers int    `json:"summary_covers,omitempty"`
+	// SeededFrom and Seed record the earlier session this one continues and the
+	// summary of it that is given to the model in place of the full transcript
+	SeededFrom string `json:"seeded_from,omitempty"`
+	Seed       string `json:"seed,omitempty"`
+	// Marks are the turns and tool calls, such as t4 or t4.2, the user tagged with /mark
+	// so that compaction keeps them word for word
+	Marks []string `json:"marks,omitempty"`
+	// Kept holds the marked items of the earlier session this one continues, verbatim
+	Kept string `json:"kept,omitempty"`
+	// Files records each version of a file the tools read or wrote, in order
+	Files []FileVersion `json:"files,omitempty"`
+	// Labels tag the session for cost attribution, such as billing:team-x
+	Labels []string `json:"labels,omitempty"`
+	// Spend totals the tokens used by each set of labels and model during the session
+	Spend []Spend `json:"spend,omitempty"`
+	// Redactions are the patterns removed with /redact, removed again on export
+	Redactions []string `json:"redactions,omitempty"`
+	// Scratchpad holds the notes the model parked with scratchpad_write, by key
+	Scratchpad map[string]string `json:"scratchpad,omitempty"`
+	// Pending is the model response, as the API returned it, whose changes were
+	// waiting for review when the session was saved, so resuming puts them to review
+	Pending json.RawMessage `json:"pending,omitempty"`
+	// HandedOff records where and when the session was handed on with /handoff
+	HandedOff *Handoff `json:"handed_off,omitempty"`
+	// Sealed holds everything above except the ID and timestamps, encrypted, when the
+	// session was saved through an EncryptedStore
+	Sealed *Sealed `json:"sealed,omitempty"`
+	// Compressed likewise holds the gzipped contents when saved through a CompressedStore
+	Compressed []byte `json:"compressed,omitempty"`
+}
+
+// Handoff is the machine that handed a session on and when
+type Handoff struct {
+	Host string    `json:"host"`
+	At   time.Time `json:"at"`
+}
+
+// FileVersion is one version of a file as a tool read or wrote it during turn Ref.
+// The content is stored apart from the session, under its SHA-256 Hash.
+type FileVersion struct {
+	Path  string    `json:"path"`
+	Ref   string    `json:"ref"`
+	Hash  string    `json:"hash"`
+	Wrote bool      `json:"wrote,omitempty"`
+	Lines int       `json:"lines"`
+	Time  time.Time `json:"time"`
+}
+
+// Spend is the tokens used while the session carried Labels, on Model
+type Spend struct {
+	Labels                   []string `json:"labels,omitempty"`
+	Model                    string   `json:"model"`
+	Requests                 int      `json:"requests"`
+	InputTokens              int64    `json:"input_tokens"`
+	OutputTokens             int64    `json:"output_tokens"`
+	CacheReadInputTokens     int64    `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int64    `json:"cache_creation_input_tokens"`
+}
+
+// Message is the storage form of a conversation message. The SDK's param types
+// marshal to JSON but cannot be decoded again, so sessions keep their own copy.
+type Message struct {
+	Role    string  `json:"role"`
+	Content []Block `json:"content"`
+}
+
+// Block is the storage form of a single content block
+type Block struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// New creates an empty session with a fresh ID
+func New() *Session {
+	now := time.Now().UTC()
+	return &Session{
+		ID:        NewID(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// NewID returns a sortable, collision-resistant session identifier
+func NewID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("session: failed to read random bytes: %v", err))
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// Transcript renders the conversation as plain text, abbreviating tool results to
+// maxResult bytes each
+func (s *Session) Transcript(maxResult int) string {
+	var b strings.Builder
+	for _, message := range s.Messages {
+		for _, block := range message.Content {
+			switch block.Type {
+			case "text":
+				fmt.Fprintf(&b, "%s: %s\n\n", message.Role, block.Text)
+			case "tool_use":
+				fmt.Fprintf(&b, "%s called %s(%s)\n\n", message.Role, block.Name, block.Input)
+			case "tool_result":
+				text := block.Text
+				if len(text) > maxResult {
+					text = text[:maxResult] + "..."
+				}
+				fmt.Fprintf(&b, "tool result: %s\n\n", text)
+			}
+		}
+	}
+	return b.String()
+}
+
+// SetConversation replaces the session's messages with the given conversation
+func (s *Session) SetConversation(conversation []anthropic.MessageParam) {
+	s.Messages = FromParams(conversation)
+	s.UpdatedAt = time.Now().UTC()
+}
+
+// Conversation returns the session's messages in the form the API expects
+func (s *Session) Conversation() []anthropic.MessageParam {
+	return ToParams(s.Messages)
+}
+
+// FromParams converts API message params into their storage form
+func FromParams(params []anthropic.MessageParam) []Message {
+	messages := make([]Message, 0, len(params))
+	for _, param := range params {
+		message := Message{Role: string(param.Role)}
+		for _, block := range param.Content {
+			switch {
+			case block.OfRequestTextBlock != nil:
+				message.Content = append(message.Content, Block{Type: "text", Text: block.OfRequestTextBlock.Text})
+			case block.OfRequestToolUseBlock != nil:
+				input, err := json.Marshal(block.OfRequestToolUseBlock.Input)
+				if err != nil {
+					input = json.RawMessage("{}")
+				}
+				message.Content = append(message.Content, Block{
+					Type:  "tool_use",
+					ID:    block.OfRequestToolUseBlock.ID,
+					Name:  block.OfRequestToolUseBlock.Name,
+					Input: input,
+				})
+			case block.OfRequestToolResultBlock != nil:
+				result := block.OfRequestToolResultBlock
+				var text string
+				for _, content := range result.Content {
+					if content.OfRequestTextBlock != nil {
+						text += content.OfRequestTextBlock.Text
+					}
+				}
+				message.Content = append(message.Content, Block{
+					Type:      "tool_result",
+					ToolUseID: result.ToolUseID,
+					Text:      text,
+					IsError:   result.IsError.Value,
+				})
+			}
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// ToParams converts stored messages back into API message params
+func ToParams(messages []Message) []anthropic.MessageParam {
+	params := make([]anthropic.MessageParam, 0, len(messages))
+	for _, message := range messages {
+		var blocks []anthropic.ContentBlockParamUnion
+		for _, block := range message.Content {
+			switch block.Type {
+			case "text":
+				blocks = append(blocks, anthropic.NewTextBlock(block.Text))
+			case "tool_use":
+				blocks = append(blocks, anthropic.ContentBlockParamUnion{
+					OfRequestToolUseBlock: &anthropic.ToolUseBlockParam{
+						ID:    block.ID,
+						Name:  block.Name,
+						Input: block.Input,
+					},
+				})
+			case "tool_result":
+				blocks = append(blocks, anthropic.NewToolResultBlock(block.ToolUseID, block.Text, block.IsError))
+			}
+		}
+		params = append(params, anthropic.MessageParam{
+			Role:    anthropic.MessageParamRole(message.Role),
+			Content: blocks,
+		})
+	}
+	return params
+}
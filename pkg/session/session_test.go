@@ -0,0 +1,115 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testSession() *Session {
+	s := New()
+	s.Messages = []Message{
+		{Role: "user", Content: []Block{{Type: "text", Text: "What does main.go do?"}}},
+		{Role: "assistant", Content: []Block{{Type: "text", Text: "It starts the server on :8080."}}},
+	}
+	s.Labels = []string{"billing"}
+	return s
+}
+
+func TestWrappedStores(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	encrypted := func(inner Store) Store {
+		store, err := NewEncryptedStore(inner, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+	passphrase := func(inner Store) Store {
+		store, err := NewPassphraseStore(inner, "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+	compressed := func(inner Store) Store { return NewCompressedStore(inner) }
+	plain := func(inner Store) Store { return inner }
+
+	tests := []struct {
+		name       string
+		save, load func(Store) Store
+		err        error
+	}{
+		{"encrypted", encrypted, encrypted, nil},
+		{"passphrase", passphrase, passphrase, nil},
+		{"compressed", compressed, compressed, nil},
+		{"compressed and encrypted", func(s Store) Store { return compressed(encrypted(s)) }, func(s Store) Store { return compressed(encrypted(s)) }, nil},
+		// Compressed sessions are detected without the wrapper
+		{"compressed read plain", compressed, plain, nil},
+		{"compressed and encrypted read encrypted", func(s Store) Store { return compressed(encrypted(s)) }, encrypted, nil},
+		{"encrypted inside compressed", func(s Store) Store { return encrypted(compressed(s)) }, func(s Store) Store { return encrypted(compressed(s)) }, nil},
+		{"plain read encrypted", plain, encrypted, nil},
+		// Without the key an encrypted session must fail, not load empty
+		{"encrypted read plain", encrypted, plain, ErrEncrypted},
+		{"encrypted read compressed", encrypted, compressed, ErrEncrypted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			base := NewFileStore(t.TempDir())
+			want := testSession()
+			if err := tt.save(base).Save(ctx, want); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.load(base).Load(ctx, want.ID)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Load = %v, %v; want %v", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Messages) != 2 || got.Messages[1].Content[0].Text != want.Messages[1].Content[0].Text || len(got.Labels) != 1 {
+				t.Errorf("Load = %+v; want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestEncryptedStoreRejects(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, _ := NewEncryptedStore(NewFileStore(dir), bytes.Repeat([]byte{1}, 32))
+	s := testSession()
+	if err := store.Save(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	wrongKey, _ := NewEncryptedStore(NewFileStore(dir), bytes.Repeat([]byte{2}, 32))
+	if _, err := wrongKey.Load(ctx, s.ID); err == nil {
+		t.Error("loaded with the wrong key")
+	}
+	wrongPassphrase, _ := NewPassphraseStore(NewFileStore(dir), "guess")
+	if _, err := wrongPassphrase.Load(ctx, s.ID); err == nil {
+		t.Error("loaded a key-sealed session with a passphrase")
+	}
+
+	// A sealed session copied under another ID must not open
+	data, err := os.ReadFile(filepath.Join(dir, s.ID+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewID()
+	data = bytes.ReplaceAll(data, []byte(s.ID), []byte(other))
+	if err := os.WriteFile(filepath.Join(dir, other+".json"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx, other); err == nil {
+		t.Error("loaded a sealed session swapped in under another ID")
+	}
+}
@@ -0,0 +1,338 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// actionTimeout bounds one run of a build, test or lint command
+	actionTimeout = 15 * time.Minute
+	// maxActionOutput is how much of the end of a command's output is returned
+	maxActionOutput = 16 * 1024
+)
+
+// ActionNames are the actions inferred for a project, in the order they are reported
+var ActionNames = []string{"build", "test", "lint"}
+
+// actionTargets are the task runner targets and scripts that stand for each action
+var actionTargets = map[string][]string{
+	"build": {"build"},
+	"test":  {"test", "tests"},
+	"lint":  {"lint", "vet", "check"},
+}
+
+// Action is a project's canonical command for building, testing or linting it, and the
+// file it was inferred from
+type Action struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Source  string `json:"source"`
+}
+
+// actionCache is the cache file: the actions and the state of the files they were
+// inferred from, so they are inferred again only when one of the files changes
+type actionCache struct {
+	Inputs  map[string]string `json:"inputs"`
+	Actions []Action          `json:"actions"`
+}
+
+// InferActions finds the build, test and lint commands of the project in dir. Targets
+// of its task runners come first, then the commands its CI runs, then the defaults of
+// the language's manifest. The result is cached in cachePath, when not empty, until
+// one of those files changes.
+func InferActions(dir, cachePath string) []Action {
+	inputs := actionInputs(dir)
+	if cachePath != "" {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var cache actionCache
+			if json.Unmarshal(data, &cache) == nil && maps.Equal(cache.Inputs, inputs) {
+				return cache.Actions
+			}
+		}
+	}
+	actions := inferActions(dir)
+	if cachePath != "" {
+		if data, err := json.MarshalIndent(actionCache{Inputs: inputs, Actions: actions}, "", "  "); err == nil {
+			if os.MkdirAll(filepath.Dir(cachePath), 0755) == nil {
+				os.WriteFile(cachePath, data, 0644)
+			}
+		}
+	}
+	return actions
+}
+
+// actionSources lists the files actions are inferred from that exist in dir
+func actionSources(dir string) []string {
+	var names []string
+	names = append(names, makefileNames...)
+	names = append(names, justfileNames...)
+	names = append(names, taskfileNames...)
+	names = append(names, "package.json", ".gitlab-ci.yml", "go.mod", "Cargo.toml", "pyproject.toml", "setup.py",
+		"pom.xml", "build.gradle", "build.gradle.kts", "gradlew", "pnpm-lock.yaml", "yarn.lock", "bun.lockb")
+	workflows, _ := filepath.Glob(filepath.Join(dir, ".github", "workflows", "*.y*ml"))
+	var sources []string
+	for _, name := range names {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			sources = append(sources, name)
+		}
+	}
+	for _, workflow := range workflows {
+		if rel, err := filepath.Rel(dir, workflow); err == nil {
+			sources = append(sources, filepath.ToSlash(rel))
+		}
+	}
+	return sources
+}
+
+// actionInputs fingerprints the sources by size and modification time
+func actionInputs(dir string) map[string]string {
+	inputs := map[string]string{}
+	for _, source := range actionSources(dir) {
+		if info, err := os.Stat(filepath.Join(dir, source)); err == nil {
+			inputs[source] = fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return inputs
+}
+
+func inferActions(dir string) []Action {
+	found := map[string]Action{}
+	add := func(name, command, source string) {
+		if _, ok := found[name]; !ok && command != "" {
+			found[name] = Action{Name: name, Command: command, Source: source}
+		}
+	}
+
+	// Task runner targets
+	var files []taskFile
+	if path, ok := firstFile(dir, makefileNames); ok {
+		if file, err := parseMakefile(path); err == nil {
+			files = append(files, file)
+		}
+	}
+	if path, ok := firstFile(dir, justfileNames); ok {
+		if file, err := parseJustfile(path); err == nil {
+			files = append(files, file)
+		}
+	}
+	if path, ok := firstFile(dir, taskfileNames); ok {
+		if file, err := parseTaskfile(path); err == nil {
+			files = append(files, file)
+		}
+	}
+	if path, ok := firstFile(dir, []string{"package.json"}); ok {
+		if file, err := parsePackageScripts(path); err == nil {
+			files = append(files, file)
+		}
+	}
+	for _, file := range files {
+		source, _ := filepath.Rel(dir, file.path)
+		for _, name := range ActionNames {
+			for _, task := range file.tasks {
+				if slices.Contains(actionTargets[name], task.name) {
+					// file.run ends with a placeholder such as <target>
+					run, _, _ := strings.Cut(file.run, "<")
+					add(name, run+task.name, source)
+					break
+				}
+			}
+		}
+	}
+
+	// Commands the CI runs
+	for _, source := range actionSources(dir) {
+		for _, line := range ciCommands(filepath.Join(dir, source), source) {
+			if name := classifyCommand(line); name != "" {
+				add(name, line, source)
+			}
+		}
+	}
+
+	// Manifest defaults
+	manifests := []struct {
+		file              string
+		build, test, lint string
+	}{
+		{"go.mod", "go build ./...", "go test ./...", "go vet ./..."},
+		{"Cargo.toml", "cargo build", "cargo test", "cargo clippy"},
+		{"pyproject.toml", "", "pytest", ""},
+		{"setup.py", "", "pytest", ""},
+		{"pom.xml", "mvn -q compile", "mvn -q test", ""},
+		{"gradlew", "./gradlew build", "./gradlew test", ""},
+		{"build.gradle", "gradle build", "gradle test", ""},
+		{"build.gradle.kts", "gradle build", "gradle test", ""},
+	}
+	for _, m := range manifests {
+		if _, err := os.Stat(filepath.Join(dir, m.file)); err == nil {
+			add("build", m.build, m.file)
+			add("test", m.test, m.file)
+			add("lint", m.lint, m.file)
+		}
+	}
+
+	var actions []Action
+	for _, name := range ActionNames {
+		if action, ok := found[name]; ok {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// ciCommands returns the shell lines a GitHub Actions workflow's steps or a GitLab CI
+// job's scripts run, or nothing for other files
+func ciCommands(path, source string) []string {
+	var scripts []string
+	switch {
+	case strings.HasPrefix(source, ".github/workflows/"):
+		var workflow struct {
+			Jobs map[string]struct {
+				Steps []struct {
+					Run string `yaml:"run"`
+				} `yaml:"steps"`
+			} `yaml:"jobs"`
+		}
+		if data, err := os.ReadFile(path); err != nil || yaml.Unmarshal(data, &workflow) != nil {
+			return nil
+		}
+		names := make([]string, 0, len(workflow.Jobs))
+		for name := range workflow.Jobs {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			for _, step := range workflow.Jobs[name].Steps {
+				scripts = append(scripts, step.Run)
+			}
+		}
+	case source == ".gitlab-ci.yml":
+		var pipeline map[string]any
+		if data, err := os.ReadFile(path); err != nil || yaml.Unmarshal(data, &pipeline) != nil {
+			return nil
+		}
+		names := make([]string, 0, len(pipeline))
+		for name := range pipeline {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			job, _ := pipeline[name].(map[string]any)
+			switch script := job["script"].(type) {
+			case string:
+				scripts = append(scripts, script)
+			case []any:
+				for _, line := range script {
+					if s, ok := line.(string); ok {
+						scripts = append(scripts, s)
+					}
+				}
+			}
+		}
+	}
+	var lines []string
+	for _, script := range scripts {
+		for _, line := range strings.Split(script, "\n") {
+			// Lines using CI expressions or variables cannot be run as they are
+			if line = strings.TrimSpace(line); line != "" && !strings.Contains(line, "${{") && !strings.Contains(line, "$CI_") {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+// classifyCommand names the action a CI line performs, or returns "" for setup steps
+func classifyCommand(line string) string {
+	words := strings.FieldsFunc(strings.ToLower(line), func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '/' || r == ':' || r == '-'
+	})
+	has := func(candidates ...string) bool {
+		return slices.ContainsFunc(words, func(word string) bool { return slices.Contains(candidates, word) })
+	}
+	switch {
+	case has("install", "ci", "setup", "checkout", "cache", "upload", "download", "echo", "cd"):
+		return ""
+	case has("test", "tests", "pytest", "jest", "vitest", "rspec"):
+		return "test"
+	case has("lint", "vet", "clippy", "golangci", "ruff", "eslint", "flake8", "staticcheck"):
+		return "lint"
+	case has("build", "compile"):
+		return "build"
+	}
+	return ""
+}
+
+type runActionInput struct {
+	Name string `json:"name"`
+}
+
+// ActionTool returns a run_action tool running the given actions by name, so the model
+// uses the project's own commands instead of guessing them
+func ActionTool(actions []Action) ToolDefinition {
+	var names, lines []string
+	for _, action := range actions {
+		names = append(names, action.Name)
+		lines = append(lines, fmt.Sprintf("%s: `%s` (from %s)", action.Name, action.Command, action.Source))
+	}
+	tool := opaque(mutating(New("run_action",
+		"Run one of the project's own build, test or lint commands and return its output. Use these "+
+			"instead of guessing commands. Available: "+strings.Join(lines, "; ")+".",
+		func(ctx context.Context, in runActionInput) (string, error) {
+			i := slices.IndexFunc(actions, func(action Action) bool { return action.Name == in.Name })
+			if i < 0 {
+				return "", fmt.Errorf("unknown action '%s'; use %s", in.Name, strings.Join(names, ", "))
+			}
+			return runAction(actions[i])
+		})))
+	// The names are only known at runtime, so the schema is written out
+	tool.SchemaFunc = func() anthropic.ToolInputSchemaParam {
+		schema := anthropic.ToolInputSchemaParam{
+			Properties: map[string]any{
+				"name": map[string]any{"type": "string", "enum": names, "description": "The action to run."},
+			},
+		}
+		schema.WithExtraFields(map[string]any{"required": []string{"name"}})
+		return schema
+	}
+	return tool
+}
+
+// runAction runs the action's command in a shell and returns the end of its output.
+// A failing command is an error, with its output, so the model sees what broke.
+func runAction(action Action) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", action.Command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", action.Command)
+	}
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if len(output) > maxActionOutput {
+		output = fmt.Sprintf("... (%d earlier bytes omitted)\n%s", len(output)-maxActionOutput, output[len(output)-maxActionOutput:])
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("`%s` did not finish within %s:\n%s", action.Command, actionTimeout, output)
+	}
+	if err != nil {
+		return "", fmt.Errorf("`%s` failed (%s):\n%s", action.Command, err.Error(), output)
+	}
+	if output == "" {
+		output = "(no output)"
+	}
+	return fmt.Sprintf("`%s` succeeded:\n%s", action.Command, output), nil
+}
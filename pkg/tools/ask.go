@@ -0,0 +1,49 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Asker is implemented by Prompters that can put free-form or multiple-choice
+// questions to the user. Without one, ask_user tells the model nobody can answer.
+type Asker interface {
+	Ask(question string, options []string) (string, error)
+}
+
+// AskUser tool
+type AskUserInput struct {
+	Question string   `json:"question" jsonschema_description:"The question for the user. Make it self-contained: they may not have followed every tool call."`
+	Options  []string `json:"options,omitempty" jsonschema_description:"Optional answers to choose from. The user can still reply with something else."`
+}
+
+var AskUserInputSchema = LazySchema[AskUserInput]()
+
+func AskUser(ctx context.Context, askInput AskUserInput) (string, error) {
+	if strings.TrimSpace(askInput.Question) == "" {
+		return "", fmt.Errorf("question must not be empty")
+	}
+
+	prompterMu.Lock()
+	asker, ok := prompter.(Asker)
+	prompterMu.Unlock()
+	if !ok {
+		return "No user is available to answer in this run. Proceed with your best judgement and state the assumption you made.", nil
+	}
+
+	answer, err := asker.Ask(askInput.Question, askInput.Options)
+	if err != nil {
+		return "", fmt.Errorf("failed to get an answer from the user: %w", err)
+	}
+	if strings.TrimSpace(answer) == "" {
+		return "The user gave no answer. Proceed with your best judgement and state the assumption you made.", nil
+	}
+	return "The user answered: " + answer, nil
+}
+
+var AskUserDefinition = New("ask_user",
+	"Ask the user a clarifying question and wait for the answer. Use this when the request is ambiguous "+
+		"and guessing wrong would waste work, rather than asking in a reply and stopping. Offer options when the "+
+		"likely answers are known.",
+	AskUser)
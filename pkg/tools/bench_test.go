@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// largeTree writes dirs*files Go files under a temporary directory and returns its path
+func largeTree(b *testing.B, dirs, files int) string {
+	b.Helper()
+	root := b.TempDir()
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%03d", d), "internal")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			content := fmt.Sprintf("package internal\n\n// Handler%d serves requests\nfunc Handler%d() string { return %q }\n", f, f, "TODO: retry")
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d.go", f)), []byte(content), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func rawInput(b *testing.B, v any) json.RawMessage {
+	b.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return raw
+}
+
+func BenchmarkListFiles(b *testing.B) {
+	input := rawInput(b, ListFilesInput{Path: largeTree(b, 100, 100)})
+	b.ResetTimer()
+	for b.Loop() {
+		if _, err := ListFilesDefinition.Function(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRipGrepSearch(b *testing.B) {
+	if _, err := exec.LookPath("rg"); err != nil {
+		b.Skip("ripgrep is not installed")
+	}
+	input := rawInput(b, RipGrepInput{Query: "TODO", Path: largeTree(b, 100, 100)})
+	b.ResetTimer()
+	for b.Loop() {
+		if _, err := RipGrepToolDefinition.Function(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseBlame(b *testing.B) {
+	var porcelain strings.Builder
+	for line := 1; line <= 5000; line++ {
+		commit := fmt.Sprintf("%040x", line/50)
+		fmt.Fprintf(&porcelain, "%s %d %d 1\nauthor Jane Doe\nauthor-time 1700000000\nsummary Change %d\nfilename main.go\n\tline %d\n",
+			commit, line, line, line/50, line)
+	}
+	out := porcelain.String()
+	b.ResetTimer()
+	for b.Loop() {
+		parseBlame(out)
+	}
+}
+
+func BenchmarkGenerateSchema(b *testing.B) {
+	b.Run("reflect", func(b *testing.B) {
+		for b.Loop() {
+			reflectSchema[RipGrepInput]()
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for b.Loop() {
+			GenerateSchema[RipGrepInput]()
+		}
+	})
+}
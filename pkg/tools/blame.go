@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitBlame tool
+type GitBlameInput struct {
+	Path      string `json:"path" jsonschema_description:"The relative path of a file tracked by git."`
+	StartLine int    `json:"start_line,omitempty" jsonschema_description:"First line to blame. Defaults to the start of the file."`
+	EndLine   int    `json:"end_line,omitempty" jsonschema_description:"Last line to blame. Defaults to the end of the file."`
+}
+
+var GitBlameInputSchema = LazySchema[GitBlameInput]()
+
+// blameRange is a run of consecutive lines last changed by the same commit
+type blameRange struct {
+	start, end int
+	commit     string
+	author     string
+	time       time.Time
+	summary    string
+}
+
+func GitBlame(ctx context.Context, blameInput GitBlameInput) (string, error) {
+
+	args := []string{"blame", "--line-porcelain"}
+	if blameInput.StartLine > 0 || blameInput.EndLine > 0 {
+		start := max(blameInput.StartLine, 1)
+		end := ""
+		if blameInput.EndLine > 0 {
+			end = strconv.Itoa(blameInput.EndLine)
+		}
+		args = append(args, "-L", fmt.Sprintf("%d,%s", start, end))
+	}
+	args = append(args, "--", blameInput.Path)
+
+	out, err := exec.CommandContext(ctx, "git", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git blame failed for '%s': %s", blameInput.Path, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to execute git blame: %w", err)
+	}
+
+	ranges := parseBlame(string(out))
+	if len(ranges) == 0 {
+		return "No lines to blame.", nil
+	}
+
+	now := time.Now()
+	var b strings.Builder
+	for _, r := range ranges {
+		lines := fmt.Sprintf("L%d", r.start)
+		if r.end != r.start {
+			lines = fmt.Sprintf("L%d-%d", r.start, r.end)
+		}
+		fmt.Fprintf(&b, "%s %s %s %s (%s) %s\n",
+			lines, r.commit[:min(len(r.commit), 10)], r.author, r.time.Format("2006-01-02"), age(now.Sub(r.time)), r.summary)
+	}
+	return b.String(), nil
+}
+
+// parseBlame groups --line-porcelain output into ranges of consecutive lines per commit
+func parseBlame(out string) []blameRange {
+	var ranges []blameRange
+	var current blameRange
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			// The content line ends each entry
+			if n := len(ranges); n > 0 && ranges[n-1].commit == current.commit && ranges[n-1].end+1 == current.start {
+				ranges[n-1].end = current.start
+			} else {
+				current.end = current.start
+				ranges = append(ranges, current)
+			}
+		case strings.HasPrefix(line, "author "):
+			current.author = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "author-time "):
+			seconds, _ := strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64)
+			current.time = time.Unix(seconds, 0)
+		case strings.HasPrefix(line, "summary "):
+			current.summary = strings.TrimPrefix(line, "summary ")
+		default:
+			// Header: <sha> <orig-line> <final-line> [<group-size>]
+			fields := strings.Fields(line)
+			if len(fields) >= 3 && isObjectID(fields[0]) {
+				finalLine, err := strconv.Atoi(fields[2])
+				if err == nil {
+					current.commit = fields[0]
+					current.start = finalLine
+				}
+			}
+		}
+	}
+	return ranges
+}
+
+// isObjectID reports whether s is a full commit ID: 40 hex characters for SHA-1
+// repositories, 64 for SHA-256 ones
+func isObjectID(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// age renders a duration as a rough human-readable age
+func age(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	switch {
+	case d < time.Hour:
+		return "just now"
+	case days < 1:
+		return fmt.Sprintf("%d hours ago", int(d.Hours()))
+	case days < 60:
+		return fmt.Sprintf("%d days ago", days)
+	case days < 730:
+		return fmt.Sprintf("%d months ago", days/30)
+	default:
+		return fmt.Sprintf("%d years ago", days/365)
+	}
+}
+
+var GitBlameDefinition = New("git_blame",
+	"Show which commit, author and date last changed each line of a file, grouped into line ranges. Use this when diagnosing regressions to find recent changes and reference the commit responsible.",
+	GitBlame)
@@ -0,0 +1,261 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	// dbTimeout bounds each database tool call
+	dbTimeout = 30 * time.Second
+	// maxQueryRows caps the rows db_query returns
+	maxQueryRows = 100
+)
+
+// DBSchema tool
+type DBSchemaInput struct {
+	Table string `json:"table,omitempty" jsonschema_description:"Show only this table, optionally schema-qualified. Omit for every table outside the system schemas."`
+}
+
+// DBQuery tool
+type DBQueryInput struct {
+	Query string `json:"query" jsonschema_description:"A read-only SQL query. It runs in a read-only transaction, so writes fail."`
+}
+
+// DatabaseTools returns db_schema and db_query tools for the PostgreSQL database at
+// dsn. The connection is opened on first use, and queries run read-only.
+func DatabaseTools(dsn string) []ToolDefinition {
+	open := sync.OnceValues(func() (*sql.DB, error) {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database connection: %w", err)
+		}
+		return db, nil
+	})
+
+	schema := New("db_schema",
+		"Describe the current database schema: tables with their columns, types, nullability, defaults, constraints and indexes.",
+		func(ctx context.Context, in DBSchemaInput) (string, error) {
+			db, err := open()
+			if err != nil {
+				return "", err
+			}
+			ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+			defer cancel()
+			return describeSchema(ctx, db, in.Table)
+		})
+	query := opaque(New("db_query",
+		fmt.Sprintf("Run a read-only SQL query against the database and return up to %d rows as tab-separated text.", maxQueryRows),
+		func(ctx context.Context, in DBQueryInput) (string, error) {
+			db, err := open()
+			if err != nil {
+				return "", err
+			}
+			ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+			defer cancel()
+			return readOnlyQuery(ctx, db, in.Query)
+		}))
+	return []ToolDefinition{schema, query}
+}
+
+// describeSchema renders the columns, constraints and indexes of the user tables
+func describeSchema(ctx context.Context, db *sql.DB, table string) (string, error) {
+	schemaName, tableName := "", table
+	if before, after, ok := strings.Cut(table, "."); ok {
+		schemaName, tableName = before, after
+	}
+	filter := `table_schema NOT IN ('pg_catalog', 'information_schema')
+		AND ($1 = '' OR table_name = $1) AND ($2 = '' OR table_schema = $2)`
+
+	rows, err := db.QueryContext(ctx, `SELECT table_schema, table_name, column_name, data_type,
+		is_nullable, COALESCE(column_default, '') FROM information_schema.columns
+		WHERE `+filter+` ORDER BY table_schema, table_name, ordinal_position`, tableName, schemaName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read columns: %w", err)
+	}
+	defer rows.Close()
+	var b strings.Builder
+	current := ""
+	for rows.Next() {
+		var schema, table, column, dataType, nullable, def string
+		if err := rows.Scan(&schema, &table, &column, &dataType, &nullable, &def); err != nil {
+			return "", fmt.Errorf("failed to read columns: %w", err)
+		}
+		if name := schema + "." + table; name != current {
+			fmt.Fprintf(&b, "\ntable %s\n", name)
+			current = name
+		}
+		fmt.Fprintf(&b, "  %s %s", column, dataType)
+		if nullable == "NO" {
+			b.WriteString(" NOT NULL")
+		}
+		if def != "" {
+			fmt.Fprintf(&b, " DEFAULT %s", def)
+		}
+		b.WriteString("\n")
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to read columns: %w", err)
+	}
+	if current == "" {
+		if table != "" {
+			return "", fmt.Errorf("no table named '%s'", table)
+		}
+		return "The database has no tables.", nil
+	}
+
+	constraints, err := db.QueryContext(ctx, `SELECT n.nspname || '.' || c.relname, con.conname, pg_get_constraintdef(con.oid)
+		FROM pg_constraint con JOIN pg_class c ON c.oid = con.conrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')
+		AND ($1 = '' OR c.relname = $1) AND ($2 = '' OR n.nspname = $2) ORDER BY 1, 2`, tableName, schemaName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read constraints: %w", err)
+	}
+	defer constraints.Close()
+	b.WriteString("\nconstraints\n")
+	for constraints.Next() {
+		var table, name, def string
+		if err := constraints.Scan(&table, &name, &def); err != nil {
+			return "", fmt.Errorf("failed to read constraints: %w", err)
+		}
+		fmt.Fprintf(&b, "  %s %s: %s\n", table, name, def)
+	}
+
+	indexes, err := db.QueryContext(ctx, `SELECT schemaname || '.' || tablename, indexdef FROM pg_indexes
+		WHERE schemaname NOT IN ('pg_catalog', 'information_schema')
+		AND ($1 = '' OR tablename = $1) AND ($2 = '' OR schemaname = $2) ORDER BY 1, 2`, tableName, schemaName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer indexes.Close()
+	b.WriteString("\nindexes\n")
+	for indexes.Next() {
+		var table, def string
+		if err := indexes.Scan(&table, &def); err != nil {
+			return "", fmt.Errorf("failed to read indexes: %w", err)
+		}
+		fmt.Fprintf(&b, "  %s\n", def)
+	}
+	return strings.TrimPrefix(b.String(), "\n"), nil
+}
+
+// readOnlyQuery runs query in a read-only transaction that is always rolled back. The
+// query must be a single statement: COMMIT or SET TRANSACTION READ WRITE followed by a
+// write would otherwise escape the transaction. It is also prepared, because the
+// extended protocol that preparing uses runs only one statement.
+func readOnlyQuery(ctx context.Context, db *sql.DB, query string) (string, error) {
+	query, err := singleStatement(query)
+	if err != nil {
+		return "", err
+	}
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to start read-only transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return "", fmt.Errorf("query failed: %w", err)
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", fmt.Errorf("query failed: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Join(columns, "\t") + "\n")
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	n := 0
+	for rows.Next() {
+		if n == maxQueryRows {
+			fmt.Fprintf(&b, "... (more than %d rows; add a LIMIT or a narrower WHERE)\n", maxQueryRows)
+			break
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return "", fmt.Errorf("failed to read row: %w", err)
+		}
+		cells := make([]string, len(values))
+		for i, v := range values {
+			cells[i] = "NULL"
+			if v.Valid {
+				cells[i] = v.String
+			}
+		}
+		b.WriteString(strings.Join(cells, "\t") + "\n")
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("query failed: %w", err)
+	}
+	if n == 0 {
+		b.WriteString("(no rows)\n")
+	}
+	return b.String(), nil
+}
+
+// singleStatement returns query without its trailing semicolons, or an error if it
+// holds more than one statement. Semicolons in string literals, quoted identifiers,
+// dollar-quoted strings and comments do not separate statements.
+func singleStatement(query string) (string, error) {
+	query = strings.TrimSpace(query)
+	for i := 0; i < len(query); i++ {
+		switch {
+		case query[i] == '\'' || query[i] == '"':
+			// A doubled quote inside is an escaped one, and re-enters this case
+			end := strings.IndexByte(query[i+1:], query[i])
+			if end < 0 {
+				return query, nil
+			}
+			i += end + 1
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return query, nil
+			}
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return query, nil
+			}
+			i += end + 3
+		case query[i] == '$':
+			// $tag$ ... $tag$, where the tag may be empty
+			tagEnd := strings.IndexByte(query[i+1:], '$')
+			if tagEnd < 0 || strings.ContainsFunc(query[i+1:i+1+tagEnd], func(r rune) bool {
+				return !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+			}) {
+				continue
+			}
+			tag := query[i : i+tagEnd+2]
+			end := strings.Index(query[i+len(tag):], tag)
+			if end < 0 {
+				return query, nil
+			}
+			i += len(tag) + end + len(tag) - 1
+		case query[i] == ';':
+			if rest := strings.Trim(query[i:], "; \t\r\n"); rest != "" {
+				return "", fmt.Errorf("db_query runs one statement at a time; send '%s' on its own", rest)
+			}
+			return query[:i], nil
+		}
+	}
+	return query, nil
+}
@@ -0,0 +1,119 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrRendererMissing is returned by RenderDiagram when the renderer for a diagram
+// language is not installed
+var ErrRendererMissing = errors.New("diagram renderer not installed")
+
+// renderTimeout bounds a single diagram render; mmdc starts a headless browser
+const renderTimeout = 2 * time.Minute
+
+// mermaidDiagramTypes are the keywords a Mermaid diagram can start with
+var mermaidDiagramTypes = []string{
+	"graph", "flowchart", "sequenceDiagram", "classDiagram", "stateDiagram", "stateDiagram-v2", "erDiagram",
+	"journey", "gantt", "pie", "quadrantChart", "requirementDiagram", "gitGraph", "mindmap", "timeline",
+	"sankey-beta", "xychart-beta", "block-beta", "C4Context", "C4Container", "C4Component", "C4Dynamic", "C4Deployment",
+}
+
+// DiagramExtension returns the usual source file extension for a diagram language
+func DiagramExtension(language string) string {
+	if language == "plantuml" {
+		return ".puml"
+	}
+	return ".mmd"
+}
+
+// ValidateDiagram checks the basic structure of Mermaid or PlantUML source, so obvious
+// mistakes are reported without running a renderer
+func ValidateDiagram(language, source string) error {
+	switch language {
+	case "mermaid":
+		for _, line := range strings.Split(source, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "%%") {
+				continue
+			}
+			if line == "---" {
+				return nil // front matter; the renderer validates the rest
+			}
+			keyword, _, _ := strings.Cut(line, " ")
+			for _, t := range mermaidDiagramTypes {
+				if keyword == t {
+					return nil
+				}
+			}
+			return fmt.Errorf("mermaid source must start with a diagram type such as flowchart or sequenceDiagram, not '%s'", keyword)
+		}
+		return fmt.Errorf("mermaid source is empty")
+	case "plantuml":
+		trimmed := strings.TrimSpace(source)
+		if !strings.HasPrefix(trimmed, "@start") {
+			return fmt.Errorf("plantuml source must begin with @startuml (or another @start tag)")
+		}
+		if !strings.Contains(trimmed, "@end") {
+			return fmt.Errorf("plantuml source must end with @enduml (or the matching @end tag)")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported diagram language '%s'; use mermaid or plantuml", language)
+	}
+}
+
+// RenderDiagram validates source and renders it to svg or png with mmdc (Mermaid) or
+// plantuml, returning the image
+func RenderDiagram(language, format, source string) ([]byte, error) {
+	if err := ValidateDiagram(language, source); err != nil {
+		return nil, err
+	}
+	if format != "svg" && format != "png" {
+		return nil, fmt.Errorf("unsupported diagram format '%s'; use svg or png", format)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), renderTimeout)
+	defer cancel()
+
+	if language == "plantuml" {
+		if _, err := exec.LookPath("plantuml"); err != nil {
+			return nil, fmt.Errorf("%w: install plantuml to render PlantUML", ErrRendererMissing)
+		}
+		cmd := exec.CommandContext(ctx, "plantuml", "-t"+format, "-pipe")
+		cmd.Stdin = strings.NewReader(source)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("plantuml rejected the diagram: %s", strings.TrimSpace(stderr.String()+" "+err.Error()))
+		}
+		return stdout.Bytes(), nil
+	}
+
+	if _, err := exec.LookPath("mmdc"); err != nil {
+		return nil, fmt.Errorf("%w: install @mermaid-js/mermaid-cli (mmdc) to render Mermaid", ErrRendererMissing)
+	}
+	dir, err := os.MkdirTemp("", "agent-diagram-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "diagram.mmd"), filepath.Join(dir, "diagram."+format)
+	if err := os.WriteFile(in, []byte(source), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write diagram source: %w", err)
+	}
+	if output, err := exec.CommandContext(ctx, "mmdc", "-q", "-i", in, "-o", out).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("mmdc rejected the diagram: %s", strings.TrimSpace(string(output)+" "+err.Error()))
+	}
+	image, err := os.ReadFile(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rendered diagram: %w", err)
+	}
+	return image, nil
+}
@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around a change
+const diffContext = 3
+
+// Change is the edit a tool call would make to a file, as a unified diff hunk
+type Change struct {
+	Path string
+	Diff string
+}
+
+// EditFilePreview returns the hunk edit_file would write for input
+func EditFilePreview(input json.RawMessage) (Change, error) {
+	return editFilePreview(OSFS{}, input)
+}
+
+func editFilePreview(fsys FS, input json.RawMessage) (Change, error) {
+	editFileInput := EditFileInput{}
+	if err := json.Unmarshal(input, &editFileInput); err != nil {
+		return Change{}, fmt.Errorf("invalid input format for edit_file: %w", err)
+	}
+	content, err := fsys.ReadFile(editFileInput.Path)
+	if err != nil {
+		return Change{}, fmt.Errorf("failed to read file '%s' for editing: %w", editFileInput.Path, err)
+	}
+	editorConfig := LoadEditorConfig(fsys, editFileInput.Path)
+	contentStr := editorConfig.decode(content)
+	newStr := editFileInput.NewStr
+	if index := strings.Index(contentStr, editFileInput.OldStr); index >= 0 {
+		newStr = processEdit(Edit{Path: editFileInput.Path, Content: contentStr, Offset: index, OldStr: editFileInput.OldStr, NewStr: newStr, Config: editorConfig})
+	}
+	diff, ok := replacementDiff(contentStr, editFileInput.OldStr, newStr)
+	if !ok {
+		return Change{}, fmt.Errorf("string '%s' not found in file '%s'", editFileInput.OldStr, editFileInput.Path)
+	}
+	return Change{Path: editFileInput.Path, Diff: diff}, nil
+}
+
+// replacementDiff renders replacing the first oldStr in content with newStr as one
+// unified diff hunk
+func replacementDiff(content, oldStr, newStr string) (string, bool) {
+	index := strings.Index(content, oldStr)
+	if oldStr == "" || index < 0 {
+		return "", false
+	}
+	return RangeDiff(content, index, index+len(oldStr), newStr), true
+}
+
+// RangeDiff renders replacing the bytes of content from index to stop with newStr as
+// one unified diff hunk
+func RangeDiff(content string, index, stop int, newStr string) string {
+	oldStr := content[index:stop]
+	// Widen the replacement to whole lines
+	start := strings.LastIndex(content[:index], "\n") + 1
+	end := stop
+	if nl := strings.Index(content[end:], "\n"); nl >= 0 {
+		end += nl + 1
+	} else {
+		end = len(content)
+	}
+	before := splitLines(content[:start])
+	removed := splitLines(content[start:end])
+	added := splitLines(content[start:index] + newStr + content[index+len(oldStr):end])
+	after := splitLines(content[end:])
+
+	leading := before[max(0, len(before)-diffContext):]
+	trailing := after[:min(len(after), diffContext)]
+	oldStart := len(before) - len(leading) + 1
+	var b strings.Builder
+	fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", oldStart, len(leading)+len(removed)+len(trailing),
+		oldStart, len(leading)+len(added)+len(trailing))
+	for _, line := range leading {
+		b.WriteString(" " + line + "\n")
+	}
+	for _, line := range removed {
+		b.WriteString("-" + line + "\n")
+	}
+	for _, line := range added {
+		b.WriteString("+" + line + "\n")
+	}
+	for _, line := range trailing {
+		b.WriteString(" " + line + "\n")
+	}
+	return b.String()
+}
+
+// splitLines splits text into lines without their terminators
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
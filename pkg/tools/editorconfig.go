@@ -0,0 +1,238 @@
+package tools
+
+import (
+	"bufio"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// utf8BOM starts files whose .editorconfig charset is utf-8-bom
+const utf8BOM = "\uFEFF"
+
+// EditorConfig holds the .editorconfig properties that apply to one file. Unset
+// properties are empty, zero or nil.
+type EditorConfig struct {
+	IndentStyle            string // tab or space
+	IndentSize             int
+	Charset                string // utf-8, utf-8-bom or latin1
+	TrimTrailingWhitespace *bool
+	InsertFinalNewline     *bool
+}
+
+// LoadEditorConfig reads the .editorconfig files from the directory holding name up to
+// the one marked root = true, or the top of fsys, and returns the properties whose
+// sections match name. Nearer files and later sections win. A file that cannot be
+// read or parsed is skipped, as editors do.
+func LoadEditorConfig(fsys FS, name string) EditorConfig {
+	if _, ok := fsys.(OSFS); ok {
+		if abs, err := filepath.Abs(name); err == nil {
+			name = abs
+		}
+	}
+	name = filepath.ToSlash(filepath.Clean(name))
+
+	// Collect the files nearest first, then apply them from the root down
+	var dirs []string
+	var files [][]editorConfigSection
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		content, err := fsys.ReadFile(path.Join(dir, ".editorconfig"))
+		if err == nil {
+			sections, root := parseEditorConfig(string(content))
+			dirs, files = append(dirs, dir), append(files, sections)
+			if root {
+				break
+			}
+		}
+		if parent := path.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	properties := map[string]string{}
+	for i := len(files) - 1; i >= 0; i-- {
+		relative := strings.TrimPrefix(name, strings.TrimSuffix(dirs[i], "/")+"/")
+		if dirs[i] == "." {
+			relative = name
+		}
+		for _, section := range files[i] {
+			if section.pattern.MatchString(relative) {
+				for key, value := range section.properties {
+					properties[key] = value
+				}
+			}
+		}
+	}
+	return newEditorConfig(properties)
+}
+
+// editorConfigSection is a [glob] section of an .editorconfig file
+type editorConfigSection struct {
+	pattern    *regexp.Regexp
+	properties map[string]string
+}
+
+// parseEditorConfig reads the sections of an .editorconfig file and whether it is the root
+func parseEditorConfig(content string) (sections []editorConfigSection, root bool) {
+	var current *editorConfigSection
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			pattern, err := editorConfigGlob(line[1 : len(line)-1])
+			if err != nil {
+				current = nil
+				continue
+			}
+			sections = append(sections, editorConfigSection{pattern: pattern, properties: map[string]string{}})
+			current = &sections[len(sections)-1]
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			key = strings.ToLower(strings.TrimSpace(key))
+			value = strings.ToLower(strings.TrimSpace(value))
+			if current == nil {
+				root = root || (key == "root" && value == "true")
+			} else {
+				current.properties[key] = value
+			}
+		}
+	}
+	return sections, root
+}
+
+// editorConfigGlob compiles a section name into a pattern for paths relative to the
+// .editorconfig's directory. A glob without a slash matches the file name in any
+// directory below it.
+func editorConfigGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	switch {
+	case strings.HasPrefix(glob, "/"):
+		glob = glob[1:]
+	case !strings.Contains(glob, "/"):
+		b.WriteString("(?:.*/)?")
+	}
+	braces := 0
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case '{':
+			braces++
+			b.WriteString("(?:")
+		case '}':
+			if braces == 0 {
+				b.WriteString(`\}`)
+				continue
+			}
+			braces--
+			b.WriteString(")")
+		case ',':
+			if braces > 0 {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if braces > 0 {
+		return nil, fmt.Errorf("unbalanced braces in '%s'", glob)
+	}
+	return regexp.Compile("^" + b.String() + "$")
+}
+
+// newEditorConfig reads the properties the file tools act on
+func newEditorConfig(properties map[string]string) EditorConfig {
+	cfg := EditorConfig{Charset: properties["charset"]}
+	if style := properties["indent_style"]; style == "tab" || style == "space" {
+		cfg.IndentStyle = style
+	}
+	size := properties["indent_size"]
+	if size == "tab" || size == "" {
+		size = properties["tab_width"]
+	}
+	if n, err := strconv.Atoi(size); err == nil && n > 0 {
+		cfg.IndentSize = n
+	}
+	flag := func(key string) *bool {
+		switch properties[key] {
+		case "true":
+			on := true
+			return &on
+		case "false":
+			off := false
+			return &off
+		}
+		return nil
+	}
+	cfg.TrimTrailingWhitespace = flag("trim_trailing_whitespace")
+	cfg.InsertFinalNewline = flag("insert_final_newline")
+	return cfg
+}
+
+// decode returns content as UTF-8 text, reading it in the configured charset
+func (c EditorConfig) decode(content []byte) string {
+	switch c.Charset {
+	case "latin1":
+		runes := make([]rune, len(content))
+		for i, b := range content {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	case "utf-8-bom":
+		return strings.TrimPrefix(string(content), utf8BOM)
+	}
+	return string(content)
+}
+
+// encode returns text in the configured charset, failing on characters latin1 lacks
+func (c EditorConfig) encode(text string) ([]byte, error) {
+	switch c.Charset {
+	case "latin1":
+		out := make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xff || r == utf8.RuneError {
+				return nil, fmt.Errorf("'%c' cannot be written in latin1, the charset .editorconfig sets for this file", r)
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	case "utf-8-bom":
+		return []byte(utf8BOM + text), nil
+	}
+	return []byte(text), nil
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// FS is the filesystem the file tools read and edit. It is an fs.FS that can also
+// stat, list directories and write, so the tools can run against the working tree
+// (OSFS), in-memory fixtures (MemFS), or another backend such as an overlay or a
+// remote checkout.
+type FS interface {
+	fs.ReadFileFS
+	fs.StatFS
+	fs.ReadDirFS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// UncommittedChecker is implemented by filesystems backed by the user's checkout,
+// whose files can hold uncommitted work the agent did not make. edit_file asks before
+// changing such a file, and only these filesystems' files are tracked as touched or
+// recorded in the file history.
+type UncommittedChecker interface {
+	// Uncommitted summarises name's uncommitted changes, or returns "" if it has none
+	// or is not in a git repository
+	Uncommitted(name string) string
+}
+
+// OSFS is the operating system's filesystem. Unlike os.DirFS it takes names as the
+// model gives them, relative to the working directory or absolute.
+type OSFS struct{}
+
+func (OSFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (OSFS) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (OSFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+func (OSFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+// Uncommitted asks git about name, in the working directory's repository
+func (OSFS) Uncommitted(name string) string {
+	status, err := exec.Command("git", "status", "--porcelain", "--", name).Output()
+	if err != nil || strings.TrimSpace(string(status)) == "" {
+		return ""
+	}
+	stat, _ := exec.Command("git", "diff", "--stat", "HEAD", "--", name).Output()
+	if stat := strings.TrimRight(string(stat), "\n"); stat != "" {
+		return stat
+	}
+	// Untracked files have no diff against HEAD
+	return strings.TrimRight(string(status), "\n")
+}
+
+// MemFS is an in-memory FS for testing tools against fixtures. Names are cleaned, so
+// "./a.go" and "a.go" are the same file, and directories exist implicitly.
+type MemFS struct {
+	mu    sync.RWMutex
+	files fstest.MapFS
+}
+
+// NewMemFS creates a MemFS holding files, keyed by slash-separated path
+func NewMemFS(files map[string]string) *MemFS {
+	m := &MemFS{files: fstest.MapFS{}}
+	for name, content := range files {
+		m.files[memName(name)] = &fstest.MapFile{Data: []byte(content), Mode: 0644, ModTime: time.Now()}
+	}
+	return m
+}
+
+// memName turns a name as the model gives it into an fs.FS path
+func memName(name string) string {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.Open(memName(name))
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.ReadFile(memName(name))
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.Stat(memName(name))
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.ReadDir(memName(name))
+}
+
+// WriteFile creates or replaces the file. Like os.WriteFile it fails if name is a directory.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = memName(name)
+	if info, err := m.files.Stat(name); err == nil && info.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: errors.New("is a directory")}
+	}
+	m.files[name] = &fstest.MapFile{Data: data, Mode: perm, ModTime: time.Now()}
+	return nil
+}
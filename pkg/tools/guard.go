@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// touchedFiles records files the agent wrote, or the user cleared for editing, this
+// session, so their uncommitted changes are not mistaken for in-progress human work
+var (
+	touchedMu    sync.Mutex
+	touchedFiles = map[string]bool{}
+)
+
+func touchKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func markTouched(path string) {
+	touchedMu.Lock()
+	defer touchedMu.Unlock()
+	touchedFiles[touchKey(path)] = true
+}
+
+func isTouched(path string) bool {
+	touchedMu.Lock()
+	defer touchedMu.Unlock()
+	return touchedFiles[touchKey(path)]
+}
+
+// guardUncommitted refuses to modify a file of fsys holding uncommitted changes the
+// agent did not make, unless the user confirms. Filesystems that are not an
+// UncommittedChecker, and files outside a git repository, are always allowed.
+func guardUncommitted(fsys FS, path string) error {
+	checker, ok := fsys.(UncommittedChecker)
+	if !ok || isTouched(path) {
+		return nil
+	}
+	stat := checker.Uncommitted(path)
+	if stat == "" {
+		return nil
+	}
+
+	question := fmt.Sprintf("'%s' has uncommitted changes that the agent did not make:\n%s\nLet the agent edit it anyway?", path, stat)
+	if !confirm(question) {
+		return fmt.Errorf("'%s' has uncommitted changes by the user, and editing it was not approved; "+
+			"leave this file alone or ask the user to commit or stash their work first", path)
+	}
+	markTouched(path)
+	return nil
+}
+
+// Authorizer decides whether a tool call may run, returning an error that says why
+// not. It sees the call before anything is read or changed.
+type Authorizer func(tool ToolDefinition, input json.RawMessage) error
+
+var (
+	authorizerMu sync.Mutex
+	authorizer   Authorizer
+)
+
+// SetAuthorizer puts every tool call the agents make to authorize; nil allows all
+func SetAuthorizer(authorize Authorizer) {
+	authorizerMu.Lock()
+	defer authorizerMu.Unlock()
+	authorizer = authorize
+}
+
+// Authorize checks a call with the authorizer set by SetAuthorizer, if any
+func Authorize(tool ToolDefinition, input json.RawMessage) error {
+	authorizerMu.Lock()
+	authorize := authorizer
+	authorizerMu.Unlock()
+	if authorize == nil {
+		return nil
+	}
+	return authorize(tool, input)
+}
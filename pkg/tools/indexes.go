@@ -0,0 +1,367 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxIndexMatches bounds the definitions or references one query returns
+const maxIndexMatches = 50
+
+var (
+	// ctagsNames are the tag files ctags writes, in the order they are looked for
+	ctagsNames = []string{"tags", ".tags"}
+	// compileCommandsNames are where CMake, Bear and the like leave a compilation database
+	compileCommandsNames = []string{"compile_commands.json", "build/compile_commands.json", "out/compile_commands.json"}
+)
+
+// IndexTools returns tools that query the symbol indexes the project in dir already
+// has, so very large codebases are searched through them instead of a second index:
+// find_definition for a ctags file or GNU Global database, find_references for a
+// Global database, and compile_command for a compile_commands.json. Indexes that are
+// missing add no tools.
+func IndexTools(dir string) []ToolDefinition {
+	tagsPath, hasTags := firstFile(dir, ctagsNames)
+	_, hasGtags := firstFile(dir, []string{"GTAGS"})
+	if hasGtags {
+		if _, err := exec.LookPath("global"); err != nil {
+			hasGtags = false
+		}
+	}
+	compileCommands, hasCompileCommands := firstFile(dir, compileCommandsNames)
+
+	var defs []ToolDefinition
+	if hasTags || hasGtags {
+		source := "the ctags file"
+		if !hasTags {
+			source = "the GNU Global database"
+		}
+		defs = append(defs, New("find_definition",
+			"Find where a symbol (function, type, method, variable, macro) is defined, using "+source+
+				" already built for this project. Much faster than searching very large trees; use it before "+
+				"ripgrep_search when looking for a definition. Returns path:line with the kind of each match.",
+			func(ctx context.Context, query SymbolQueryInput) (string, error) {
+				if hasTags {
+					return ctagsDefinitions(tagsPath, query.Symbol)
+				}
+				return globalQuery(dir, query.Symbol, "-d")
+			}))
+	}
+	if hasGtags {
+		defs = append(defs, New("find_references",
+			"Find where a symbol is used, using the GNU Global database already built for this project. "+
+				"Returns path:line with the line's text for each reference.",
+			func(ctx context.Context, query SymbolQueryInput) (string, error) {
+				return globalQuery(dir, query.Symbol, "-r")
+			}))
+	}
+	if hasCompileCommands {
+		defs = append(defs, New("compile_command",
+			"Show how a C, C++ or Objective-C source file is compiled, from the project's "+
+				"compile_commands.json: the compiler, include paths, defines and flags. Use it to find which headers "+
+				"and macros apply to a file.",
+			func(ctx context.Context, in CompileCommandInput) (string, error) {
+				return compileCommand(compileCommands, in.Path)
+			}))
+	}
+	return defs
+}
+
+// SymbolQuery tools
+type SymbolQueryInput struct {
+	Symbol string `json:"symbol" jsonschema_description:"The exact name of the symbol, without package or class qualifiers."`
+}
+
+var SymbolQueryInputSchema = LazySchema[SymbolQueryInput]()
+
+// Validate trims the symbol and requires one
+func (query *SymbolQueryInput) Validate() error {
+	if query.Symbol = strings.TrimSpace(query.Symbol); query.Symbol == "" {
+		return fmt.Errorf("symbol must not be empty")
+	}
+	return nil
+}
+
+// ctagsTag is one line of a ctags file
+type ctagsTag struct {
+	name, file, address, kind string
+	line                      int
+}
+
+// parseCtagsLine splits name<TAB>file<TAB>address;"<TAB>fields. The address is a
+// line number or a search pattern, which may itself contain tabs.
+func parseCtagsLine(line string) (ctagsTag, bool) {
+	name, rest, ok := strings.Cut(line, "\t")
+	if !ok || strings.HasPrefix(name, "!_TAG_") {
+		return ctagsTag{}, false
+	}
+	file, rest, ok := strings.Cut(rest, "\t")
+	if !ok {
+		return ctagsTag{}, false
+	}
+	tag := ctagsTag{name: name, file: file, address: rest}
+	if address, fields, ok := strings.Cut(rest, ";\"\t"); ok {
+		tag.address = address
+		for _, field := range strings.Split(fields, "\t") {
+			key, value, hasKey := strings.Cut(field, ":")
+			switch {
+			case !hasKey:
+				tag.kind = field
+			case key == "kind":
+				tag.kind = value
+			case key == "line":
+				tag.line, _ = strconv.Atoi(value)
+			}
+		}
+	}
+	tag.address = strings.TrimSuffix(tag.address, ";\"")
+	if n, err := strconv.Atoi(tag.address); err == nil {
+		tag.line = n
+	}
+	return tag, true
+}
+
+// ctagsDefinitions looks symbol up in the tags file at path. Sorted files, the
+// default, are binary searched so even a tags file of gigabytes answers at once.
+func ctagsDefinitions(path, symbol string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open tags file '%s': %w", path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to open tags file '%s': %w", path, err)
+	}
+
+	start := int64(0)
+	sorted := ctagsSorted(f)
+	if sorted {
+		// Find the first line whose name is not less than symbol
+		lo, hi := int64(0), info.Size()
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			offset, line, err := lineAt(f, mid)
+			if err != nil {
+				return "", fmt.Errorf("failed to read tags file '%s': %w", path, err)
+			}
+			name, _, _ := strings.Cut(line, "\t")
+			if offset >= info.Size() || (!strings.HasPrefix(line, "!_TAG_") && name >= symbol) {
+				hi = mid
+			} else {
+				lo = mid + 1
+			}
+		}
+		if start, _, err = lineAt(f, lo); err != nil {
+			return "", fmt.Errorf("failed to read tags file '%s': %w", path, err)
+		}
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read tags file '%s': %w", path, err)
+	}
+
+	base := filepath.Dir(path)
+	var matches []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		tag, ok := parseCtagsLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if tag.name != symbol {
+			if sorted && tag.name > symbol {
+				break
+			}
+			continue
+		}
+		file := tag.file
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(base, file)
+		}
+		if tag.line == 0 {
+			tag.line = resolvePattern(file, tag.address)
+		}
+		location := file
+		if tag.line > 0 {
+			location = fmt.Sprintf("%s:%d", file, tag.line)
+		}
+		if tag.kind != "" {
+			location += " (" + tag.kind + ")"
+		}
+		matches = append(matches, location)
+		if len(matches) == maxIndexMatches {
+			matches = append(matches, fmt.Sprintf("... more than %d definitions; use a less common name", maxIndexMatches))
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read tags file '%s': %w", path, err)
+	}
+	if len(matches) == 0 {
+		return fmt.Sprintf("No definition of '%s' in %s. The file may be out of date; ripgrep_search can confirm.", symbol, path), nil
+	}
+	return strings.Join(matches, "\n"), nil
+}
+
+// ctagsSorted reports whether the tags file's header says it is sorted by byte value
+func ctagsSorted(f *os.File) bool {
+	f.Seek(0, io.SeekStart)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "!_TAG_") {
+			return false
+		}
+		if strings.HasPrefix(line, "!_TAG_FILE_SORTED\t") {
+			return strings.HasPrefix(strings.TrimPrefix(line, "!_TAG_FILE_SORTED\t"), "1")
+		}
+	}
+	return false
+}
+
+// lineAt returns the offset and text of the first line starting at or after offset
+func lineAt(f *os.File, offset int64) (int64, string, error) {
+	start := max(offset-1, 0)
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+	reader := bufio.NewReader(f)
+	if offset > 0 {
+		// Skip the rest of the line the byte before offset is on, which is nothing but
+		// its newline when a line starts exactly at offset
+		skipped, err := reader.ReadString('\n')
+		start += int64(len(skipped))
+		if err == io.EOF {
+			return start, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, strings.TrimRight(line, "\r\n"), nil
+}
+
+// resolvePattern finds the line a ctags search pattern such as /^func main() {$/
+// points at, or returns 0
+func resolvePattern(path, pattern string) int {
+	if len(pattern) < 2 || (pattern[0] != '/' && pattern[0] != '?') {
+		return 0
+	}
+	text := pattern[1 : len(pattern)-1]
+	anchored := strings.HasPrefix(text, "^")
+	text = strings.TrimPrefix(text, "^")
+	whole := strings.HasSuffix(text, "$")
+	text = strings.TrimSuffix(text, "$")
+	text = strings.NewReplacer(`\/`, "/", `\?`, "?", `\\`, `\`).Replace(text)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		switch {
+		case anchored && whole && line == text,
+			anchored && !whole && strings.HasPrefix(line, text),
+			!anchored && whole && strings.HasSuffix(line, text),
+			!anchored && !whole && strings.Contains(line, text):
+			return n
+		}
+	}
+	return 0
+}
+
+// globalQuery runs GNU Global in dir, with -d for definitions or -r for references
+func globalQuery(dir, symbol, mode string) (string, error) {
+	cmd := exec.Command("global", mode, "--result=grep", "--", symbol)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("global failed for '%s': %s", symbol, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to execute global: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		what := "definition"
+		if mode == "-r" {
+			what = "reference"
+		}
+		return fmt.Sprintf("No %s of '%s' in the GNU Global database.", what, symbol), nil
+	}
+	if len(lines) > maxIndexMatches {
+		lines = append(lines[:maxIndexMatches], fmt.Sprintf("... %d more", len(lines)-maxIndexMatches))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// CompileCommand tool
+type CompileCommandInput struct {
+	Path string `json:"path" jsonschema_description:"The relative path of a source file."`
+}
+
+var CompileCommandInputSchema = LazySchema[CompileCommandInput]()
+
+// compileEntry is one entry of a compilation database
+type compileEntry struct {
+	Directory string   `json:"directory"`
+	File      string   `json:"file"`
+	Command   string   `json:"command"`
+	Arguments []string `json:"arguments"`
+	Output    string   `json:"output"`
+}
+
+// compileCommand returns how the compilation database at dbPath compiles path
+func compileCommand(dbPath, path string) (string, error) {
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read '%s': %w", dbPath, err)
+	}
+	var entries []compileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return "", fmt.Errorf("failed to parse '%s': %w", dbPath, err)
+	}
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve '%s': %w", path, err)
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		file := entry.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(entry.Directory, file)
+		}
+		if filepath.Clean(file) != target {
+			continue
+		}
+		command := entry.Command
+		if command == "" {
+			command = strings.Join(entry.Arguments, " ")
+		}
+		fmt.Fprintf(&b, "directory: %s\ncommand: %s\n", entry.Directory, command)
+		if entry.Output != "" {
+			fmt.Fprintf(&b, "output: %s\n", entry.Output)
+		}
+	}
+	if b.Len() == 0 {
+		return fmt.Sprintf("'%s' is not in %s; it may be a header, or not built in this configuration.", path, dbPath), nil
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,254 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// maxLogLine is the longest log line read; longer lines are cut
+	maxLogLine = 1 << 20
+	// maxLogClusters bounds the number of distinct messages tracked
+	maxLogClusters = 10_000
+)
+
+var (
+	// logLevel finds a severity word near the start of a line
+	logLevel = regexp.MustCompile(`(?i)\b(fatal|panic|critical|crit|error|err|warning|warn|info|debug|trace)\b`)
+	// logVariable matches the parts of a message that vary between occurrences
+	logVariable = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}` +
+		`|\b0x[0-9a-fA-F]+\b|\b[0-9a-f]{12,}\b|\b\d+(\.\d+)*[a-zA-Z]*\b|"[^"]*"|'[^']*'`)
+	// logTimestamps are the timestamp layouts recognised at the start of a line
+	logTimestamps = []struct {
+		pattern *regexp.Regexp
+		layout  string
+	}{
+		{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), ""},
+		{regexp.MustCompile(`\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}`), "2006/01/02 15:04:05"},
+		{regexp.MustCompile(`[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`), time.Stamp},
+	}
+)
+
+// logCluster groups log lines that differ only in their variable parts
+type logCluster struct {
+	template    string
+	level       string
+	count       int
+	example     string
+	first, last time.Time
+}
+
+// AnalyzeLog tool
+type AnalyzeLogInput struct {
+	Path     string `json:"path" jsonschema_description:"The relative path of the log file. It is streamed, so any size works."`
+	MinLevel string `json:"min_level,omitempty" jsonschema:"enum=error,enum=warn,enum=info,enum=all" jsonschema_description:"Lowest severity to cluster. Defaults to warn; lines without a level count as info."`
+	Filter   string `json:"filter,omitempty" jsonschema_description:"Optional regex; only matching lines are analysed."`
+	Top      int    `json:"top,omitempty" jsonschema_description:"How many clusters to show. Defaults to 20."`
+}
+
+var AnalyzeLogInputSchema = LazySchema[AnalyzeLogInput]()
+
+func AnalyzeLog(ctx context.Context, logInput AnalyzeLogInput) (string, error) {
+	if logInput.Top <= 0 {
+		logInput.Top = 20
+	}
+	minRank, ok := map[string]int{"": 2, "warn": 2, "error": 3, "info": 1, "all": 0}[logInput.MinLevel]
+	if !ok {
+		return "", fmt.Errorf("min_level must be error, warn, info or all")
+	}
+	var filter *regexp.Regexp
+	if logInput.Filter != "" {
+		var err error
+		if filter, err = regexp.Compile(logInput.Filter); err != nil {
+			return "", fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+
+	file, err := os.Open(logInput.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open log file '%s': %w", logInput.Path, err)
+	}
+	defer file.Close()
+
+	clusters := map[string]*logCluster{}
+	levels := map[string]int{}
+	var total, matched, dropped int
+	var first, last time.Time
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLine)
+	for scanner.Scan() {
+		line := scanner.Text()
+		total++
+		if filter != nil && !filter.MatchString(line) {
+			continue
+		}
+		matched++
+		ts, rest := logTimestamp(line)
+		if !ts.IsZero() {
+			if first.IsZero() || ts.Before(first) {
+				first = ts
+			}
+			if ts.After(last) {
+				last = ts
+			}
+		}
+		level := "info"
+		if m := logLevel.FindStringSubmatch(rest[:min(len(rest), 80)]); m != nil {
+			level = normalizeLevel(m[1])
+		}
+		levels[level]++
+		if levelRank(level) < minRank {
+			continue
+		}
+
+		template := logVariable.ReplaceAllString(strings.TrimSpace(rest), "<*>")
+		cluster, ok := clusters[template]
+		if !ok {
+			if len(clusters) >= maxLogClusters {
+				dropped++
+				continue
+			}
+			cluster = &logCluster{template: template, level: level, example: line}
+			clusters[template] = cluster
+		}
+		cluster.count++
+		if !ts.IsZero() {
+			if cluster.first.IsZero() {
+				cluster.first = ts
+			}
+			cluster.last = ts
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read log file '%s': %w", logInput.Path, err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d lines", logInput.Path, total)
+	if filter != nil {
+		fmt.Fprintf(&b, ", %d matching the filter", matched)
+	}
+	if !first.IsZero() {
+		fmt.Fprintf(&b, ", %s to %s (%s)", first.Format(time.RFC3339), last.Format(time.RFC3339), last.Sub(first).Round(time.Second))
+	}
+	b.WriteString("\nBy level:")
+	for _, level := range []string{"fatal", "error", "warn", "info", "debug"} {
+		if levels[level] > 0 {
+			fmt.Fprintf(&b, " %s=%d", level, levels[level])
+		}
+	}
+	b.WriteString("\n")
+
+	sorted := make([]*logCluster, 0, len(clusters))
+	for _, c := range clusters {
+		sorted = append(sorted, c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if levelRank(sorted[i].level) != levelRank(sorted[j].level) {
+			return levelRank(sorted[i].level) > levelRank(sorted[j].level)
+		}
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].template < sorted[j].template
+	})
+	if len(sorted) == 0 {
+		b.WriteString("No lines at or above the requested level.\n")
+		return b.String(), nil
+	}
+	fmt.Fprintf(&b, "\n%d distinct messages", len(sorted))
+	if len(sorted) > logInput.Top {
+		fmt.Fprintf(&b, ", the top %d shown", logInput.Top)
+	}
+	b.WriteString(" (variable parts shown as <*>):\n")
+	for _, c := range sorted[:min(len(sorted), logInput.Top)] {
+		fmt.Fprintf(&b, "\n[%s] x%d", c.level, c.count)
+		if !c.first.IsZero() {
+			fmt.Fprintf(&b, " %s .. %s", c.first.Format(time.RFC3339), c.last.Format(time.RFC3339))
+		}
+		fmt.Fprintf(&b, "\n  %s\n  e.g. %s\n", truncateLine(c.template, 300), truncateLine(c.example, 300))
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&b, "\n%d lines were not clustered because there were more than %d distinct messages; use filter to narrow the analysis.\n", dropped, maxLogClusters)
+	}
+	return b.String(), nil
+}
+
+// logTimestamp parses a timestamp near the start of line, returning it and the rest of the line
+func logTimestamp(line string) (time.Time, string) {
+	head := line[:min(len(line), 40)]
+	for _, ts := range logTimestamps {
+		loc := ts.pattern.FindStringIndex(head)
+		if loc == nil || loc[0] > 5 {
+			continue
+		}
+		text := head[loc[0]:loc[1]]
+		var t time.Time
+		var err error
+		if ts.layout == "" {
+			normalized := strings.Replace(text, " ", "T", 1)
+			for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700", "2006-01-02T15:04:05.999999999"} {
+				if t, err = time.Parse(layout, normalized); err == nil {
+					break
+				}
+			}
+		} else {
+			t, err = time.Parse(ts.layout, text)
+		}
+		if err == nil {
+			if t.Year() == 0 {
+				// Syslog timestamps have no year
+				t = t.AddDate(time.Now().Year(), 0, 0)
+			}
+			return t, line[loc[1]:]
+		}
+	}
+	return time.Time{}, line
+}
+
+func normalizeLevel(level string) string {
+	switch strings.ToLower(level) {
+	case "fatal", "panic", "critical", "crit":
+		return "fatal"
+	case "error", "err":
+		return "error"
+	case "warning", "warn":
+		return "warn"
+	case "debug", "trace":
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+func levelRank(level string) int {
+	switch level {
+	case "fatal":
+		return 4
+	case "error":
+		return 3
+	case "warn":
+		return 2
+	case "info":
+		return 1
+	default:
+		return 0
+	}
+}
+
+func truncateLine(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+var AnalyzeLogDefinition = New("analyze_log",
+	"Summarise a log file of any size without reading it into context: line counts by level, the time range covered, and the most frequent error and warning messages clustered by template with first and last occurrence. Use this before reading specific parts of a large log.",
+	AnalyzeLog)
@@ -0,0 +1,228 @@
+package tools
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	maskMu       sync.Mutex
+	maskedPaths  []string         // slash-separated glob patterns relative to the working directory
+	maskPatterns []*regexp.Regexp // extra patterns masked in those files
+	// pseudonyms maps each masked value to its stand-in, so the same person gets the
+	// same one in every read and search of the session
+	pseudonyms map[string]string
+	counts     map[string]int
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{2,4}\)[ .-]?|\b\d{2,4}[ .-])\d{3,4}[ .-]?\d{3,4}\b`)
+	// namedPattern matches a capitalised value given for a name field, as in
+	// "first_name": "Ada" or customer: Ada Lovelace
+	namedPattern = regexp.MustCompile(`(?i:(["']?\b(?:first|last|full|given|family|middle|sur|display|customer|contact|user)?[_ -]?name["']?\s*[:=]\s*["']?))` +
+		`(\p{Lu}[\p{L}'.-]*(?:[ \t]+\p{Lu}[\p{L}'.-]*){0,3})`)
+)
+
+// SetMaskedFiles marks the files matching paths, glob patterns in which ** stands for
+// any number of directories, as holding personal data. What any tool returns from them
+// has emails, phone numbers, names and the matches of patterns replaced by consistent
+// stand-ins.
+func SetMaskedFiles(paths, patterns []string) error {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid masking pattern '%s': %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	var cleaned []string
+	for _, p := range paths {
+		if _, err := path.Match(strings.ReplaceAll(p, "**", "*"), ""); err != nil {
+			return fmt.Errorf("invalid masked path '%s': %w", p, err)
+		}
+		cleaned = append(cleaned, scopeName(p))
+	}
+	maskMu.Lock()
+	defer maskMu.Unlock()
+	maskedPaths, maskPatterns = cleaned, compiled
+	pseudonyms, counts = map[string]string{}, map[string]int{}
+	return nil
+}
+
+// isMasked reports whether the file at name is marked as holding personal data
+func isMasked(name string) bool {
+	maskMu.Lock()
+	patterns := maskedPaths
+	maskMu.Unlock()
+	if len(patterns) == 0 {
+		return false
+	}
+	if filepath.IsAbs(name) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, name); err == nil {
+				name = rel
+			}
+		}
+	}
+	name = scopeName(name)
+	for _, pattern := range patterns {
+		if globMatch(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches path segments against pattern segments, where a ** segment
+// matches any number of them
+func globMatch(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if globMatch(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// maskFile masks the personal data in the text of the file at name. In CSV and TSV
+// files every value of a column whose header mentions a name is masked as well.
+func maskFile(name, text string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		text = maskColumns(text, ',')
+	case ".tsv":
+		text = maskColumns(text, '\t')
+	}
+	return maskText(text)
+}
+
+// maskText masks the emails, phone numbers, name fields and extra patterns in text
+func maskText(text string) string {
+	maskMu.Lock()
+	defer maskMu.Unlock()
+	for _, re := range maskPatterns {
+		text = re.ReplaceAllStringFunc(text, func(m string) string { return pseudonym("value", m) })
+	}
+	text = emailPattern.ReplaceAllStringFunc(text, func(m string) string { return pseudonym("email", m) })
+	text = phonePattern.ReplaceAllStringFunc(text, func(m string) string { return pseudonym("phone", m) })
+	return namedPattern.ReplaceAllStringFunc(text, func(m string) string {
+		groups := namedPattern.FindStringSubmatch(m)
+		return groups[1] + pseudonym("name", groups[2])
+	})
+}
+
+// maskColumns masks the name columns of delimited text, leaving it unchanged if it
+// does not parse
+func maskColumns(text string, comma rune) string {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma, reader.FieldsPerRecord, reader.LazyQuotes = comma, -1, true
+	records, err := reader.ReadAll()
+	if err != nil || len(records) < 2 {
+		return text
+	}
+	var columns []int
+	for i, header := range records[0] {
+		if strings.Contains(strings.ToLower(header), "name") {
+			columns = append(columns, i)
+		}
+	}
+	if len(columns) == 0 {
+		return text
+	}
+	maskMu.Lock()
+	for _, record := range records[1:] {
+		for _, i := range columns {
+			if i < len(record) && record[i] != "" {
+				record[i] = pseudonym("name", record[i])
+			}
+		}
+	}
+	maskMu.Unlock()
+	var b strings.Builder
+	writer := csv.NewWriter(&b)
+	writer.Comma = comma
+	writer.WriteAll(records)
+	return b.String()
+}
+
+// pseudonym returns the stand-in for a value of kind, shaped like the original so
+// fixtures still read naturally. maskMu must be held.
+func pseudonym(kind, value string) string {
+	key := kind + "\x00" + value
+	if stand, ok := pseudonyms[key]; ok {
+		return stand
+	}
+	counts[kind]++
+	n := counts[kind]
+	var stand string
+	switch kind {
+	case "email":
+		stand = fmt.Sprintf("person%d@example.com", n)
+	case "phone":
+		stand = fmt.Sprintf("555-%04d", 100+n)
+	case "name":
+		stand = fmt.Sprintf("Person %d", n)
+	default:
+		stand = fmt.Sprintf("[masked-%d]", n)
+	}
+	pseudonyms[key] = stand
+	return stand
+}
+
+// maskOutput masks what a call returned from masked files. A call naming one in its
+// path or file field is masked whole, as is every call of an Opaque tool. Otherwise
+// the lines that start with the path:line of a masked file, as search and index
+// results do, are masked.
+func maskOutput(tool ToolDefinition, input json.RawMessage, output string) string {
+	maskMu.Lock()
+	masking := len(maskedPaths) > 0
+	maskMu.Unlock()
+	if !masking {
+		return output
+	}
+	if tool.Opaque {
+		return maskText(output)
+	}
+	var fields map[string]any
+	json.Unmarshal(input, &fields)
+	for _, field := range []string{"path", "file"} {
+		if name, ok := fields[field].(string); ok && name != "" && isMasked(name) {
+			return maskFile(name, output)
+		}
+	}
+	return maskMatches(output)
+}
+
+// maskMatches masks the lines of out found in masked files
+func maskMatches(out string) string {
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		m := locationPattern.FindStringSubmatchIndex(line)
+		if m == nil || !isMasked(line[m[2]:m[3]]) {
+			continue
+		}
+		lines[i] = line[:m[6]] + maskText(line[m[6]:])
+	}
+	return strings.Join(lines, "\n")
+}
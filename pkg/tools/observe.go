@@ -0,0 +1,28 @@
+package tools
+
+import "sync"
+
+// FileObserver is told about each version of a file the file tools see: the text
+// read_file returned to the model, or the text edit_file saved
+type FileObserver func(path, content string, wrote bool)
+
+var (
+	observerMu   sync.Mutex
+	fileObserver FileObserver
+)
+
+// SetFileObserver installs the observer of file versions, or removes it when nil
+func SetFileObserver(fn FileObserver) {
+	observerMu.Lock()
+	defer observerMu.Unlock()
+	fileObserver = fn
+}
+
+func observeFile(path, content string, wrote bool) {
+	observerMu.Lock()
+	fn := fileObserver
+	observerMu.Unlock()
+	if fn != nil {
+		fn(path, content, wrote)
+	}
+}
@@ -0,0 +1,394 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIMethods are the operation keys of an OpenAPI path item, in display order
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// maxRefDepth bounds $ref resolution so recursive schemas terminate
+const maxRefDepth = 4
+
+// skippedDirs are not searched for specs or route registrations
+var skippedDirs = map[string]bool{".git": true, "node_modules": true, "vendor": true, "dist": true, "build": true, ".agent": true}
+
+// openAPISpec is a parsed OpenAPI 3 or Swagger 2 document
+type openAPISpec struct {
+	path string
+	doc  map[string]any
+}
+
+// openAPIOperation is one method on one path
+type openAPIOperation struct {
+	Method, Path string
+	ID, Summary  string
+	op           map[string]any
+	pathItem     map[string]any
+}
+
+// loadOpenAPISpec parses the spec at path, or finds one in the working directory when path is empty
+func loadOpenAPISpec(path string) (*openAPISpec, error) {
+	if path == "" {
+		found, err := findOpenAPISpec(".")
+		if err != nil {
+			return nil, err
+		}
+		path = found
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI spec '%s': %w", path, err)
+	}
+	// JSON is valid YAML, so one decoder reads both
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec '%s': %w", path, err)
+	}
+	if doc["openapi"] == nil && doc["swagger"] == nil {
+		return nil, fmt.Errorf("'%s' is not an OpenAPI spec: it has no openapi or swagger version field", path)
+	}
+	return &openAPISpec{path: path, doc: doc}, nil
+}
+
+// findOpenAPISpec returns the shallowest file under root named openapi.* or swagger.*
+func findOpenAPISpec(root string) (string, error) {
+	var found []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := strings.ToLower(d.Name())
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		switch filepath.Ext(name) {
+		case ".yaml", ".yml", ".json":
+			if base == "openapi" || base == "swagger" {
+				found = append(found, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to search for an OpenAPI spec: %w", err)
+	}
+	if len(found) == 0 {
+		return "", fmt.Errorf("no openapi.yaml, openapi.json or swagger file found; pass the spec path")
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return strings.Count(found[i], string(filepath.Separator)) < strings.Count(found[j], string(filepath.Separator))
+	})
+	return found[0], nil
+}
+
+// operations lists the spec's operations sorted by path, then method
+func (s *openAPISpec) operations() []openAPIOperation {
+	paths, _ := s.doc["paths"].(map[string]any)
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ops []openAPIOperation
+	for _, name := range names {
+		item, _ := paths[name].(map[string]any)
+		for _, method := range openAPIMethods {
+			op, ok := item[method].(map[string]any)
+			if !ok {
+				continue
+			}
+			id, _ := op["operationId"].(string)
+			summary, _ := op["summary"].(string)
+			ops = append(ops, openAPIOperation{Method: strings.ToUpper(method), Path: name, ID: id, Summary: summary, op: op, pathItem: item})
+		}
+	}
+	return ops
+}
+
+// resolve replaces local $refs in v with the definitions they point to
+func (s *openAPISpec) resolve(v any, depth int) any {
+	switch v := v.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			if depth >= maxRefDepth {
+				return map[string]any{"$ref": ref, "note": "not expanded further"}
+			}
+			target, ok := s.lookup(ref)
+			if !ok {
+				return v
+			}
+			return s.resolve(target, depth+1)
+		}
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			out[key] = s.resolve(value, depth)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			out[i] = s.resolve(value, depth)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// lookup follows a local JSON pointer such as #/components/schemas/Pet
+func (s *openAPISpec) lookup(ref string) (any, bool) {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, false
+	}
+	var current any = s.doc
+	for _, part := range strings.Split(pointer, "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// OpenAPIListEndpoints tool
+type OpenAPIListEndpointsInput struct {
+	Spec string `json:"spec,omitempty" jsonschema_description:"Relative path of the OpenAPI or Swagger spec (YAML or JSON). Found automatically when omitted."`
+}
+
+var OpenAPIListEndpointsInputSchema = LazySchema[OpenAPIListEndpointsInput]()
+
+func OpenAPIListEndpoints(ctx context.Context, listInput OpenAPIListEndpointsInput) (string, error) {
+
+	spec, err := loadOpenAPISpec(listInput.Spec)
+	if err != nil {
+		return "", err
+	}
+	ops := spec.operations()
+	if len(ops) == 0 {
+		return fmt.Sprintf("%s defines no operations.", spec.path), nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d operations\n", spec.path, len(ops))
+	for _, op := range ops {
+		fmt.Fprintf(&b, "%-7s %s", op.Method, op.Path)
+		if op.ID != "" {
+			fmt.Fprintf(&b, "  %s", op.ID)
+		}
+		if op.Summary != "" {
+			fmt.Fprintf(&b, "  %s", op.Summary)
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+var OpenAPIListEndpointsDefinition = New("openapi_list_endpoints",
+	"List the operations in the repository's OpenAPI or Swagger spec: method, path, operationId and summary.",
+	OpenAPIListEndpoints)
+
+// OpenAPIGetOperation tool
+type OpenAPIGetOperationInput struct {
+	Spec        string `json:"spec,omitempty" jsonschema_description:"Relative path of the OpenAPI or Swagger spec. Found automatically when omitted."`
+	OperationID string `json:"operation_id,omitempty" jsonschema_description:"The operationId to show. Alternatively give method and path."`
+	Method      string `json:"method,omitempty" jsonschema_description:"HTTP method of the operation, e.g. GET."`
+	Path        string `json:"path,omitempty" jsonschema_description:"Path of the operation exactly as in the spec, e.g. /pets/{petId}."`
+}
+
+var OpenAPIGetOperationInputSchema = LazySchema[OpenAPIGetOperationInput]()
+
+func OpenAPIGetOperation(ctx context.Context, opInput OpenAPIGetOperationInput) (string, error) {
+	if opInput.OperationID == "" && (opInput.Method == "" || opInput.Path == "") {
+		return "", fmt.Errorf("give operation_id, or both method and path")
+	}
+
+	spec, err := loadOpenAPISpec(opInput.Spec)
+	if err != nil {
+		return "", err
+	}
+	for _, op := range spec.operations() {
+		if opInput.OperationID != "" && op.ID != opInput.OperationID {
+			continue
+		}
+		if opInput.OperationID == "" && (!strings.EqualFold(op.Method, opInput.Method) || op.Path != opInput.Path) {
+			continue
+		}
+		resolved := spec.resolve(op.op, 0).(map[string]any)
+		// Parameters declared on the path apply to every operation under it
+		if shared, ok := op.pathItem["parameters"].([]any); ok {
+			own, _ := resolved["parameters"].([]any)
+			resolved["parameters"] = append(spec.resolve(shared, 0).([]any), own...)
+		}
+		out, err := json.MarshalIndent(map[string]any{"method": op.Method, "path": op.Path, "operation": resolved}, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal operation: %w", err)
+		}
+		return string(out), nil
+	}
+	if opInput.OperationID != "" {
+		return "", fmt.Errorf("no operation with operationId '%s' in %s", opInput.OperationID, spec.path)
+	}
+	return "", fmt.Errorf("no %s %s operation in %s", strings.ToUpper(opInput.Method), opInput.Path, spec.path)
+}
+
+var OpenAPIGetOperationDefinition = New("openapi_get_operation",
+	"Show one operation from the OpenAPI spec, with its parameters, request body and responses and every $ref to a schema expanded inline.",
+	OpenAPIGetOperation)
+
+// OpenAPICheckRoutes tool
+type OpenAPICheckRoutesInput struct {
+	Spec string `json:"spec,omitempty" jsonschema_description:"Relative path of the OpenAPI or Swagger spec. Found automatically when omitted."`
+	Path string `json:"path,omitempty" jsonschema_description:"Directory of handler or client code to check. Defaults to the current directory."`
+}
+
+var OpenAPICheckRoutesInputSchema = LazySchema[OpenAPICheckRoutesInput]()
+
+var (
+	// routeLine matches lines that register or call a route in common frameworks and clients
+	routeLine = regexp.MustCompile(`(?i)(handle|route|mapping|fetch\(|axios|\.(get|post|put|patch|delete|head|options|any|group|request)\s*\()`)
+	// routeLiteral captures quoted paths, optionally prefixed by a method as in Go 1.22 patterns
+	routeLiteral = regexp.MustCompile("[\"'`](?:(?:GET|POST|PUT|PATCH|DELETE|HEAD|OPTIONS) )?(/[A-Za-z0-9_\\-./{}:<>*]*)[\"'`]")
+	// pathParam matches {id}, :id, <id> and <int:id> segments
+	pathParam = regexp.MustCompile(`\{[^/}]+\}|:[A-Za-z_][A-Za-z0-9_]*|<[^/>]+>`)
+	// routeSources are the file types scanned for routes
+	routeSources = map[string]bool{".go": true, ".ts": true, ".tsx": true, ".js": true, ".jsx": true, ".py": true, ".java": true, ".kt": true, ".rb": true, ".php": true, ".cs": true, ".rs": true}
+)
+
+// normalizeRoute makes OpenAPI and framework path templates comparable
+func normalizeRoute(path string) string {
+	path = pathParam.ReplaceAllString(path, "{}")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+func OpenAPICheckRoutes(ctx context.Context, checkInput OpenAPICheckRoutesInput) (string, error) {
+	dir := "."
+	if checkInput.Path != "" {
+		dir = checkInput.Path
+	}
+
+	spec, err := loadOpenAPISpec(checkInput.Spec)
+	if err != nil {
+		return "", err
+	}
+
+	found := map[string][]string{} // normalized route -> locations
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !routeSources[filepath.Ext(path)] {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			if !routeLine.MatchString(line) {
+				continue
+			}
+			for _, m := range routeLiteral.FindAllStringSubmatch(line, -1) {
+				route := normalizeRoute(m[1])
+				found[route] = append(found[route], fmt.Sprintf("%s:%d", path, i+1))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to scan '%s' for routes: %w", dir, err)
+	}
+
+	documented := map[string]bool{}
+	var missing []string
+	for _, op := range spec.operations() {
+		route := normalizeRoute(op.Path)
+		if documented[route] {
+			continue
+		}
+		documented[route] = true
+		if !routeImplemented(route, found) {
+			missing = append(missing, op.Path)
+		}
+	}
+	var undocumented []string
+	for route, locations := range found {
+		if !routeDocumented(route, documented) {
+			undocumented = append(undocumented, fmt.Sprintf("%s (%s)", route, strings.Join(locations, ", ")))
+		}
+	}
+	sort.Strings(undocumented)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Checked %d documented paths in %s against %d route literals found in %s\n"+
+		"(matching is by path template only, so routes built at runtime are missed)\n", len(documented), spec.path, len(found), dir)
+	if len(missing) == 0 && len(undocumented) == 0 {
+		b.WriteString("Every documented path appears in the code, and every route found is documented.\n")
+		return b.String(), nil
+	}
+	if len(missing) > 0 {
+		b.WriteString("\nDocumented but not found in the code:\n")
+		for _, path := range missing {
+			fmt.Fprintf(&b, "  %s\n", path)
+		}
+	}
+	if len(undocumented) > 0 {
+		b.WriteString("\nIn the code but not in the spec:\n")
+		for _, route := range undocumented {
+			fmt.Fprintf(&b, "  %s\n", route)
+		}
+	}
+	return b.String(), nil
+}
+
+// routeImplemented reports whether a documented route appears in the code, either in
+// full or, for routers mounted under a prefix, as its trailing segments
+func routeImplemented(route string, found map[string][]string) bool {
+	for candidate := range found {
+		if candidate == route || (candidate != "/" && strings.HasSuffix(route, candidate)) || strings.HasSuffix(candidate, route) {
+			return true
+		}
+	}
+	return false
+}
+
+func routeDocumented(route string, documented map[string]bool) bool {
+	for doc := range documented {
+		if doc == route || (route != "/" && strings.HasSuffix(doc, route)) || strings.HasSuffix(route, doc) {
+			return true
+		}
+	}
+	return false
+}
+
+var OpenAPICheckRoutesDefinition = New("openapi_check_routes",
+	"Compare the paths in the OpenAPI spec with the route paths registered or called in handler and client code, reporting documented paths missing from the code and routes missing from the spec.",
+	OpenAPICheckRoutes)
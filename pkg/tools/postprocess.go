@@ -0,0 +1,240 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Edit is a replacement edit_file is about to write: NewStr replaces OldStr at Offset
+// in Content. Post-processors rewrite only NewStr, so the lines the agent did not
+// touch keep whatever whitespace they had and the diff shows just the change.
+type Edit struct {
+	Path    string
+	Content string // the file before the edit
+	Offset  int
+	OldStr  string
+	NewStr  string
+	Config  EditorConfig // the file's .editorconfig properties
+}
+
+// before returns the file's content ahead of the replacement
+func (e *Edit) before() string {
+	return e.Content[:e.Offset]
+}
+
+// after returns the file's content following the replacement
+func (e *Edit) after() string {
+	return e.Content[e.Offset+len(e.OldStr):]
+}
+
+// PostProcessor tidies the text an edit writes
+type PostProcessor func(e *Edit)
+
+// PostProcessors are the processors that can be enabled, by name
+var PostProcessors = map[string]PostProcessor{
+	"indentation":              NormalizeIndentation,
+	"trim_trailing_whitespace": TrimTrailingWhitespace,
+	"insert_final_newline":     InsertFinalNewline,
+}
+
+// DefaultPostProcessors are applied until SetPostProcessors is called, in this order.
+// indentation is left out: it cannot tell code from the contents of a raw string, such
+// as embedded YAML, which must keep its spaces.
+var DefaultPostProcessors = []string{"trim_trailing_whitespace", "insert_final_newline"}
+
+var (
+	postProcessMu sync.Mutex
+	postProcess   = DefaultPostProcessors
+)
+
+// SetPostProcessors chooses the processors applied to edits, run in the order given.
+// An empty list writes edits exactly as the model gave them.
+func SetPostProcessors(names []string) error {
+	for _, name := range names {
+		if _, ok := PostProcessors[name]; !ok {
+			return fmt.Errorf("unknown post-processor '%s'; use indentation, trim_trailing_whitespace or insert_final_newline", name)
+		}
+	}
+	postProcessMu.Lock()
+	defer postProcessMu.Unlock()
+	postProcess = names
+	return nil
+}
+
+// processEdit runs the enabled post-processors and returns the text to write
+func processEdit(e Edit) string {
+	postProcessMu.Lock()
+	names := postProcess
+	postProcessMu.Unlock()
+	for _, name := range names {
+		PostProcessors[name](&e)
+	}
+	return e.NewStr
+}
+
+// TrimTrailingWhitespace removes spaces and tabs from the ends of the lines the edit
+// writes. The last line is only trimmed if it ends the line in the file, not when the
+// file's text continues after it. Nothing is trimmed where .editorconfig sets
+// trim_trailing_whitespace = false.
+func TrimTrailingWhitespace(e *Edit) {
+	if off := e.Config.TrimTrailingWhitespace; off != nil && !*off {
+		return
+	}
+	lines := strings.Split(e.NewStr, "\n")
+	after := e.after()
+	for i, line := range lines {
+		last := i == len(lines)-1
+		if last && after != "" && !strings.HasPrefix(after, "\n") && !strings.HasPrefix(after, "\r\n") {
+			continue
+		}
+		carriage := strings.HasSuffix(line, "\r")
+		line = strings.TrimRight(strings.TrimSuffix(line, "\r"), " \t")
+		if carriage {
+			line += "\r"
+		}
+		lines[i] = line
+	}
+	e.NewStr = strings.Join(lines, "\n")
+}
+
+// InsertFinalNewline ends the file with a newline when the edit writes its end, unless
+// .editorconfig sets insert_final_newline = false
+func InsertFinalNewline(e *Edit) {
+	if off := e.Config.InsertFinalNewline; off != nil && !*off {
+		return
+	}
+	if e.after() != "" || e.NewStr == "" || strings.HasSuffix(e.NewStr, "\n") {
+		return
+	}
+	if strings.Contains(e.Content, "\r\n") {
+		e.NewStr += "\r\n"
+	} else {
+		e.NewStr += "\n"
+	}
+}
+
+// NormalizeIndentation re-indents the lines the edit writes to the style the rest of
+// the file uses, tabs or a number of spaces, so a model that mixes them up does not
+// leave a file indented two ways. An indent_style in .editorconfig takes precedence
+// over the style detected; files with neither are left alone.
+func NormalizeIndentation(e *Edit) {
+	if style := e.Config.IndentStyle; style != "" {
+		size := e.Config.IndentSize
+		if size == 0 {
+			_, size, _ = detectIndentation(e.Content)
+		}
+		if size == 0 {
+			size = 4
+		}
+		reindent(e, style == "tab", size)
+		return
+	}
+	tabs, size, ok := detectIndentation(e.Content)
+	if !ok {
+		return
+	}
+	reindent(e, tabs, size)
+}
+
+// reindent rewrites the leading whitespace of each line the edit starts, measured with
+// tabs as size columns, as tabs or as spaces. Edits among lines already indented the
+// other way, such as YAML or SQL in a string literal, are left alone.
+func reindent(e *Edit, tabs bool, size int) {
+	if surroundingIndent(e, !tabs) {
+		return
+	}
+	lines := strings.Split(e.NewStr, "\n")
+	before := e.before()
+	for i, line := range lines {
+		if i == 0 && before != "" && !strings.HasSuffix(before, "\n") {
+			// The first line continues one already in the file
+			continue
+		}
+		body := strings.TrimLeft(line, " \t")
+		width := 0
+		for _, r := range line[:len(line)-len(body)] {
+			if r == '\t' {
+				width += size - width%size
+			} else {
+				width++
+			}
+		}
+		if body == "" || width == 0 {
+			continue
+		}
+		if tabs {
+			lines[i] = strings.Repeat("\t", width/size) + strings.Repeat(" ", width%size) + body
+		} else {
+			lines[i] = strings.Repeat(" ", width) + body
+		}
+	}
+	e.NewStr = strings.Join(lines, "\n")
+}
+
+// surroundingIndent reports whether the lines the edit replaces, or the nearest
+// indented lines before and after it, are indented with tabs, or with spaces when
+// tabs is false
+func surroundingIndent(e *Edit, tabs bool) bool {
+	uses := func(line string) bool {
+		if tabs {
+			return strings.HasPrefix(line, "\t")
+		}
+		return strings.HasPrefix(line, " ") && strings.TrimSpace(line) != ""
+	}
+	indented := func(line string) bool {
+		return strings.TrimSpace(line) != "" && (line[0] == ' ' || line[0] == '\t')
+	}
+	for _, line := range strings.Split(e.OldStr, "\n") {
+		if uses(line) {
+			return true
+		}
+	}
+	before := strings.Split(e.before(), "\n")
+	// The last element is the start of the edit's first line, not a line before it
+	for i := len(before) - 2; i >= 0; i-- {
+		if indented(before[i]) {
+			if uses(before[i]) {
+				return true
+			}
+			break
+		}
+	}
+	after := strings.Split(e.after(), "\n")
+	for _, line := range after[1:] {
+		if indented(line) {
+			return uses(line)
+		}
+	}
+	return false
+}
+
+// detectIndentation finds whether content is indented with tabs, or with spaces and
+// how many per level, when at least three quarters of its indented lines agree
+func detectIndentation(content string) (tabs bool, size int, ok bool) {
+	tabbed, spaced := 0, 0
+	size = 8
+	for _, line := range strings.Split(content, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			tabbed++
+		case strings.HasPrefix(line, "  "):
+			// Lines that only continue a comment block, such as " * text", are not indentation
+			n := len(line) - len(strings.TrimLeft(line, " "))
+			if n < len(line) && line[n] != '*' {
+				spaced++
+				size = min(size, n)
+			}
+		}
+	}
+	total := tabbed + spaced
+	switch {
+	case total < 3:
+		return false, 0, false
+	case tabbed*4 >= total*3:
+		return true, 4, true
+	case spaced*4 >= total*3:
+		return false, size, true
+	}
+	return false, 0, false
+}
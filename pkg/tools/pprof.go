@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// maxPprofOutput caps a pprof report so a broad symbol regex cannot flood the context
+const maxPprofOutput = 20_000
+
+// PprofProfile names the profile every pprof tool reads
+type PprofProfile struct {
+	Profile     string `json:"profile" jsonschema_description:"Path of the profile file, e.g. cpu.out or heap.pb.gz."`
+	Binary      string `json:"binary,omitempty" jsonschema_description:"Optional path of the binary that produced the profile, for symbols a profile without them lacks."`
+	SampleIndex string `json:"sample_index,omitempty" jsonschema_description:"Sample type to report, e.g. alloc_space or inuse_objects for heap profiles. Defaults to the profile's default."`
+}
+
+// PprofTop tool
+type PprofTopInput struct {
+	PprofProfile
+	NodeCount  int  `json:"node_count,omitempty" jsonschema_description:"How many functions to show. Defaults to 25."`
+	Cumulative bool `json:"cumulative,omitempty" jsonschema_description:"Sort by cumulative rather than flat cost, to find expensive call paths rather than hot leaf functions."`
+}
+
+// PprofList tool
+type PprofListInput struct {
+	PprofProfile
+	Symbol string `json:"symbol" jsonschema_description:"Regex matching the functions to annotate, e.g. 'main\\.parse$'."`
+}
+
+// PprofPeek tool
+type PprofPeekInput struct {
+	PprofProfile
+	Symbol string `json:"symbol" jsonschema_description:"Regex matching the functions whose callers and callees to show."`
+}
+
+var (
+	PprofTopInputSchema  = LazySchema[PprofTopInput]()
+	PprofListInputSchema = LazySchema[PprofListInput]()
+	PprofPeekInputSchema = LazySchema[PprofPeekInput]()
+)
+
+func PprofTop(ctx context.Context, topInput PprofTopInput) (string, error) {
+	if topInput.NodeCount <= 0 {
+		topInput.NodeCount = 25
+	}
+	args := []string{"-top", "-nodecount=" + strconv.Itoa(topInput.NodeCount)}
+	if topInput.Cumulative {
+		args = append(args, "-cum")
+	}
+	return runPprof(topInput.PprofProfile, args...)
+}
+
+func PprofList(ctx context.Context, listInput PprofListInput) (string, error) {
+	if listInput.Symbol == "" {
+		return "", fmt.Errorf("symbol is required")
+	}
+	return runPprof(listInput.PprofProfile, "-list="+listInput.Symbol)
+}
+
+func PprofPeek(ctx context.Context, peekInput PprofPeekInput) (string, error) {
+	if peekInput.Symbol == "" {
+		return "", fmt.Errorf("symbol is required")
+	}
+	return runPprof(peekInput.PprofProfile, "-peek="+peekInput.Symbol)
+}
+
+// runPprof runs go tool pprof with the report args over the profile and returns its text
+func runPprof(profile PprofProfile, args ...string) (string, error) {
+	if profile.Profile == "" {
+		return "", fmt.Errorf("profile is required")
+	}
+	if _, err := os.Stat(profile.Profile); err != nil {
+		return "", fmt.Errorf("failed to read profile '%s': %w", profile.Profile, err)
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		return "", fmt.Errorf("go is not installed, so go tool pprof is unavailable")
+	}
+
+	cmdArgs := append([]string{"tool", "pprof"}, args...)
+	if profile.SampleIndex != "" {
+		cmdArgs = append(cmdArgs, "-sample_index="+profile.SampleIndex)
+	}
+	if profile.Binary != "" {
+		cmdArgs = append(cmdArgs, profile.Binary)
+	}
+	cmdArgs = append(cmdArgs, profile.Profile)
+
+	out, err := exec.Command("go", cmdArgs...).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		if output == "" {
+			output = err.Error()
+		}
+		return "", fmt.Errorf("go tool pprof failed for '%s': %s", profile.Profile, output)
+	}
+	if output == "" {
+		return "No samples matched.", nil
+	}
+	if len(output) > maxPprofOutput {
+		output = output[:maxPprofOutput] + "\n... (output truncated; use a narrower symbol regex)"
+	}
+	return output, nil
+}
+
+var PprofTopDefinition = New("pprof_top",
+	"Show the most expensive functions in a Go CPU, heap, allocation, block or mutex profile with go tool pprof -top. Start here when interpreting a profile.",
+	PprofTop)
+
+var PprofListDefinition = opaque(New("pprof_list",
+	"Annotate the source of the functions matching a regex with the flat and cumulative cost of each line, using go tool pprof -list. Use it to find the exact lines to optimise.",
+	PprofList))
+
+var PprofPeekDefinition = New("pprof_peek",
+	"Show the callers and callees of the functions matching a regex with their costs, using go tool pprof -peek, to see where an expensive function is called from.",
+	PprofPeek)
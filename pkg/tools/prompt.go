@@ -0,0 +1,33 @@
+package tools
+
+import "sync"
+
+// Prompter lets tools ask the person running the agent for a decision
+type Prompter interface {
+	Confirm(question string) bool
+}
+
+// declineAll is the default Prompter for unattended runs: nobody is there to approve
+type declineAll struct{}
+
+func (declineAll) Confirm(string) bool { return false }
+
+var (
+	prompterMu sync.Mutex
+	prompter   Prompter = declineAll{}
+)
+
+// SetPrompter installs the Prompter used by tools that need confirmation. Until it is
+// called every confirmation is declined, which suits non-interactive runs.
+func SetPrompter(p Prompter) {
+	prompterMu.Lock()
+	defer prompterMu.Unlock()
+	prompter = p
+}
+
+func confirm(question string) bool {
+	prompterMu.Lock()
+	p := prompter
+	prompterMu.Unlock()
+	return p.Confirm(question)
+}
@@ -0,0 +1,282 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	protoComments = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+	protoTokens   = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|[A-Za-z_][\w.]*|\S`)
+)
+
+// protoFile is the outline of one .proto file
+type protoFile struct {
+	path     string
+	pkg      string
+	services []protoService
+	messages []string // fully qualified within the file, e.g. Outer.Inner
+	enums    []string
+}
+
+type protoService struct {
+	name string
+	rpcs []string
+}
+
+// parseProto extracts the package, services, RPCs, messages and enums from source.
+// It reads only the declarations needed for an outline, not the full grammar.
+func parseProto(path, source string) protoFile {
+	file := protoFile{path: path}
+	tokens := protoTokens.FindAllString(protoComments.ReplaceAllString(source, " "), -1)
+	next := func(i int) string {
+		if i < len(tokens) {
+			return tokens[i]
+		}
+		return ""
+	}
+
+	// scopes holds the names of enclosing messages, or "" for other blocks
+	var scopes []string
+	var service *protoService
+	for i := 0; i < len(tokens); i++ {
+		switch tok := tokens[i]; {
+		case tok == "package" && len(scopes) == 0:
+			file.pkg = next(i + 1)
+		case (tok == "message" || tok == "enum" || tok == "service") && next(i+2) == "{":
+			name := next(i + 1)
+			var qualified []string
+			for _, scope := range scopes {
+				if scope != "" {
+					qualified = append(qualified, scope)
+				}
+			}
+			full := strings.Join(append(qualified, name), ".")
+			switch tok {
+			case "message":
+				file.messages = append(file.messages, full)
+				scopes = append(scopes, name)
+			case "enum":
+				file.enums = append(file.enums, full)
+				scopes = append(scopes, "")
+			case "service":
+				file.services = append(file.services, protoService{name: name})
+				service = &file.services[len(file.services)-1]
+				scopes = append(scopes, "")
+			}
+			i += 2
+		case tok == "rpc" && service != nil:
+			// rpc Name ( [stream] Request ) returns ( [stream] Response )
+			j := i + 1
+			name := next(j)
+			var parts []string
+			for j++; j < len(tokens) && tokens[j] != ";" && tokens[j] != "{"; j++ {
+				parts = append(parts, tokens[j])
+			}
+			signature := strings.Join(parts, " ")
+			signature = strings.NewReplacer("( ", "(", " )", ")").Replace(signature)
+			service.rpcs = append(service.rpcs, name+signature)
+			if next(j) == "{" {
+				scopes = append(scopes, "")
+			}
+			i = j
+		case tok == "{":
+			scopes = append(scopes, "")
+		case tok == "}":
+			if len(scopes) > 0 {
+				scopes = scopes[:len(scopes)-1]
+			}
+			if len(scopes) == 0 {
+				service = nil
+			}
+		}
+	}
+	return file
+}
+
+// protoFiles returns the .proto files at path, a file or a directory
+func protoFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && skippedDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && filepath.Ext(p) == ".proto" {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search '%s' for .proto files: %w", path, err)
+	}
+	return files, nil
+}
+
+// ProtoList tool
+type ProtoListInput struct {
+	Path string `json:"path,omitempty" jsonschema_description:"A .proto file or a directory to search. Defaults to the current directory."`
+}
+
+var ProtoListInputSchema = LazySchema[ProtoListInput]()
+
+func ProtoList(ctx context.Context, listInput ProtoListInput) (string, error) {
+	path := "."
+	if listInput.Path != "" {
+		path = listInput.Path
+	}
+
+	files, err := protoFiles(path)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "No .proto files found.", nil
+	}
+	var b strings.Builder
+	for _, name := range files {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file '%s': %w", name, err)
+		}
+		file := parseProto(name, string(content))
+		if file.pkg != "" {
+			fmt.Fprintf(&b, "%s (package %s)\n", file.path, file.pkg)
+		} else {
+			fmt.Fprintf(&b, "%s\n", file.path)
+		}
+		for _, service := range file.services {
+			fmt.Fprintf(&b, "  service %s\n", service.name)
+			for _, rpc := range service.rpcs {
+				fmt.Fprintf(&b, "    rpc %s\n", rpc)
+			}
+		}
+		for _, message := range file.messages {
+			fmt.Fprintf(&b, "  message %s\n", message)
+		}
+		for _, enum := range file.enums {
+			fmt.Fprintf(&b, "  enum %s\n", enum)
+		}
+	}
+	return b.String(), nil
+}
+
+var ProtoListDefinition = New("proto_list",
+	"Outline .proto files: package, gRPC services with their RPC signatures (including streaming), messages and enums.",
+	ProtoList)
+
+// ProtoLint tool
+type ProtoLintInput struct {
+	Path    string `json:"path,omitempty" jsonschema_description:"Directory or .proto file to check. Defaults to the current directory."`
+	Against string `json:"against,omitempty" jsonschema_description:"Git ref to compare with for breaking changes, e.g. main. Requires buf."`
+}
+
+var ProtoLintInputSchema = LazySchema[ProtoLintInput]()
+
+func ProtoLint(ctx context.Context, lintInput ProtoLintInput) (string, error) {
+	path := "."
+	if lintInput.Path != "" {
+		path = lintInput.Path
+	}
+
+	if _, err := exec.LookPath("buf"); err == nil {
+		var b strings.Builder
+		b.WriteString(runProtoCommand("buf lint", exec.Command("buf", "lint", path)))
+		if lintInput.Against != "" {
+			against := ".git#ref=" + lintInput.Against
+			b.WriteString(runProtoCommand("buf breaking against "+lintInput.Against, exec.Command("buf", "breaking", path, "--against", against)))
+		}
+		return b.String(), nil
+	}
+	if lintInput.Against != "" {
+		return "", fmt.Errorf("breaking change detection needs buf, which is not installed")
+	}
+	if _, err := exec.LookPath("protoc"); err != nil {
+		return "", fmt.Errorf("neither buf nor protoc is installed")
+	}
+
+	// Without buf, compiling the files with protoc still catches syntax and type errors
+	files, err := protoFiles(path)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "No .proto files found.", nil
+	}
+	root := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		root = filepath.Dir(path)
+	}
+	args := []string{"-I", root, "--descriptor_set_out", os.DevNull}
+	for _, file := range files {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			rel = file
+		}
+		args = append(args, rel)
+	}
+	return runProtoCommand("protoc (buf is not installed, so only compilation is checked)", exec.Command("protoc", args...)), nil
+}
+
+// runProtoCommand runs cmd and reports its output under title, so failures read as findings
+func runProtoCommand(title string, cmd *exec.Cmd) string {
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		if output == "" {
+			output = err.Error()
+		}
+		return fmt.Sprintf("%s: problems found\n%s\n", title, output)
+	}
+	if output == "" {
+		return fmt.Sprintf("%s: passed\n", title)
+	}
+	return fmt.Sprintf("%s: passed\n%s\n", title, output)
+}
+
+var ProtoLintDefinition = New("proto_lint",
+	"Check .proto files with buf lint, and with buf breaking against a git ref when given, falling back to a protoc compile when buf is not installed. Run it after every change to a gRPC API.",
+	ProtoLint)
+
+// ProtoGenerate tool
+type ProtoGenerateInput struct {
+	Path string `json:"path,omitempty" jsonschema_description:"Directory containing buf.gen.yaml. Defaults to the current directory."`
+}
+
+var ProtoGenerateInputSchema = LazySchema[ProtoGenerateInput]()
+
+func ProtoGenerate(ctx context.Context, genInput ProtoGenerateInput) (string, error) {
+	dir := "."
+	if genInput.Path != "" {
+		dir = genInput.Path
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "buf.gen.yaml")); err != nil {
+		return "", fmt.Errorf("no buf.gen.yaml in '%s'; generate code with the project's own command instead", dir)
+	}
+	if _, err := exec.LookPath("buf"); err != nil {
+		return "", fmt.Errorf("buf is not installed")
+	}
+	cmd := exec.Command("buf", "generate")
+	cmd.Dir = dir
+	return runProtoCommand("buf generate", cmd), nil
+}
+
+var ProtoGenerateDefinition = mutating(New("proto_generate",
+	"Regenerate code from .proto files with buf generate, using the project's buf.gen.yaml, and report any errors.",
+	ProtoGenerate))
@@ -1,12 +1,36 @@
 package tools
 
 import (
+	"reflect"
+	"sync"
+
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/invopop/jsonschema"
 )
 
-// GenerateSchema creates a JSON schema for the given type
+// schemaCache holds one generated schema per input type, so tools sharing an input
+// type, or built again at runtime, reuse the reflection done for the first one
+var schemaCache sync.Map // reflect.Type -> anthropic.ToolInputSchemaParam
+
+// GenerateSchema creates a JSON schema for the given type. The result is cached per type
+// and shared between callers, so it must not be modified
 func GenerateSchema[T any]() anthropic.ToolInputSchemaParam {
+	t := reflect.TypeFor[T]()
+	if cached, ok := schemaCache.Load(t); ok {
+		return cached.(anthropic.ToolInputSchemaParam)
+	}
+	schema, _ := schemaCache.LoadOrStore(t, reflectSchema[T]())
+	return schema.(anthropic.ToolInputSchemaParam)
+}
+
+// LazySchema returns a function that generates the schema for T on its first call, for
+// ToolDefinition.SchemaFunc. Reflection is skipped entirely for tools never sent to the model
+func LazySchema[T any]() func() anthropic.ToolInputSchemaParam {
+	return GenerateSchema[T]
+}
+
+// reflectSchema builds the schema for T without consulting the cache
+func reflectSchema[T any]() anthropic.ToolInputSchemaParam {
 	reflector := jsonschema.Reflector{
 		AllowAdditionalProperties: false,
 		DoNotReference:            true,
@@ -15,7 +39,12 @@ func GenerateSchema[T any]() anthropic.ToolInputSchemaParam {
 
 	schema := reflector.Reflect(v)
 
-	return anthropic.ToolInputSchemaParam{
+	param := anthropic.ToolInputSchemaParam{
 		Properties: schema.Properties,
 	}
-}
\ No newline at end of file
+	// Fields without omitempty are required, as New enforces
+	if len(schema.Required) > 0 {
+		param.WithExtraFields(map[string]any{"required": schema.Required})
+	}
+	return param
+}
@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	scopeMu sync.Mutex
+	scope   []string // slash-separated roots relative to the working directory; nil for the whole tree
+)
+
+// SetScope limits the listings, searches and indexes that default to the whole working
+// tree to roots, the sub-projects of a monorepo that matter, so they stay fast on
+// trees with millions of files. An explicit path still reaches anywhere. nil lifts the
+// limit.
+func SetScope(roots []string) {
+	var cleaned []string
+	for _, root := range roots {
+		cleaned = append(cleaned, scopeName(root))
+	}
+	scopeMu.Lock()
+	defer scopeMu.Unlock()
+	scope = cleaned
+}
+
+// ExpandScope adds the directory root to the scope, and "." lifts the limit. Without a
+// scope the whole tree is already covered, so it does nothing.
+func ExpandScope(root string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("failed to add '%s' to the scope: %w", root, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("failed to add '%s' to the scope: not a directory", root)
+	}
+	root = scopeName(root)
+	scopeMu.Lock()
+	defer scopeMu.Unlock()
+	if root == "." {
+		scope = nil
+	}
+	if scope != nil && !slices.Contains(scope, root) {
+		scope = append(scope, root)
+	}
+	return nil
+}
+
+// Scope returns the roots default walks and searches are limited to, or nil when they
+// cover the whole working tree
+func Scope() []string {
+	scopeMu.Lock()
+	defer scopeMu.Unlock()
+	return slices.Clone(scope)
+}
+
+// scopeName cleans a root into the slash-separated form walks report paths in
+func scopeName(root string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(root)), "./")
+}
+
+// inScope reports whether a walk of the working tree from "." should visit path: a
+// directory on the way to a root, or anything within one
+func inScope(roots []string, path string, dir bool) bool {
+	path = scopeName(path)
+	if roots == nil || path == "." {
+		return true
+	}
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, root+"/") {
+			return true
+		}
+		if dir && strings.HasPrefix(root, path+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// maxSearchHits bounds the merged matches one search returns
+const maxSearchHits = 100
+
+var (
+	// identifierPattern matches queries that could name a symbol, which the symbol
+	// indexes are asked about as well
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// locationPattern matches the path:line a match line starts with
+	locationPattern = regexp.MustCompile(`^([^\s:]+):(\d+)(?::|\s|$)\s*(.*)$`)
+)
+
+// SearchSource is a tool search can fan a query out to
+type SearchSource struct {
+	// Tool is the tool's name; sources whose tool is not available are skipped
+	Tool string
+	// Field is the input field the query goes in, query by default
+	Field string
+	// Regex marks tools that take a regular expression, which plain queries are
+	// quoted for
+	Regex bool
+	// Symbols marks tools that look up exact symbol names, which only identifiers
+	// are sent to
+	Symbols bool
+}
+
+// LocalSearchSources are the search tools that come with the agent
+var LocalSearchSources = []SearchSource{
+	{Tool: "ripgrep_search", Regex: true},
+	{Tool: "find_definition", Field: "symbol", Symbols: true},
+	{Tool: "find_references", Field: "symbol", Symbols: true},
+}
+
+// SearchInput is the input of the search tool
+type SearchInput struct {
+	Query string `json:"query" jsonschema_description:"The text or symbol name to search for."`
+	Regex bool   `json:"regex,omitempty" jsonschema_description:"Treat the query as a regular expression. Only sources that take one are searched."`
+}
+
+var SearchInputSchema = LazySchema[SearchInput]()
+
+// searchHit is one location the sources found, with the sources that found it
+type searchHit struct {
+	location, text string
+	sources        []string
+}
+
+// SearchTool returns a search tool over the sources available in defs, when there
+// are at least two of them, so the model asks once instead of picking one. Queries
+// are routed by shape: identifiers go to every source, other text and regular
+// expressions only to the text searches. The sources run in parallel and their
+// matches are merged by path and line, each labelled with the sources that found it;
+// matches more sources agree on come first.
+func SearchTool(defs []ToolDefinition, sources []SearchSource) (ToolDefinition, bool) {
+	available := map[string]ToolDefinition{}
+	var usable []SearchSource
+	for _, source := range sources {
+		i := slices.IndexFunc(defs, func(def ToolDefinition) bool { return def.Name == source.Tool })
+		if i < 0 || available[source.Tool].Function != nil {
+			continue
+		}
+		available[source.Tool] = defs[i]
+		usable = append(usable, source)
+	}
+	if len(usable) < 2 {
+		return ToolDefinition{}, false
+	}
+	names := make([]string, len(usable))
+	for i, source := range usable {
+		names[i] = source.Tool
+	}
+	description := "Search the project with every search tool available at once (" + strings.Join(names, ", ") +
+		") and get their matches merged, each labelled with the tools that found it. Prefer it to calling " +
+		"those tools one by one when you do not know which will find what you are looking for."
+	return New("search", description, func(ctx context.Context, in SearchInput) (string, error) {
+		return federate(ctx, in, usable, available), nil
+	}), true
+}
+
+// Validate trims the query and requires one
+func (in *SearchInput) Validate() error {
+	if in.Query = strings.TrimSpace(in.Query); in.Query == "" {
+		return fmt.Errorf("query must not be empty")
+	}
+	return nil
+}
+
+// federate sends the query to the sources it suits and merges what they return
+func federate(ctx context.Context, in SearchInput, sources []SearchSource, defs map[string]ToolDefinition) string {
+	var routed []SearchSource
+	for _, source := range sources {
+		switch {
+		case in.Regex && !source.Regex:
+		case source.Symbols && !identifierPattern.MatchString(in.Query):
+		default:
+			routed = append(routed, source)
+		}
+	}
+	if len(routed) == 0 {
+		return "No search tool takes this query; try it without regex."
+	}
+
+	outputs := make([]string, len(routed))
+	errs := make([]error, len(routed))
+	var wg sync.WaitGroup
+	for i, source := range routed {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query := in.Query
+			if source.Regex && !in.Regex {
+				query = regexp.QuoteMeta(query)
+			}
+			field := source.Field
+			if field == "" {
+				field = "query"
+			}
+			input, _ := json.Marshal(map[string]string{field: query})
+			def := defs[source.Tool]
+			if errs[i] = Authorize(def, input); errs[i] == nil {
+				// The merged output is masked once, by search's own Call
+				outputs[i], errs[i] = def.call(ctx, input)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var hits []*searchHit
+	byLocation := map[string]*searchHit{}
+	var notes []string
+	for i, source := range routed {
+		if errs[i] != nil {
+			notes = append(notes, fmt.Sprintf("%s failed: %s", source.Tool, errs[i].Error()))
+			continue
+		}
+		for _, line := range strings.Split(outputs[i], "\n") {
+			m := locationPattern.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			location := scopeName(m[1]) + ":" + m[2]
+			hit := byLocation[location]
+			if hit == nil {
+				hit = &searchHit{location: location}
+				byLocation[location] = hit
+				hits = append(hits, hit)
+			}
+			if !slices.Contains(hit.sources, source.Tool) {
+				hit.sources = append(hit.sources, source.Tool)
+			}
+			// Prefer the matched line's text to an index's (kind)
+			if text := strings.TrimSpace(m[3]); len(text) > len(hit.text) {
+				hit.text = text
+			}
+		}
+	}
+	slices.SortStableFunc(hits, func(a, b *searchHit) int { return len(b.sources) - len(a.sources) })
+
+	var b strings.Builder
+	for i, hit := range hits {
+		if i == maxSearchHits {
+			fmt.Fprintf(&b, "... %d more matches; narrow the query\n", len(hits)-maxSearchHits)
+			break
+		}
+		fmt.Fprintf(&b, "%s [%s] %s\n", hit.location, strings.Join(hit.sources, ", "), hit.text)
+	}
+	if len(hits) == 0 {
+		b.WriteString("No matches found.\n")
+	}
+	searched := make([]string, len(routed))
+	for i, source := range routed {
+		searched[i] = source.Tool
+	}
+	fmt.Fprintf(&b, "Searched %s.", strings.Join(searched, ", "))
+	for _, note := range notes {
+		b.WriteString("\n" + note)
+	}
+	return b.String()
+}
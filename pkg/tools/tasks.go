@@ -0,0 +1,281 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// makeTarget matches a rule line, "build test: deps ## description"
+	makeTarget = regexp.MustCompile(`^([A-Za-z0-9_][\w./%-]*(?:\s+[A-Za-z0-9_][\w./%-]*)*)\s*::?([^=].*)?$`)
+	// justRecipe matches a recipe line, "@build target='x': deps"
+	justRecipe = regexp.MustCompile(`^@?([A-Za-z_][\w-]*)(\s[^:]*)?:([^=].*)?$`)
+)
+
+// projectTask is one runnable target of a task runner
+type projectTask struct {
+	name, description string
+}
+
+// taskFile is the tasks one file defines and how to run them
+type taskFile struct {
+	path, run string
+	tasks     []projectTask
+}
+
+// task runner files, in the order they are reported
+var (
+	makefileNames = []string{"GNUmakefile", "makefile", "Makefile"}
+	taskfileNames = []string{"Taskfile.yml", "Taskfile.yaml", "taskfile.yml", "taskfile.yaml"}
+	justfileNames = []string{"justfile", "Justfile", ".justfile"}
+)
+
+// ListTasks tool
+type ListTasksInput struct {
+	Path string `json:"path,omitempty" jsonschema_description:"Directory to look in. Defaults to the current directory."`
+}
+
+var ListTasksInputSchema = LazySchema[ListTasksInput]()
+
+func ListTasks(ctx context.Context, listInput ListTasksInput) (string, error) {
+	dir := "."
+	if listInput.Path != "" {
+		dir = listInput.Path
+	}
+
+	var files []taskFile
+	if path, ok := firstFile(dir, makefileNames); ok {
+		file, err := parseMakefile(path)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, file)
+	}
+	if path, ok := firstFile(dir, taskfileNames); ok {
+		file, err := parseTaskfile(path)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, file)
+	}
+	if path, ok := firstFile(dir, []string{"package.json"}); ok {
+		file, err := parsePackageScripts(path)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, file)
+	}
+	if path, ok := firstFile(dir, justfileNames); ok {
+		file, err := parseJustfile(path)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, file)
+	}
+
+	var b strings.Builder
+	for _, file := range files {
+		if len(file.tasks) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s (run with: %s)\n", file.path, file.run)
+		for _, task := range file.tasks {
+			if task.description != "" {
+				fmt.Fprintf(&b, "  %s: %s\n", task.name, task.description)
+			} else {
+				fmt.Fprintf(&b, "  %s\n", task.name)
+			}
+		}
+	}
+	if b.Len() == 0 {
+		return "No Makefile, Taskfile, package.json scripts or justfile found.", nil
+	}
+	return b.String(), nil
+}
+
+// firstFile returns the first of names that exists in dir
+func firstFile(dir string, names []string) (string, bool) {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// parseMakefile lists a Makefile's explicit targets. Descriptions come from a trailing
+// "## text" on the rule line, the self-documenting help convention, or from the
+// comment on the line before.
+func parseMakefile(path string) (taskFile, error) {
+	file := taskFile{path: path, run: "make <target>"}
+	f, err := os.Open(path)
+	if err != nil {
+		return file, fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	seen := map[string]bool{}
+	comment := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			comment = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			continue
+		}
+		m := makeTarget.FindStringSubmatch(line)
+		if m == nil {
+			comment = ""
+			continue
+		}
+		description := comment
+		if _, doc, ok := strings.Cut(m[2], "##"); ok {
+			description = strings.TrimSpace(doc)
+		}
+		comment = ""
+		for _, name := range strings.Fields(m[1]) {
+			// Special targets, pattern rules and file targets are not tasks
+			if strings.HasPrefix(name, ".") || strings.Contains(name, "%") || strings.Contains(name, "/") || seen[name] {
+				continue
+			}
+			seen[name] = true
+			file.tasks = append(file.tasks, projectTask{name: name, description: description})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return file, fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	return file, nil
+}
+
+// parseTaskfile lists the tasks of a go-task Taskfile in file order, with their desc
+func parseTaskfile(path string) (taskFile, error) {
+	file := taskFile{path: path, run: "task <name>"}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	// Decoding into nodes keeps the tasks in the order they are written
+	var doc struct {
+		Tasks yaml.Node `yaml:"tasks"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return file, fmt.Errorf("failed to parse Taskfile '%s': %w", path, err)
+	}
+	for i := 0; i+1 < len(doc.Tasks.Content); i += 2 {
+		name, body := doc.Tasks.Content[i].Value, doc.Tasks.Content[i+1]
+		var task struct {
+			Desc     string `yaml:"desc"`
+			Summary  string `yaml:"summary"`
+			Internal bool   `yaml:"internal"`
+		}
+		if body.Kind == yaml.MappingNode {
+			body.Decode(&task)
+		}
+		if task.Internal {
+			continue
+		}
+		description := task.Desc
+		if description == "" {
+			description, _, _ = strings.Cut(strings.TrimSpace(task.Summary), "\n")
+		}
+		file.tasks = append(file.tasks, projectTask{name: name, description: description})
+	}
+	return file, nil
+}
+
+// parsePackageScripts lists the scripts of a package.json with the command each runs
+func parsePackageScripts(path string) (taskFile, error) {
+	file := taskFile{path: path, run: packageManager(filepath.Dir(path)) + " run <script>"}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return file, fmt.Errorf("failed to parse '%s': %w", path, err)
+	}
+	names := make([]string, 0, len(pkg.Scripts))
+	for name := range pkg.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file.tasks = append(file.tasks, projectTask{name: name, description: pkg.Scripts[name]})
+	}
+	return file, nil
+}
+
+// packageManager picks the package manager whose lockfile is in dir
+func packageManager(dir string) string {
+	for _, lock := range []struct{ file, manager string }{
+		{"pnpm-lock.yaml", "pnpm"},
+		{"yarn.lock", "yarn"},
+		{"bun.lockb", "bun"},
+	} {
+		if _, err := os.Stat(filepath.Join(dir, lock.file)); err == nil {
+			return lock.manager
+		}
+	}
+	return "npm"
+}
+
+// parseJustfile lists a justfile's public recipes with their doc comments
+func parseJustfile(path string) (taskFile, error) {
+	file := taskFile{path: path, run: "just <recipe>"}
+	f, err := os.Open(path)
+	if err != nil {
+		return file, fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	comment, private := "", false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#"):
+			comment = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			continue
+		case strings.HasPrefix(line, "["):
+			// Attributes such as [private] or [group('ci')] sit between a comment and its recipe
+			private = private || strings.Contains(line, "private")
+			continue
+		}
+		m := justRecipe.FindStringSubmatch(line)
+		// Recipes starting with _ or marked [private] are hidden from just --list too
+		if m != nil && !isJustKeyword(m[1]) && !private && !strings.HasPrefix(m[1], "_") {
+			file.tasks = append(file.tasks, projectTask{name: m[1], description: comment})
+		}
+		comment, private = "", false
+	}
+	if err := scanner.Err(); err != nil {
+		return file, fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	return file, nil
+}
+
+// isJustKeyword reports whether a line starting with word is a justfile directive, not a recipe
+func isJustKeyword(word string) bool {
+	switch word {
+	case "set", "alias", "export", "import", "mod":
+		return true
+	}
+	return false
+}
+
+var ListTasksDefinition = New("list_tasks",
+	"List the project's task runner targets with their descriptions: Makefile targets, Taskfile tasks, package.json scripts and justfile recipes, with the command that runs them. Check this before building, testing or linting, and run the project's own targets instead of inventing commands.",
+	ListTasks)
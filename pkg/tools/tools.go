@@ -1,9 +1,11 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -17,6 +19,50 @@ type ToolDefinition struct {
 	Description string                         `json:"description"`
 	InputSchema anthropic.ToolInputSchemaParam `json:"input_schema"`
 	Function    func(input json.RawMessage) (string, error)
+	// SchemaFunc generates the input schema on first use and takes precedence over InputSchema
+	SchemaFunc func() anthropic.ToolInputSchemaParam `json:"-"`
+	// Mutating marks tools that change the working tree, which read-only modes leave out
+	Mutating bool `json:"mutating,omitempty"`
+	// Preview describes the change a call would make without making it, for review
+	Preview func(input json.RawMessage) (Change, error) `json:"-"`
+	// Run is Function given the context of the turn, which Call prefers when set
+	Run func(ctx context.Context, input json.RawMessage) (string, error) `json:"-"`
+	// Opaque marks tools whose output can quote any file, such as commands, which
+	// masking covers whole
+	Opaque bool `json:"-"`
+}
+
+// Call runs the tool with input, passing ctx to Run if the tool has one, and masks
+// what it returns from files holding personal data
+func (t ToolDefinition) Call(ctx context.Context, input json.RawMessage) (string, error) {
+	output, err := t.call(ctx, input)
+	if err != nil {
+		// Failing commands report their output in the error
+		if masked := maskOutput(t, input, err.Error()); masked != err.Error() {
+			return "", errors.New(masked)
+		}
+		return "", err
+	}
+	return maskOutput(t, input, output), nil
+}
+
+// call runs the tool without masking its output
+func (t ToolDefinition) call(ctx context.Context, input json.RawMessage) (string, error) {
+	if t.Run == nil {
+		return t.Function(input)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return t.Run(ctx, input)
+}
+
+// Schema returns the tool's input schema, generating it if it is lazy
+func (t ToolDefinition) Schema() anthropic.ToolInputSchemaParam {
+	if t.SchemaFunc != nil {
+		return t.SchemaFunc()
+	}
+	return t.InputSchema
 }
 
 // ReadFile tool
@@ -24,27 +70,26 @@ type ReadFileInput struct {
 	Path string `json:"path" jsonschema_description:"The relative path of a file in the working directory."`
 }
 
-var ReadFileInputSchema = GenerateSchema[ReadFileInput]()
-
-func ReadFile(input json.RawMessage) (string, error) {
-	readFileInput := ReadFileInput{}
-	err := json.Unmarshal(input, &readFileInput)
-	if err != nil {
-		return "", fmt.Errorf("invalid input format for read_file: %w", err)
-	}
+var ReadFileInputSchema = LazySchema[ReadFileInput]()
 
-	content, err := os.ReadFile(readFileInput.Path)
+func readFile(fsys FS, readFileInput ReadFileInput) (string, error) {
+	content, err := fsys.ReadFile(readFileInput.Path)
 	if err != nil {
 		return "", fmt.Errorf("failed to read file '%s': %w", readFileInput.Path, err)
 	}
-	return string(content), nil
+	text := LoadEditorConfig(fsys, readFileInput.Path).decode(content)
+	if _, ok := fsys.(UncommittedChecker); ok {
+		observeFile(readFileInput.Path, text, false)
+	}
+	return text, nil
 }
 
-var ReadFileDefinition = ToolDefinition{
-	Name:        "read_file",
-	Description: "Read the contents of a given relative file path. Use this when you want to see what's inside a file. Do not use this with directory names.",
-	InputSchema: ReadFileInputSchema,
-	Function:    ReadFile,
+var ReadFileDefinition = readFileTool(OSFS{})
+
+func readFileTool(fsys FS) ToolDefinition {
+	return New("read_file",
+		"Read the contents of a given relative file path. Use this when you want to see what's inside a file. Do not use this with directory names.",
+		func(ctx context.Context, in ReadFileInput) (string, error) { return readFile(fsys, in) })
 }
 
 // ListFiles tool
@@ -52,25 +97,28 @@ type ListFilesInput struct {
 	Path string `json:"path,omitempty" jsonschema_description:"Optional relative path to list files from. Defaults to current directory if not provided."`
 }
 
-var ListFilesInputSchema = GenerateSchema[ListFilesInput]()
-
-func ListFiles(input json.RawMessage) (string, error) {
-	listFilesInput := ListFilesInput{}
-	err := json.Unmarshal(input, &listFilesInput)
-	if err != nil {
-		return "", fmt.Errorf("invalid input format for list_files: %w", err)
-	}
+var ListFilesInputSchema = LazySchema[ListFilesInput]()
 
+func listFiles(fsys FS, listFilesInput ListFilesInput) (string, error) {
 	dir := "."
+	var roots []string
 	if listFilesInput.Path != "" {
 		dir = listFilesInput.Path
+	} else {
+		roots = Scope()
 	}
 
 	var files []string
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(fsys, dir, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if !inScope(roots, path, entry.IsDir()) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
 
 		relPath, err := filepath.Rel(dir, path)
 		if err != nil {
@@ -78,7 +126,7 @@ func ListFiles(input json.RawMessage) (string, error) {
 		}
 
 		if relPath != "." {
-			if info.IsDir() {
+			if entry.IsDir() {
 				files = append(files, relPath+"/")
 			} else {
 				files = append(files, relPath)
@@ -99,11 +147,12 @@ func ListFiles(input json.RawMessage) (string, error) {
 	return string(result), nil
 }
 
-var ListFilesDefinition = ToolDefinition{
-	Name:        "list_files",
-	Description: "List files and directories at a given path. If no path is provided, lists files in the current directory.",
-	InputSchema: ListFilesInputSchema,
-	Function:    ListFiles,
+var ListFilesDefinition = listFilesTool(OSFS{})
+
+func listFilesTool(fsys FS) ToolDefinition {
+	return New("list_files",
+		"List files and directories at a given path. If no path is provided, lists files in the current directory.",
+		func(ctx context.Context, in ListFilesInput) (string, error) { return listFiles(fsys, in) })
 }
 
 // EditFile tool
@@ -113,39 +162,53 @@ type EditFileInput struct {
 	NewStr string `json:"new_str" jsonschema_description:"Text to replace old_str with"`
 }
 
-var EditFileInputSchema = GenerateSchema[EditFileInput]()
+var EditFileInputSchema = LazySchema[EditFileInput]()
 
-func EditFile(input json.RawMessage) (string, error) {
-	editFileInput := EditFileInput{}
-	err := json.Unmarshal(input, &editFileInput)
-	if err != nil {
-		return "", fmt.Errorf("invalid input format for edit_file: %w", err)
-	}
-
-	content, err := os.ReadFile(editFileInput.Path)
+func editFile(fsys FS, editFileInput EditFileInput) (string, error) {
+	content, err := fsys.ReadFile(editFileInput.Path)
 	if err != nil {
 		return "", fmt.Errorf("failed to read file '%s' for editing: %w", editFileInput.Path, err)
 	}
 
-	contentStr := string(content)
-	newContentStr := strings.Replace(contentStr, editFileInput.OldStr, editFileInput.NewStr, 1)
+	editorConfig := LoadEditorConfig(fsys, editFileInput.Path)
+	contentStr := editorConfig.decode(content)
+	newContentStr := contentStr
+	if index := strings.Index(contentStr, editFileInput.OldStr); index >= 0 {
+		newStr := processEdit(Edit{Path: editFileInput.Path, Content: contentStr, Offset: index, OldStr: editFileInput.OldStr, NewStr: editFileInput.NewStr, Config: editorConfig})
+		newContentStr = contentStr[:index] + newStr + contentStr[index+len(editFileInput.OldStr):]
+	}
 	if newContentStr == contentStr {
 		return "", fmt.Errorf("string '%s' not found in file '%s'", editFileInput.OldStr, editFileInput.Path)
 	}
 
-	err = os.WriteFile(editFileInput.Path, []byte(newContentStr), 0644)
+	if err := guardUncommitted(fsys, editFileInput.Path); err != nil {
+		return "", err
+	}
+
+	encoded, err := editorConfig.encode(newContentStr)
 	if err != nil {
+		return "", fmt.Errorf("failed to edit file '%s': %w", editFileInput.Path, err)
+	}
+	if err := fsys.WriteFile(editFileInput.Path, encoded, 0644); err != nil {
 		return "", fmt.Errorf("failed to write changes to file '%s': %w", editFileInput.Path, err)
 	}
+	// Only files in the user's checkout have a git state and a place in its history
+	if _, ok := fsys.(UncommittedChecker); ok {
+		markTouched(editFileInput.Path)
+		observeFile(editFileInput.Path, newContentStr, true)
+	}
 
 	return "File edited successfully", nil
 }
 
-var EditFileDefinition = ToolDefinition{
-	Name:        "edit_file",
-	Description: "Edit a file by replacing a specific string with another string. The old string must match exactly and must only have one match in the file.",
-	InputSchema: EditFileInputSchema,
-	Function:    EditFile,
+var EditFileDefinition = editFileTool(OSFS{})
+
+func editFileTool(fsys FS) ToolDefinition {
+	edit := mutating(New("edit_file",
+		"Edit a file by replacing a specific string with another string. The old string must match exactly and must only have one match in the file.",
+		func(ctx context.Context, in EditFileInput) (string, error) { return editFile(fsys, in) }))
+	edit.Preview = func(input json.RawMessage) (Change, error) { return editFilePreview(fsys, input) }
+	return edit
 }
 
 // RipGrepSearch tool
@@ -156,15 +219,9 @@ type RipGrepInput struct {
 	MaxCount   int    `json:"max_count,omitempty" jsonschema_description:"Limit the number of matches per file."`
 }
 
-var RipGrepInputSchema = GenerateSchema[RipGrepInput]()
-
-func RipGrepSearch(input json.RawMessage) (string, error) {
-	rgInput := RipGrepInput{}
-	err := json.Unmarshal(input, &rgInput)
-	if err != nil {
-		return "", fmt.Errorf("invalid input format for ripgrep_search: %w", err)
-	}
+var RipGrepInputSchema = LazySchema[RipGrepInput]()
 
+func RipGrepSearch(ctx context.Context, rgInput RipGrepInput) (string, error) {
 	args := []string{"--no-heading", "--with-filename", "--line-number"}
 	if rgInput.IgnoreCase {
 		args = append(args, "--ignore-case")
@@ -175,11 +232,13 @@ func RipGrepSearch(input json.RawMessage) (string, error) {
 	args = append(args, "--", rgInput.Query)
 	if rgInput.Path != "" {
 		args = append(args, rgInput.Path)
+	} else if roots := Scope(); roots != nil {
+		args = append(args, roots...)
 	} else {
 		args = append(args, ".")
 	}
 
-	cmd := exec.Command("rg", args...)
+	cmd := exec.CommandContext(ctx, "rg", args...)
 	out, err := cmd.Output()
 
 	if err != nil {
@@ -206,11 +265,14 @@ func RipGrepSearch(input json.RawMessage) (string, error) {
 	return string(out), nil
 }
 
-var RipGrepToolDefinition = ToolDefinition{
-	Name:        "ripgrep_search",
-	Description: "Search for a regex pattern in files using ripgrep. Provides filename and line number for matches.",
-	InputSchema: RipGrepInputSchema,
-	Function:    RipGrepSearch,
+var RipGrepToolDefinition = New("ripgrep_search",
+	"Search for a regex pattern in files using ripgrep. Provides filename and line number for matches.",
+	RipGrepSearch)
+
+// FileTools returns read_file, list_files and edit_file working on fsys instead of the
+// working tree, e.g. a MemFS in tests or an overlay that keeps edits out of the checkout
+func FileTools(fsys FS) []ToolDefinition {
+	return []ToolDefinition{readFileTool(fsys), listFilesTool(fsys), editFileTool(fsys)}
 }
 
 // GetTools returns all available tools
@@ -220,6 +282,19 @@ func GetTools() []ToolDefinition {
 		ListFilesDefinition,
 		EditFileDefinition,
 		RipGrepToolDefinition,
+		GitBlameDefinition,
+		AskUserDefinition,
+		OpenAPIListEndpointsDefinition,
+		OpenAPIGetOperationDefinition,
+		OpenAPICheckRoutesDefinition,
+		ProtoListDefinition,
+		ProtoLintDefinition,
+		ProtoGenerateDefinition,
+		ListTasksDefinition,
+		AnalyzeLogDefinition,
+		PprofTopDefinition,
+		PprofListDefinition,
+		PprofPeekDefinition,
 	}
 }
 
@@ -231,5 +306,3 @@ type ToolError struct {
 func (e *ToolError) Error() string {
 	return fmt.Sprintf("tool %s: %v", e.ToolName, e.Err)
 }
-
-type MessageHandler func() (string, bool)
\ No newline at end of file
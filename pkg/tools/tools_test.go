@@ -0,0 +1,416 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// memTools returns the file tools working on a MemFS with files, by name
+func memTools(t *testing.T, files map[string]string) (*MemFS, map[string]ToolDefinition) {
+	t.Helper()
+	fsys := NewMemFS(files)
+	byName := map[string]ToolDefinition{}
+	for _, tool := range FileTools(fsys) {
+		byName[tool.Name] = tool
+	}
+	return fsys, byName
+}
+
+func call(t *testing.T, tool ToolDefinition, input any) (string, error) {
+	t.Helper()
+	raw, err := json.Marshal(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tool.Call(context.Background(), raw)
+}
+
+func TestReadFile(t *testing.T) {
+	_, tools := memTools(t, map[string]string{"pkg/a.go": "package pkg\n"})
+	got, err := call(t, tools["read_file"], ReadFileInput{Path: "./pkg/a.go"})
+	if err != nil || got != "package pkg\n" {
+		t.Errorf("read_file = %q, %v", got, err)
+	}
+	if _, err := call(t, tools["read_file"], ReadFileInput{Path: "missing.go"}); err == nil {
+		t.Error("read_file of a missing file succeeded")
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	_, tools := memTools(t, map[string]string{"go.mod": "", "pkg/a.go": "", "pkg/sub/b.go": ""})
+	got, err := call(t, tools["list_files"], ListFilesInput{})
+	if want := `["go.mod","pkg/","pkg/a.go","pkg/sub/","pkg/sub/b.go"]`; err != nil || got != want {
+		t.Errorf("list_files = %s, %v; want %s", got, err, want)
+	}
+	got, err = call(t, tools["list_files"], ListFilesInput{Path: "pkg"})
+	if want := `["a.go","sub/","sub/b.go"]`; err != nil || got != want {
+		t.Errorf("list_files pkg = %s, %v; want %s", got, err, want)
+	}
+}
+
+func TestListFilesScope(t *testing.T) {
+	SetScope([]string{"services/api", "./libs"})
+	defer SetScope(nil)
+	_, tools := memTools(t, map[string]string{"go.mod": "", "services/api/main.go": "", "services/web/app.js": "", "libs/x.go": ""})
+	got, err := call(t, tools["list_files"], ListFilesInput{})
+	if want := `["libs/","libs/x.go","services/","services/api/","services/api/main.go"]`; err != nil || got != want {
+		t.Errorf("list_files = %s, %v; want %s", got, err, want)
+	}
+	got, err = call(t, tools["list_files"], ListFilesInput{Path: "services/web"})
+	if want := `["app.js"]`; err != nil || got != want {
+		t.Errorf("list_files services/web = %s, %v; want %s", got, err, want)
+	}
+}
+
+func TestReadFileMasked(t *testing.T) {
+	if err := SetMaskedFiles([]string{"testdata/**/*.json", "dumps/*.csv"}, []string{`ACCT-\d+`}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetMaskedFiles(nil, nil)
+	_, tools := memTools(t, map[string]string{
+		"testdata/fixtures/users.json": `{"full_name": "Ada Lovelace", "email": "ada@acme.io", "phone": "+44 20 7946 0958", "account": "ACCT-1234"}` + "\n" +
+			`{"full_name": "Alan Turing", "email": "ada@acme.io", "status": "Active"}`,
+		"dumps/customers.csv": "id,first_name,contact\n1,Grace,grace@acme.io\n",
+		"main.go":             "// ada@acme.io\n",
+	})
+	tests := []struct{ path, want string }{
+		{"testdata/fixtures/users.json", `{"full_name": "Person 1", "email": "person1@example.com", "phone": "555-0101", "account": "[masked-1]"}` + "\n" +
+			`{"full_name": "Person 2", "email": "person1@example.com", "status": "Active"}`},
+		{"dumps/customers.csv", "id,first_name,contact\n1,Person 3,person2@example.com\n"},
+		{"main.go", "// ada@acme.io\n"},
+	}
+	for _, tt := range tests {
+		if got, err := call(t, tools["read_file"], ReadFileInput{Path: tt.path}); err != nil || got != tt.want {
+			t.Errorf("read_file %s = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestMaskedTools(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=Ada Lovelace", "-c", "user.email=ada@acme.io", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+	os.MkdirAll("dumps", 0755)
+	os.WriteFile("dumps/users.csv", []byte("id,email\n1,ada@acme.io\n"), 0644)
+	for _, args := range [][]string{
+		{"add", "."},
+		{"-c", "user.name=Ada Lovelace", "-c", "user.email=ada@acme.io", "commit", "-q", "-m", "Add the export ada@acme.io sent"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+	if err := SetMaskedFiles([]string{"dumps/*.csv"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer SetMaskedFiles(nil, nil)
+
+	fixed := func(name, output string, opaque bool) ToolDefinition {
+		return ToolDefinition{Name: name, Opaque: opaque, Function: func(json.RawMessage) (string, error) { return output, nil }}
+	}
+	tests := []struct {
+		name  string
+		tool  ToolDefinition
+		input any
+		want  string
+	}{
+		{"git_blame", GitBlameDefinition, GitBlameInput{Path: "dumps/users.csv"}, "person1@example.com sent"},
+		{"analyze_log", fixed("analyze_log", "1 error: ada@acme.io", false), map[string]string{"path": "dumps/users.csv"}, "1 error: person1@example.com"},
+		{"references", fixed("find_references", "dumps/users.csv:2 ada@acme.io\nmain.go:1: ada@acme.io", false), map[string]string{"symbol": "x"},
+			"dumps/users.csv:2 person1@example.com\nmain.go:1: ada@acme.io"},
+		{"run_action", fixed("run_action", "cat: ada@acme.io", true), map[string]string{"name": "test"}, "cat: person1@example.com"},
+		{"unmasked path", fixed("analyze_log", "ada@acme.io", false), map[string]string{"path": "app.log"}, "ada@acme.io"},
+	}
+	for _, tt := range tests {
+		got, err := call(t, tt.tool, tt.input)
+		if err != nil || !strings.Contains(got, tt.want) {
+			t.Errorf("%s = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestEditFile(t *testing.T) {
+	fsys, tools := memTools(t, map[string]string{"a.go": "x := 1\ny := 1\n"})
+	if _, err := call(t, tools["edit_file"], EditFileInput{Path: "a.go", OldStr: "y := 1", NewStr: "y := 2"}); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := fsys.ReadFile("a.go")
+	if got := string(content); got != "x := 1\ny := 2\n" {
+		t.Errorf("after edit_file, a.go = %q", got)
+	}
+	if _, err := call(t, tools["edit_file"], EditFileInput{Path: "a.go", OldStr: "z", NewStr: "w"}); err == nil {
+		t.Error("edit_file succeeded without a match")
+	}
+}
+
+func TestEditFileUncommitted(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("a.go", []byte("x := 1\n"), 0644)
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}, {"-c", "user.name=t", "-c", "user.email=t@t", "commit", "-q", "-m", "init"}} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+	// The user's own, uncommitted work
+	os.WriteFile("a.go", []byte("x := 2\n"), 0644)
+
+	edit := EditFileInput{Path: "a.go", OldStr: "x := 2", NewStr: "x := 3"}
+	_, tools := memTools(t, map[string]string{"a.go": "x := 2\n"})
+	if _, err := call(t, tools["edit_file"], edit); err != nil {
+		t.Errorf("edit_file on a MemFS = %v; want the checkout's git state ignored", err)
+	}
+	if _, err := call(t, EditFileDefinition, edit); err == nil || !strings.Contains(err.Error(), "uncommitted changes") {
+		t.Errorf("edit_file on the checkout = %v; want it refused", err)
+	}
+}
+
+func TestEditFilePreview(t *testing.T) {
+	fsys, tools := memTools(t, map[string]string{"a.go": "one\ntwo\n"})
+	raw, _ := json.Marshal(EditFileInput{Path: "a.go", OldStr: "two", NewStr: "2"})
+	change, err := tools["edit_file"].Preview(raw)
+	if want := "@@ -1,2 +1,2 @@\n one\n-two\n+2\n"; err != nil || change.Diff != want {
+		t.Errorf("preview = %q, %v; want %q", change.Diff, err, want)
+	}
+	if content, _ := fsys.ReadFile("a.go"); string(content) != "one\ntwo\n" {
+		t.Error("preview changed the file")
+	}
+}
+
+func TestEditFilePostProcessing(t *testing.T) {
+	// indentation is opt-in
+	if err := SetPostProcessors([]string{"indentation", "trim_trailing_whitespace", "insert_final_newline"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetPostProcessors(DefaultPostProcessors)
+	goFile := "func f() {\n\ta := 1\n\tb := 2\n\treturn\n}"
+	tests := []struct {
+		name, content, oldStr, newStr, want string
+	}{
+		{"trailing whitespace", "a\nb\nc\n", "b", "x  \ny\t", "a\nx\ny\nc\n"},
+		{"mid-line text kept", "a b c\n", "a ", "x ", "x b c\n"},
+		{"final newline", "a\nb", "b", "c", "a\nc\n"},
+		{"tabs from spaces", goFile, "\tb := 2", "    b := 3\n    if b > 2 {\n        b = 2\n    }", "func f() {\n\ta := 1\n\tb := 3\n\tif b > 2 {\n\t\tb = 2\n\t}\n\treturn\n}"},
+		{"spaces from tabs", "def f():\n    a = 1\n    b = 2\n    if a:\n        return\n", "    b = 2", "\tb = 3", "def f():\n    a = 1\n    b = 3\n    if a:\n        return\n"},
+		{"untouched lines kept", "a  \nb  \nc\n", "c", "d", "a  \nb  \nd\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys, tools := memTools(t, map[string]string{"f": tt.content})
+			if _, err := call(t, tools["edit_file"], EditFileInput{Path: "f", OldStr: tt.oldStr, NewStr: tt.newStr}); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := fsys.ReadFile("f"); string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditFileEditorConfig(t *testing.T) {
+	// indentation is opt-in
+	if err := SetPostProcessors([]string{"indentation", "trim_trailing_whitespace", "insert_final_newline"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetPostProcessors(DefaultPostProcessors)
+	editorConfig := "root = true\n\n[*]\ninsert_final_newline = false\n\n[*.py]\nindent_style = space\nindent_size = 2\n\n[legacy/**]\ncharset = latin1\n\n[*.{cs,vb}]\ncharset = utf-8-bom\ntrim_trailing_whitespace = false\n"
+	tests := []struct {
+		name, path, content, oldStr, newStr, want string
+	}{
+		{"indent style", "src/a.py", "x", "x", "def f():\n\treturn 1", "def f():\n  return 1"},
+		{"no final newline", "b.txt", "a\nb", "b", "c", "a\nc"},
+		{"latin1", "legacy/c.txt", "caf\xe9\n", "café", "crème", "cr\xe8me\n"},
+		{"bom", "d.cs", "class D {}", "D", "E  ", "\uFEFFclass E   {}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys, tools := memTools(t, map[string]string{".editorconfig": editorConfig, tt.path: tt.content})
+			if _, err := call(t, tools["edit_file"], EditFileInput{Path: tt.path, OldStr: tt.oldStr, NewStr: tt.newStr}); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := fsys.ReadFile(tt.path); string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	_, tools := memTools(t, map[string]string{".editorconfig": editorConfig, "legacy/e.txt": "a"})
+	if _, err := call(t, tools["edit_file"], EditFileInput{Path: "legacy/e.txt", OldStr: "a", NewStr: "日本"}); err == nil {
+		t.Error("writing characters latin1 lacks succeeded")
+	}
+}
+
+func TestCtagsDefinitions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tags := "!_TAG_FILE_FORMAT\t2\n!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted/\n"
+	tags += "main\tmain.go\t/^func main() {$/;\"\tkind:func\n"
+	for i := range 500 {
+		tags += fmt.Sprintf("sym%03d\tpkg/f%d.go\t%d;\"\tf\n", i, i, i+1)
+	}
+	path := filepath.Join(dir, "tags")
+	if err := os.WriteFile(path, []byte(tags), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"sym000": filepath.Join(dir, "pkg/f0.go") + ":1 (f)",
+		"sym250": filepath.Join(dir, "pkg/f250.go") + ":251 (f)",
+		"sym499": filepath.Join(dir, "pkg/f499.go") + ":500 (f)",
+		"main":   filepath.Join(dir, "main.go") + ":3 (func)",
+	}
+	for symbol, want := range tests {
+		if got, err := ctagsDefinitions(path, symbol); err != nil || got != want {
+			t.Errorf("ctagsDefinitions(%s) = %q, %v; want %q", symbol, got, err, want)
+		}
+	}
+	if got, _ := ctagsDefinitions(path, "sym25"); !strings.HasPrefix(got, "No definition") {
+		t.Errorf("ctagsDefinitions(sym25) = %q", got)
+	}
+}
+
+func TestSearchTool(t *testing.T) {
+	stub := func(name, out string) ToolDefinition {
+		return ToolDefinition{Name: name, Function: func(input json.RawMessage) (string, error) { return out, nil }}
+	}
+	defs := []ToolDefinition{
+		stub("ripgrep_search", "./main.go:3:func handle() {}\nmain.go:5:\thandle()"),
+		stub("find_definition", "main.go:3 (func)"),
+	}
+	if _, ok := SearchTool(defs[:1], LocalSearchSources); ok {
+		t.Error("search offered with a single source")
+	}
+	search, ok := SearchTool(defs, LocalSearchSources)
+	if !ok {
+		t.Fatal("search not offered with two sources")
+	}
+	want := "main.go:3 [ripgrep_search, find_definition] func handle() {}\nmain.go:5 [ripgrep_search] handle()\nSearched ripgrep_search, find_definition."
+	if got, err := call(t, search, SearchInput{Query: "handle"}); err != nil || got != want {
+		t.Errorf("search handle = %q, %v; want %q", got, err, want)
+	}
+	if got, _ := call(t, search, SearchInput{Query: "handle()"}); !strings.HasSuffix(got, "Searched ripgrep_search.") {
+		t.Errorf("search for text was sent to the symbol index: %q", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	type key struct{}
+	tool := New("find_definition", "", func(ctx context.Context, in SymbolQueryInput) (string, error) {
+		return fmt.Sprintf("%s %v", in.Symbol, ctx.Value(key{})), nil
+	})
+	ctx := context.WithValue(context.Background(), key{}, "turn")
+	tests := map[string]string{
+		`{"symbol": " main "}`: "main turn",
+		`{}`:                   "invalid input for find_definition: missing required field 'symbol'",
+		`{"symbol": " "}`:      "invalid input for find_definition: symbol must not be empty",
+		`{"symbol": 1}`:        "invalid input format for find_definition",
+	}
+	for input, want := range tests {
+		got, err := tool.Call(ctx, json.RawMessage(input))
+		if err != nil {
+			got = err.Error()
+		}
+		if !strings.HasPrefix(got, want) {
+			t.Errorf("Call(%s) = %q; want %q", input, got, want)
+		}
+	}
+	schema, err := json.Marshal(tool.Schema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(schema), `"required":["symbol"]`) {
+		t.Errorf("schema %s does not require symbol", schema)
+	}
+}
+
+func TestParseBlame(t *testing.T) {
+	for _, width := range []int{40, 64} {
+		first, second := strings.Repeat("a", width), strings.Repeat("b", width)
+		var porcelain strings.Builder
+		for line, commit := range []string{first, first, second} {
+			fmt.Fprintf(&porcelain, "%s %d %d 1\nauthor Ada\nauthor-time 1700000000\nsummary Change\nfilename main.go\n\tline\n",
+				commit, line+1, line+1)
+		}
+		ranges := parseBlame(porcelain.String())
+		if len(ranges) != 2 || ranges[0].commit != first || ranges[0].start != 1 || ranges[0].end != 2 ||
+			ranges[1].commit != second || ranges[1].start != 3 {
+			t.Errorf("parseBlame with %d-character IDs = %+v", width, ranges)
+		}
+	}
+	if ranges := parseBlame(strings.Repeat("g", 40) + " 1 1 1\n\tline\n"); len(ranges) != 1 || ranges[0].commit != "" {
+		t.Errorf("parseBlame took a non-hex header as a commit: %+v", ranges)
+	}
+}
+
+func TestDBQuerySingleStatement(t *testing.T) {
+	tests := map[string]string{
+		"SELECT 1":                                   "SELECT 1",
+		" SELECT 1;; \n":                             "SELECT 1",
+		"SELECT ';' AS a, \"x;y\" FROM t":            "SELECT ';' AS a, \"x;y\" FROM t",
+		"SELECT 'it''s; fine'":                       "SELECT 'it''s; fine'",
+		"SELECT 1 -- no; more\nFROM t":               "SELECT 1 -- no; more\nFROM t",
+		"SELECT /* a; b */ 1":                        "SELECT /* a; b */ 1",
+		"SELECT $$a;b$$, $tag$c;d$tag$":              "SELECT $$a;b$$, $tag$c;d$tag$",
+		"COMMIT; DROP TABLE users":                   "",
+		"SET TRANSACTION READ WRITE; DELETE FROM t":  "",
+		"SELECT 1; SELECT 2;":                        "",
+		"SELECT 'a'';'; DROP TABLE users":            "",
+		"SELECT $x$ ; $x$; UPDATE t SET a = 1":       "",
+		"SELECT /* ; */ 1; COMMIT; DROP TABLE users": "",
+	}
+	for query, want := range tests {
+		got, err := singleStatement(query)
+		if want == "" {
+			if err == nil {
+				t.Errorf("singleStatement(%q) = %q; want an error", query, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("singleStatement(%q) = %q, %v; want %q", query, got, err, want)
+		}
+	}
+
+	// The check runs before the database is contacted
+	query := DatabaseTools("postgres://127.0.0.1:1/none?connect_timeout=1")[1]
+	for _, payload := range []string{"COMMIT; DROP TABLE users", "SET TRANSACTION READ WRITE; DELETE FROM users"} {
+		if _, err := call(t, query, DBQueryInput{Query: payload}); err == nil || !strings.Contains(err.Error(), "one statement") {
+			t.Errorf("db_query(%q) = %v; want it refused", payload, err)
+		}
+	}
+}
+
+func TestNormalizeIndentation(t *testing.T) {
+	file := "package a\n\nfunc a() {\n\tx := 1\n\ty := 2\n\tz := 3\n\tif x > y {\n\t\treturn\n\t}\n\tprint(z)\n}\n\n" +
+		"var config = `\nserver:\n  port: 80\n  host: a\n`\n"
+	tests := []struct {
+		name, old, new, want string
+	}{
+		{"spaces among tabs", "\ty := 2\n", "    y := 2\n    w := 4\n", "\ty := 2\n\tw := 4\n"},
+		{"spaces among spaces", "  port: 80\n", "  port: 8080\n  tls: true\n", "  port: 8080\n  tls: true\n"},
+	}
+	for _, tt := range tests {
+		e := Edit{Content: file, Offset: strings.Index(file, tt.old), OldStr: tt.old, NewStr: tt.new}
+		NormalizeIndentation(&e)
+		if e.NewStr != tt.want {
+			t.Errorf("%s: NormalizeIndentation = %q; want %q", tt.name, e.NewStr, tt.want)
+		}
+	}
+	if slices.Contains(DefaultPostProcessors, "indentation") {
+		t.Error("indentation runs by default, rewriting string literals in tab-indented files")
+	}
+}
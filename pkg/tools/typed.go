@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Validator is implemented by tool inputs that check themselves after decoding. A
+// pointer receiver can also normalise fields, such as trimming spaces.
+type Validator interface {
+	Validate() error
+}
+
+// New returns a tool whose input is a T, a struct described by json and
+// jsonschema_description tags. The schema is generated lazily from T, and each call's
+// input is decoded into a T before fn runs: fields without omitempty must be present,
+// and a T implementing Validator is validated. fn gets the context of the turn the
+// agent runs the call in.
+func New[T any](name, description string, fn func(ctx context.Context, in T) (string, error)) ToolDefinition {
+	required := sync.OnceValue(requiredFields[T])
+	run := func(ctx context.Context, input json.RawMessage) (string, error) {
+		var in T
+		if err := json.Unmarshal(input, &in); err != nil {
+			return "", fmt.Errorf("invalid input format for %s: %w", name, err)
+		}
+		if fields := required(); len(fields) > 0 {
+			var present map[string]json.RawMessage
+			json.Unmarshal(input, &present)
+			for _, field := range fields {
+				if _, ok := present[field]; !ok {
+					return "", fmt.Errorf("invalid input for %s: missing required field '%s'", name, field)
+				}
+			}
+		}
+		if v, ok := any(&in).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return "", fmt.Errorf("invalid input for %s: %w", name, err)
+			}
+		}
+		return fn(ctx, in)
+	}
+	return ToolDefinition{
+		Name:        name,
+		Description: description,
+		SchemaFunc:  LazySchema[T](),
+		Function:    func(input json.RawMessage) (string, error) { return run(context.Background(), input) },
+		Run:         run,
+	}
+}
+
+// requiredFields lists the JSON names of T's fields that are not omitempty
+func requiredFields[T any]() []string {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []string
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// mutating marks a tool as changing the working tree
+func mutating(def ToolDefinition) ToolDefinition {
+	def.Mutating = true
+	return def
+}
+
+// opaque marks a tool whose output can quote any file
+func opaque(def ToolDefinition) ToolDefinition {
+	def.Opaque = true
+	return def
+}